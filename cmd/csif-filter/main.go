@@ -12,9 +12,14 @@ import (
 )
 
 var (
-	endpoint   = flag.String("endpoint", "", "endpoint")
-	tgtport    = flag.Uint("tgtport", 0, "tgtd iscsi port")
-	tgtcontrol = flag.Uint("tgtcontrol", 0, "tgtd control port")
+	endpoint       = flag.String("endpoint", "", "endpoint")
+	tgtport        = flag.Uint("tgtport", 0, "tgtd iscsi port")
+	tgtcontrol     = flag.Uint("tgtcontrol", 0, "tgtd control port")
+	portalIfaces   = flag.String("portal-interfaces", "", "comma-separated interfaces whose addresses are advertised as additional portals, enables multipath on nodes (network path redundancy, the device doesn't survive filter restart)")
+	metricsAddress = flag.String("metrics-address", "", "address to serve prometheus I/O metrics of targets on, empty disables")
+	probe          = flag.Bool("probe", false, "check health of filter server on --endpoint and exit")
+	tracingExp     = flag.String("tracing-exporter", "", "export spans of Filter RPCs: otlp or file, empty disables")
+	tracingEp      = flag.String("tracing-endpoint", "", "OTLP collector host:port or trace file path")
 )
 
 func init() {
@@ -32,14 +37,38 @@ func logDevDir() {
 func main() {
 	flag.Parse()
 
+	if *probe {
+		if err := csif.ProbeFilterHealth(*endpoint); err != nil {
+			fmt.Printf("Filter is not ready: %v", err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	shutdownTracing, err := csif.SetupTracing("csif-filter", *tracingExp, *tracingEp)
+	if err != nil {
+		fmt.Printf("Failed to setup tracing: %v", err)
+		os.Exit(1)
+	}
+	defer shutdownTracing()
+
 	portal, err := csif.GetPortal()
 	if err != nil {
 		fmt.Printf("Failed to obtain portal: %v", err)
 		os.Exit(1)
 	}
+	portals := []string{portal}
+	if *portalIfaces != "" {
+		extra, err := csif.GetInterfacePortals(strings.Split(*portalIfaces, ","))
+		if err != nil {
+			fmt.Printf("Failed to obtain portals: %v", err)
+			os.Exit(1)
+		}
+		portals = append(portals, extra...)
+	}
 
 	tgtd, err := csif.NewCsifTGTD(uint32(*tgtcontrol),
-		csif.CsifFilterIQNPrefix, portal, uint32(*tgtport))
+		csif.CsifFilterIQNPrefix, portals, uint32(*tgtport))
 	if err != nil {
 		fmt.Printf("Can't create new tgtd: %v", err.Error())
 		os.Exit(1)
@@ -47,7 +76,7 @@ func main() {
 
 	logDevDir()
 
-	filter, err := csif.NewCsifFilterServer(*endpoint, tgtd)
+	filter, err := csif.NewCsifFilterServer(*endpoint, *metricsAddress, tgtd)
 	if err != nil {
 		fmt.Printf("Can't create new filter: %v", err.Error())
 		os.Exit(1)
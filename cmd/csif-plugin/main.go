@@ -4,6 +4,7 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"strings"
 
 	"github.com/pooh64/csif-driver/pkg/csif"
 )
@@ -11,20 +12,61 @@ import (
 var (
 	version           = "0.0.1"
 	endpoint          = flag.String("endpoint", "unix://tmp/csi.sock", "endpoint")
-	nodeID            = flag.String("nodeid", "", "node id")
+	mode              = flag.String("mode", csif.DriverModeAll, "services to run: controller, node or all")
+	nodeID            = flag.String("nodeid", "", "node id, not required in controller mode")
 	driverName        = flag.String("drivername", "csif.csi.pooh64.io", "driver name")
 	maxVolumesPerNode = flag.Int64("maxvolumespernode", 0, "limit of volumes per node")
+	filterMode        = flag.String("filter-mode", csif.FilterModePod, "filter placement: pod (per volume, shared by slices of a pool) or daemon (per node, node-local source PVs only, set in controller too to reject others on CreateVolume)")
+	warmPoolSize      = flag.Int("warm-pool-size", 0, "ready filter pods kept on the node for node-local sources, 0 disables warm pool")
+	warmPoolDirs      = flag.String("warm-pool-local-dirs", "", "comma-separated host dirs of local and hostPath PVs, mounted to warm pods; other PVs get a dedicated filter pod")
+	metricsAddress    = flag.String("metrics-address", "", "address to serve prometheus metrics on (CSI RPCs, staging, warm pool, reconciler), e.g. :9833, empty disables")
+	podTemplateFile   = flag.String("filter-pod-template", "", "filter pod template file (YAML)")
+	podTemplateCM     = flag.String("filter-pod-configmap", "", "namespace/name of ConfigMap with filter pod template in template.yaml")
+	stateDir          = flag.String("state-dir", "", "dir to persist staged volumes in, empty disables")
+	reconcileInterval = flag.Duration("reconcile-interval", 0, "period of orphaned filter pods, sessions and targets cleanup, 0 disables, requires --state-dir")
+	leaderElection    = flag.Bool("leader-election", false, "elect a leader among controller replicas, requires --leader-election-address")
+	leaderNamespace   = flag.String("leader-election-namespace", "", "namespace of the leader Lease, filter pod template one if empty")
+	leaderAddress     = flag.String("leader-election-address", "", "host:port this replica serves calls forwarded by other replicas on, e.g. $(POD_IP):9834")
+	tracingExporter   = flag.String("tracing-exporter", "", "export spans of CSI RPCs: otlp or file, empty disables")
+	tracingEndpoint   = flag.String("tracing-endpoint", "", "OTLP collector host:port or trace file path")
 )
 
 func init() {
 	flag.Set("logtostderr", "true")
 }
 
+func warmPoolLocalDirs() []string {
+	if *warmPoolDirs == "" {
+		return nil
+	}
+	return strings.Split(*warmPoolDirs, ",")
+}
+
 func main() {
 	flag.Parse()
 
-	driver, err := csif.NewCsifDriver(*driverName, *nodeID, *endpoint, version,
-		*maxVolumesPerNode)
+	shutdownTracing, err := csif.SetupTracing("csif-plugin", *tracingExporter, *tracingEndpoint)
+	if err != nil {
+		fmt.Printf("Failed to setup tracing: %v", err)
+		os.Exit(1)
+	}
+	defer shutdownTracing()
+
+	driver, err := csif.NewCsifDriver(*driverName, *nodeID, *endpoint, version, csif.DriverOptions{
+		Mode:                    *mode,
+		MaxVolumesPerNode:       *maxVolumesPerNode,
+		FilterMode:              *filterMode,
+		WarmPoolSize:            *warmPoolSize,
+		WarmPoolLocalDirs:       warmPoolLocalDirs(),
+		MetricsAddress:          *metricsAddress,
+		PodTemplateFile:         *podTemplateFile,
+		PodTemplateConfigMap:    *podTemplateCM,
+		StateDir:                *stateDir,
+		ReconcileInterval:       *reconcileInterval,
+		LeaderElection:          *leaderElection,
+		LeaderElectionNamespace: *leaderNamespace,
+		LeaderAddress:           *leaderAddress,
+	})
 	if err != nil {
 		fmt.Printf("Can't create new driver: %s", err.Error())
 		os.Exit(1)
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/pooh64/csif-driver/pkg/csif"
+	"golang.org/x/net/context"
+)
+
+// Goes through the controller, reports Unimplemented if it has no snapshots
+func cmdSnapshot(ctx context.Context, args []string) error {
+	conn, err := csif.DialEndpoint(ctx, *csiEndpoint)
+	if err != nil {
+		return fmt.Errorf("failed to connect to %s: %v", *csiEndpoint, err)
+	}
+	defer conn.Close()
+
+	resp, err := csi.NewControllerClient(conn).CreateSnapshot(ctx, &csi.CreateSnapshotRequest{
+		SourceVolumeId: args[0],
+		Name:           args[1],
+	})
+	if err != nil {
+		return err
+	}
+	snap := resp.GetSnapshot()
+	return printOutput(snap, []string{"SNAPSHOT", "SOURCE", "SIZE", "READY"}, [][]string{{
+		snap.GetSnapshotId(), snap.GetSourceVolumeId(), fmt.Sprint(snap.GetSizeBytes()), fmt.Sprint(snap.GetReadyToUse()),
+	}})
+}
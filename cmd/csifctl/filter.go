@@ -0,0 +1,257 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pooh64/csif-driver/pkg/csif"
+	"github.com/pooh64/csif-driver/pkg/filter"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+func newClientset() (*kubernetes.Clientset, error) {
+	config, err := clientcmd.BuildConfigFromFlags("", *kubeconfig)
+	if err != nil {
+		return nil, fmt.Errorf("load k8s config: %v", err)
+	}
+	return kubernetes.NewForConfig(config)
+}
+
+// Filter pods of --node, pods without IP are skipped
+func listFilterPods(ctx context.Context) ([]core.Pod, error) {
+	clientset, err := newClientset()
+	if err != nil {
+		return nil, err
+	}
+	opts := metav1.ListOptions{LabelSelector: csif.FilterPodSelector()}
+	if *nodeName != "" {
+		opts.FieldSelector = fields.OneTermEqualSelector("spec.nodeName", *nodeName).String()
+	}
+	pods, err := clientset.CoreV1().Pods("").List(ctx, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list filter pods: %v", err)
+	}
+	var out []core.Pod
+	for _, pod := range pods.Items {
+		if pod.Status.PodIP != "" {
+			out = append(out, pod)
+		}
+	}
+	return out, nil
+}
+
+// Filter serving the volume: --filter, pod from node state or any pod
+// listing the volume
+func dialVolumeFilter(ctx context.Context, volID string) (*grpc.ClientConn, error) {
+	if *filterAddr != "" {
+		return csif.DialFilter(ctx, *filterAddr)
+	}
+
+	if st, err := findNodeState(volID); err == nil && st.FilterPod != "" {
+		clientset, err := newClientset()
+		if err != nil {
+			return nil, err
+		}
+		pod, err := clientset.CoreV1().Pods(st.PodNamespace).Get(ctx, st.FilterPod, metav1.GetOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("failed to get filter pod %s: %v", st.FilterPod, err)
+		}
+		return csif.DialFilter(ctx, csif.FilterPodAddr(pod))
+	}
+
+	pods, err := listFilterPods(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for i := range pods {
+		conn, err := dialPod(ctx, &pods[i])
+		if err != nil {
+			continue
+		}
+		resp, err := filter.NewFilterClient(conn).ListTargets(ctx, &filter.ListTargetsRequest{})
+		if err == nil {
+			for _, t := range resp.GetTargets() {
+				if t.GetVolumeId() == volID {
+					return conn, nil
+				}
+			}
+		}
+		conn.Close()
+	}
+	return nil, fmt.Errorf("no filter serves volume %q", volID)
+}
+
+// Unresponsive pods must not stall listing of the others
+func dialPod(ctx context.Context, pod *core.Pod) (*grpc.ClientConn, error) {
+	ctx, cancel := context.WithTimeout(ctx, csif.FilterProbeTimeout)
+	defer cancel()
+	return csif.DialFilter(ctx, csif.FilterPodAddr(pod))
+}
+
+type targetRow struct {
+	Pod    string                `json:"pod"`
+	Target *filter.TargetSummary `json:"target,omitempty"`
+	Error  string                `json:"error,omitempty"`
+}
+
+func cmdTargets(ctx context.Context, args []string) error {
+	type endpoint struct{ name, addr string }
+	var eps []endpoint
+	if *filterAddr != "" {
+		eps = append(eps, endpoint{*filterAddr, *filterAddr})
+	} else {
+		pods, err := listFilterPods(ctx)
+		if err != nil {
+			return err
+		}
+		for i := range pods {
+			eps = append(eps, endpoint{pods[i].Namespace + "/" + pods[i].Name, csif.FilterPodAddr(&pods[i])})
+		}
+	}
+
+	var out []*targetRow
+	for _, ep := range eps {
+		resp, err := func() (*filter.ListTargetsResponse, error) {
+			dctx, cancel := context.WithTimeout(ctx, csif.FilterProbeTimeout)
+			defer cancel()
+			conn, err := csif.DialFilter(dctx, ep.addr)
+			if err != nil {
+				return nil, err
+			}
+			defer conn.Close()
+			return filter.NewFilterClient(conn).ListTargets(ctx, &filter.ListTargetsRequest{})
+		}()
+		if err != nil {
+			out = append(out, &targetRow{Pod: ep.name, Error: err.Error()})
+			continue
+		}
+		targets := resp.GetTargets()
+		sort.Slice(targets, func(i, j int) bool { return targets[i].GetVolumeId() < targets[j].GetVolumeId() })
+		for _, t := range targets {
+			out = append(out, &targetRow{Pod: ep.name, Target: t})
+		}
+	}
+
+	var rows [][]string
+	for _, r := range out {
+		if r.Error != "" {
+			rows = append(rows, []string{r.Pod, "<error>", r.Error, "", ""})
+			continue
+		}
+		t := r.Target
+		rows = append(rows, []string{r.Pod, orNone(t.GetVolumeId()), orNone(t.GetTarget().GetIqn()),
+			t.GetSource(), orNone(strings.Join(t.GetFilters(), ","))})
+	}
+	return printOutput(out, []string{"POD", "VOLUME", "IQN", "SOURCE", "FILTERS"}, rows)
+}
+
+type volumeStatus struct {
+	Filters []*filter.FilterStatus         `json:"filters"`
+	Stats   *filter.GetTargetStatsResponse `json:"stats,omitempty"`
+}
+
+func cmdStatus(ctx context.Context, args []string) error {
+	volID := args[0]
+	conn, err := dialVolumeFilter(ctx, volID)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	client := filter.NewFilterClient(conn)
+
+	st, err := client.GetFilterStatus(ctx, &filter.GetFilterStatusRequest{VolumeId: volID})
+	if err != nil {
+		return err
+	}
+	out := &volumeStatus{Filters: st.GetFilters()}
+	out.Stats, err = client.GetTargetStats(ctx, &filter.GetTargetStatsRequest{VolumeId: volID})
+	if err != nil && status.Code(err) != codes.FailedPrecondition {
+		return err
+	}
+
+	if *output == "json" {
+		return printOutput(out, nil, nil)
+	}
+
+	var rows [][]string
+	for _, f := range out.Filters {
+		var kv []string
+		for k, v := range f.GetCounters() {
+			kv = append(kv, fmt.Sprintf("%s=%d", k, v))
+		}
+		for k, v := range f.GetInfo() {
+			kv = append(kv, k+"="+v)
+		}
+		sort.Strings(kv)
+		cond := f.GetCondition()
+		if cond == "" {
+			cond = "ok"
+		}
+		rows = append(rows, []string{f.GetName(), cond, strings.Join(kv, " ")})
+	}
+	if err := printOutput(out, []string{"FILTER", "CONDITION", "COUNTERS"}, rows); err != nil {
+		return err
+	}
+	if out.Stats == nil {
+		return nil
+	}
+
+	fmt.Println()
+	rows = nil
+	for _, l := range []struct {
+		name  string
+		stats *filter.IOStats
+	}{{"lun", out.Stats.GetLun()}, {"backing", out.Stats.GetBacking()}} {
+		for _, o := range []struct {
+			name  string
+			stats *filter.IOOpStats
+		}{{"read", l.stats.GetRead()}, {"write", l.stats.GetWrite()}, {"flush", l.stats.GetFlush()}, {"trim", l.stats.GetTrim()}} {
+			var avg time.Duration
+			if ops := o.stats.GetOps(); ops != 0 {
+				avg = time.Duration(o.stats.GetLatencySumUs()/ops) * time.Microsecond
+			}
+			rows = append(rows, []string{l.name, o.name, fmt.Sprint(o.stats.GetOps()),
+				fmt.Sprint(o.stats.GetBytes()), fmt.Sprint(o.stats.GetErrors()), avg.String(),
+				fmt.Sprint(l.stats.GetQueueDepth())})
+		}
+	}
+	return printOutput(out, []string{"LAYER", "OP", "OPS", "BYTES", "ERRORS", "AVG LATENCY", "QUEUE"}, rows)
+}
+
+func cmdFlush(ctx context.Context, args []string) error {
+	conn, err := dialVolumeFilter(ctx, args[0])
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if _, err := filter.NewFilterClient(conn).FlushTarget(ctx, &filter.FlushTargetRequest{VolumeId: args[0]}); err != nil {
+		return err
+	}
+	fmt.Printf("volume %s: flushed\n", args[0])
+	return nil
+}
+
+func cmdScrub(ctx context.Context, args []string) error {
+	conn, err := dialVolumeFilter(ctx, args[0])
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	resp, err := filter.NewFilterClient(conn).ScrubTarget(ctx, &filter.ScrubTargetRequest{VolumeId: args[0]})
+	if err != nil {
+		return err
+	}
+	return printOutput(resp, []string{"SCANNED", "ERRORS", "FIRST ERROR"}, [][]string{{
+		fmt.Sprint(resp.GetBytesScanned()), fmt.Sprint(resp.GetReadErrors()), orNone(resp.GetFirstError()),
+	}})
+}
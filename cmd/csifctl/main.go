@@ -0,0 +1,78 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+var (
+	csiEndpoint = flag.String("csi-endpoint", "unix:///csi/csi.sock", "CSI endpoint of csif-plugin")
+	stateDir    = flag.String("state-dir", "/csi-data-dir", "node state dir of csif-plugin (--state-dir)")
+	filterAddr  = flag.String("filter", "", "filter gRPC host:port, found via node state or filter pods if unset")
+	kubeconfig  = flag.String("kubeconfig", os.Getenv("KUBECONFIG"), "kubeconfig, in-cluster config if unset")
+	nodeName    = flag.String("node", os.Getenv("NODE_NAME"), "node to list filter pods on, all nodes if unset")
+	output      = flag.String("o", "table", "output format: table or json")
+	timeout     = flag.Duration("timeout", time.Minute, "timeout of command")
+)
+
+type command struct {
+	args  string
+	help  string
+	nargs int
+	run   func(ctx context.Context, args []string) error
+}
+
+var commands = map[string]*command{
+	"volumes":      {"", "list volumes staged on this node", 0, cmdVolumes},
+	"state":        {"[volume]", "dump persisted node state", -1, cmdState},
+	"targets":      {"", "list targets of filter pods", 0, cmdTargets},
+	"status":       {"<volume>", "show filter chain status and I/O stats", 1, cmdStatus},
+	"flush":        {"<volume>", "write back dirty data of filter chain", 1, cmdFlush},
+	"scrub":        {"<volume>", "read the whole volume through filter chain", 1, cmdScrub},
+	"snapshot":     {"<volume> <name>", "create snapshot via CSI controller", 2, cmdSnapshot},
+	"force-detach": {"<volume>", "logout iSCSI, delete target and node state of stuck volume, restart csif-plugin afterwards", 1, cmdForceDetach},
+}
+
+var commandOrder = []string{"volumes", "state", "targets", "status", "flush", "scrub", "snapshot", "force-detach"}
+
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, "Usage: %s [flags] <command> [args]\n\nCommands:\n", os.Args[0])
+	for _, name := range commandOrder {
+		c := commands[name]
+		fmt.Fprintf(out, "  %-14s %-16s %s\n", name, c.args, c.help)
+	}
+	fmt.Fprintf(out, "\nFlags:\n")
+	flag.PrintDefaults()
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		usage()
+		os.Exit(2)
+	}
+	c, ok := commands[flag.Arg(0)]
+	args := flag.Args()[1:]
+	if !ok || (c.nargs >= 0 && len(args) != c.nargs) || (c.nargs < 0 && len(args) > 1) {
+		usage()
+		os.Exit(2)
+	}
+	if *output != "table" && *output != "json" {
+		fmt.Fprintf(os.Stderr, "unknown output format: %s\n", *output)
+		os.Exit(2)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+	if err := c.run(ctx, args); err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", flag.Arg(0), err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+
+	lib_iscsi "github.com/pooh64/csi-lib-iscsi/iscsi"
+	"github.com/pooh64/csif-driver/pkg/csif"
+	"github.com/pooh64/csif-driver/pkg/filter"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func loadNodeStates() ([]*csif.NodeDiskState, error) {
+	states, err := csif.LoadNodeDiskStates(*stateDir)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(states, func(i, j int) bool { return states[i].VolumeID < states[j].VolumeID })
+	return states, nil
+}
+
+func findNodeState(volID string) (*csif.NodeDiskState, error) {
+	states, err := loadNodeStates()
+	if err != nil {
+		return nil, err
+	}
+	for _, st := range states {
+		if st.VolumeID == volID {
+			return st, nil
+		}
+	}
+	return nil, fmt.Errorf("volume %q is not staged on this node", volID)
+}
+
+func cmdVolumes(ctx context.Context, args []string) error {
+	states, err := loadNodeStates()
+	if err != nil {
+		return err
+	}
+	var rows [][]string
+	for _, st := range states {
+		pod := st.FilterPod
+		if pod != "" {
+			pod = st.PodNamespace + "/" + pod
+		}
+		var iqn string
+		if c := st.Connector; c != nil && len(c.Targets) != 0 {
+			iqn = c.Targets[0].Iqn
+		}
+		rows = append(rows, []string{st.VolumeID, orNone(st.Device), orNone(pod), orNone(iqn)})
+	}
+	return printOutput(states, []string{"VOLUME", "DEVICE", "FILTER POD", "IQN"}, rows)
+}
+
+// Always JSON, it is what the plugin restores from
+func cmdState(ctx context.Context, args []string) error {
+	*output = "json"
+	if len(args) != 0 {
+		st, err := findNodeState(args[0])
+		if err != nil {
+			return err
+		}
+		return printOutput(st, nil, nil)
+	}
+	states, err := loadNodeStates()
+	if err != nil {
+		return err
+	}
+	return printOutput(states, nil, nil)
+}
+
+// Undo what staging did, bypassing the plugin. Steps are idempotent, so a
+// failed run may be repeated
+func cmdForceDetach(ctx context.Context, args []string) error {
+	volID := args[0]
+	st, err := findNodeState(volID)
+	if err != nil {
+		return err
+	}
+
+	if c := st.Connector; c != nil && len(c.Targets) != 0 {
+		if c.Multipath && st.Device != "" {
+			if err := csif.FlushMultipath(st.Device); err != nil {
+				return err
+			}
+		}
+		// all paths lead to the same target
+		iqn := c.Targets[0].Iqn
+		var portals []string
+		for _, t := range c.Targets {
+			portals = append(portals, t.Portal+":"+t.Port)
+		}
+		if err := lib_iscsi.Disconnect(iqn, portals); err != nil {
+			return fmt.Errorf("iscsi logout %s failed: %v", iqn, err)
+		}
+		fmt.Printf("logged out of %s\n", iqn)
+	}
+
+	if st.FilterPod != "" || *filterAddr != "" {
+		if err := deleteTarget(ctx, volID); err != nil {
+			return err
+		}
+		if err := deleteFilterPod(ctx, st); err != nil {
+			return err
+		}
+	}
+
+	if err := csif.RemoveNodeDiskState(*stateDir, volID); err != nil {
+		return err
+	}
+	fmt.Printf("volume %s: detached, restart csif-plugin on this node to drop it from memory\n", volID)
+	return nil
+}
+
+func deleteTarget(ctx context.Context, volID string) error {
+	conn, err := dialVolumeFilter(ctx, volID)
+	if err != nil {
+		fmt.Printf("filter is unreachable, target is not deleted: %v\n", err)
+		return nil
+	}
+	defer conn.Close()
+	_, err = filter.NewFilterClient(conn).DeleteTarget(ctx, &filter.DeleteTargetRequest{VolumeId: volID})
+	if err != nil && status.Code(err) != codes.NotFound {
+		return fmt.Errorf("failed to delete target: %v", err)
+	}
+	fmt.Printf("deleted target of %s\n", volID)
+	return nil
+}
+
+// Pod is kept while other staged volumes use it
+func deleteFilterPod(ctx context.Context, st *csif.NodeDiskState) error {
+	if st.FilterPod == "" || st.Daemon {
+		return nil
+	}
+	states, err := loadNodeStates()
+	if err != nil {
+		return err
+	}
+	for _, other := range states {
+		if other.VolumeID != st.VolumeID && other.PodKey == st.PodKey {
+			fmt.Printf("filter pod %s is used by volume %s, kept\n", st.FilterPod, other.VolumeID)
+			return nil
+		}
+	}
+
+	clientset, err := newClientset()
+	if err != nil {
+		return err
+	}
+	err = clientset.CoreV1().Pods(st.PodNamespace).Delete(ctx, st.FilterPod, metav1.DeleteOptions{})
+	if err != nil && !errors.IsNotFound(err) {
+		return fmt.Errorf("failed to delete filter pod %s: %v", st.FilterPod, err)
+	}
+	fmt.Printf("deleted filter pod %s/%s\n", st.PodNamespace, st.FilterPod)
+	return nil
+}
@@ -1,8 +1,10 @@
 #!/bin/bash
 
+#kubectl delete -f filter-daemon.yaml
 kubectl delete -f node.yaml
 kubectl delete -f controller.yaml
 kubectl delete -f driverinfo.yaml
+#kubectl delete -f filter-pod-template.yaml
 kubectl delete -f rbac-node.yaml
 kubectl delete -f rbac-controller.yaml
 
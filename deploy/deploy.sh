@@ -5,6 +5,8 @@
 
 kubectl apply -f rbac-controller.yaml
 kubectl apply -f rbac-node.yaml
+#kubectl apply -f filter-pod-template.yaml
 kubectl apply -f driverinfo.yaml
 kubectl apply -f controller.yaml
-kubectl apply -f node.yaml
\ No newline at end of file
+kubectl apply -f node.yaml
+#kubectl apply -f filter-daemon.yaml
\ No newline at end of file
@@ -8,16 +8,24 @@ require (
 	github.com/google/uuid v1.2.0
 	github.com/kubernetes-csi/csi-lib-utils v0.9.1
 	github.com/pooh64/csi-lib-iscsi v1.0.0
+	github.com/prometheus/client_golang v1.7.1
+	go.opentelemetry.io/otel v1.0.1
+	go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp v1.0.1
+	go.opentelemetry.io/otel/exporters/stdout/stdouttrace v1.0.1
+	go.opentelemetry.io/otel/sdk v1.0.1
+	go.opentelemetry.io/otel/trace v1.0.1
 	golang.org/x/net v0.0.0-20210423184538-5f58ad60dda6
-	golang.org/x/sys v0.0.0-20210423185535-09eb48e85fd7 // indirect
+	golang.org/x/sys v0.0.0-20210423185535-09eb48e85fd7
+	golang.org/x/time v0.0.0-20210220033141-f8bda1e9f3ba
 	google.golang.org/genproto v0.0.0-20210423144448-3a41ef94ed2b // indirect
-	google.golang.org/grpc v1.37.0
-	google.golang.org/protobuf v1.26.0
+	google.golang.org/grpc v1.41.0
+	google.golang.org/protobuf v1.27.1
 	k8s.io/api v0.21.0-rc.0
 	k8s.io/apimachinery v0.21.0
 	k8s.io/client-go v0.21.0-rc.0
 	k8s.io/mount-utils v0.21.0
 	k8s.io/utils v0.0.0-20210305010621-2afb4311ab10
+	sigs.k8s.io/yaml v1.2.0
 )
 
 replace (
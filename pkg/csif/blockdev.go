@@ -0,0 +1,195 @@
+package csif
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+
+	"github.com/golang/glog"
+	"github.com/pooh64/csif-driver/pkg/filter"
+	"golang.org/x/sys/unix"
+)
+
+// LBA units in Filter API
+const sectorSize = 512
+
+// Block device as seen by filters
+type blockDev interface {
+	io.ReaderAt
+	io.WriterAt
+	Size() int64
+	Flush() error
+	Trim(off, length int64) error
+	Close() error
+}
+
+// Filter stacked on top of lower blockDev
+// Flush must propagate to the lower device, Close must not close it
+type blockFilter interface {
+	blockDev
+	Name() string
+	Status() *filter.FilterStatus
+}
+
+// Filter that accepts parameter changes at runtime
+type configurableFilter interface {
+	Configure(params map[string]string) error
+}
+
+// Filter that may block I/O for long, export waits for I/O on close, so
+// the waits are interrupted first. I/O fails afterwards
+type interruptibleFilter interface {
+	interrupt()
+}
+
+type blockFilterCtor func(lower blockDev, params map[string]string) (blockFilter, error)
+
+var blockFilters = map[string]blockFilterCtor{
+	"cache":    newCacheFilter,
+	"throttle": newThrottleFilter,
+	"fault":    newFaultFilter,
+	"trace":    newTraceFilter,
+	"dedup":    newDedupFilter,
+	"thin":     newThinFilter,
+	"slice":    newSliceFilter,
+}
+
+type fileBlockDev struct {
+	file *os.File
+	size int64
+}
+
+func openFileBlockDev(path string) (*fileBlockDev, error) {
+	file, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return nil, err
+	}
+	size, err := file.Seek(0, io.SeekEnd)
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to get size: %s: %v", path, err)
+	}
+	return &fileBlockDev{file: file, size: size}, nil
+}
+
+func (b *fileBlockDev) ReadAt(p []byte, off int64) (int, error) {
+	return b.file.ReadAt(p, off)
+}
+
+func (b *fileBlockDev) WriteAt(p []byte, off int64) (int, error) {
+	return b.file.WriteAt(p, off)
+}
+
+func (b *fileBlockDev) Size() int64 {
+	return b.size
+}
+
+func (b *fileBlockDev) Flush() error {
+	return b.file.Sync()
+}
+
+func (b *fileBlockDev) Trim(off, length int64) error {
+	// Best effort: regular files and devices without discard support are fine
+	err := unix.Fallocate(int(b.file.Fd()), unix.FALLOC_FL_PUNCH_HOLE|unix.FALLOC_FL_KEEP_SIZE, off, length)
+	if err != nil && err != unix.EOPNOTSUPP && err != unix.ENODEV {
+		return err
+	}
+	return nil
+}
+
+func (b *fileBlockDev) Close() error {
+	return b.file.Close()
+}
+
+type filterChain struct {
+	src     blockDev
+	filters []blockFilter // bottom to top
+}
+
+func newFilterChain(src blockDev, cfgs []*filter.FilterConfig) (_ *filterChain, err error) {
+	chain := &filterChain{src: src}
+	defer cleanup(&err, func() { chain.close() })
+
+	for _, cfg := range cfgs {
+		ctor, ok := blockFilters[cfg.GetName()]
+		if !ok {
+			return nil, fmt.Errorf("unknown filter: %s", cfg.GetName())
+		}
+		f, err := ctor(chain.top(), cfg.GetParams())
+		if err != nil {
+			return nil, fmt.Errorf("failed to create %s filter: %v", cfg.GetName(), err)
+		}
+		glog.V(4).Infof("filter chain: %s: %v", cfg.GetName(), cfg.GetParams())
+		chain.filters = append(chain.filters, f)
+	}
+	return chain, nil
+}
+
+func (fc *filterChain) top() blockDev {
+	if len(fc.filters) == 0 {
+		return fc.src
+	}
+	return fc.filters[len(fc.filters)-1]
+}
+
+func (fc *filterChain) getFilter(name string) blockFilter {
+	for _, f := range fc.filters {
+		if f.Name() == name {
+			return f
+		}
+	}
+	return nil
+}
+
+func (fc *filterChain) Status() []*filter.FilterStatus {
+	var st []*filter.FilterStatus
+	for _, f := range fc.filters {
+		st = append(st, f.Status())
+	}
+	return st
+}
+
+func (fc *filterChain) interrupt() {
+	for _, f := range fc.filters {
+		if i, ok := f.(interruptibleFilter); ok {
+			i.interrupt()
+		}
+	}
+}
+
+// Flush all filters, then close them top to bottom
+// Filters that were closed are removed, so close may be retried on error
+func (fc *filterChain) close() error {
+	if fc.src == nil {
+		return nil
+	}
+	if err := fc.top().Flush(); err != nil {
+		return fmt.Errorf("flush failed: %v", err)
+	}
+	for len(fc.filters) != 0 {
+		f := fc.filters[len(fc.filters)-1]
+		if err := f.Close(); err != nil {
+			return fmt.Errorf("failed to close %s filter: %v", f.Name(), err)
+		}
+		fc.filters = fc.filters[:len(fc.filters)-1]
+	}
+	if err := fc.src.Close(); err != nil {
+		return fmt.Errorf("failed to close source: %v", err)
+	}
+	fc.src = nil
+	return nil
+}
+
+// Parse filter parameter, return def if not set
+func parseFilterParam(params map[string]string, key string, def int64) (int64, error) {
+	str, ok := params[key]
+	if !ok || str == "" {
+		return def, nil
+	}
+	val, err := strconv.ParseInt(str, 10, 64)
+	if err != nil || val < 0 {
+		return 0, fmt.Errorf("bad %s: %s", key, str)
+	}
+	return val, nil
+}
@@ -0,0 +1,464 @@
+package csif
+
+import (
+	"bytes"
+	"container/list"
+	"encoding/binary"
+	"fmt"
+	"sync"
+
+	"github.com/golang/glog"
+	"github.com/pooh64/csif-driver/pkg/filter"
+)
+
+// Block cache on top of a fast device (local PVC)
+//
+// Cache device layout:
+//   header | dirty table (8 bytes per slot) | data slots
+// Dirty table entry holds src block + 1 while slot is dirty, 0 otherwise,
+// so write-back data survives filter restart. Clean blocks are not
+// persisted: cache starts cold and dirty blocks are written back on open.
+// An entry is cleared only after lower is flushed, and the clear is flushed
+// before the slot is reused, so recovery never skips nor misplaces data.
+
+const (
+	cacheModeWriteThrough = "writethrough"
+	cacheModeWriteBack    = "writeback"
+
+	cacheDefaultBlockSize = 64 * 1024
+	cacheHeaderSize       = 4096
+	cacheHeaderMagic      = "CSIFCACHE1"
+)
+
+type cacheBlock struct {
+	src   int64
+	slot  int64
+	dirty bool
+	elem  *list.Element
+}
+
+type cacheFilter struct {
+	lower blockDev
+	cache blockDev
+	mode  string
+	bsize int64
+
+	nslots  int64
+	dataOff int64
+
+	mu     sync.Mutex
+	blocks map[int64]*cacheBlock // by src block
+	lru    *list.List            // front is most recent
+	free   []int64
+	ndirty int64
+
+	hits       uint64
+	misses     uint64
+	evictions  uint64
+	writebacks uint64
+}
+
+func newCacheFilter(lower blockDev, params map[string]string) (blockFilter, error) {
+	mode := params["mode"]
+	switch mode {
+	case "":
+		mode = cacheModeWriteThrough
+	case cacheModeWriteThrough, cacheModeWriteBack:
+	default:
+		return nil, fmt.Errorf("bad cache mode: %s", mode)
+	}
+	bsize, err := parseFilterParam(params, "blockSize", cacheDefaultBlockSize)
+	if err != nil {
+		return nil, err
+	}
+	if bsize < nbdBlockSize || bsize%nbdBlockSize != 0 {
+		return nil, fmt.Errorf("cache block size must be multiple of %v", nbdBlockSize)
+	}
+	if params["device"] == "" {
+		return nil, fmt.Errorf("no cache device")
+	}
+
+	cache, err := openFileBlockDev(params["device"])
+	if err != nil {
+		return nil, fmt.Errorf("failed to open cache device: %v", err)
+	}
+
+	c := &cacheFilter{
+		lower:  lower,
+		cache:  cache,
+		mode:   mode,
+		bsize:  bsize,
+		blocks: map[int64]*cacheBlock{},
+		lru:    list.New(),
+	}
+
+	c.nslots = (cache.Size() - cacheHeaderSize) / (bsize + 8)
+	c.dataOff = alignUp(cacheHeaderSize+c.nslots*8, bsize)
+	c.nslots = (cache.Size() - c.dataOff) / bsize
+	if c.nslots <= 0 {
+		cache.Close()
+		return nil, fmt.Errorf("cache device is too small: %v", cache.Size())
+	}
+	for slot := c.nslots - 1; slot >= 0; slot-- {
+		c.free = append(c.free, slot)
+	}
+
+	if err := c.recover(); err != nil {
+		cache.Close()
+		return nil, fmt.Errorf("cache recovery failed: %v", err)
+	}
+	glog.V(4).Infof("cache: mode=%s bsize=%v slots=%v", mode, bsize, c.nslots)
+	return c, nil
+}
+
+func alignUp(val, align int64) int64 {
+	return (val + align - 1) / align * align
+}
+
+func (c *cacheFilter) makeHeader() []byte {
+	hdr := make([]byte, cacheHeaderSize)
+	copy(hdr, cacheHeaderMagic)
+	binary.LittleEndian.PutUint64(hdr[16:], uint64(c.bsize))
+	binary.LittleEndian.PutUint64(hdr[24:], uint64(c.lower.Size()))
+	binary.LittleEndian.PutUint64(hdr[32:], uint64(c.nslots))
+	return hdr
+}
+
+// Write back dirty blocks left by previous run, reset dirty table
+func (c *cacheFilter) recover() error {
+	hdr := make([]byte, cacheHeaderSize)
+	if _, err := c.cache.ReadAt(hdr, 0); err != nil {
+		return err
+	}
+	want := c.makeHeader()
+
+	if bytes.HasPrefix(hdr, []byte(cacheHeaderMagic)) {
+		if !bytes.Equal(hdr, want) {
+			return fmt.Errorf("cache device belongs to other source or geometry")
+		}
+		table := make([]byte, c.nslots*8)
+		if _, err := c.cache.ReadAt(table, cacheHeaderSize); err != nil {
+			return err
+		}
+		buf := make([]byte, c.bsize)
+		for slot := int64(0); slot < c.nslots; slot++ {
+			ent := binary.LittleEndian.Uint64(table[slot*8:])
+			if ent == 0 {
+				continue
+			}
+			src := int64(ent - 1)
+			data := buf[:c.blockLen(src)]
+			if _, err := c.cache.ReadAt(data, c.slotOff(slot)); err != nil {
+				return err
+			}
+			if _, err := c.lower.WriteAt(data, src*c.bsize); err != nil {
+				return err
+			}
+			c.writebacks++
+		}
+		if err := c.lower.Flush(); err != nil {
+			return err
+		}
+	}
+
+	if _, err := c.cache.WriteAt(make([]byte, c.nslots*8), cacheHeaderSize); err != nil {
+		return err
+	}
+	if _, err := c.cache.WriteAt(want, 0); err != nil {
+		return err
+	}
+	return c.cache.Flush()
+}
+
+func (c *cacheFilter) slotOff(slot int64) int64 {
+	return c.dataOff + slot*c.bsize
+}
+
+func (c *cacheFilter) blockLen(src int64) int64 {
+	if rem := c.lower.Size() - src*c.bsize; rem < c.bsize {
+		return rem
+	}
+	return c.bsize
+}
+
+func (c *cacheFilter) setDirtyEntry(b *cacheBlock, dirty bool) error {
+	ent := make([]byte, 8)
+	if dirty {
+		binary.LittleEndian.PutUint64(ent, uint64(b.src+1))
+	}
+	if _, err := c.cache.WriteAt(ent, cacheHeaderSize+b.slot*8); err != nil {
+		return err
+	}
+	if dirty != b.dirty {
+		if dirty {
+			c.ndirty++
+		} else {
+			c.ndirty--
+		}
+	}
+	b.dirty = dirty
+	return nil
+}
+
+// Blocks stay cached, clean
+func (c *cacheFilter) writeBack(blocks ...*cacheBlock) error {
+	var written []*cacheBlock
+	for _, b := range blocks {
+		if !b.dirty {
+			continue
+		}
+		data := make([]byte, c.blockLen(b.src))
+		if _, err := c.cache.ReadAt(data, c.slotOff(b.slot)); err != nil {
+			return err
+		}
+		if _, err := c.lower.WriteAt(data, b.src*c.bsize); err != nil {
+			return err
+		}
+		c.writebacks++
+		written = append(written, b)
+	}
+	if len(written) == 0 {
+		return nil
+	}
+
+	if err := c.lower.Flush(); err != nil {
+		return err
+	}
+	for _, b := range written {
+		if err := c.setDirtyEntry(b, false); err != nil {
+			return err
+		}
+	}
+	return c.cache.Flush()
+}
+
+func (c *cacheFilter) drop(b *cacheBlock) {
+	c.lru.Remove(b.elem)
+	delete(c.blocks, b.src)
+	c.free = append(c.free, b.slot)
+}
+
+func (c *cacheFilter) allocBlock(src int64) (*cacheBlock, error) {
+	if len(c.free) == 0 {
+		victim := c.lru.Back().Value.(*cacheBlock)
+		if err := c.writeBack(victim); err != nil {
+			return nil, fmt.Errorf("write back failed: %v", err)
+		}
+		c.drop(victim)
+		c.evictions++
+	}
+	slot := c.free[len(c.free)-1]
+	c.free = c.free[:len(c.free)-1]
+
+	b := &cacheBlock{src: src, slot: slot}
+	b.elem = c.lru.PushFront(b)
+	c.blocks[src] = b
+	return b, nil
+}
+
+// Load whole src block into the cache
+func (c *cacheFilter) fill(src int64) (*cacheBlock, error) {
+	data := make([]byte, c.blockLen(src))
+	if _, err := c.lower.ReadAt(data, src*c.bsize); err != nil {
+		return nil, err
+	}
+	b, err := c.allocBlock(src)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := c.cache.WriteAt(data, c.slotOff(b.slot)); err != nil {
+		c.drop(b)
+		return nil, err
+	}
+	return b, nil
+}
+
+func (c *cacheFilter) lookup(src int64) *cacheBlock {
+	b, ok := c.blocks[src]
+	if ok {
+		c.hits++
+		c.lru.MoveToFront(b.elem)
+		return b
+	}
+	c.misses++
+	return nil
+}
+
+func (c *cacheFilter) readBlock(src, boff int64, buf []byte) error {
+	b := c.lookup(src)
+	if b == nil {
+		var err error
+		if b, err = c.fill(src); err != nil {
+			return err
+		}
+	}
+	_, err := c.cache.ReadAt(buf, c.slotOff(b.slot)+boff)
+	return err
+}
+
+func (c *cacheFilter) writeBlock(src, boff int64, buf []byte) error {
+	b := c.lookup(src)
+
+	if c.mode == cacheModeWriteThrough {
+		if _, err := c.lower.WriteAt(buf, src*c.bsize+boff); err != nil {
+			return err
+		}
+		if b == nil {
+			return nil // no write allocate
+		}
+		if _, err := c.cache.WriteAt(buf, c.slotOff(b.slot)+boff); err != nil {
+			c.drop(b)
+			return nil // lower is up to date
+		}
+		return nil
+	}
+
+	if b == nil {
+		var err error
+		if int64(len(buf)) == c.blockLen(src) {
+			b, err = c.allocBlock(src)
+		} else {
+			b, err = c.fill(src)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if _, err := c.cache.WriteAt(buf, c.slotOff(b.slot)+boff); err != nil {
+		// slot may be garbage now, a clean block has no entry and its data
+		// is on lower, dirty one stays as recovery writes it back anyway
+		if !b.dirty {
+			c.drop(b)
+		}
+		return err
+	}
+	if !b.dirty {
+		return c.setDirtyEntry(b, true)
+	}
+	return nil
+}
+
+func (c *cacheFilter) forEachBlock(p []byte, off int64, fn func(src, boff int64, buf []byte) error) (int, error) {
+	if off+int64(len(p)) > c.lower.Size() {
+		return 0, fmt.Errorf("out of range: off=%v len=%v", off, len(p))
+	}
+	done := 0
+	for done < len(p) {
+		pos := off + int64(done)
+		src, boff := pos/c.bsize, pos%c.bsize
+		n := c.blockLen(src) - boff
+		if rem := int64(len(p) - done); n > rem {
+			n = rem
+		}
+		if err := fn(src, boff, p[done:done+int(n)]); err != nil {
+			return done, err
+		}
+		done += int(n)
+	}
+	return done, nil
+}
+
+func (c *cacheFilter) ReadAt(p []byte, off int64) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.forEachBlock(p, off, c.readBlock)
+}
+
+func (c *cacheFilter) WriteAt(p []byte, off int64) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.forEachBlock(p, off, c.writeBlock)
+}
+
+func (c *cacheFilter) Size() int64 {
+	return c.lower.Size()
+}
+
+func (c *cacheFilter) flushDirty() error {
+	var blocks []*cacheBlock
+	for e := c.lru.Front(); e != nil; e = e.Next() {
+		blocks = append(blocks, e.Value.(*cacheBlock))
+	}
+	if err := c.writeBack(blocks...); err != nil {
+		return fmt.Errorf("write back failed: %v", err)
+	}
+	return nil
+}
+
+func (c *cacheFilter) Flush() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.flushDirty(); err != nil {
+		return err
+	}
+	if err := c.cache.Flush(); err != nil {
+		return err
+	}
+	return c.lower.Flush()
+}
+
+func (c *cacheFilter) Trim(off, length int64) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// Drop fully covered blocks, partial ones stay cached
+	cleared := false
+	for src := alignUp(off, c.bsize) / c.bsize; (src+1)*c.bsize <= off+length; src++ {
+		if b, ok := c.blocks[src]; ok {
+			if b.dirty {
+				if err := c.setDirtyEntry(b, false); err != nil {
+					return err
+				}
+				cleared = true
+			}
+			c.drop(b)
+		}
+	}
+	// stale entry of a reused slot would be written back on recovery
+	if cleared {
+		if err := c.cache.Flush(); err != nil {
+			return err
+		}
+	}
+	return c.lower.Trim(off, length)
+}
+
+func (c *cacheFilter) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.flushDirty(); err != nil {
+		return err
+	}
+	if err := c.cache.Flush(); err != nil {
+		return err
+	}
+	return c.cache.Close()
+}
+
+func (c *cacheFilter) Name() string {
+	return "cache"
+}
+
+func (c *cacheFilter) Status() *filter.FilterStatus {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return &filter.FilterStatus{
+		Name: c.Name(),
+		Counters: map[string]uint64{
+			"hits":         c.hits,
+			"misses":       c.misses,
+			"evictions":    c.evictions,
+			"writebacks":   c.writebacks,
+			"dirtyBlocks":  uint64(c.ndirty),
+			"cachedBlocks": uint64(len(c.blocks)),
+			"slots":        uint64(c.nslots),
+		},
+		Info: map[string]string{
+			"mode":      c.mode,
+			"blockSize": fmt.Sprint(c.bsize),
+		},
+	}
+}
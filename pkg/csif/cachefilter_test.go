@@ -0,0 +1,199 @@
+package csif
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path"
+	"testing"
+)
+
+const testCacheBlock = 4096
+
+// Cache device of 4 slots
+func testCacheDevice(t *testing.T) string {
+	file := path.Join(t.TempDir(), "cache")
+	if err := os.WriteFile(file, make([]byte, 6*testCacheBlock), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func openTestCache(t *testing.T, lower blockDev, device, mode string) *cacheFilter {
+	t.Helper()
+	f, err := newCacheFilter(lower, map[string]string{
+		"device":    device,
+		"mode":      mode,
+		"blockSize": "4096",
+	})
+	if err != nil {
+		t.Fatalf("newCacheFilter: %v", err)
+	}
+	return f.(*cacheFilter)
+}
+
+func testBlockData(src int) []byte {
+	return bytes.Repeat([]byte{byte(src + 1)}, testCacheBlock)
+}
+
+func writeTestBlock(t *testing.T, c *cacheFilter, src int) {
+	t.Helper()
+	if _, err := c.WriteAt(testBlockData(src), int64(src*testCacheBlock)); err != nil {
+		t.Fatalf("write of block %d: %v", src, err)
+	}
+}
+
+func TestCacheFilterWriteBack(t *testing.T) {
+	lower := newVolatileDev(16 * testCacheBlock)
+	c := openTestCache(t, lower, testCacheDevice(t), cacheModeWriteBack)
+	defer c.Close()
+
+	writeTestBlock(t, c, 0)
+	if lower.data[0] != 0 {
+		t.Errorf("write-back reached the source before flush")
+	}
+	buf := make([]byte, testCacheBlock)
+	if _, err := c.ReadAt(buf, 0); err != nil || !bytes.Equal(buf, testBlockData(0)) {
+		t.Errorf("read of dirty block: %v", err)
+	}
+	if n := c.Status().GetCounters()["dirtyBlocks"]; n != 1 {
+		t.Errorf("%d dirty blocks", n)
+	}
+
+	if err := c.Flush(); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	if !bytes.Equal(lower.block(0), testBlockData(0)) {
+		t.Errorf("flushed block is not on the source")
+	}
+	if n := c.Status().GetCounters()["dirtyBlocks"]; n != 0 {
+		t.Errorf("%d dirty blocks after flush", n)
+	}
+}
+
+func TestCacheFilterWriteThrough(t *testing.T) {
+	lower := newVolatileDev(16 * testCacheBlock)
+	c := openTestCache(t, lower, testCacheDevice(t), cacheModeWriteThrough)
+	defer c.Close()
+
+	writeTestBlock(t, c, 0)
+	if !bytes.Equal(lower.data[:testCacheBlock], testBlockData(0)) {
+		t.Errorf("write-through didn't reach the source")
+	}
+	if n := c.Status().GetCounters()["dirtyBlocks"]; n != 0 {
+		t.Errorf("%d dirty blocks", n)
+	}
+}
+
+// Evicted blocks are on the source, the rest is written back by recovery
+func TestCacheFilterEvictionCrash(t *testing.T) {
+	lower := newVolatileDev(16 * testCacheBlock)
+	device := testCacheDevice(t)
+	c := openTestCache(t, lower, device, cacheModeWriteBack)
+	if c.nslots != 4 {
+		t.Fatalf("%d cache slots, expected 4", c.nslots)
+	}
+
+	for src := 0; src < 6; src++ {
+		writeTestBlock(t, c, src)
+	}
+	if n := c.Status().GetCounters()["evictions"]; n != 2 {
+		t.Errorf("%d evictions", n)
+	}
+
+	// crash: the filter is gone without flush
+	c.cache.Close()
+	lower.crash()
+
+	c = openTestCache(t, lower, device, cacheModeWriteBack)
+	defer c.Close()
+	if n := c.Status().GetCounters()["writebacks"]; n != 4 {
+		t.Errorf("%d blocks written back on recovery", n)
+	}
+	for src := 0; src < 6; src++ {
+		if !bytes.Equal(lower.block(src), testBlockData(src)) {
+			t.Errorf("block %d is lost", src)
+		}
+	}
+}
+
+// Trimmed dirty block must not be written back over newer data
+func TestCacheFilterTrimCrash(t *testing.T) {
+	lower := newVolatileDev(16 * testCacheBlock)
+	device := testCacheDevice(t)
+	c := openTestCache(t, lower, device, cacheModeWriteBack)
+
+	writeTestBlock(t, c, 0)
+	if err := c.Trim(0, testCacheBlock); err != nil {
+		t.Fatalf("Trim: %v", err)
+	}
+	for src := 1; src < 5; src++ {
+		writeTestBlock(t, c, src)
+	}
+	c.cache.Close()
+	lower.crash()
+
+	c = openTestCache(t, lower, device, cacheModeWriteBack)
+	defer c.Close()
+	if lower.block(0)[0] != 0 {
+		t.Errorf("trimmed block is written back")
+	}
+	for src := 1; src < 5; src++ {
+		if !bytes.Equal(lower.block(src), testBlockData(src)) {
+			t.Errorf("block %d is lost", src)
+		}
+	}
+}
+
+// Cache device failing writes of block data, dirty table is written
+type failingCacheDev struct {
+	blockDev
+	dataOff int64
+	fail    bool
+}
+
+func (d *failingCacheDev) WriteAt(p []byte, off int64) (int, error) {
+	if d.fail && off >= d.dataOff {
+		return 0, fmt.Errorf("cache write failed")
+	}
+	return d.blockDev.WriteAt(p, off)
+}
+
+// Slot of a failed write is freed, not left mapped to garbage
+func TestCacheFilterWriteError(t *testing.T) {
+	lower := newVolatileDev(16 * testCacheBlock)
+	for src := 0; src < 4; src++ {
+		copy(lower.data[src*testCacheBlock:], testBlockData(src))
+	}
+	c := openTestCache(t, lower, testCacheDevice(t), cacheModeWriteBack)
+	defer c.Close()
+	cache := &failingCacheDev{blockDev: c.cache, dataOff: c.dataOff}
+	c.cache = cache
+
+	writeTestBlock(t, c, 0)
+	readDevBlock(t, c, 2)
+
+	cache.fail = true
+	if _, err := c.WriteAt(make([]byte, testCacheBlock), testCacheBlock); err == nil {
+		t.Fatalf("write of new block succeeded")
+	}
+	if _, err := c.WriteAt([]byte("data"), 2*testCacheBlock); err == nil {
+		t.Fatalf("write of clean block succeeded")
+	}
+	if _, err := c.WriteAt(make([]byte, testCacheBlock), 0); err == nil {
+		t.Fatalf("write of dirty block succeeded")
+	}
+	cache.fail = false
+
+	counters := c.Status().GetCounters()
+	if len(c.free) != 3 || counters["dirtyBlocks"] != 1 {
+		t.Errorf("%d free slots, %d dirty blocks after failed writes", len(c.free), counters["dirtyBlocks"])
+	}
+	for src := 1; src < 4; src++ {
+		checkDevBlock(t, c, src, testBlockData(src))
+	}
+	checkDevBlock(t, c, 0, testBlockData(0))
+	if n := c.Status().GetCounters()["evictions"]; n != 0 {
+		t.Errorf("%d evictions, slots of failed writes are lost", n)
+	}
+}
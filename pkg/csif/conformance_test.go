@@ -0,0 +1,458 @@
+package csif
+
+import (
+	"net"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	core "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Hand-written subset of kubernetes-csi csi-sanity checks: capabilities,
+// validation and idempotency of the RPCs. The whole driver is served on a
+// unix socket in-process: fake clientset with a pool PVC to carve slices
+// from, in-memory filter, fake initiator and mounter.
+//
+// TODO: run sanity.Test of github.com/kubernetes-csi/csi-test/v5/pkg/sanity
+// on the same socket once it is vendored, this is not a replacement of it.
+
+const (
+	conformancePool   = "pool"
+	conformanceVolume = 16 * mib
+)
+
+type conformanceEnv struct {
+	td         *testDriver
+	identity   csi.IdentityClient
+	controller csi.ControllerClient
+	node       csi.NodeClient
+}
+
+func conformancePoolPVC() *core.PersistentVolumeClaim {
+	return &core.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{Name: conformancePool, Namespace: "default"},
+		Status: core.PersistentVolumeClaimStatus{
+			Phase:    core.ClaimBound,
+			Capacity: core.ResourceList{core.ResourceStorage: resource.MustParse("1Gi")},
+		},
+	}
+}
+
+func newConformanceEnv(t *testing.T) *conformanceEnv {
+	td := newTestDriver(t, conformancePoolPVC())
+	td.cd.version = "conformance"
+	cs := newCsifControllerServer(td.cd)
+
+	socket := path.Join(t.TempDir(), "csi.sock")
+	lis, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := grpc.NewServer(grpc.ChainUnaryInterceptor(driverLogInterceptor))
+	td.cd.registerServices(cs)(s)
+	go s.Serve(lis)
+	t.Cleanup(s.Stop)
+
+	conn, err := DialEndpoint(context.Background(), "unix://"+socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	return &conformanceEnv{
+		td:         td,
+		identity:   csi.NewIdentityClient(conn),
+		controller: csi.NewControllerClient(conn),
+		node:       csi.NewNodeClient(conn),
+	}
+}
+
+func conformanceCapability(block bool) *csi.VolumeCapability {
+	capability := &csi.VolumeCapability{
+		AccessType: &csi.VolumeCapability_Mount{Mount: &csi.VolumeCapability_MountVolume{}},
+		AccessMode: &csi.VolumeCapability_AccessMode{Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER},
+	}
+	if block {
+		capability.AccessType = &csi.VolumeCapability_Block{Block: &csi.VolumeCapability_BlockVolume{}}
+	}
+	return capability
+}
+
+func conformanceCreateRequest(name string, block bool) *csi.CreateVolumeRequest {
+	return &csi.CreateVolumeRequest{
+		Name:               name,
+		CapacityRange:      &csi.CapacityRange{RequiredBytes: conformanceVolume},
+		VolumeCapabilities: []*csi.VolumeCapability{conformanceCapability(block)},
+		Parameters:         map[string]string{paramSlicePool: conformancePool},
+	}
+}
+
+func expectCode(t *testing.T, what string, err error, code codes.Code) {
+	t.Helper()
+	if c := status.Code(err); c != code {
+		t.Errorf("%s: code %v, expected %v: %v", what, c, code, err)
+	}
+}
+
+func (e *conformanceEnv) createVolume(t *testing.T, name string, block bool) *csi.Volume {
+	t.Helper()
+	resp, err := e.controller.CreateVolume(context.Background(), conformanceCreateRequest(name, block))
+	if err != nil {
+		t.Fatalf("CreateVolume: %v", err)
+	}
+	return resp.GetVolume()
+}
+
+// Every advertised capability must be backed by an implemented RPC
+func (e *conformanceEnv) controllerCapabilityRPCs() map[csi.ControllerServiceCapability_RPC_Type]func(ctx context.Context) error {
+	return map[csi.ControllerServiceCapability_RPC_Type]func(ctx context.Context) error{
+		csi.ControllerServiceCapability_RPC_CREATE_DELETE_VOLUME: func(ctx context.Context) error {
+			_, err := e.controller.DeleteVolume(ctx, &csi.DeleteVolumeRequest{VolumeId: "nonexistent"})
+			return err
+		},
+		csi.ControllerServiceCapability_RPC_PUBLISH_UNPUBLISH_VOLUME: func(ctx context.Context) error {
+			_, err := e.controller.ControllerUnpublishVolume(ctx, &csi.ControllerUnpublishVolumeRequest{VolumeId: "nonexistent"})
+			return err
+		},
+		csi.ControllerServiceCapability_RPC_LIST_VOLUMES: func(ctx context.Context) error {
+			_, err := e.controller.ListVolumes(ctx, &csi.ListVolumesRequest{})
+			return err
+		},
+		csi.ControllerServiceCapability_RPC_GET_CAPACITY: func(ctx context.Context) error {
+			_, err := e.controller.GetCapacity(ctx, &csi.GetCapacityRequest{})
+			return err
+		},
+		csi.ControllerServiceCapability_RPC_CREATE_DELETE_SNAPSHOT: func(ctx context.Context) error {
+			_, err := e.controller.DeleteSnapshot(ctx, &csi.DeleteSnapshotRequest{SnapshotId: "nonexistent"})
+			return err
+		},
+		csi.ControllerServiceCapability_RPC_LIST_SNAPSHOTS: func(ctx context.Context) error {
+			_, err := e.controller.ListSnapshots(ctx, &csi.ListSnapshotsRequest{})
+			return err
+		},
+		csi.ControllerServiceCapability_RPC_EXPAND_VOLUME: func(ctx context.Context) error {
+			_, err := e.controller.ControllerExpandVolume(ctx, &csi.ControllerExpandVolumeRequest{
+				VolumeId:      "nonexistent",
+				CapacityRange: &csi.CapacityRange{RequiredBytes: conformanceVolume},
+			})
+			return err
+		},
+		csi.ControllerServiceCapability_RPC_GET_VOLUME: func(ctx context.Context) error {
+			_, err := e.controller.ControllerGetVolume(ctx, &csi.ControllerGetVolumeRequest{VolumeId: "nonexistent"})
+			return err
+		},
+	}
+}
+
+func (e *conformanceEnv) nodeCapabilityRPCs() map[csi.NodeServiceCapability_RPC_Type]func(ctx context.Context) error {
+	return map[csi.NodeServiceCapability_RPC_Type]func(ctx context.Context) error{
+		csi.NodeServiceCapability_RPC_STAGE_UNSTAGE_VOLUME: func(ctx context.Context) error {
+			_, err := e.node.NodeUnstageVolume(ctx, &csi.NodeUnstageVolumeRequest{VolumeId: "nonexistent", StagingTargetPath: "/nonexistent"})
+			return err
+		},
+		csi.NodeServiceCapability_RPC_GET_VOLUME_STATS: func(ctx context.Context) error {
+			_, err := e.node.NodeGetVolumeStats(ctx, &csi.NodeGetVolumeStatsRequest{VolumeId: "nonexistent", VolumePath: "/nonexistent"})
+			return err
+		},
+		csi.NodeServiceCapability_RPC_EXPAND_VOLUME: func(ctx context.Context) error {
+			_, err := e.node.NodeExpandVolume(ctx, &csi.NodeExpandVolumeRequest{VolumeId: "nonexistent", VolumePath: "/nonexistent"})
+			return err
+		},
+		// reported by NodeGetVolumeStats, checked by the lifecycle
+		csi.NodeServiceCapability_RPC_VOLUME_CONDITION: func(ctx context.Context) error { return nil },
+	}
+}
+
+func conformanceIdentity(t *testing.T, e *conformanceEnv) {
+	ctx := context.Background()
+	info, err := e.identity.GetPluginInfo(ctx, &csi.GetPluginInfoRequest{})
+	if err != nil {
+		t.Fatalf("GetPluginInfo: %v", err)
+	}
+	if info.GetName() != testDriverName || info.GetVendorVersion() == "" {
+		t.Errorf("bad plugin info: %+v", info)
+	}
+	if _, err := e.identity.Probe(ctx, &csi.ProbeRequest{}); err != nil {
+		t.Errorf("Probe: %v", err)
+	}
+
+	caps, err := e.identity.GetPluginCapabilities(ctx, &csi.GetPluginCapabilitiesRequest{})
+	if err != nil {
+		t.Fatalf("GetPluginCapabilities: %v", err)
+	}
+	for _, c := range caps.GetCapabilities() {
+		if c.GetService().GetType() != csi.PluginCapability_Service_CONTROLLER_SERVICE {
+			continue
+		}
+		if _, err := e.controller.ControllerGetCapabilities(ctx, &csi.ControllerGetCapabilitiesRequest{}); err != nil {
+			t.Errorf("controller service is advertised, but: %v", err)
+		}
+	}
+}
+
+func conformanceControllerCapabilities(t *testing.T, e *conformanceEnv) {
+	ctx := context.Background()
+	resp, err := e.controller.ControllerGetCapabilities(ctx, &csi.ControllerGetCapabilitiesRequest{})
+	if err != nil {
+		t.Fatalf("ControllerGetCapabilities: %v", err)
+	}
+	rpcs := e.controllerCapabilityRPCs()
+	for _, c := range resp.GetCapabilities() {
+		typ := c.GetRpc().GetType()
+		rpc, ok := rpcs[typ]
+		if !ok {
+			t.Errorf("no check for advertised %v", typ)
+			continue
+		}
+		if err := rpc(ctx); status.Code(err) == codes.Unimplemented {
+			t.Errorf("%v is advertised, but unimplemented: %v", typ, err)
+		}
+	}
+}
+
+func conformanceNodeCapabilities(t *testing.T, e *conformanceEnv) {
+	ctx := context.Background()
+	resp, err := e.node.NodeGetCapabilities(ctx, &csi.NodeGetCapabilitiesRequest{})
+	if err != nil {
+		t.Fatalf("NodeGetCapabilities: %v", err)
+	}
+	rpcs := e.nodeCapabilityRPCs()
+	for _, c := range resp.GetCapabilities() {
+		typ := c.GetRpc().GetType()
+		rpc, ok := rpcs[typ]
+		if !ok {
+			t.Errorf("no check for advertised %v", typ)
+			continue
+		}
+		if err := rpc(ctx); status.Code(err) == codes.Unimplemented {
+			t.Errorf("%v is advertised, but unimplemented: %v", typ, err)
+		}
+	}
+
+	info, err := e.node.NodeGetInfo(ctx, &csi.NodeGetInfoRequest{})
+	if err != nil {
+		t.Fatalf("NodeGetInfo: %v", err)
+	}
+	if info.GetNodeId() == "" {
+		t.Errorf("empty node id")
+	}
+}
+
+func conformanceCreateVolume(t *testing.T, e *conformanceEnv) {
+	ctx := context.Background()
+
+	req := conformanceCreateRequest("", false)
+	_, err := e.controller.CreateVolume(ctx, req)
+	expectCode(t, "CreateVolume without name", err, codes.InvalidArgument)
+
+	req = conformanceCreateRequest("conformance", false)
+	req.VolumeCapabilities = nil
+	_, err = e.controller.CreateVolume(ctx, req)
+	expectCode(t, "CreateVolume without capabilities", err, codes.InvalidArgument)
+
+	vol := e.createVolume(t, "conformance", false)
+	if vol.GetVolumeId() == "" || vol.GetCapacityBytes() < conformanceVolume {
+		t.Errorf("bad volume: %+v", vol)
+	}
+	again := e.createVolume(t, "conformance", false)
+	if again.GetVolumeId() != vol.GetVolumeId() {
+		t.Errorf("CreateVolume is not idempotent: %s, then %s", vol.GetVolumeId(), again.GetVolumeId())
+	}
+
+	req = conformanceCreateRequest("conformance", false)
+	req.CapacityRange.RequiredBytes *= 2
+	_, err = e.controller.CreateVolume(ctx, req)
+	expectCode(t, "CreateVolume with other size", err, codes.AlreadyExists)
+
+	other := e.createVolume(t, "conformance-other", false)
+	if other.GetVolumeId() == vol.GetVolumeId() {
+		t.Errorf("volumes share id %s", vol.GetVolumeId())
+	}
+}
+
+func conformanceDeleteVolume(t *testing.T, e *conformanceEnv) {
+	ctx := context.Background()
+
+	_, err := e.controller.DeleteVolume(ctx, &csi.DeleteVolumeRequest{})
+	expectCode(t, "DeleteVolume without id", err, codes.InvalidArgument)
+
+	_, err = e.controller.DeleteVolume(ctx, &csi.DeleteVolumeRequest{VolumeId: "nonexistent"})
+	expectCode(t, "DeleteVolume of unknown volume", err, codes.OK)
+
+	vol := e.createVolume(t, "conformance", true)
+	for i := 0; i < 2; i++ {
+		_, err = e.controller.DeleteVolume(ctx, &csi.DeleteVolumeRequest{VolumeId: vol.GetVolumeId()})
+		expectCode(t, "DeleteVolume", err, codes.OK)
+	}
+}
+
+func conformanceValidateVolumeCapabilities(t *testing.T, e *conformanceEnv) {
+	ctx := context.Background()
+	vol := e.createVolume(t, "conformance", false)
+	caps := []*csi.VolumeCapability{conformanceCapability(false)}
+
+	_, err := e.controller.ValidateVolumeCapabilities(ctx, &csi.ValidateVolumeCapabilitiesRequest{VolumeCapabilities: caps})
+	expectCode(t, "ValidateVolumeCapabilities without id", err, codes.InvalidArgument)
+
+	_, err = e.controller.ValidateVolumeCapabilities(ctx, &csi.ValidateVolumeCapabilitiesRequest{VolumeId: vol.GetVolumeId()})
+	expectCode(t, "ValidateVolumeCapabilities without capabilities", err, codes.InvalidArgument)
+
+	_, err = e.controller.ValidateVolumeCapabilities(ctx, &csi.ValidateVolumeCapabilitiesRequest{
+		VolumeId:           "nonexistent",
+		VolumeCapabilities: caps,
+	})
+	expectCode(t, "ValidateVolumeCapabilities of unknown volume", err, codes.NotFound)
+
+	resp, err := e.controller.ValidateVolumeCapabilities(ctx, &csi.ValidateVolumeCapabilitiesRequest{
+		VolumeId:           vol.GetVolumeId(),
+		VolumeContext:      vol.GetVolumeContext(),
+		VolumeCapabilities: caps,
+	})
+	if err != nil {
+		t.Fatalf("ValidateVolumeCapabilities: %v", err)
+	}
+	if resp.GetConfirmed() == nil {
+		t.Errorf("capabilities of the volume are not confirmed: %s", resp.GetMessage())
+	}
+}
+
+func conformanceNodeArgs(t *testing.T, e *conformanceEnv) {
+	ctx := context.Background()
+	capability := conformanceCapability(true)
+
+	_, err := e.node.NodeStageVolume(ctx, &csi.NodeStageVolumeRequest{StagingTargetPath: "/staging", VolumeCapability: capability})
+	expectCode(t, "NodeStageVolume without id", err, codes.InvalidArgument)
+	_, err = e.node.NodeStageVolume(ctx, &csi.NodeStageVolumeRequest{VolumeId: "vol", VolumeCapability: capability})
+	expectCode(t, "NodeStageVolume without staging path", err, codes.InvalidArgument)
+	_, err = e.node.NodeStageVolume(ctx, &csi.NodeStageVolumeRequest{VolumeId: "vol", StagingTargetPath: "/staging"})
+	expectCode(t, "NodeStageVolume without capability", err, codes.InvalidArgument)
+
+	_, err = e.node.NodeUnstageVolume(ctx, &csi.NodeUnstageVolumeRequest{StagingTargetPath: "/staging"})
+	expectCode(t, "NodeUnstageVolume without id", err, codes.InvalidArgument)
+	_, err = e.node.NodeUnstageVolume(ctx, &csi.NodeUnstageVolumeRequest{VolumeId: "vol"})
+	expectCode(t, "NodeUnstageVolume without staging path", err, codes.InvalidArgument)
+
+	_, err = e.node.NodePublishVolume(ctx, &csi.NodePublishVolumeRequest{
+		StagingTargetPath: "/staging", TargetPath: "/target", VolumeCapability: capability,
+	})
+	expectCode(t, "NodePublishVolume without id", err, codes.InvalidArgument)
+	_, err = e.node.NodePublishVolume(ctx, &csi.NodePublishVolumeRequest{
+		VolumeId: "vol", StagingTargetPath: "/staging", TargetPath: "/target",
+	})
+	expectCode(t, "NodePublishVolume without capability", err, codes.InvalidArgument)
+
+	_, err = e.node.NodeUnpublishVolume(ctx, &csi.NodeUnpublishVolumeRequest{TargetPath: "/target"})
+	expectCode(t, "NodeUnpublishVolume without id", err, codes.InvalidArgument)
+	_, err = e.node.NodeUnpublishVolume(ctx, &csi.NodeUnpublishVolumeRequest{VolumeId: "vol"})
+	expectCode(t, "NodeUnpublishVolume without target path", err, codes.InvalidArgument)
+
+	_, err = e.node.NodeGetVolumeStats(ctx, &csi.NodeGetVolumeStatsRequest{VolumePath: "/target"})
+	expectCode(t, "NodeGetVolumeStats without id", err, codes.InvalidArgument)
+	_, err = e.node.NodeGetVolumeStats(ctx, &csi.NodeGetVolumeStatsRequest{VolumeId: "vol", VolumePath: "/target"})
+	expectCode(t, "NodeGetVolumeStats of unknown volume", err, codes.NotFound)
+}
+
+// Create, stage, publish and back, as the CO would do it
+func conformanceLifecycle(block bool) func(t *testing.T, e *conformanceEnv) {
+	return func(t *testing.T, e *conformanceEnv) {
+		ctx := context.Background()
+		vol := e.createVolume(t, "conformance", block)
+		capability := conformanceCapability(block)
+		staging := path.Join(t.TempDir(), "staging")
+		target := path.Join(t.TempDir(), "target")
+		if err := os.Mkdir(staging, 0750); err != nil {
+			t.Fatal(err)
+		}
+		if !block {
+			e.td.expectFormat(nil)
+		}
+
+		// retries succeed without doing the work again
+		for i := 0; i < 2; i++ {
+			_, err := e.node.NodeStageVolume(ctx, &csi.NodeStageVolumeRequest{
+				VolumeId:          vol.GetVolumeId(),
+				StagingTargetPath: staging,
+				VolumeCapability:  capability,
+				VolumeContext:     vol.GetVolumeContext(),
+			})
+			if err != nil {
+				t.Fatalf("NodeStageVolume: %v", err)
+			}
+		}
+		e.td.exec.done(t)
+
+		for i := 0; i < 2; i++ {
+			_, err := e.node.NodePublishVolume(ctx, &csi.NodePublishVolumeRequest{
+				VolumeId:          vol.GetVolumeId(),
+				StagingTargetPath: staging,
+				TargetPath:        target,
+				VolumeCapability:  capability,
+				VolumeContext:     vol.GetVolumeContext(),
+			})
+			if err != nil {
+				t.Fatalf("NodePublishVolume: %v", err)
+			}
+		}
+
+		stats, err := e.node.NodeGetVolumeStats(ctx, &csi.NodeGetVolumeStatsRequest{
+			VolumeId:   vol.GetVolumeId(),
+			VolumePath: target,
+		})
+		if err != nil {
+			t.Errorf("NodeGetVolumeStats: %v", err)
+		} else if c := stats.GetVolumeCondition(); c == nil || c.GetAbnormal() {
+			t.Errorf("bad volume condition: %v", c)
+		}
+
+		for i := 0; i < 2; i++ {
+			_, err = e.node.NodeUnpublishVolume(ctx, &csi.NodeUnpublishVolumeRequest{
+				VolumeId:   vol.GetVolumeId(),
+				TargetPath: target,
+			})
+			expectCode(t, "NodeUnpublishVolume", err, codes.OK)
+		}
+
+		_, err = e.node.NodeUnstageVolume(ctx, &csi.NodeUnstageVolumeRequest{
+			VolumeId:          vol.GetVolumeId(),
+			StagingTargetPath: staging,
+		})
+		if err != nil {
+			t.Fatalf("NodeUnstageVolume: %v", err)
+		}
+		if len(e.td.mounter.MountPoints) != 0 {
+			t.Errorf("mounts are left: %v", e.td.mounter.MountPoints)
+		}
+
+		_, err = e.controller.DeleteVolume(ctx, &csi.DeleteVolumeRequest{VolumeId: vol.GetVolumeId()})
+		expectCode(t, "DeleteVolume", err, codes.OK)
+	}
+}
+
+func TestConformance(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		run  func(t *testing.T, e *conformanceEnv)
+	}{
+		{"Identity", conformanceIdentity},
+		{"ControllerCapabilities", conformanceControllerCapabilities},
+		{"NodeCapabilities", conformanceNodeCapabilities},
+		{"CreateVolume", conformanceCreateVolume},
+		{"DeleteVolume", conformanceDeleteVolume},
+		{"ValidateVolumeCapabilities", conformanceValidateVolumeCapabilities},
+		{"NodeArgs", conformanceNodeArgs},
+		{"LifecycleMount", conformanceLifecycle(false)},
+		{"LifecycleBlock", conformanceLifecycle(true)},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.run(t, newConformanceEnv(t))
+		})
+	}
+}
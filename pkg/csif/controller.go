@@ -2,6 +2,7 @@ package csif
 
 import (
 	"fmt"
+	"sync"
 
 	"github.com/container-storage-interface/spec/lib/go/csi"
 	"github.com/golang/glog"
@@ -17,15 +18,18 @@ const (
 	volAccessBlock
 )
 
+// Stateless, volumes are kept in the API server, see volstore.go
 type csifControllerServer struct {
-	cd      *csifDriver
-	volumes map[string]*csifVolume
+	cd    *csifDriver
+	locks *volumeLocks // by name on creation, by id on deletion
+
+	mu sync.Mutex // slice allocation must see all volumes
 }
 
 func newCsifControllerServer(driver *csifDriver) *csifControllerServer {
 	return &csifControllerServer{
-		cd:      driver,
-		volumes: map[string]*csifVolume{},
+		cd:    driver,
+		locks: newVolumeLocks(),
 	}
 }
 
@@ -38,23 +42,7 @@ type csifVolume struct {
 	Disk       *csifDisk
 }
 
-func (cs *csifControllerServer) getVolumeByID(volID string) (*csifVolume, error) {
-	if vol, ok := cs.volumes[volID]; ok {
-		return vol, nil
-	}
-	return nil, fmt.Errorf("no volID=%s in volumes", volID)
-}
-
-func (cs *csifControllerServer) getVolumeByName(volName string) (*csifVolume, error) {
-	for _, vol := range cs.volumes {
-		if vol.Name == volName {
-			return vol, nil
-		}
-	}
-	return nil, fmt.Errorf("no volName=%s in volumes", volName)
-}
-
-func (cs *csifControllerServer) createVolume(req *csi.CreateVolumeRequest, accessType volAccessType) (*csifVolume, error) {
+func (cs *csifControllerServer) createVolume(ctx context.Context, req *csi.CreateVolumeRequest, accessType volAccessType) (*csifVolume, error) {
 	name := req.GetName()
 	glog.V(4).Infof("creating csif volume: %s", name)
 
@@ -72,7 +60,14 @@ func (cs *csifControllerServer) createVolume(req *csi.CreateVolumeRequest, acces
 	disk := newCsifDisk(cs.cd)
 
 	if err := disk.Create(req, volID); err != nil {
-		return nil, fmt.Errorf("disk.Create failed: %v", err)
+		return nil, err
+	}
+
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	if err := cs.allocSlice(ctx, disk); err != nil {
+		return nil, err
 	}
 
 	vol := &csifVolume{
@@ -82,15 +77,23 @@ func (cs *csifControllerServer) createVolume(req *csi.CreateVolumeRequest, acces
 		AccessType: accessType,
 		Disk:       disk,
 	}
-	cs.volumes[volID] = vol
+	if err := cs.saveVolume(ctx, vol); err != nil {
+		return nil, err
+	}
 	return vol, nil
 }
 
-func (cs *csifControllerServer) deleteVolume(volID string) error {
+func (cs *csifControllerServer) deleteVolume(ctx context.Context, volID string) error {
 	glog.V(4).Infof("deleting csif volume: %s", volID)
 
-	vol, err := cs.getVolumeByID(volID)
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	vol, err := cs.getVolumeByID(ctx, volID)
 	if err != nil {
+		return err
+	}
+	if vol == nil {
 		glog.V(5).Infof("deleting nonexistent volume")
 		return nil
 	}
@@ -98,9 +101,7 @@ func (cs *csifControllerServer) deleteVolume(volID string) error {
 	if err := vol.Disk.Destroy(); err != nil {
 		return fmt.Errorf("failed to disconnect disk: %v", err)
 	}
-
-	delete(cs.volumes, volID)
-	return nil
+	return cs.removeVolume(ctx, vol)
 }
 
 func (cs *csifControllerServer) ControllerGetCapabilities(ctx context.Context, req *csi.ControllerGetCapabilitiesRequest) (*csi.ControllerGetCapabilitiesResponse, error) {
@@ -112,9 +113,6 @@ func (cs *csifControllerServer) ControllerGetCapabilities(ctx context.Context, r
 func (cs *csifControllerServer) getCSCapabilities() []*csi.ControllerServiceCapability {
 	rpcCap := []csi.ControllerServiceCapability_RPC_Type{
 		csi.ControllerServiceCapability_RPC_CREATE_DELETE_VOLUME,
-		csi.ControllerServiceCapability_RPC_CREATE_DELETE_SNAPSHOT, // TODO: NI, remove
-		csi.ControllerServiceCapability_RPC_EXPAND_VOLUME,          // TODO: NI, remove
-		//csi.ControllerServiceCapability_RPC_LIST_VOLUMES,
 	}
 	var csCap []*csi.ControllerServiceCapability
 
@@ -190,6 +188,10 @@ func (cs *csifControllerServer) CreateVolume(ctx context.Context, req *csi.Creat
 	if caps == nil {
 		return nil, status.Error(codes.InvalidArgument, "nil vol.caps")
 	}
+	if !cs.locks.tryAcquire(req.GetName()) {
+		return nil, volumeBusyError(req.GetName())
+	}
+	defer cs.locks.release(req.GetName())
 
 	accessType, err := obtainVolumeCapabilitiy(caps)
 	if err != nil {
@@ -208,7 +210,9 @@ func (cs *csifControllerServer) CreateVolume(ctx context.Context, req *csi.Creat
 	}
 
 	// If volume exists - verify parameters, respond
-	if vol, err := cs.getVolumeByName(req.GetName()); err == nil {
+	if vol, err := cs.getVolumeByName(ctx, req.GetName()); err != nil {
+		return nil, status.Errorf(codes.Internal, "%v", err)
+	} else if vol != nil {
 		glog.V(4).Infof("%s volume exists, veifying parameters", req.GetName())
 		if vol.Size != capacity {
 			return nil, status.Errorf(codes.AlreadyExists, "vol.size mismatch")
@@ -219,9 +223,11 @@ func (cs *csifControllerServer) CreateVolume(ctx context.Context, req *csi.Creat
 		}, nil
 	}
 
-	vol, err := cs.createVolume(req, accessType)
-	if err != nil {
+	vol, err := cs.createVolume(ctx, req, accessType)
+	if _, ok := status.FromError(err); !ok {
 		return nil, fmt.Errorf("failed to create volume %v: %w", req.GetName(), err)
+	} else if err != nil {
+		return nil, err
 	}
 	glog.V(4).Infof("volume: %s created", vol.ID)
 
@@ -241,7 +247,12 @@ func (cs *csifControllerServer) DeleteVolume(ctx context.Context, req *csi.Delet
 	}
 
 	volId := req.GetVolumeId()
-	if err := cs.deleteVolume(volId); err != nil {
+	if !cs.locks.tryAcquire(volId) {
+		return nil, volumeBusyError(volId)
+	}
+	defer cs.locks.release(volId)
+
+	if err := cs.deleteVolume(ctx, volId); err != nil {
 		return nil, fmt.Errorf("deleteVolume %v failed: %w", volId, err)
 	}
 	glog.V(4).Infof("volume %v deleted", volId)
@@ -257,8 +268,48 @@ func (cs *csifControllerServer) ControllerUnpublishVolume(_ context.Context, _ *
 	return nil, status.Error(codes.Unimplemented, "unimplemented")
 }
 
+// Statically provisioned volumes are known from their PVs only
+func (cs *csifControllerServer) volumeExists(ctx context.Context, volID string) (bool, error) {
+	if vol, err := cs.getVolumeByID(ctx, volID); err != nil || vol != nil {
+		return vol != nil, err
+	}
+	pv, err := cs.cd.findPV(ctx, volID)
+	return pv != nil, err
+}
+
 func (cs *csifControllerServer) ValidateVolumeCapabilities(ctx context.Context, req *csi.ValidateVolumeCapabilitiesRequest) (*csi.ValidateVolumeCapabilitiesResponse, error) {
-	return nil, status.Error(codes.Unimplemented, "unimplemented")
+	if len(req.GetVolumeId()) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "No volID in request")
+	}
+	if len(req.GetVolumeCapabilities()) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "nil vol.caps")
+	}
+
+	if ok, err := cs.volumeExists(ctx, req.GetVolumeId()); err != nil {
+		return nil, status.Errorf(codes.Internal, "%v", err)
+	} else if !ok {
+		return nil, status.Errorf(codes.NotFound, "volume %s not found", req.GetVolumeId())
+	}
+
+	if _, err := obtainVolumeCapabilitiy(req.GetVolumeCapabilities()); err != nil {
+		return &csi.ValidateVolumeCapabilitiesResponse{Message: err.Error()}, nil
+	}
+	if len(req.GetVolumeContext()) != 0 {
+		d := newCsifDisk(cs.cd)
+		if err := d.LoadContext(req.GetVolumeContext()); err != nil {
+			return &csi.ValidateVolumeCapabilitiesResponse{Message: err.Error()}, nil
+		}
+		if err := d.checkFilterMode(); err != nil {
+			return &csi.ValidateVolumeCapabilitiesResponse{Message: err.Error()}, nil
+		}
+	}
+	return &csi.ValidateVolumeCapabilitiesResponse{
+		Confirmed: &csi.ValidateVolumeCapabilitiesResponse_Confirmed{
+			VolumeContext:      req.GetVolumeContext(),
+			VolumeCapabilities: req.GetVolumeCapabilities(),
+			Parameters:         req.GetParameters(),
+		},
+	}, nil
 }
 
 func (cs *csifControllerServer) ListVolumes(_ context.Context, _ *csi.ListVolumesRequest) (*csi.ListVolumesResponse, error) {
@@ -0,0 +1,445 @@
+package csif
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"sync"
+
+	"github.com/golang/glog"
+	"github.com/pooh64/csif-driver/pkg/filter"
+	"golang.org/x/sys/unix"
+)
+
+// Inline deduplication, source device becomes a content-addressed block store
+//
+// Source layout:
+//   header | map (8 bytes per logical block) | meta (refcnt + hash per physical block) | data
+// Map entry is physical block + 1, 0 is an unmapped (zero) block.
+// Blocks that lost all references keep their hash and may be re-referenced,
+// they are reclaimed lazily when free blocks run out.
+//
+// Refcounts are rebuilt from the map on load, so a crash may only leak, never
+// misplace data: a hash reaches the meta only after the data is flushed, a
+// reclaimed block has its hash cleared and flushed before new data goes
+// there, and the map is flushed before the old block loses a reference.
+//
+// params: blockSize: default 4096
+//         virtualSize: logical size in bytes, default is the source size
+
+const (
+	dedupDefaultBlockSize = 4096
+	dedupHeaderSize       = 4096
+	dedupHeaderMagic      = "CSIFDEDUP1"
+	dedupMetaEntrySize    = 4 + sha256.Size
+)
+
+type dedupHash [sha256.Size]byte
+
+type dedupFilter struct {
+	lower blockDev
+	bsize int64
+	vsize int64
+
+	nlog    int64
+	nphys   int64
+	mapOff  int64
+	metaOff int64
+	dataOff int64
+
+	mu       sync.Mutex
+	lmap     []int64 // logical -> physical + 1
+	refs     []uint32
+	hashes   []dedupHash
+	index    map[dedupHash]int64
+	free     []int64
+	zeroRefs map[int64]struct{} // reclaimable blocks
+
+	dedupHits  uint64
+	leaksFixed uint64
+}
+
+func newDedupFilter(lower blockDev, params map[string]string) (blockFilter, error) {
+	bsize, err := parseFilterParam(params, "blockSize", dedupDefaultBlockSize)
+	if err != nil {
+		return nil, err
+	}
+	if bsize < sectorSize || bsize%sectorSize != 0 {
+		return nil, fmt.Errorf("dedup block size must be multiple of %v", sectorSize)
+	}
+	vsize, err := parseFilterParam(params, "virtualSize", lower.Size())
+	if err != nil {
+		return nil, err
+	}
+
+	d := &dedupFilter{
+		lower:    lower,
+		bsize:    bsize,
+		nlog:     vsize / bsize,
+		index:    map[dedupHash]int64{},
+		zeroRefs: map[int64]struct{}{},
+	}
+	d.vsize = d.nlog * bsize
+	d.mapOff = dedupHeaderSize
+	d.metaOff = alignUp(d.mapOff+d.nlog*8, bsize)
+	d.nphys = (lower.Size() - d.metaOff) / (bsize + dedupMetaEntrySize)
+	d.dataOff = alignUp(d.metaOff+d.nphys*dedupMetaEntrySize, bsize)
+	d.nphys = (lower.Size() - d.dataOff) / bsize
+	if d.nlog <= 0 || d.nphys <= 0 {
+		return nil, fmt.Errorf("source is too small for dedup: %v", lower.Size())
+	}
+
+	if err := d.load(); err != nil {
+		return nil, err
+	}
+	glog.V(4).Infof("dedup: bsize=%v logical=%v physical=%v", bsize, d.nlog, d.nphys)
+	return d, nil
+}
+
+func (d *dedupFilter) makeHeader() []byte {
+	hdr := make([]byte, dedupHeaderSize)
+	copy(hdr, dedupHeaderMagic)
+	binary.LittleEndian.PutUint64(hdr[16:], uint64(d.bsize))
+	binary.LittleEndian.PutUint64(hdr[24:], uint64(d.vsize))
+	binary.LittleEndian.PutUint64(hdr[32:], uint64(d.nphys))
+	return hdr
+}
+
+// Read metadata, format if source is empty, fix refcounts leaked by a crash
+func (d *dedupFilter) load() error {
+	hdr := make([]byte, dedupHeaderSize)
+	if _, err := d.lower.ReadAt(hdr, 0); err != nil {
+		return fmt.Errorf("failed to read header: %v", err)
+	}
+	want := d.makeHeader()
+
+	d.lmap = make([]int64, d.nlog)
+	d.refs = make([]uint32, d.nphys)
+	d.hashes = make([]dedupHash, d.nphys)
+
+	if !bytes.HasPrefix(hdr, []byte(dedupHeaderMagic)) {
+		if !bytes.Equal(hdr, make([]byte, dedupHeaderSize)) {
+			return fmt.Errorf("source contains foreign data, refusing to format")
+		}
+		glog.V(4).Infof("dedup: formatting source")
+		if err := d.writeZeroes(d.mapOff, d.dataOff-d.mapOff); err != nil {
+			return fmt.Errorf("failed to format: %v", err)
+		}
+		if _, err := d.lower.WriteAt(want, 0); err != nil {
+			return fmt.Errorf("failed to write header: %v", err)
+		}
+		for p := d.nphys - 1; p >= 0; p-- {
+			d.free = append(d.free, p)
+		}
+		return d.lower.Flush()
+	}
+	if !bytes.Equal(hdr, want) {
+		return fmt.Errorf("dedup geometry mismatch")
+	}
+
+	mapBuf := make([]byte, d.nlog*8)
+	if _, err := d.lower.ReadAt(mapBuf, d.mapOff); err != nil {
+		return err
+	}
+	metaBuf := make([]byte, d.nphys*dedupMetaEntrySize)
+	if _, err := d.lower.ReadAt(metaBuf, d.metaOff); err != nil {
+		return err
+	}
+
+	refs := make([]uint32, d.nphys)
+	for l := range d.lmap {
+		ent := int64(binary.LittleEndian.Uint64(mapBuf[l*8:]))
+		if ent > d.nphys {
+			return fmt.Errorf("corrupted map entry: %v", l)
+		}
+		d.lmap[l] = ent
+		if ent != 0 {
+			refs[ent-1]++
+		}
+	}
+
+	var empty dedupHash
+	for p := d.nphys - 1; p >= 0; p-- {
+		ent := metaBuf[p*dedupMetaEntrySize:]
+		copy(d.hashes[p][:], ent[4:dedupMetaEntrySize])
+		d.refs[p] = refs[p]
+		if binary.LittleEndian.Uint32(ent) != refs[p] {
+			if err := d.writeMeta(p); err != nil {
+				return err
+			}
+			d.leaksFixed++
+		}
+		switch {
+		case d.hashes[p] == empty && refs[p] == 0:
+			d.free = append(d.free, p)
+		case d.hashes[p] == empty:
+			// crash before the hash got there, not deduplicated
+		case refs[p] == 0:
+			d.index[d.hashes[p]] = p
+			d.zeroRefs[p] = struct{}{}
+		default:
+			d.index[d.hashes[p]] = p
+		}
+	}
+	return nil
+}
+
+func (d *dedupFilter) writeZeroes(off, length int64) error {
+	zero := make([]byte, 1*mib)
+	for length > 0 {
+		n := int64(len(zero))
+		if n > length {
+			n = length
+		}
+		if _, err := d.lower.WriteAt(zero[:n], off); err != nil {
+			return err
+		}
+		off += n
+		length -= n
+	}
+	return nil
+}
+
+func (d *dedupFilter) writeMeta(p int64) error {
+	ent := make([]byte, dedupMetaEntrySize)
+	binary.LittleEndian.PutUint32(ent, d.refs[p])
+	copy(ent[4:], d.hashes[p][:])
+	_, err := d.lower.WriteAt(ent, d.metaOff+p*dedupMetaEntrySize)
+	return err
+}
+
+func (d *dedupFilter) writeMap(l int64) error {
+	ent := make([]byte, 8)
+	binary.LittleEndian.PutUint64(ent, uint64(d.lmap[l]))
+	_, err := d.lower.WriteAt(ent, d.mapOff+l*8)
+	return err
+}
+
+func (d *dedupFilter) allocPhys() (int64, error) {
+	if n := len(d.free); n != 0 {
+		p := d.free[n-1]
+		d.free = d.free[:n-1]
+		return p, nil
+	}
+	for p := range d.zeroRefs {
+		delete(d.zeroRefs, p)
+		delete(d.index, d.hashes[p])
+		d.hashes[p] = dedupHash{}
+		// leaked until reload on failure
+		if err := d.writeMeta(p); err != nil {
+			return 0, err
+		}
+		if err := d.lower.Flush(); err != nil {
+			return 0, err
+		}
+		return p, nil
+	}
+	return 0, fmt.Errorf("dedup store is full: %w", unix.ENOSPC)
+}
+
+func (d *dedupFilter) unref(p int64) error {
+	d.refs[p]--
+	if d.refs[p] == 0 {
+		d.zeroRefs[p] = struct{}{}
+	}
+	return d.writeMeta(p)
+}
+
+// Point logical block to data, data must be a whole block
+func (d *dedupFilter) storeBlock(l int64, data []byte) error {
+	old := d.lmap[l]
+	var next int64
+
+	if !bytes.Equal(data, make([]byte, len(data))) {
+		hash := dedupHash(sha256.Sum256(data))
+		p, ok := d.index[hash]
+		if ok {
+			d.dedupHits++
+			delete(d.zeroRefs, p)
+		} else {
+			var err error
+			if p, err = d.allocPhys(); err != nil {
+				return err
+			}
+			if _, err := d.lower.WriteAt(data, d.dataOff+p*d.bsize); err != nil {
+				d.free = append(d.free, p)
+				return err
+			}
+			if err := d.lower.Flush(); err != nil {
+				d.free = append(d.free, p)
+				return err
+			}
+			d.hashes[p] = hash
+			d.index[hash] = p
+		}
+		d.refs[p]++
+		if err := d.writeMeta(p); err != nil {
+			return err
+		}
+		next = p + 1
+	}
+
+	if next == old {
+		if old != 0 {
+			return d.unref(old - 1) // drop the ref taken above
+		}
+		return nil
+	}
+	d.lmap[l] = next
+	if err := d.writeMap(l); err != nil {
+		return err
+	}
+	if old == 0 {
+		return nil
+	}
+	if err := d.lower.Flush(); err != nil {
+		return err
+	}
+	return d.unref(old - 1)
+}
+
+func (d *dedupFilter) loadBlock(l int64, buf []byte) error {
+	ent := d.lmap[l]
+	if ent == 0 {
+		for i := range buf {
+			buf[i] = 0
+		}
+		return nil
+	}
+	_, err := d.lower.ReadAt(buf, d.dataOff+(ent-1)*d.bsize)
+	return err
+}
+
+func (d *dedupFilter) forEachBlock(p []byte, off int64, fn func(l, boff int64, buf []byte) error) (int, error) {
+	if off+int64(len(p)) > d.vsize {
+		return 0, fmt.Errorf("out of range: off=%v len=%v", off, len(p))
+	}
+	done := 0
+	for done < len(p) {
+		pos := off + int64(done)
+		l, boff := pos/d.bsize, pos%d.bsize
+		n := d.bsize - boff
+		if rem := int64(len(p) - done); n > rem {
+			n = rem
+		}
+		if err := fn(l, boff, p[done:done+int(n)]); err != nil {
+			return done, err
+		}
+		done += int(n)
+	}
+	return done, nil
+}
+
+func (d *dedupFilter) ReadAt(p []byte, off int64) (int, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	blk := make([]byte, d.bsize)
+	return d.forEachBlock(p, off, func(l, boff int64, buf []byte) error {
+		if err := d.loadBlock(l, blk); err != nil {
+			return err
+		}
+		copy(buf, blk[boff:])
+		return nil
+	})
+}
+
+func (d *dedupFilter) WriteAt(p []byte, off int64) (int, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	blk := make([]byte, d.bsize)
+	return d.forEachBlock(p, off, func(l, boff int64, buf []byte) error {
+		if int64(len(buf)) != d.bsize {
+			if err := d.loadBlock(l, blk); err != nil {
+				return err
+			}
+		}
+		copy(blk[boff:], buf)
+		return d.storeBlock(l, blk)
+	})
+}
+
+func (d *dedupFilter) Size() int64 {
+	return d.vsize
+}
+
+func (d *dedupFilter) Flush() error {
+	return d.lower.Flush()
+}
+
+// Unmap fully covered blocks
+func (d *dedupFilter) Trim(off, length int64) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var unmapped []int64
+	for l := alignUp(off, d.bsize) / d.bsize; (l+1)*d.bsize <= off+length && l < d.nlog; l++ {
+		old := d.lmap[l]
+		if old == 0 {
+			continue
+		}
+		d.lmap[l] = 0
+		if err := d.writeMap(l); err != nil {
+			return err
+		}
+		unmapped = append(unmapped, old-1)
+	}
+	if len(unmapped) == 0 {
+		return nil
+	}
+	if err := d.lower.Flush(); err != nil {
+		return err
+	}
+	for _, p := range unmapped {
+		if err := d.unref(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *dedupFilter) Close() error {
+	return nil
+}
+
+func (d *dedupFilter) Name() string {
+	return "dedup"
+}
+
+func (d *dedupFilter) Status() *filter.FilterStatus {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var mapped uint64
+	for _, ent := range d.lmap {
+		if ent != 0 {
+			mapped++
+		}
+	}
+	unique := uint64(d.nphys) - uint64(len(d.free)) - uint64(len(d.zeroRefs))
+	ratio := 1.0
+	if unique != 0 {
+		ratio = float64(mapped) / float64(unique)
+	}
+	bs := uint64(d.bsize)
+
+	return &filter.FilterStatus{
+		Name: d.Name(),
+		Counters: map[string]uint64{
+			"logicalBlocks":    mapped,
+			"uniqueBlocks":     unique,
+			"physicalBlocks":   uint64(d.nphys),
+			"freeBlocks":       uint64(len(d.free)),
+			"savedBytes":       (mapped - unique) * bs,
+			"reclaimableBytes": uint64(len(d.zeroRefs)) * bs,
+			"dedupHits":        d.dedupHits,
+			"leaksFixed":       d.leaksFixed,
+		},
+		Info: map[string]string{
+			"dedupRatio": fmt.Sprintf("%.2f", ratio),
+			"blockSize":  fmt.Sprint(d.bsize),
+		},
+	}
+}
@@ -0,0 +1,126 @@
+package csif
+
+import (
+	"bytes"
+	"testing"
+)
+
+// 8 logical and 4 physical blocks
+const testDedupSourceSize = 7 * testCacheBlock
+
+func openTestDedup(t *testing.T, lower blockDev) *dedupFilter {
+	t.Helper()
+	f, err := newDedupFilter(lower, map[string]string{"virtualSize": "32768"})
+	if err != nil {
+		t.Fatalf("newDedupFilter: %v", err)
+	}
+	d := f.(*dedupFilter)
+	if d.nphys != 4 || d.nlog != 8 {
+		t.Fatalf("dedup geometry: %d physical, %d logical blocks", d.nphys, d.nlog)
+	}
+	return d
+}
+
+func writeDevBlock(t *testing.T, dev blockDev, l int, data []byte) {
+	t.Helper()
+	if _, err := dev.WriteAt(data, int64(l*testCacheBlock)); err != nil {
+		t.Fatalf("write of block %d: %v", l, err)
+	}
+}
+
+func readDevBlock(t *testing.T, dev blockDev, l int) []byte {
+	t.Helper()
+	buf := make([]byte, testCacheBlock)
+	if _, err := dev.ReadAt(buf, int64(l*testCacheBlock)); err != nil {
+		t.Fatalf("read of block %d: %v", l, err)
+	}
+	return buf
+}
+
+func trimDevBlock(t *testing.T, dev blockDev, l int) {
+	t.Helper()
+	if err := dev.Trim(int64(l*testCacheBlock), testCacheBlock); err != nil {
+		t.Fatalf("trim of block %d: %v", l, err)
+	}
+}
+
+// Block is one of the given contents
+func checkDevBlock(t *testing.T, dev blockDev, l int, want ...[]byte) {
+	t.Helper()
+	got := readDevBlock(t, dev, l)
+	for _, w := range want {
+		if bytes.Equal(got, w) {
+			return
+		}
+	}
+	t.Errorf("block %d has unexpected data %x...", l, got[:4])
+}
+
+func TestDedupFilter(t *testing.T) {
+	lower := newVolatileDev(testDedupSourceSize)
+	d := openTestDedup(t, lower)
+
+	for l := 0; l < 8; l++ {
+		writeDevBlock(t, d, l, testBlockData(l%2))
+	}
+	counters := d.Status().GetCounters()
+	if counters["uniqueBlocks"] != 2 || counters["dedupHits"] != 6 {
+		t.Errorf("unexpected counters %v", counters)
+	}
+
+	trimDevBlock(t, d, 0)
+	if err := d.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	d = openTestDedup(t, lower)
+	checkDevBlock(t, d, 0, make([]byte, testCacheBlock))
+	for l := 1; l < 8; l++ {
+		checkDevBlock(t, d, l, testBlockData(l%2))
+	}
+}
+
+// Data of block reclaimed from zero-ref one must not be found by old hash
+func TestDedupFilterReclaimCrash(t *testing.T) {
+	lower := newVolatileDev(testDedupSourceSize)
+	d := openTestDedup(t, lower)
+	for l := 0; l < 4; l++ {
+		writeDevBlock(t, d, l, testBlockData(l))
+	}
+	trimDevBlock(t, d, 0)
+
+	lower.checkpoint()
+	writeDevBlock(t, d, 0, testBlockData(4))
+
+	zero := make([]byte, testCacheBlock)
+	lower.forEachCrash(func(dev *volatileDev) {
+		d := openTestDedup(t, dev)
+		checkDevBlock(t, d, 0, zero, testBlockData(4))
+		trimDevBlock(t, d, 3)
+		writeDevBlock(t, d, 4, testBlockData(0))
+		checkDevBlock(t, d, 4, testBlockData(0))
+		for l := 1; l < 3; l++ {
+			checkDevBlock(t, d, l, testBlockData(l))
+		}
+	})
+}
+
+// Overwritten block is either old or new, hashes stay right
+func TestDedupFilterOverwriteCrash(t *testing.T) {
+	lower := newVolatileDev(testDedupSourceSize)
+	d := openTestDedup(t, lower)
+	writeDevBlock(t, d, 0, testBlockData(0))
+	writeDevBlock(t, d, 1, testBlockData(1))
+
+	lower.checkpoint()
+	writeDevBlock(t, d, 1, testBlockData(2))
+
+	lower.forEachCrash(func(dev *volatileDev) {
+		d := openTestDedup(t, dev)
+		checkDevBlock(t, d, 0, testBlockData(0))
+		checkDevBlock(t, d, 1, testBlockData(1), testBlockData(2))
+		for l, src := range []int{1, 2, 0} {
+			writeDevBlock(t, d, l+2, testBlockData(src))
+			checkDevBlock(t, d, l+2, testBlockData(src))
+		}
+	})
+}
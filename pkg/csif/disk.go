@@ -3,21 +3,18 @@ package csif
 import (
 	"encoding/json"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/pooh64/csif-driver/pkg/filter"
 
+	"go.opentelemetry.io/otel/attribute"
 	"golang.org/x/net/context"
 	core "k8s.io/api/core/v1"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/fields"
-	"k8s.io/apimachinery/pkg/labels"
-	v1 "k8s.io/client-go/kubernetes/typed/core/v1"
 
 	"github.com/container-storage-interface/spec/lib/go/csi"
 	"github.com/golang/glog"
 	lib_iscsi "github.com/pooh64/csi-lib-iscsi/iscsi"
-	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 )
@@ -28,7 +25,10 @@ const (
 	CsifFilterPortGRPC       = 9820
 	CsifFilterPortTGT        = 9821
 	CsifFilterPortTGTControl = 9822
+	CsifFilterPortMetrics    = 9823
 	CsifFilterBstoreSrc      = "/dev/csi-csif-bstore-src"
+	CsifFilterBstoreCache    = "/dev/csi-csif-bstore-cache"
+	CsifFilterTraceDir       = "/var/log/csif-trace"
 	СsifFilterForcedLoop0    = "/dev/loop0" // TODO: fix
 )
 
@@ -38,11 +38,58 @@ type csifDisk struct {
 	SourcePVC string      `json:"sourcePVC"`
 	cd        *csifDriver `json:"-"`
 
-	filterPod    *core.Pod            `json:"-"`
-	filterConn   *grpc.ClientConn     `json:"-"`
-	targetExists bool                 `json:"-"`
-	targetConn   *lib_iscsi.Connector `json:"-"`
-	dev          string               `json:"-"`
+	// namespace of SourcePVC and CachePVC, filter pod is placed there,
+	// filter pod template namespace if unset
+	SourcePVCNamespace string `json:"sourcePVCNamespace,omitempty"`
+
+	// overrides driver filter pod template, YAML or JSON
+	FilterPodTemplate string `json:"filterPodTemplate,omitempty"`
+
+	// cache filter: fast PVC used as block cache for SourcePVC
+	CachePVC       string `json:"cachePVC,omitempty"`
+	CacheMode      string `json:"cacheMode,omitempty"`
+	CacheBlockSize string `json:"cacheBlockSize,omitempty"`
+
+	// throttle filter: token bucket limits, 0 or unset is unlimited
+	MaxReadIOPS  string `json:"maxReadIOPS,omitempty"`
+	MaxWriteIOPS string `json:"maxWriteIOPS,omitempty"`
+	MaxReadBPS   string `json:"maxReadBPS,omitempty"`
+	MaxWriteBPS  string `json:"maxWriteBPS,omitempty"`
+	BurstSeconds string `json:"burstSeconds,omitempty"`
+
+	// dedup filter: "true" turns SourcePVC into a content-addressed store
+	Dedup            string `json:"dedup,omitempty"`
+	DedupBlockSize   string `json:"dedupBlockSize,omitempty"`
+	DedupVirtualSize string `json:"dedupVirtualSize,omitempty"`
+
+	// thin filter: SourcePVC becomes a pool for ThinVirtualSize volume
+	ThinVirtualSize   string `json:"thinVirtualSize,omitempty"`
+	ThinExtentSize    string `json:"thinExtentSize,omitempty"`
+	ThinFullThreshold string `json:"thinFullThreshold,omitempty"`
+
+	// slice of SourcePVC in bytes, whole source if unset
+	SliceOffset string `json:"sliceOffset,omitempty"`
+	SliceLength string `json:"sliceLength,omitempty"`
+
+	// fault filter: "true" enables fault injection rules via Filter API
+	FaultInjection string `json:"faultInjection,omitempty"`
+
+	// trace filter: "true" enables access log, streamed via Filter API
+	Trace           string `json:"trace,omitempty"`
+	TraceBufferSize string `json:"traceBufferSize,omitempty"`
+	TraceFile       string `json:"traceFile,omitempty"`
+	TraceFormat     string `json:"traceFormat,omitempty"`
+
+	volID        string                `json:"-"`
+	filterPod    *filterPod            `json:"-"`
+	targetExists bool                  `json:"-"`
+	targetConn   *lib_iscsi.Connector  `json:"-"`
+	dev          string                `json:"-"`
+	staging      *diskStaging          `json:"-"` // as staged by NodeStageVolume
+	condition    string                `json:"-"` // last reported by filters
+	pvRef        *core.ObjectReference `json:"-"` // events, see recordEvent
+	pvcRef       *core.ObjectReference `json:"-"`
+	ioErrors     uint64                `json:"-"` // as of the last GetTargetStats
 }
 
 func newCsifDisk(driver *csifDriver) *csifDisk {
@@ -51,146 +98,298 @@ func newCsifDisk(driver *csifDriver) *csifDisk {
 	}
 }
 
-// CS routine: process sclass volumeAttributes: check, provision
-func (d *csifDisk) Create(req *csi.CreateVolumeRequest, volID string) error {
-	/* no dynamic provisioning */
-	return status.Errorf(codes.Unimplemented, "")
-}
+// Filters to stack on top of SourcePVC, bottom to top
+func (d *csifDisk) filterConfigs() ([]*filter.FilterConfig, error) {
+	var cfgs []*filter.FilterConfig
 
-// CS routine: delete created disk
-func (d *csifDisk) Destroy() error {
-	/* no dynamic provisioning */
-	return status.Errorf(codes.Unimplemented, "")
-}
+	if d.Dedup == "true" && d.ThinVirtualSize != "" {
+		return nil, fmt.Errorf("dedup and thin filters are mutually exclusive")
+	}
 
-func waitPodCond(coreif v1.CoreV1Interface, pod *core.Pod, pred func(*core.Pod) bool, timeout time.Duration) (*core.Pod, error) {
-	watcher, err := coreif.Pods(pod.Namespace).Watch(context.TODO(), metav1.ListOptions{
-		Watch:           true,
-		ResourceVersion: pod.ResourceVersion,
-		FieldSelector:   fields.Set{"metadata.name": pod.Name}.AsSelector().String(),
-		LabelSelector:   labels.Everything().String(),
-	})
-	if err != nil {
-		return nil, fmt.Errorf("failed to create watcher: %v", err)
-	}
-
-	func() {
-		for {
-			select {
-			case event, ok := <-watcher.ResultChan():
-				if !ok {
-					return
-				}
-				podupd, ok := event.Object.(*core.Pod)
-				if ok && pred(podupd) {
-					watcher.Stop()
-				}
-			case <-time.After(timeout):
-				watcher.Stop()
-			}
+	// Slices share the filter pod, which is configured by the first one
+	if d.SliceLength != "" {
+		if d.CachePVC != "" {
+			return nil, fmt.Errorf("cache filter is not supported on slices")
 		}
-	}()
-	return coreif.Pods(pod.Namespace).Get(context.TODO(), pod.Name, metav1.GetOptions{})
-}
+		cfgs = append(cfgs, &filter.FilterConfig{
+			Name: "slice",
+			Params: map[string]string{
+				"offset": d.SliceOffset,
+				"length": d.SliceLength,
+			},
+		})
+	}
 
-func (d *csifDisk) createFilterPod() error {
-	var err error
-	pod := makeFilterPodConf(d)
+	// Throttle goes right above the source to protect the backing storage
+	if d.MaxReadIOPS != "" || d.MaxWriteIOPS != "" || d.MaxReadBPS != "" || d.MaxWriteBPS != "" {
+		cfgs = append(cfgs, &filter.FilterConfig{
+			Name: "throttle",
+			Params: map[string]string{
+				"maxReadIOPS":  d.MaxReadIOPS,
+				"maxWriteIOPS": d.MaxWriteIOPS,
+				"maxReadBPS":   d.MaxReadBPS,
+				"maxWriteBPS":  d.MaxWriteBPS,
+				"burstSeconds": d.BurstSeconds,
+			},
+		})
+	}
 
-	coreif := d.cd.clientset.CoreV1()
+	if d.ThinVirtualSize != "" {
+		cfgs = append(cfgs, &filter.FilterConfig{
+			Name: "thin",
+			Params: map[string]string{
+				"virtualSize":   d.ThinVirtualSize,
+				"extentSize":    d.ThinExtentSize,
+				"fullThreshold": d.ThinFullThreshold,
+			},
+		})
+	}
 
-	pod, err = coreif.Pods(pod.Namespace).Create(context.TODO(), pod, metav1.CreateOptions{})
-	if err != nil {
-		return fmt.Errorf("failed to create pod: %v", err)
+	if d.Dedup == "true" {
+		cfgs = append(cfgs, &filter.FilterConfig{
+			Name: "dedup",
+			Params: map[string]string{
+				"blockSize":   d.DedupBlockSize,
+				"virtualSize": d.DedupVirtualSize,
+			},
+		})
+	}
+
+	if d.CachePVC != "" {
+		cfgs = append(cfgs, &filter.FilterConfig{
+			Name: "cache",
+			Params: map[string]string{
+				"device":    CsifFilterBstoreCache,
+				"mode":      d.CacheMode,
+				"blockSize": d.CacheBlockSize,
+			},
+		})
 	}
-	d.filterPod = pod
 
-	pred := func(pod *core.Pod) bool { return pod.Status.Phase != core.PodPending }
+	// Topmost, so that injected faults are seen exactly as requested
+	if d.FaultInjection == "true" {
+		cfgs = append(cfgs, &filter.FilterConfig{
+			Name: "fault",
+		})
+	}
 
-	pod, err = waitPodCond(coreif, pod, pred, 100*time.Second)
-	if err != nil {
-		if err := d.deleteFilterPod(); err != nil {
-			glog.Errorf("failed to delete pod: %v", err)
+	// Above faults: record requests as the application sees them
+	if d.Trace == "true" {
+		if _, err := traceFilePath(CsifFilterTraceDir, d.TraceFile); err != nil {
+			return nil, err
 		}
+		cfgs = append(cfgs, &filter.FilterConfig{
+			Name: "trace",
+			Params: map[string]string{
+				"bufferSize": d.TraceBufferSize,
+				"file":       d.TraceFile,
+				"format":     d.TraceFormat,
+			},
+		})
+	}
+	return cfgs, nil
+}
+
+// CS routine: process sclass parameters, dynamic disk is a slice of pool PVC
+// Slice offset is chosen by controller
+func (d *csifDisk) Create(req *csi.CreateVolumeRequest, volID string) error {
+	params := map[string]string{}
+	for k, v := range req.GetParameters() {
+		params[k] = v
+	}
+	pool := params[paramSlicePool]
+	if pool == "" {
+		return status.Errorf(codes.Unimplemented, "only slices of %s may be provisioned", paramSlicePool)
+	}
+	delete(params, paramSlicePool)
+
+	if err := d.LoadContext(params); err != nil {
+		return status.Errorf(codes.InvalidArgument, "bad parameters: %v", err)
+	}
+	if d.SourcePVC != "" || d.SliceOffset != "" || d.SliceLength != "" {
+		return status.Errorf(codes.InvalidArgument, "source and slice are chosen by allocator")
+	}
+
+	size := req.GetCapacityRange().GetRequiredBytes()
+	limit := req.GetCapacityRange().GetLimitBytes()
+	if size <= 0 {
+		return status.Errorf(codes.InvalidArgument, "slice capacity is required")
+	}
+	if size = alignUp(size, sliceAlign); limit != 0 && size > limit {
+		size = alignUp(req.GetCapacityRange().GetRequiredBytes(), sectorSize)
+		if size > limit {
+			return status.Errorf(codes.OutOfRange, "capacity range can't be satisfied")
+		}
+	}
+
+	d.volID = volID
+	d.SourcePVC = pool
+	d.SourcePVCNamespace = d.sourceNamespace()
+	d.SliceLength = fmt.Sprint(size)
+	if _, err := d.filterConfigs(); err != nil {
+		return status.Errorf(codes.InvalidArgument, "bad filter config: %v", err)
+	}
+	if _, err := d.podTemplate(); err != nil {
+		return status.Errorf(codes.InvalidArgument, "%v", err)
+	}
+	if err := d.checkFilterMode(); err != nil {
+		return status.Errorf(codes.InvalidArgument, "%v", err)
+	}
+	return nil
+}
+
+// Filter daemon serves node-local PVs only, reject others on provisioning
+// instead of failing on staging
+func (d *csifDisk) checkFilterMode() error {
+	if d.cd.filterMode != FilterModeDaemon {
+		return nil
+	}
+	if _, err := d.cd.resolveLocalPVC(d.sourceNamespace(), d.SourcePVC); err != nil {
 		return err
 	}
-	if pod.Status.Phase != core.PodRunning {
-		if err := d.deleteFilterPod(); err != nil {
-			glog.Errorf("failed to delete pod: %v", err)
+	if d.CachePVC != "" {
+		if _, err := d.cd.resolveLocalPVC(d.sourceNamespace(), d.CachePVC); err != nil {
+			return err
 		}
-		return fmt.Errorf("pod failed to start within timeout: %v", pod.Status.Phase)
 	}
+	return nil
+}
 
-	d.filterPod = pod
+func (d *csifDisk) sourceNamespace() string {
+	if d.SourcePVCNamespace != "" {
+		return d.SourcePVCNamespace
+	}
+	return d.cd.podTemplate.Namespace
+}
+
+// CS routine: delete created disk
+// Slice is released with the PV, data is left as is
+func (d *csifDisk) Destroy() error {
 	return nil
 }
 
-func (d *csifDisk) deleteFilterPod() error {
-	coreif := d.cd.clientset.CoreV1()
-	err := coreif.Pods(d.filterPod.Namespace).Delete(context.TODO(), d.filterPod.Name, metav1.DeleteOptions{})
+// Source and cache devices as seen by filter daemon or warm pod
+func (d *csifDisk) resolveLocalPaths(filters []*filter.FilterConfig) (string, error) {
+	source, err := d.cd.resolveLocalPVC(d.sourceNamespace(), d.SourcePVC)
 	if err != nil {
-		d.filterPod = nil
+		return "", err
 	}
-
-	// TODO: print log, in create... too
-	// TODO: wait deletion
-	return err
+	for _, cfg := range filters {
+		if cfg.GetName() != "cache" {
+			continue
+		}
+		if cfg.Params["device"], err = d.cd.resolveLocalPVC(d.sourceNamespace(), d.CachePVC); err != nil {
+			return "", err
+		}
+	}
+	return source, nil
 }
 
 // NS routine: attach disk as block device
-func (d *csifDisk) Connect() error {
+func (d *csifDisk) Connect(ctx context.Context) error {
 	var err error
 
-	if err := d.createFilterPod(); err != nil {
-		return fmt.Errorf("create filter pod failed: %v", err)
+	filters, err := d.filterConfigs()
+	if err != nil {
+		return status.Errorf(codes.InvalidArgument, "bad filter config: %v", err)
+	}
+	if _, err := d.podTemplate(); err != nil {
+		return status.Errorf(codes.InvalidArgument, "%v", err)
 	}
 
-	opts := []grpc.DialOption{
-		grpc.WithInsecure(),
+	if err = d.resolveVolumeRefs(ctx); err != nil {
+		return status.Errorf(codes.Unavailable, "%v", err)
 	}
-	d.filterConn, err = grpc.Dial(d.filterPod.Status.PodIP+":"+fmt.Sprint(CsifFilterPortGRPC), opts...)
-	if err != nil {
-		d.Disconnect()
-		return fmt.Errorf("failed to connect to filter gRPC: %v", err)
+	if d.filterPod, err = d.cd.pods.getFilterPod(ctx, d); err != nil {
+		d.recordEvent(core.EventTypeWarning, eventFilterPodFailed, "%v", err)
+		return wrapStatus(err, "get filter pod failed")
+	}
+	d.recordEvent(core.EventTypeNormal, eventFilterPodReady, "served by filter pod %s/%s",
+		d.filterPod.pod.Namespace, d.filterPod.pod.Name)
+
+	var source string
+	if d.filterPod.local {
+		if source, err = d.resolveLocalPaths(filters); err != nil {
+			d.Disconnect(ctx)
+			return status.Errorf(codes.FailedPrecondition, "%v", err)
+		}
 	}
 
-	client := filter.NewFilterClient(d.filterConn)
-	resp, err := client.CreateTarget(context.Background(), &filter.CreateTargetRequest{})
+	client := filter.NewFilterClient(d.filterPod.conn)
+	createReq := &filter.CreateTargetRequest{
+		Filters:  filters,
+		VolumeId: d.volID,
+		Source:   source,
+	}
+	resp, err := client.CreateTarget(ctx, createReq)
+	if status.Code(err) == codes.AlreadyExists {
+		// filter pods are per node and the volume isn't attached, so the
+		// target is left by a stage whose node state was lost
+		glog.Warningf("volume %s: replacing stale filter target", d.volID)
+		if _, err = client.DeleteTarget(ctx, &filter.DeleteTargetRequest{VolumeId: d.volID}); err == nil {
+			resp, err = client.CreateTarget(ctx, createReq)
+		}
+	}
 	if err != nil {
-		d.Disconnect() // BUG: deleteFilterPod was skipped here somehow
+		d.recordEvent(core.EventTypeWarning, eventTargetExportFailed, "%v", err)
+		d.Disconnect(ctx) // BUG: deleteFilterPod was skipped here somehow
 		return fmt.Errorf("failed to create filter target: %v", err)
 	}
 	d.targetExists = true
 
 	resptgt := resp.GetTarget()
+	d.recordEvent(core.EventTypeNormal, eventTargetExported, "exported as %s", getTargetInfoStr(resptgt))
+	paths := resp.GetPaths()
+	if len(paths) == 0 {
+		paths = []*filter.TargetInfo{resptgt} // older filter image
+	}
 	d.targetConn = &lib_iscsi.Connector{
-		VolumeName: getTargetInfoStr(resptgt),
-		Targets: []lib_iscsi.TargetInfo{{
-			Iqn:    resptgt.GetIqn(),
-			Portal: resptgt.GetPortal(),
-			Port:   fmt.Sprint(resptgt.GetPort())}},
+		VolumeName:  getTargetInfoStr(resptgt),
 		Lun:         csifTGTDdefaultLUN,
-		Multipath:   false,
+		Multipath:   len(paths) > 1,
 		DoDiscovery: true,
 	}
-	d.dev, err = lib_iscsi.Connect(*d.targetConn)
+	for _, p := range paths {
+		d.targetConn.Targets = append(d.targetConn.Targets, lib_iscsi.TargetInfo{
+			Iqn:    p.GetIqn(),
+			Portal: p.GetPortal(),
+			Port:   fmt.Sprint(p.GetPort()),
+		})
+	}
+	start := time.Now()
+	_, span := startSpan(ctx, "iscsi connect", attribute.String("iscsi.iqn", resptgt.GetIqn()))
+	d.dev, err = d.cd.iscsi.Connect(*d.targetConn)
+	endSpan(span, err)
+	observeISCSI("connect", start, err)
 	if err != nil {
+		d.recordEvent(core.EventTypeWarning, eventISCSILoginFailed, "%v", err)
 		d.targetConn = nil
 		d.dev = ""
-		d.Disconnect()
+		d.Disconnect(ctx)
 		return status.Errorf(codes.Internal, "iscsi connect failed: %v", err)
 	}
-
-	// TODO:
-	//file := path.Join(req.GetTargetPath(), d.name+".json")
-	//err = iscsi_lib.PersistConnector(d.conn, file)
+	d.recordEvent(core.EventTypeNormal, eventAttached, "attached as %s on node %s", d.dev, d.cd.nodeID)
 	return nil
 }
 
-func (d *csifDisk) Disconnect() error {
+func (d *csifDisk) Disconnect(ctx context.Context) error {
 	if d.targetConn != nil {
+		if d.targetConn.Multipath && d.dev != "" {
+			if err := d.cd.iscsi.FlushMultipath(d.dev); err != nil {
+				return err
+			}
+		}
+		// all paths lead to the same target
 		t := &d.targetConn.Targets[0]
-		err := lib_iscsi.Disconnect(t.Iqn, []string{t.Portal + ":" + t.Port})
+		var portals []string
+		for _, p := range d.targetConn.Targets {
+			portals = append(portals, p.Portal+":"+p.Port)
+		}
+		start := time.Now()
+		_, span := startSpan(ctx, "iscsi disconnect", attribute.String("iscsi.iqn", t.Iqn))
+		err := d.cd.iscsi.Disconnect(t.Iqn, portals)
+		endSpan(span, err)
+		observeISCSI("disconnect", start, err)
 		if err != nil {
 			return fmt.Errorf("failed to disconnect server target: %v", err)
 		}
@@ -198,29 +397,67 @@ func (d *csifDisk) Disconnect() error {
 	}
 
 	if d.targetExists {
-		client := filter.NewFilterClient(d.filterConn)
-		if _, err := client.DeleteTarget(context.Background(), &filter.DeleteTargetRequest{}); err != nil {
+		client := filter.NewFilterClient(d.filterPod.conn)
+		if _, err := client.DeleteTarget(detachedContext(ctx), &filter.DeleteTargetRequest{
+			VolumeId: d.volID,
+		}); err != nil {
 			return fmt.Errorf("failed to delete filter target: %v", err)
 		}
 		d.targetExists = false
 	}
 
-	if d.filterConn != nil {
-		if err := d.filterConn.Close(); err != nil {
-			return fmt.Errorf("failed to close filter conn: %v", err)
-		}
-		d.filterConn = nil
-	}
-
 	if d.filterPod != nil {
-		if err := d.deleteFilterPod(); err != nil {
-			return fmt.Errorf("failed to delete filter pod: %v", err)
+		if err := d.cd.pods.putFilterPod(d.filterPod); err != nil {
+			return err
 		}
 		d.filterPod = nil
 	}
 	return nil
 }
 
+// Abnormal conditions reported by filters, empty if healthy
+func (d *csifDisk) GetCondition(ctx context.Context) (string, error) {
+	if d.filterPod == nil {
+		return "", nil
+	}
+	client := filter.NewFilterClient(d.filterPod.conn)
+	resp, err := client.GetFilterStatus(ctx, &filter.GetFilterStatusRequest{
+		VolumeId: d.volID,
+	})
+	if status.Code(err) == codes.NotFound {
+		return "", nil // no filters
+	}
+	if err != nil {
+		return "", err
+	}
+
+	var conds []string
+	for _, f := range resp.GetFilters() {
+		if f.GetCondition() != "" {
+			conds = append(conds, f.GetName()+": "+f.GetCondition())
+		}
+	}
+	return strings.Join(conds, "; "), nil
+}
+
+// I/O stats of the target, nil if the filter doesn't observe I/O
+func (d *csifDisk) GetTargetStats(ctx context.Context) (*filter.GetTargetStatsResponse, error) {
+	if d.filterPod == nil || !d.targetExists {
+		return nil, nil
+	}
+	client := filter.NewFilterClient(d.filterPod.conn)
+	resp, err := client.GetTargetStats(ctx, &filter.GetTargetStatsRequest{
+		VolumeId: d.volID,
+	})
+	switch status.Code(err) {
+	case codes.OK:
+		return resp, nil
+	case codes.FailedPrecondition, codes.Unimplemented:
+		return nil, nil // no filter chain or older filter image
+	}
+	return nil, err
+}
+
 func (d *csifDisk) GetDevPath() string {
 	if d.dev == "" {
 		panic("empty disk dev path")
@@ -250,65 +487,3 @@ func (disk *csifDisk) LoadContext(attr map[string]string) error {
 	}
 	return nil
 }
-
-func makeFilterPodConf(d *csifDisk) *core.Pod {
-	priv := true
-	return &core.Pod{
-		TypeMeta: metav1.TypeMeta{
-			Kind:       "Pod",
-			APIVersion: "v1",
-		},
-		ObjectMeta: metav1.ObjectMeta{
-			Name:      "csi-csif-fs-" + d.SourcePVC,
-			Namespace: "default",
-			//Labels: map[string]string{
-			//	"appxxx": "xxx",
-			//},
-		},
-		Spec: core.PodSpec{
-			Volumes: []core.Volume{
-				{
-					Name: "csi-csif-vol-src",
-					VolumeSource: core.VolumeSource{
-						PersistentVolumeClaim: &core.PersistentVolumeClaimVolumeSource{
-							ClaimName: d.SourcePVC,
-							ReadOnly:  false,
-						},
-					},
-				},
-			},
-			//DNSPolicy:   "ClusterFirstWithHostNet",
-			HostNetwork: false,
-			//Hostname:    "",
-			//NodeName: d.cd.nodeID,
-
-			Containers: []core.Container{
-				{
-					Name:            "filter",
-					Image:           "pooh64/csif-filter:latest",
-					ImagePullPolicy: core.PullAlways,
-					Args: []string{
-						"--endpoint=tcp://:" + fmt.Sprint(CsifFilterPortGRPC),
-						"--tgtport=" + fmt.Sprint(CsifFilterPortTGT),
-						"--tgtcontrol=" + fmt.Sprint(CsifFilterPortTGTControl),
-						"--v=5",
-					},
-					VolumeDevices: []core.VolumeDevice{
-						{
-							Name:       "csi-csif-vol-src",
-							DevicePath: CsifFilterBstoreSrc,
-						},
-					},
-					SecurityContext: &core.SecurityContext{
-						Privileged: &priv,
-						Capabilities: &core.Capabilities{
-							Add: []core.Capability{
-								"SYS_ADMIN",
-							},
-						},
-					},
-				},
-			},
-		},
-	}
-}
@@ -2,6 +2,12 @@ package csif
 
 import (
 	"fmt"
+	"os"
+	"os/signal"
+	"path"
+	"sync"
+	"syscall"
+	"time"
 
 	"github.com/container-storage-interface/spec/lib/go/csi"
 	"github.com/golang/glog"
@@ -11,6 +17,9 @@ import (
 
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/mount-utils"
+	"k8s.io/utils/exec"
 )
 
 const (
@@ -21,21 +30,109 @@ const (
 	TopologyKeyNode = "topology.csif.csi/node"
 )
 
+// Services run by the plugin:
+//
+//	controller: Controller service only, provisioning in the cluster, needs
+//	     neither host paths nor privileges
+//	node: Node service only, stages volumes on the node it runs on
+//	all: both in one process
+const (
+	DriverModeController = "controller"
+	DriverModeNode       = "node"
+	DriverModeAll        = "all"
+)
+
+// Optional driver settings
+type DriverOptions struct {
+	Mode              string // DriverModeAll if empty
+	MaxVolumesPerNode int64
+	FilterMode        string // FilterModePod if empty
+	WarmPoolSize      int
+	WarmPoolLocalDirs []string // host dirs of local PVs warm pods may bind
+	MetricsAddress    string
+	StateDir          string        // node state, empty disables persistence
+	ReconcileInterval time.Duration // 0 disables reconciler, needs StateDir
+
+	// controller replicas: Lease namespace, filter pod template one if
+	// empty, and host:port other replicas forward calls to
+	LeaderElection          bool
+	LeaderElectionNamespace string
+	LeaderAddress           string
+
+	// filter pod template: file or "namespace/name" ConfigMap
+	PodTemplateFile      string
+	PodTemplateConfigMap string
+}
+
 type csifDriver struct {
 	name              string
 	version           string
 	endpoint          string
 	nodeID            string
+	mode              string
 	maxVolumesPerNode int64
+	filterMode        string
+	warmPoolSize      int
+	warmPoolLocalDirs []string
+	metricsAddress    string
+	stateDir          string
+	reconcileInterval time.Duration
+
+	clientset   kubernetes.Interface
+	recorder    record.EventRecorder
+	iscsi       iscsiInitiator
+	mounter     *mount.SafeFormatAndMount
+	pods        filterPodManager
+	ns          *csifNodeServer
+	podTemplate *filterPodTemplate
 
-	clientset *kubernetes.Clientset
-	ns        *csifNodeServer
+	podsMu      sync.Mutex
+	filterPods  map[string]*filterPod    // see getFilterPod
+	podsPending map[string]chan struct{} // see lookupFilterPod
+	warmPool    *warmPool
+	leader      *controllerLeader // nil if single replica
 }
 
-func NewCsifDriver(name, nodeID, endpoint, version string, maxVolumesPerNode int64) (*csifDriver, error) {
-	if name == "" || endpoint == "" || nodeID == "" {
+func NewCsifDriver(name, nodeID, endpoint, version string, opts DriverOptions) (*csifDriver, error) {
+	if opts.Mode == "" {
+		opts.Mode = DriverModeAll
+	}
+	switch opts.Mode {
+	case DriverModeController, DriverModeNode, DriverModeAll:
+	default:
+		return nil, fmt.Errorf("unknown driver mode: %s", opts.Mode)
+	}
+	if name == "" || endpoint == "" || (nodeID == "" && opts.Mode != DriverModeController) {
 		return nil, fmt.Errorf("wrong args")
 	}
+	if opts.Mode == DriverModeController && (opts.StateDir != "" || opts.WarmPoolSize > 0 || opts.ReconcileInterval > 0) {
+		return nil, fmt.Errorf("state dir, warm pool and reconciler require %s mode", DriverModeNode)
+	}
+	if opts.FilterMode == "" {
+		opts.FilterMode = FilterModePod
+	}
+	switch opts.FilterMode {
+	case FilterModePod, FilterModeDaemon:
+	default:
+		return nil, fmt.Errorf("unknown filter mode: %s", opts.FilterMode)
+	}
+	if opts.WarmPoolSize < 0 || (opts.WarmPoolSize > 0 && opts.FilterMode != FilterModePod) {
+		return nil, fmt.Errorf("warm pool requires %s filter mode", FilterModePod)
+	}
+	if opts.WarmPoolSize > 0 && len(opts.WarmPoolLocalDirs) == 0 {
+		return nil, fmt.Errorf("warm pool requires local volume dirs")
+	}
+	for _, dir := range opts.WarmPoolLocalDirs {
+		if !path.IsAbs(dir) || path.Clean(dir) == "/" {
+			return nil, fmt.Errorf("bad warm pool local dir: %q", dir)
+		}
+	}
+	if opts.ReconcileInterval > 0 && opts.StateDir == "" {
+		return nil, fmt.Errorf("reconciler requires state dir")
+	}
+	if opts.LeaderElection && (opts.Mode == DriverModeNode || opts.LeaderAddress == "") {
+		return nil, fmt.Errorf("leader election requires controller mode and leader address")
+	}
 	if version == "" {
 		version = "notset"
 	}
@@ -44,21 +141,50 @@ func NewCsifDriver(name, nodeID, endpoint, version string, maxVolumesPerNode int
 	if err != nil {
 		return nil, fmt.Errorf("load k8s config: %v", err)
 	}
+	config.Wrap(wrapTracingTransport)
 	clientset, err := kubernetes.NewForConfig(config)
 	if err != nil {
 		return nil, fmt.Errorf("create k8s clientset: %v", err)
 	}
 
+	tmpl, err := loadFilterPodTemplate(clientset, opts.PodTemplateFile, opts.PodTemplateConfigMap)
+	if err != nil {
+		return nil, fmt.Errorf("bad filter pod template: %v", err)
+	}
+
 	cd := &csifDriver{
 		name:              name,
 		version:           version,
 		endpoint:          endpoint,
 		nodeID:            nodeID,
-		maxVolumesPerNode: maxVolumesPerNode,
+		mode:              opts.Mode,
+		maxVolumesPerNode: opts.MaxVolumesPerNode,
+		filterMode:        opts.FilterMode,
+		warmPoolSize:      opts.WarmPoolSize,
+		warmPoolLocalDirs: opts.WarmPoolLocalDirs,
+		metricsAddress:    opts.MetricsAddress,
+		stateDir:          opts.StateDir,
+		reconcileInterval: opts.ReconcileInterval,
 		clientset:         clientset,
+		recorder:          newEventRecorder(clientset, name, nodeID),
+		podTemplate:       tmpl,
+		filterPods:        map[string]*filterPod{},
+		podsPending:       map[string]chan struct{}{},
+	}
+	if cd.runsNode() {
+		cd.iscsi = libISCSI{}
+		cd.mounter = &mount.SafeFormatAndMount{
+			Interface: mount.New(""),
+			Exec:      exec.New(),
+		}
+		cd.pods = cd
+	}
+	if opts.LeaderElection {
+		cd.leader = newControllerLeader(cd, opts.LeaderElectionNamespace, opts.LeaderAddress)
 	}
 
-	glog.Infof("New Driver: name=%v version=%v", name, version)
+	glog.Infof("New Driver: name=%v version=%v mode=%v filter-mode=%v", name, version, cd.mode, cd.filterMode)
+	glog.V(4).Infof("filter pod template: %+v", tmpl)
 
 	return cd, nil
 }
@@ -79,11 +205,17 @@ func driverLogInterceptor(ctx context.Context, req interface{}, info *grpc.Unary
 	return resp, err
 }
 
-func (cd *csifDriver) Run() error {
-	cd.ns = newCsifNodeServer(cd)
-	cs := newCsifControllerServer(cd)
+// Empty mode is all, drivers in tests are built without NewCsifDriver
+func (cd *csifDriver) runsController() bool {
+	return cd.mode != DriverModeNode
+}
+
+func (cd *csifDriver) runsNode() bool {
+	return cd.mode != DriverModeController
+}
 
-	register := func(s *grpc.Server) {
+func (cd *csifDriver) registerServices(cs *csifControllerServer) func(*grpc.Server) {
+	return func(s *grpc.Server) {
 		csi.RegisterIdentityServer(s, cd)
 		if cs != nil {
 			csi.RegisterControllerServer(s, cs)
@@ -92,9 +224,71 @@ func (cd *csifDriver) Run() error {
 			csi.RegisterNodeServer(s, cd.ns)
 		}
 	}
+}
+
+func (cd *csifDriver) Run() error {
+	var cs *csifControllerServer
+	if cd.runsController() {
+		cs = newCsifControllerServer(cd)
+	}
+	if cd.runsNode() {
+		cd.ns = newCsifNodeServer(cd)
+	}
+
+	if cd.stateDir != "" {
+		if err := cd.ns.restoreDisks(); err != nil {
+			return fmt.Errorf("failed to restore node state: %v", err)
+		}
+	}
+	if cd.metricsAddress != "" {
+		serveMetrics(cd.metricsAddress, metricsRegistry)
+	}
+	if cd.warmPoolSize > 0 {
+		cd.warmPool = newWarmPool(cd, cd.warmPoolSize, cd.warmPoolLocalDirs)
+		go cd.warmPool.run()
+	}
+	if cd.reconcileInterval > 0 {
+		go newReconciler(cd, cd.reconcileInterval).run()
+	}
+
+	interceptors := []grpc.UnaryServerInterceptor{tracingInterceptor, metricsInterceptor, driverLogInterceptor}
+	if cd.leader == nil {
+		server := NewNbServer()
+		server.Start(cd.endpoint, cd.registerServices(cs), interceptors...)
+		server.Wait()
+		return nil
+	}
+	return cd.runReplica(cs, interceptors)
+}
+
+// On termination calls in flight complete before the lease is released, so
+// the next leader starts from their results
+func (cd *csifDriver) runReplica(cs *csifControllerServer, interceptors []grpc.UnaryServerInterceptor) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	elected := make(chan struct{})
+	go func() {
+		cd.leader.run(ctx)
+		close(elected)
+	}()
 
 	server := NewNbServer()
-	server.Start(cd.endpoint, register, driverLogInterceptor)
+	server.Start(cd.endpoint, cd.registerServices(cs), append(interceptors, cd.leader.interceptor(true))...)
+	peer := NewNbServer()
+	peer.Start("tcp://"+cd.leader.identity, func(s *grpc.Server) {
+		csi.RegisterControllerServer(s, cs)
+	}, append(interceptors, cd.leader.interceptor(false))...)
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGTERM, syscall.SIGINT)
+	go func() {
+		glog.Infof("%v: stopping", <-sig)
+		server.Stop()
+		peer.Stop()
+	}()
+
 	server.Wait()
+	peer.Wait()
+	cancel()
+	<-elected
 	return nil
 }
@@ -0,0 +1,99 @@
+package csif
+
+import (
+	"fmt"
+
+	"github.com/golang/glog"
+	"golang.org/x/net/context"
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcore "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+// Events explain csif steps in `kubectl describe` of the consuming PVC and
+// PV and of the filter pod. Repeated events are aggregated by the recorder,
+// flapping ones are dropped by its per object rate limit
+
+const (
+	eventBurst = 10
+	eventQPS   = 1. / 30
+
+	eventFilterPodReady     = "FilterPodReady"
+	eventFilterPodFailed    = "FilterPodFailed"
+	eventTargetExported     = "TargetExported"
+	eventTargetExportFailed = "TargetExportFailed"
+	eventISCSILoginFailed   = "ISCSILoginFailed"
+	eventAttached           = "Attached"
+	eventMountFailed        = "FormatAndMountFailed"
+	eventVolumeAbnormal     = "VolumeAbnormal"
+)
+
+func newEventRecorder(clientset kubernetes.Interface, component, host string) record.EventRecorder {
+	b := record.NewBroadcasterWithCorrelatorOptions(record.CorrelatorOptions{
+		BurstSize: eventBurst,
+		QPS:       eventQPS,
+	})
+	b.StartLogging(glog.V(4).Infof)
+	b.StartRecordingToSink(&typedcore.EventSinkImpl{Interface: clientset.CoreV1().Events("")})
+	return b.NewRecorder(scheme.Scheme, core.EventSource{Component: component, Host: host})
+}
+
+// PV of the volume, nil if there is none (e.g. staged by csi-sanity)
+func (cd *csifDriver) findPV(ctx context.Context, volID string) (*core.PersistentVolume, error) {
+	pvs, err := cd.clientset.CoreV1().PersistentVolumes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list PVs: %v", err)
+	}
+	for i := range pvs.Items {
+		pv := &pvs.Items[i]
+		if src := pv.Spec.CSI; src != nil && src.Driver == cd.name && src.VolumeHandle == volID {
+			return pv, nil
+		}
+	}
+	return nil, nil
+}
+
+// Find PV and its claim to record events on
+func (d *csifDisk) resolveVolumeRefs(ctx context.Context) error {
+	pv, err := d.cd.findPV(ctx, d.volID)
+	if err != nil || pv == nil {
+		return err
+	}
+	d.pvRef = &core.ObjectReference{
+		Kind:       "PersistentVolume",
+		APIVersion: "v1",
+		Name:       pv.Name,
+		UID:        pv.UID,
+	}
+	if ref := pv.Spec.ClaimRef; ref != nil {
+		d.pvcRef = &core.ObjectReference{
+			Kind:       "PersistentVolumeClaim",
+			APIVersion: "v1",
+			Namespace:  ref.Namespace,
+			Name:       ref.Name,
+			UID:        ref.UID,
+		}
+	}
+	return nil
+}
+
+// Record event on PVC, PV and filter pod of the disk
+func (d *csifDisk) recordEvent(eventtype, reason, messageFmt string, args ...interface{}) {
+	rec := d.cd.recorder
+	if rec == nil {
+		return
+	}
+	msg := fmt.Sprintf(messageFmt, args...)
+	if d.pvcRef != nil {
+		rec.Event(d.pvcRef, eventtype, reason, msg)
+	}
+	if d.pvRef != nil {
+		rec.Event(d.pvRef, eventtype, reason, msg)
+	}
+	if d.filterPod != nil && d.filterPod.pod != nil {
+		rec.Eventf(d.filterPod.pod, eventtype, reason, "volume %s: %s", d.volID, msg)
+	}
+}
@@ -0,0 +1,399 @@
+package csif
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+
+	lib_iscsi "github.com/pooh64/csi-lib-iscsi/iscsi"
+	"github.com/pooh64/csif-driver/pkg/filter"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/mount-utils"
+	utilexec "k8s.io/utils/exec"
+	testingexec "k8s.io/utils/exec/testing"
+)
+
+// iSCSI initiator, devices are named after IQNs
+type fakeISCSI struct {
+	mu          sync.Mutex
+	sessions    map[string]bool // iqn
+	connectErr  error
+	disconnects int
+	portals     []string // of the last logout
+	flushed     []string // multipath devices
+}
+
+func newFakeISCSI() *fakeISCSI {
+	return &fakeISCSI{sessions: map[string]bool{}}
+}
+
+func (f *fakeISCSI) Connect(c lib_iscsi.Connector) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.connectErr != nil {
+		return "", f.connectErr
+	}
+	iqn := c.Targets[0].Iqn
+	f.sessions[iqn] = true
+	return "/dev/fake-" + iqn, nil
+}
+
+func (f *fakeISCSI) Disconnect(iqn string, portals []string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.disconnects++
+	f.portals = portals
+	delete(f.sessions, iqn)
+	return nil
+}
+
+func (f *fakeISCSI) FlushMultipath(dev string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.flushed = append(f.flushed, dev)
+	return nil
+}
+
+func (f *fakeISCSI) GetSessions() (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	out := ""
+	for iqn := range f.sessions {
+		out += fmt.Sprintf("tcp: [1] 10.0.0.1:9821,1 %s (non-flash)\n", iqn)
+	}
+	return out, nil
+}
+
+// Filter API with targets only
+type fakeFilter struct {
+	filter.UnimplementedFilterServer
+
+	mu        sync.Mutex
+	targets   map[string]bool
+	nextID    int
+	createErr error
+	deleteErr error
+	portals   []string // additional, paths are returned if set
+}
+
+func (f *fakeFilter) CreateTarget(ctx context.Context, req *filter.CreateTargetRequest) (*filter.CreateTargetResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.createErr != nil {
+		return nil, f.createErr
+	}
+	if f.targets[req.GetVolumeId()] {
+		return nil, status.Errorf(codes.AlreadyExists, "target already exists: %q", req.GetVolumeId())
+	}
+	f.targets[req.GetVolumeId()] = true
+	f.nextID++
+	resp := &filter.CreateTargetResponse{
+		Target: &filter.TargetInfo{
+			Portal: "10.0.0.1",
+			Port:   CsifFilterPortTGT,
+			Iqn:    fmt.Sprintf("%s:%d", CsifFilterIQNPrefix, f.nextID),
+		},
+	}
+	if len(f.portals) != 0 {
+		resp.Paths = append(resp.Paths, resp.Target)
+		for _, portal := range f.portals {
+			resp.Paths = append(resp.Paths, &filter.TargetInfo{
+				Portal: portal,
+				Port:   CsifFilterPortTGT,
+				Iqn:    resp.Target.GetIqn(),
+			})
+		}
+	}
+	return resp, nil
+}
+
+func (f *fakeFilter) DeleteTarget(ctx context.Context, req *filter.DeleteTargetRequest) (*filter.DeleteTargetResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.deleteErr != nil {
+		return nil, f.deleteErr
+	}
+	if !f.targets[req.GetVolumeId()] {
+		return nil, status.Errorf(codes.NotFound, "target doesn't exist: %q", req.GetVolumeId())
+	}
+	delete(f.targets, req.GetVolumeId())
+	return &filter.DeleteTargetResponse{}, nil
+}
+
+func (f *fakeFilter) checkTarget(volID string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if !f.targets[volID] {
+		return status.Errorf(codes.NotFound, "target doesn't exist: %q", volID)
+	}
+	return nil
+}
+
+func (f *fakeFilter) GetFilterStatus(ctx context.Context, req *filter.GetFilterStatusRequest) (*filter.GetFilterStatusResponse, error) {
+	if err := f.checkTarget(req.GetVolumeId()); err != nil {
+		return nil, err
+	}
+	return &filter.GetFilterStatusResponse{}, nil
+}
+
+func (f *fakeFilter) GetTargetStats(ctx context.Context, req *filter.GetTargetStatsRequest) (*filter.GetTargetStatsResponse, error) {
+	if err := f.checkTarget(req.GetVolumeId()); err != nil {
+		return nil, err
+	}
+	return &filter.GetTargetStatsResponse{}, nil
+}
+
+func (f *fakeFilter) numTargets() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.targets)
+}
+
+// Single filter pod for all disks, served in-process
+type fakeFilterPods struct {
+	filter *fakeFilter
+	conn   *grpc.ClientConn
+	getErr error
+
+	mu   sync.Mutex
+	refs int
+}
+
+func newFakeFilterPods(t *testing.T) *fakeFilterPods {
+	lis := bufconn.Listen(1 << 20)
+	ff := &fakeFilter{targets: map[string]bool{}}
+	s := grpc.NewServer()
+	filter.RegisterFilterServer(s, ff)
+	go s.Serve(lis)
+	t.Cleanup(s.Stop)
+
+	dialer := func(ctx context.Context, _ string) (net.Conn, error) {
+		return lis.Dial()
+	}
+	conn, err := grpc.Dial("bufconn", grpc.WithInsecure(), grpc.WithContextDialer(dialer))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return &fakeFilterPods{filter: ff, conn: conn}
+}
+
+func (f *fakeFilterPods) getFilterPod(ctx context.Context, d *csifDisk) (*filterPod, error) {
+	if f.getErr != nil {
+		return nil, f.getErr
+	}
+	f.mu.Lock()
+	f.refs++
+	f.mu.Unlock()
+	pod := &core.Pod{ObjectMeta: metav1.ObjectMeta{Name: "csi-csif-fs-fake", Namespace: "default"}}
+	return &filterPod{key: pod.Name, pod: pod, conn: f.conn, refs: 1}, nil
+}
+
+func (f *fakeFilterPods) putFilterPod(fp *filterPod) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.refs--
+	return nil
+}
+
+func (f *fakeFilterPods) numRefs() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.refs
+}
+
+type testDriver struct {
+	cd       *csifDriver
+	ns       *csifNodeServer
+	iscsi    *fakeISCSI
+	pods     *fakeFilterPods
+	mounter  *mount.FakeMounter
+	exec     *fakeExec
+	recorder *record.FakeRecorder
+}
+
+// Node driver with fakes only, state is kept in a temp dir
+func newTestDriver(t *testing.T, objects ...runtime.Object) *testDriver {
+	td := &testDriver{
+		iscsi:    newFakeISCSI(),
+		pods:     newFakeFilterPods(t),
+		mounter:  mount.NewFakeMounter(nil),
+		exec:     &fakeExec{},
+		recorder: record.NewFakeRecorder(100),
+	}
+	td.cd = &csifDriver{
+		name:        testDriverName,
+		nodeID:      "node-0",
+		filterMode:  FilterModePod,
+		stateDir:    t.TempDir(),
+		clientset:   fake.NewSimpleClientset(objects...),
+		recorder:    td.recorder,
+		iscsi:       td.iscsi,
+		mounter:     &mount.SafeFormatAndMount{Interface: td.mounter, Exec: &td.exec.FakeExec},
+		pods:        td.pods,
+		podTemplate: defaultFilterPodTemplate(),
+		filterPods:  map[string]*filterPod{},
+		podsPending: map[string]chan struct{}{},
+	}
+	td.ns = newCsifNodeServer(td.cd)
+	td.cd.ns = td.ns
+	return td
+}
+
+// Scripted commands, unexpected ones panic
+type fakeExec struct {
+	testingexec.FakeExec
+	calls []string // command lines as run
+}
+
+func (f *fakeExec) expect(cmd string, out string, err error) {
+	f.CommandScript = append(f.CommandScript, func(name string, args ...string) utilexec.Cmd {
+		if name != cmd {
+			panic(fmt.Sprintf("unexpected exec %s %v, expected %s", name, args, cmd))
+		}
+		f.calls = append(f.calls, strings.Join(append([]string{name}, args...), " "))
+		fc := &testingexec.FakeCmd{
+			CombinedOutputScript: []testingexec.FakeAction{
+				func() ([]byte, []byte, error) { return []byte(out), nil, err },
+			},
+		}
+		return testingexec.InitFakeCmd(fc, name, args...)
+	})
+}
+
+func (f *fakeExec) done(t *testing.T) {
+	t.Helper()
+	if f.CommandCalls != len(f.CommandScript) {
+		t.Errorf("%d of %d scripted commands run: %v", f.CommandCalls, len(f.CommandScript), f.calls)
+	}
+}
+
+func (td *testDriver) events() []string {
+	var out []string
+	for {
+		select {
+		case ev := <-td.recorder.Events:
+			out = append(out, ev)
+		default:
+			return out
+		}
+	}
+}
+
+// Block device losing unflushed writes on crash. Writes since checkpoint are
+// logged to replay crashes at any point, see crashAt
+type volatileDev struct {
+	data    []byte
+	durable []byte
+	base    []byte // durable at checkpoint
+	log     []volatileWrite
+}
+
+type volatileWrite struct {
+	off   int64
+	data  []byte
+	flush bool
+}
+
+func newVolatileDev(size int) *volatileDev {
+	return &volatileDev{data: make([]byte, size), durable: make([]byte, size)}
+}
+
+func (d *volatileDev) ReadAt(p []byte, off int64) (int, error) {
+	return copy(p, d.data[off:]), nil
+}
+
+func (d *volatileDev) WriteAt(p []byte, off int64) (int, error) {
+	if d.base != nil {
+		d.log = append(d.log, volatileWrite{off: off, data: append([]byte{}, p...)})
+	}
+	return copy(d.data[off:], p), nil
+}
+
+func (d *volatileDev) Size() int64                  { return int64(len(d.data)) }
+func (d *volatileDev) Trim(off, length int64) error { return nil }
+func (d *volatileDev) Close() error                 { return nil }
+
+func (d *volatileDev) Flush() error {
+	if d.base != nil {
+		d.log = append(d.log, volatileWrite{flush: true})
+	}
+	copy(d.durable, d.data)
+	return nil
+}
+
+// Drop unflushed writes
+func (d *volatileDev) crash() {
+	copy(d.data, d.durable)
+}
+
+// Flushed state to replay crashes from
+func (d *volatileDev) checkpoint() {
+	d.Flush()
+	d.base = append([]byte{}, d.durable...)
+	d.log = nil
+}
+
+// Device after crash following n logged ops, writes not flushed by then
+// land if keep returns true for their index among them
+func (d *volatileDev) crashAt(n int, keep func(i int) bool) *volatileDev {
+	out := newVolatileDev(len(d.base))
+	copy(out.durable, d.base)
+	var pending []volatileWrite
+	for _, w := range d.log[:n] {
+		if w.flush {
+			for _, pw := range pending {
+				copy(out.durable[pw.off:], pw.data)
+			}
+			pending = nil
+			continue
+		}
+		pending = append(pending, w)
+	}
+	for i, pw := range pending {
+		if keep(i) {
+			copy(out.durable[pw.off:], pw.data)
+		}
+	}
+	copy(out.data, out.durable)
+	return out
+}
+
+// Number of writes not flushed after n logged ops
+func (d *volatileDev) pendingAt(n int) int {
+	pending := 0
+	for _, w := range d.log[:n] {
+		if w.flush {
+			pending = 0
+		} else {
+			pending++
+		}
+	}
+	return pending
+}
+
+// Every crash after checkpoint: at each op, with each subset of unflushed
+// writes landed
+func (d *volatileDev) forEachCrash(fn func(dev *volatileDev)) {
+	for n := 0; n <= len(d.log); n++ {
+		pending := d.pendingAt(n)
+		for mask := 0; mask < 1<<pending; mask++ {
+			fn(d.crashAt(n, func(i int) bool { return mask&(1<<i) != 0 }))
+		}
+	}
+}
+
+func (d *volatileDev) block(src int) []byte {
+	return d.durable[src*testCacheBlock : (src+1)*testCacheBlock]
+}
@@ -0,0 +1,249 @@
+package csif
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/pooh64/csif-driver/pkg/filter"
+	"golang.org/x/sys/unix"
+	"google.golang.org/protobuf/proto"
+)
+
+// Fault injection for chaos testing, rules are managed via Filter gRPC API
+
+type faultFilter struct {
+	lower blockDev
+
+	mu     sync.Mutex
+	rules  []*filter.FaultRule
+	nextID uint64
+	rnd    *rand.Rand
+
+	errors  uint64
+	delayed uint64
+	delayNs uint64
+	dropped uint64
+	torn    uint64
+}
+
+func newFaultFilter(lower blockDev, params map[string]string) (blockFilter, error) {
+	return &faultFilter{
+		lower:  lower,
+		nextID: 1,
+		rnd:    rand.New(rand.NewSource(time.Now().UnixNano())),
+	}, nil
+}
+
+func validateFaultRule(r *filter.FaultRule) error {
+	if r.GetProbability() < 0 || r.GetProbability() > 1 {
+		return fmt.Errorf("probability must be in [0, 1]")
+	}
+	switch r.GetAction() {
+	case filter.FaultRule_DROP_WRITE, filter.FaultRule_TORN_WRITE:
+		if r.GetOp() == filter.FaultRule_READ {
+			return fmt.Errorf("%v is write-only action", r.GetAction())
+		}
+	case filter.FaultRule_ERROR, filter.FaultRule_LATENCY:
+	default:
+		return fmt.Errorf("unknown action: %v", r.GetAction())
+	}
+	if r.GetDurationMs() < 0 {
+		return fmt.Errorf("negative duration")
+	}
+	return nil
+}
+
+func (f *faultFilter) AddRule(rule *filter.FaultRule) (uint64, error) {
+	if err := validateFaultRule(rule); err != nil {
+		return 0, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	r := proto.Clone(rule).(*filter.FaultRule)
+	r.Id = f.nextID
+	if r.StartTimeMs == 0 {
+		r.StartTimeMs = time.Now().UnixNano() / int64(time.Millisecond)
+	}
+	f.nextID++
+	f.rules = append(f.rules, r)
+	glog.V(4).Infof("fault: rule added: %v", r)
+	return r.Id, nil
+}
+
+func (f *faultFilter) RemoveRule(id uint64) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if id == 0 {
+		f.rules = nil
+		return nil
+	}
+	for i, r := range f.rules {
+		if r.Id == id {
+			f.rules = append(f.rules[:i], f.rules[i+1:]...)
+			return nil
+		}
+	}
+	return fmt.Errorf("no rule with id=%v", id)
+}
+
+func (f *faultFilter) ListRules() []*filter.FaultRule {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var rules []*filter.FaultRule
+	for _, r := range f.rules {
+		rules = append(rules, proto.Clone(r).(*filter.FaultRule))
+	}
+	return rules
+}
+
+func (f *faultFilter) ruleMatches(r *filter.FaultRule, op filter.FaultRule_Op, off, length int64, now int64) bool {
+	if r.Op != filter.FaultRule_ANY && r.Op != op {
+		return false
+	}
+	if now < r.StartTimeMs || (r.DurationMs != 0 && now >= r.StartTimeMs+r.DurationMs) {
+		return false
+	}
+	start := int64(r.LbaStart) * sectorSize
+	if off+length <= start {
+		return false
+	}
+	if r.LbaCount != 0 && off >= start+int64(r.LbaCount)*sectorSize {
+		return false
+	}
+	return r.Probability == 0 || f.rnd.Float64() < r.Probability
+}
+
+func (f *faultFilter) latency(r *filter.FaultRule) time.Duration {
+	mean := float64(r.LatencyUs)
+	jitter := float64(r.LatencyJitterUs)
+	var us float64
+
+	switch r.LatencyDist {
+	case filter.FaultRule_UNIFORM:
+		us = mean - jitter + 2*jitter*f.rnd.Float64()
+	case filter.FaultRule_NORMAL:
+		us = mean + jitter*f.rnd.NormFloat64()
+	case filter.FaultRule_EXPONENTIAL:
+		us = mean * f.rnd.ExpFloat64()
+	default:
+		us = mean
+	}
+	if us < 0 {
+		us = 0
+	}
+	return time.Duration(us * float64(time.Microsecond))
+}
+
+// Evaluate rules: latencies are summed, first non-latency rule is the outcome
+func (f *faultFilter) evaluate(op filter.FaultRule_Op, off, length int64) (time.Duration, *filter.FaultRule) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	now := time.Now().UnixNano() / int64(time.Millisecond)
+	var delay time.Duration
+	var outcome *filter.FaultRule
+
+	for _, r := range f.rules {
+		if !f.ruleMatches(r, op, off, length, now) {
+			continue
+		}
+		if r.Action == filter.FaultRule_LATENCY {
+			delay += f.latency(r)
+		} else if outcome == nil {
+			outcome = r
+		}
+	}
+
+	if delay != 0 {
+		f.delayed++
+		f.delayNs += uint64(delay.Nanoseconds())
+	}
+	if outcome != nil {
+		switch outcome.Action {
+		case filter.FaultRule_ERROR:
+			f.errors++
+		case filter.FaultRule_DROP_WRITE:
+			f.dropped++
+		case filter.FaultRule_TORN_WRITE:
+			f.torn++
+		}
+	}
+	return delay, outcome
+}
+
+func (f *faultFilter) ReadAt(p []byte, off int64) (int, error) {
+	delay, outcome := f.evaluate(filter.FaultRule_READ, off, int64(len(p)))
+	time.Sleep(delay)
+	if outcome != nil && outcome.Action == filter.FaultRule_ERROR {
+		return 0, fmt.Errorf("injected read error (rule %v): %w", outcome.Id, unix.EIO)
+	}
+	return f.lower.ReadAt(p, off)
+}
+
+func (f *faultFilter) WriteAt(p []byte, off int64) (int, error) {
+	delay, outcome := f.evaluate(filter.FaultRule_WRITE, off, int64(len(p)))
+	time.Sleep(delay)
+	if outcome == nil {
+		return f.lower.WriteAt(p, off)
+	}
+
+	switch outcome.Action {
+	case filter.FaultRule_DROP_WRITE:
+		return len(p), nil
+	case filter.FaultRule_TORN_WRITE:
+		f.mu.Lock()
+		n := f.rnd.Intn(len(p)/sectorSize+1) * sectorSize
+		f.mu.Unlock()
+		if n > len(p) {
+			n = len(p)
+		}
+		if _, err := f.lower.WriteAt(p[:n], off); err != nil {
+			return 0, err
+		}
+		return n, fmt.Errorf("injected torn write: %v of %v bytes (rule %v): %w", n, len(p), outcome.Id, unix.EIO)
+	}
+	return 0, fmt.Errorf("injected write error (rule %v): %w", outcome.Id, unix.EIO)
+}
+
+func (f *faultFilter) Size() int64 {
+	return f.lower.Size()
+}
+
+func (f *faultFilter) Flush() error {
+	return f.lower.Flush()
+}
+
+func (f *faultFilter) Trim(off, length int64) error {
+	return f.lower.Trim(off, length)
+}
+
+func (f *faultFilter) Close() error {
+	return nil
+}
+
+func (f *faultFilter) Name() string {
+	return "fault"
+}
+
+func (f *faultFilter) Status() *filter.FilterStatus {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return &filter.FilterStatus{
+		Name: f.Name(),
+		Counters: map[string]uint64{
+			"rules":   uint64(len(f.rules)),
+			"errors":  f.errors,
+			"delayed": f.delayed,
+			"delayNs": f.delayNs,
+			"dropped": f.dropped,
+			"torn":    f.torn,
+		},
+	}
+}
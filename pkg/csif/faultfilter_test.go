@@ -0,0 +1,236 @@
+package csif
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/pooh64/csif-driver/pkg/filter"
+	"golang.org/x/sys/unix"
+)
+
+func openTestFault(t *testing.T, lower blockDev, rules ...*filter.FaultRule) *faultFilter {
+	t.Helper()
+	f, err := newFaultFilter(lower, nil)
+	if err != nil {
+		t.Fatalf("newFaultFilter: %v", err)
+	}
+	ff := f.(*faultFilter)
+	ff.rnd = rand.New(rand.NewSource(1))
+	for _, r := range rules {
+		if _, err := ff.AddRule(r); err != nil {
+			t.Fatalf("AddRule: %v", err)
+		}
+	}
+	return ff
+}
+
+func TestFaultFilterRuleMatch(t *testing.T) {
+	now := time.Now().UnixNano() / int64(time.Millisecond)
+	for _, tc := range []struct {
+		name   string
+		rule   *filter.FaultRule
+		op     filter.FaultRule_Op
+		off    int64
+		length int64
+		match  bool
+	}{
+		{"any op", &filter.FaultRule{}, filter.FaultRule_WRITE, 0, 512, true},
+		{"same op", &filter.FaultRule{Op: filter.FaultRule_READ}, filter.FaultRule_READ, 0, 512, true},
+		{"other op", &filter.FaultRule{Op: filter.FaultRule_READ}, filter.FaultRule_WRITE, 0, 512, false},
+		{"before range", &filter.FaultRule{LbaStart: 8, LbaCount: 8}, filter.FaultRule_READ, 0, 4096, false},
+		{"range start", &filter.FaultRule{LbaStart: 8, LbaCount: 8}, filter.FaultRule_READ, 512, 4096, true},
+		{"range end", &filter.FaultRule{LbaStart: 8, LbaCount: 8}, filter.FaultRule_READ, 15 * 512, 512, true},
+		{"after range", &filter.FaultRule{LbaStart: 8, LbaCount: 8}, filter.FaultRule_READ, 16 * 512, 4096, false},
+		{"till the end", &filter.FaultRule{LbaStart: 8}, filter.FaultRule_READ, 1 << 30, 512, true},
+		{"not started", &filter.FaultRule{StartTimeMs: now + 60000}, filter.FaultRule_READ, 0, 512, false},
+		{"in window", &filter.FaultRule{StartTimeMs: now - 1000, DurationMs: 60000}, filter.FaultRule_READ, 0, 512, true},
+		{"expired", &filter.FaultRule{StartTimeMs: now - 2000, DurationMs: 1000}, filter.FaultRule_READ, 0, 512, false},
+		{"never", &filter.FaultRule{Probability: math.SmallestNonzeroFloat64}, filter.FaultRule_READ, 0, 512, false},
+	} {
+		f := openTestFault(t, newVolatileDev(1*mib), tc.rule)
+		_, outcome := f.evaluate(tc.op, tc.off, tc.length)
+		if match := outcome != nil; match != tc.match {
+			t.Errorf("%s: match %v, expected %v", tc.name, match, tc.match)
+		}
+	}
+}
+
+func TestFaultFilterProbability(t *testing.T) {
+	for _, tc := range []struct {
+		prob     float64
+		min, max int
+	}{
+		{0, 1000, 1000},
+		{1, 1000, 1000},
+		{0.25, 200, 300},
+		{0.75, 700, 800},
+	} {
+		f := openTestFault(t, newVolatileDev(1*mib), &filter.FaultRule{Probability: tc.prob})
+		hits := 0
+		for i := 0; i < 1000; i++ {
+			if _, outcome := f.evaluate(filter.FaultRule_READ, 0, 512); outcome != nil {
+				hits++
+			}
+		}
+		if hits < tc.min || hits > tc.max {
+			t.Errorf("probability %v: %d hits of 1000", tc.prob, hits)
+		}
+		if n := f.Status().GetCounters()["errors"]; n != uint64(hits) {
+			t.Errorf("probability %v: %d errors counted, %d hits", tc.prob, n, hits)
+		}
+	}
+}
+
+func TestFaultFilterLatency(t *testing.T) {
+	const n = 10000
+	for _, tc := range []struct {
+		dist     filter.FaultRule_LatencyDist
+		min, max time.Duration
+		mean     time.Duration
+	}{
+		{filter.FaultRule_FIXED, 1000 * time.Microsecond, 1000 * time.Microsecond, 1000 * time.Microsecond},
+		{filter.FaultRule_UNIFORM, 800 * time.Microsecond, 1200 * time.Microsecond, 1000 * time.Microsecond},
+		{filter.FaultRule_NORMAL, 0, time.Second, 1000 * time.Microsecond},
+		{filter.FaultRule_EXPONENTIAL, 0, time.Second, 1000 * time.Microsecond},
+	} {
+		r := &filter.FaultRule{
+			Action:          filter.FaultRule_LATENCY,
+			LatencyDist:     tc.dist,
+			LatencyUs:       1000,
+			LatencyJitterUs: 200,
+		}
+		f := openTestFault(t, newVolatileDev(1*mib))
+		var sum time.Duration
+		for i := 0; i < n; i++ {
+			d := f.latency(r)
+			if d < tc.min || d > tc.max {
+				t.Errorf("%v: latency %v out of [%v, %v]", tc.dist, d, tc.min, tc.max)
+				break
+			}
+			sum += d
+		}
+		if mean := sum / n; mean < tc.mean*95/100 || mean > tc.mean*105/100 {
+			t.Errorf("%v: mean latency %v, expected %v", tc.dist, mean, tc.mean)
+		}
+	}
+
+	// negative samples are cut
+	f := openTestFault(t, newVolatileDev(1*mib))
+	r := &filter.FaultRule{LatencyDist: filter.FaultRule_NORMAL, LatencyUs: 10, LatencyJitterUs: 1000}
+	for i := 0; i < 1000; i++ {
+		if d := f.latency(r); d < 0 {
+			t.Fatalf("negative latency %v", d)
+		}
+	}
+
+	// latencies of matching rules are summed
+	f = openTestFault(t, newVolatileDev(1*mib),
+		&filter.FaultRule{Action: filter.FaultRule_LATENCY, LatencyUs: 100},
+		&filter.FaultRule{Action: filter.FaultRule_LATENCY, LatencyUs: 200},
+		&filter.FaultRule{Action: filter.FaultRule_LATENCY, Op: filter.FaultRule_WRITE, LatencyUs: 400})
+	if delay, outcome := f.evaluate(filter.FaultRule_READ, 0, 512); delay != 300*time.Microsecond || outcome != nil {
+		t.Errorf("read delayed by %v, outcome %v", delay, outcome)
+	}
+}
+
+func TestFaultFilterError(t *testing.T) {
+	lower := newVolatileDev(1 * mib)
+	f := openTestFault(t, lower, &filter.FaultRule{Op: filter.FaultRule_READ, LbaCount: 8})
+
+	if _, err := f.ReadAt(make([]byte, 512), 0); !errors.Is(err, unix.EIO) {
+		t.Errorf("read of faulty range: %v", err)
+	}
+	if _, err := f.ReadAt(make([]byte, 512), 4096); err != nil {
+		t.Errorf("read out of faulty range: %v", err)
+	}
+	if _, err := f.WriteAt(testBlockData(0), 0); err != nil {
+		t.Errorf("write to read-faulty range: %v", err)
+	}
+	if !bytes.Equal(lower.data[:testCacheBlock], testBlockData(0)) {
+		t.Errorf("write didn't reach lower")
+	}
+}
+
+func TestFaultFilterDropWrite(t *testing.T) {
+	lower := newVolatileDev(1 * mib)
+	copy(lower.data, testBlockData(0))
+	f := openTestFault(t, lower, &filter.FaultRule{Action: filter.FaultRule_DROP_WRITE, LbaCount: 8})
+
+	if n, err := f.WriteAt(testBlockData(1), 0); n != testCacheBlock || err != nil {
+		t.Errorf("dropped write: %d, %v", n, err)
+	}
+	if !bytes.Equal(lower.data[:testCacheBlock], testBlockData(0)) {
+		t.Errorf("dropped write reached lower")
+	}
+	writeDevBlock(t, f, 1, testBlockData(1))
+	if !bytes.Equal(lower.data[testCacheBlock:2*testCacheBlock], testBlockData(1)) {
+		t.Errorf("write out of range is dropped")
+	}
+	if n := f.Status().GetCounters()["dropped"]; n != 1 {
+		t.Errorf("%d dropped writes", n)
+	}
+}
+
+func TestFaultFilterTornWrite(t *testing.T) {
+	f := openTestFault(t, nil, &filter.FaultRule{Action: filter.FaultRule_TORN_WRITE})
+	lens := map[int]bool{}
+	for i := 0; i < 100; i++ {
+		lower := newVolatileDev(1 * mib)
+		copy(lower.data, testBlockData(0))
+		f.lower = lower
+
+		n, err := f.WriteAt(testBlockData(1), 0)
+		if !errors.Is(err, unix.EIO) {
+			t.Fatalf("torn write: %v", err)
+		}
+		if n%sectorSize != 0 || n < 0 || n > testCacheBlock {
+			t.Fatalf("torn write of %d bytes", n)
+		}
+		if !bytes.Equal(lower.data[:n], testBlockData(1)[:n]) ||
+			!bytes.Equal(lower.data[n:testCacheBlock], testBlockData(0)[n:]) {
+			t.Fatalf("lower doesn't have exactly %d bytes written", n)
+		}
+		lens[n] = true
+	}
+	if len(lens) < 2 {
+		t.Errorf("torn writes of constant length %v", lens)
+	}
+	if n := f.Status().GetCounters()["torn"]; n != 100 {
+		t.Errorf("%d torn writes", n)
+	}
+}
+
+func TestFaultFilterRules(t *testing.T) {
+	f := openTestFault(t, newVolatileDev(1*mib))
+	for _, r := range []*filter.FaultRule{
+		{Probability: 1.5},
+		{Probability: -1},
+		{Action: filter.FaultRule_DROP_WRITE, Op: filter.FaultRule_READ},
+		{Action: filter.FaultRule_TORN_WRITE, Op: filter.FaultRule_READ},
+		{Action: filter.FaultRule_Action(100)},
+		{DurationMs: -1},
+	} {
+		if _, err := f.AddRule(r); err == nil {
+			t.Errorf("invalid rule %v is added", r)
+		}
+	}
+
+	id1, _ := f.AddRule(&filter.FaultRule{})
+	id2, _ := f.AddRule(&filter.FaultRule{Op: filter.FaultRule_WRITE})
+	if err := f.RemoveRule(id1); err != nil {
+		t.Errorf("RemoveRule: %v", err)
+	}
+	if rules := f.ListRules(); len(rules) != 1 || rules[0].Id != id2 {
+		t.Errorf("rules after remove: %v", rules)
+	}
+	if err := f.RemoveRule(id1); err == nil {
+		t.Errorf("removed rule is removed again")
+	}
+	if err := f.RemoveRule(0); err != nil || len(f.ListRules()) != 0 {
+		t.Errorf("rules are not cleared: %v", err)
+	}
+}
@@ -0,0 +1,616 @@
+package csif
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	core "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/watch"
+	v1 "k8s.io/client-go/kubernetes/typed/core/v1"
+)
+
+// Filter modes:
+//
+//	pod: pod per volume and node, slices of a pool share the pod of the pool
+//	     (see filterPodName), it is created with the first disk and deleted
+//	     with the last one
+//	daemon: per-node filter DaemonSet serves all disks of the node, no pods
+//	     are created on staging, sources must be node-local PVs, which is
+//	     checked on CreateVolume if controller runs in the same mode
+const (
+	FilterModePod    = "pod"
+	FilterModeDaemon = "daemon"
+
+	csifFilterDaemonApp      = "csi-csif-filter-daemon"
+	csifFilterDaemonHostRoot = "/host" // node root in filter daemon
+	csifFilterDaemonKey      = "daemon"
+
+	csifFilterApp = "csi-csif-filter"
+	// values are filterLabelValue of names, full ones are in annotations
+	filterPodNodeLabel   = "csif.pooh64.io/node" // node which owns the pod
+	filterPodPVLabel     = "csif.pooh64.io/pv"
+	filterPodSourceLabel = "csif.pooh64.io/source"
+	filterPodVolumeAnno  = "csif.pooh64.io/volume-id" // not a valid label value in general
+)
+
+// Names may be up to 253 chars, label values up to 63: long ones are
+// truncated and suffixed with hash of the name
+func filterLabelValue(name string) string {
+	if len(validation.IsValidLabelValue(name)) == 0 {
+		return name
+	}
+	sum := sha256.Sum256([]byte(name))
+	prefix := name
+	if len(prefix) > 52 {
+		prefix = prefix[:52]
+	}
+	prefix = strings.TrimRight(prefix, "-_.")
+	return prefix + "-" + hex.EncodeToString(sum[:5])
+}
+
+// Label by name, the full name is kept in annotation of the same key
+func setFilterPodLabel(pod *core.Pod, key, name string) {
+	pod.Labels[key] = filterLabelValue(name)
+	pod.Annotations[key] = name
+}
+
+type filterPod struct {
+	key    string
+	pod    *core.Pod
+	conn   *grpc.ClientConn
+	refs   int
+	daemon bool // not owned by driver
+	local  bool // sources are node-local paths, see resolveLocalPVC
+}
+
+// Pod per volume and node, slices of a pool share the pod of the pool
+func filterPodName(d *csifDisk) string {
+	id := "volume/" + d.volID
+	if d.SliceLength != "" {
+		id = "pool/" + d.sourceNamespace() + "/" + d.SourcePVC
+	}
+	sum := sha256.Sum256([]byte(id + "@" + d.cd.nodeID))
+	return "csi-csif-fs-" + hex.EncodeToString(sum[:10])
+}
+
+// Pod is owned by what it serves: pool PVC of slices or PV of the volume,
+// see resolveVolumeRefs
+func (cd *csifDriver) filterPodOwner(ctx context.Context, d *csifDisk) (*metav1.OwnerReference, string, error) {
+	coreif := cd.clientset.CoreV1()
+	if d.SliceLength != "" {
+		pvc, err := coreif.PersistentVolumeClaims(d.sourceNamespace()).Get(ctx, d.SourcePVC, metav1.GetOptions{})
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to get pool PVC %s: %v", d.SourcePVC, err)
+		}
+		return &metav1.OwnerReference{
+			APIVersion: "v1",
+			Kind:       "PersistentVolumeClaim",
+			Name:       pvc.Name,
+			UID:        pvc.UID,
+		}, "", nil
+	}
+
+	if d.pvRef == nil {
+		return nil, "", nil
+	}
+	return &metav1.OwnerReference{
+		APIVersion: "v1",
+		Kind:       "PersistentVolume",
+		Name:       d.pvRef.Name,
+		UID:        d.pvRef.UID,
+	}, d.pvRef.Name, nil
+}
+
+// Connect to filter gRPC, fails unless the filter is serving
+func DialFilter(ctx context.Context, addr string) (*grpc.ClientConn, error) {
+	opts := []grpc.DialOption{
+		grpc.WithInsecure(),
+		grpc.WithChainUnaryInterceptor(tracingClientInterceptor),
+	}
+	conn, err := grpc.Dial(addr, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to filter gRPC: %v", err)
+	}
+	if err := checkFilterHealth(ctx, conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+func dialFilterPod(ctx context.Context, pod *core.Pod) (*grpc.ClientConn, error) {
+	return DialFilter(ctx, FilterPodAddr(pod))
+}
+
+// Filter gRPC address of filter pod or daemon pod
+func FilterPodAddr(pod *core.Pod) string {
+	return pod.Status.PodIP + ":" + fmt.Sprint(CsifFilterPortGRPC)
+}
+
+// Selects filter pods of both modes
+func FilterPodSelector() string {
+	return "app in (" + csifFilterApp + "," + csifFilterDaemonApp + ")"
+}
+
+// Take a reference to the pod of key. If there is none, key is reserved
+// (nil, nil): the caller creates the pod without podsMu and releases key
+// with publishFilterPod. Others wait for the reservation
+func (cd *csifDriver) lookupFilterPod(ctx context.Context, key string) (*filterPod, error) {
+	for {
+		cd.podsMu.Lock()
+		if fp, ok := cd.filterPods[key]; ok {
+			fp.refs++
+			cd.podsMu.Unlock()
+			return fp, nil
+		}
+		done, ok := cd.podsPending[key]
+		if !ok {
+			cd.podsPending[key] = make(chan struct{})
+			cd.podsMu.Unlock()
+			return nil, nil
+		}
+		cd.podsMu.Unlock()
+
+		select {
+		case <-done:
+		case <-ctx.Done():
+			return nil, status.FromContextError(ctx.Err()).Err()
+		}
+	}
+}
+
+// Release reservation of key, fp is registered unless nil
+func (cd *csifDriver) publishFilterPod(key string, fp *filterPod) {
+	cd.podsMu.Lock()
+	defer cd.podsMu.Unlock()
+
+	if fp != nil {
+		cd.filterPods[key] = fp
+	}
+	close(cd.podsPending[key])
+	delete(cd.podsPending, key)
+}
+
+// Get running filter pod for the disk, create if there is none
+func (cd *csifDriver) getFilterPod(ctx context.Context, d *csifDisk) (*filterPod, error) {
+	key := filterPodName(d)
+	if cd.filterMode == FilterModeDaemon {
+		key = csifFilterDaemonKey
+	}
+	fp, err := cd.lookupFilterPod(ctx, key)
+	if fp != nil || err != nil {
+		return fp, err
+	}
+
+	fp, err = cd.newFilterPod(ctx, d, key)
+	cd.publishFilterPod(key, fp)
+	return fp, err
+}
+
+func (cd *csifDriver) newFilterPod(ctx context.Context, d *csifDisk, key string) (*filterPod, error) {
+	coreif := cd.clientset.CoreV1()
+	fp := &filterPod{key: key, refs: 1}
+	var err error
+
+	if cd.filterMode == FilterModeDaemon {
+		if fp.pod, err = findFilterDaemon(ctx, coreif, cd.podTemplate.Namespace, cd.nodeID); err != nil {
+			return nil, err
+		}
+		fp.daemon = true
+		fp.local = true
+		if fp.conn, err = dialFilterPod(ctx, fp.pod); err != nil {
+			return nil, err
+		}
+		return fp, nil
+	}
+
+	if cd.warmPool != nil {
+		// Falls back to dedicated pod below
+		if fp.pod, fp.conn, err = cd.warmPool.claim(ctx, d); err != nil {
+			glog.Errorf("warm pool claim failed: %v", err)
+		}
+		if fp.pod != nil {
+			fp.local = true
+			return fp, nil
+		}
+	}
+
+	t, err := d.podTemplate()
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "%v", err)
+	}
+	owner, pvName, err := cd.filterPodOwner(ctx, d)
+	if err != nil {
+		return nil, err
+	}
+	pod := makeFilterPodConf(d, t)
+	if owner != nil {
+		pod.OwnerReferences = []metav1.OwnerReference{*owner}
+	}
+	if pvName != "" {
+		setFilterPodLabel(pod, filterPodPVLabel, pvName)
+	}
+	if fp.pod, err = createFilterPod(ctx, coreif, pod); err != nil {
+		return nil, err
+	}
+	if fp.conn, err = dialFilterPod(ctx, fp.pod); err != nil {
+		if err := deleteFilterPod(coreif, fp.pod); err != nil {
+			glog.Errorf("failed to delete pod: %v", err)
+		}
+		return nil, err
+	}
+	return fp, nil
+}
+
+// Drop reference, the last one deletes the pod. Key stays reserved until
+// the pod is gone, so it is not recreated under the same name meanwhile
+func (cd *csifDriver) putFilterPod(fp *filterPod) error {
+	cd.podsMu.Lock()
+	if fp.refs > 1 {
+		fp.refs--
+		cd.podsMu.Unlock()
+		return nil
+	}
+	delete(cd.filterPods, fp.key)
+	cd.podsPending[fp.key] = make(chan struct{})
+	cd.podsMu.Unlock()
+
+	if err := cd.releaseFilterPod(fp); err != nil {
+		// keep the last reference, put is retried
+		cd.publishFilterPod(fp.key, fp)
+		return err
+	}
+	fp.refs = 0
+	cd.publishFilterPod(fp.key, nil)
+	return nil
+}
+
+func (cd *csifDriver) releaseFilterPod(fp *filterPod) error {
+	if fp.conn != nil {
+		if err := fp.conn.Close(); err != nil {
+			return fmt.Errorf("failed to close filter conn: %v", err)
+		}
+		fp.conn = nil
+	}
+	if !fp.daemon {
+		if err := deleteFilterPod(cd.clientset.CoreV1(), fp.pod); err != nil {
+			return fmt.Errorf("failed to delete filter pod: %v", err)
+		}
+	}
+	return nil
+}
+
+// Ready filter daemon pod of the node
+func findFilterDaemon(ctx context.Context, coreif v1.CoreV1Interface, namespace, nodeID string) (*core.Pod, error) {
+	pods, err := coreif.Pods(namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: labels.Set{"app": csifFilterDaemonApp}.AsSelector().String(),
+		FieldSelector: fields.Set{"spec.nodeName": nodeID}.AsSelector().String(),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list filter daemon pods: %v", err)
+	}
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		if isPodReady(pod) {
+			return pod, nil
+		}
+	}
+	return nil, status.Errorf(codes.Unavailable, "no ready filter daemon on node %s", nodeID)
+}
+
+// Filter daemon can't mount PVCs, so only node-local PVs may be used:
+// path of the PV on the node as seen by daemon
+func (cd *csifDriver) resolveLocalPVC(namespace, name string) (string, error) {
+	coreif := cd.clientset.CoreV1()
+	pvc, err := coreif.PersistentVolumeClaims(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+	if err != nil {
+		return "", fmt.Errorf("failed to get PVC %s: %v", name, err)
+	}
+	if pvc.Spec.VolumeName == "" {
+		return "", fmt.Errorf("PVC %s is not bound", name)
+	}
+	pv, err := coreif.PersistentVolumes().Get(context.TODO(), pvc.Spec.VolumeName, metav1.GetOptions{})
+	if err != nil {
+		return "", fmt.Errorf("failed to get PV %s: %v", pvc.Spec.VolumeName, err)
+	}
+
+	switch {
+	case pv.Spec.Local != nil:
+		return path.Join(csifFilterDaemonHostRoot, pv.Spec.Local.Path), nil
+	case pv.Spec.HostPath != nil:
+		return path.Join(csifFilterDaemonHostRoot, pv.Spec.HostPath.Path), nil
+	}
+	return "", fmt.Errorf("PV %s is not node-local, it can't be used in %s filter mode", pv.Name, FilterModeDaemon)
+}
+
+// Waiting reasons that won't resolve by themselves
+var podFatalReasons = map[string]codes.Code{
+	"ImagePullBackOff":           codes.FailedPrecondition,
+	"InvalidImageName":           codes.FailedPrecondition,
+	"ErrImageNeverPull":          codes.FailedPrecondition,
+	"CreateContainerConfigError": codes.FailedPrecondition,
+	"CrashLoopBackOff":           codes.Internal,
+}
+
+func isPodReady(pod *core.Pod) bool {
+	if pod.DeletionTimestamp != nil || pod.Status.Phase != core.PodRunning || pod.Status.PodIP == "" {
+		return false
+	}
+	for _, c := range pod.Status.Conditions {
+		if c.Type == core.PodReady {
+			return c.Status == core.ConditionTrue
+		}
+	}
+	return false
+}
+
+// Done if ready, error if the pod will never get ready
+func checkPodReadiness(pod *core.Pod) (bool, error) {
+	if pod.DeletionTimestamp != nil {
+		return false, status.Errorf(codes.Aborted, "pod %s is being deleted", pod.Name)
+	}
+	switch pod.Status.Phase {
+	case core.PodFailed, core.PodSucceeded:
+		return false, status.Errorf(codes.Internal, "pod %s terminated: %s %s",
+			pod.Name, pod.Status.Reason, pod.Status.Message)
+	}
+	if isPodReady(pod) {
+		return true, nil
+	}
+
+	for _, c := range pod.Status.Conditions {
+		if c.Type == core.PodScheduled && c.Status == core.ConditionFalse && c.Reason == core.PodReasonUnschedulable {
+			return false, status.Errorf(codes.ResourceExhausted, "pod %s is unschedulable: %s", pod.Name, c.Message)
+		}
+	}
+	for _, cs := range pod.Status.ContainerStatuses {
+		w := cs.State.Waiting
+		if w == nil {
+			continue
+		}
+		if code, ok := podFatalReasons[w.Reason]; ok {
+			return false, status.Errorf(code, "pod %s: container %s: %s: %s", pod.Name, cs.Name, w.Reason, w.Message)
+		}
+	}
+	return false, nil
+}
+
+// Why the pod is not ready yet: container state and the last warning event
+func describePodNotReady(coreif v1.CoreV1Interface, pod *core.Pod) string {
+	desc := fmt.Sprintf("phase %v", pod.Status.Phase)
+	for _, cs := range pod.Status.ContainerStatuses {
+		if w := cs.State.Waiting; w != nil && w.Reason != "" {
+			desc += fmt.Sprintf(", container %s: %s", cs.Name, w.Reason)
+		}
+	}
+
+	events, err := coreif.Events(pod.Namespace).List(context.TODO(), metav1.ListOptions{
+		FieldSelector: fields.Set{
+			"involvedObject.name": pod.Name,
+			"involvedObject.uid":  string(pod.UID),
+			"type":                core.EventTypeWarning,
+		}.AsSelector().String(),
+	})
+	if err != nil || len(events.Items) == 0 {
+		return desc
+	}
+	last := &events.Items[0]
+	for i := range events.Items {
+		if events.Items[i].LastTimestamp.After(last.LastTimestamp.Time) {
+			last = &events.Items[i]
+		}
+	}
+	return desc + fmt.Sprintf(", last event: %s: %s", last.Reason, last.Message)
+}
+
+// Wait for readiness until ctx is done, the watch is restarted if closed
+func waitPodReady(ctx context.Context, coreif v1.CoreV1Interface, pod *core.Pod) (*core.Pod, error) {
+	for {
+		if done, err := checkPodReadiness(pod); done || err != nil {
+			return pod, err
+		}
+
+		watcher, err := coreif.Pods(pod.Namespace).Watch(ctx, metav1.ListOptions{
+			ResourceVersion: pod.ResourceVersion,
+			FieldSelector:   fields.Set{"metadata.name": pod.Name}.AsSelector().String(),
+		})
+		if err != nil && ctx.Err() == nil {
+			return nil, fmt.Errorf("failed to watch pod %s: %v", pod.Name, err)
+		}
+
+		for closed := false; err == nil && !closed; {
+			select {
+			case event, ok := <-watcher.ResultChan():
+				if !ok {
+					closed = true
+					break
+				}
+				if event.Type == watch.Deleted {
+					watcher.Stop()
+					return nil, status.Errorf(codes.Aborted, "pod %s was deleted", pod.Name)
+				}
+				if podupd, ok := event.Object.(*core.Pod); ok {
+					pod = podupd
+					if done, err := checkPodReadiness(pod); done || err != nil {
+						watcher.Stop()
+						return pod, err
+					}
+				}
+			case <-ctx.Done():
+				err = ctx.Err()
+			}
+		}
+		if watcher != nil {
+			watcher.Stop()
+		}
+
+		if ctx.Err() != nil {
+			return nil, status.Errorf(codes.DeadlineExceeded, "pod %s is not ready: %s",
+				pod.Name, describePodNotReady(coreif, pod))
+		}
+		// watch expired, resync
+		if pod, err = coreif.Pods(pod.Namespace).Get(ctx, pod.Name, metav1.GetOptions{}); err != nil {
+			return nil, fmt.Errorf("failed to get pod: %v", err)
+		}
+	}
+}
+
+// Create pod and wait until it is ready, deleted on failure. Filter pod
+// left by a crashed plugin is adopted, its name is deterministic
+func createFilterPod(ctx context.Context, coreif v1.CoreV1Interface, conf *core.Pod) (*core.Pod, error) {
+	pod, err := coreif.Pods(conf.Namespace).Create(ctx, conf, metav1.CreateOptions{})
+	if errors.IsAlreadyExists(err) {
+		pod, err = coreif.Pods(conf.Namespace).Get(ctx, conf.Name, metav1.GetOptions{})
+		if err == nil && pod.Labels["app"] != csifFilterApp {
+			return nil, status.Errorf(codes.AlreadyExists, "pod %s/%s exists and is not a filter pod", pod.Namespace, pod.Name)
+		}
+		if err == nil {
+			glog.Infof("adopting existing filter pod %s/%s", pod.Namespace, pod.Name)
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create pod: %v", err)
+	}
+
+	created := pod
+	start := time.Now()
+	if pod, err = waitPodReady(ctx, coreif, pod); err != nil {
+		filterPodCreateDuration.WithLabelValues("error").Observe(time.Since(start).Seconds())
+		if err := deleteFilterPod(coreif, created); err != nil {
+			glog.Errorf("failed to delete pod: %v", err)
+		}
+		return nil, err
+	}
+	filterPodCreateDuration.WithLabelValues("ready").Observe(time.Since(start).Seconds())
+	return pod, nil
+}
+
+// Pod that is already gone is not an error, reconciler may race with us
+func deleteFilterPod(coreif v1.CoreV1Interface, pod *core.Pod) error {
+	glog.V(4).Infof("deleting filter pod %s/%s", pod.Namespace, pod.Name)
+	err := coreif.Pods(pod.Namespace).Delete(context.TODO(), pod.Name, metav1.DeleteOptions{})
+	if errors.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+// Filter pod without sources
+func makeFilterPodBase(t *filterPodTemplate, name string) *core.Pod {
+	priv := true
+	annotations := map[string]string{}
+	for k, v := range t.Annotations {
+		annotations[k] = v
+	}
+	args := []string{
+		"--endpoint=tcp://:" + fmt.Sprint(CsifFilterPortGRPC),
+		"--tgtport=" + fmt.Sprint(CsifFilterPortTGT),
+		"--tgtcontrol=" + fmt.Sprint(CsifFilterPortTGTControl),
+		"--metrics-address=:" + fmt.Sprint(CsifFilterPortMetrics),
+	}
+	if len(t.PortalInterfaces) != 0 {
+		args = append(args, "--portal-interfaces="+strings.Join(t.PortalInterfaces, ","))
+	}
+	return &core.Pod{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "Pod",
+			APIVersion: "v1",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: t.Namespace,
+			Labels: map[string]string{
+				"app": csifFilterApp,
+			},
+			Annotations: annotations,
+		},
+		Spec: core.PodSpec{
+			//DNSPolicy:   "ClusterFirstWithHostNet",
+			HostNetwork: false,
+			//Hostname:    "",
+			//NodeName: d.cd.nodeID,
+			Tolerations:        t.Tolerations,
+			NodeSelector:       t.NodeSelector,
+			PriorityClassName:  t.PriorityClassName,
+			ServiceAccountName: t.ServiceAccountName,
+
+			Containers: []core.Container{
+				{
+					Name:            "filter",
+					Image:           t.Image,
+					ImagePullPolicy: t.ImagePullPolicy,
+					Args:            append(args, t.ExtraArgs...),
+					Ports: []core.ContainerPort{
+						{Name: "metrics", ContainerPort: CsifFilterPortMetrics},
+					},
+					Resources: t.Resources,
+					ReadinessProbe: &core.Probe{
+						Handler: core.Handler{
+							Exec: &core.ExecAction{
+								Command: []string{
+									"/csif-filter", "--probe",
+									"--endpoint=tcp://127.0.0.1:" + fmt.Sprint(CsifFilterPortGRPC),
+								},
+							},
+						},
+						PeriodSeconds:  2,
+						TimeoutSeconds: int32(FilterProbeTimeout / time.Second),
+					},
+					// nbd and tgtd
+					SecurityContext: &core.SecurityContext{
+						Privileged: &priv,
+						Capabilities: &core.Capabilities{
+							Add: []core.Capability{
+								"SYS_ADMIN",
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+// Attach block PVC to filter container
+func addFilterPodPVC(pod *core.Pod, volName, claimName, devPath string) {
+	spec := &pod.Spec
+	spec.Volumes = append(spec.Volumes, core.Volume{
+		Name: volName,
+		VolumeSource: core.VolumeSource{
+			PersistentVolumeClaim: &core.PersistentVolumeClaimVolumeSource{
+				ClaimName: claimName,
+				ReadOnly:  false,
+			},
+		},
+	})
+	spec.Containers[0].VolumeDevices = append(spec.Containers[0].VolumeDevices, core.VolumeDevice{
+		Name:       volName,
+		DevicePath: devPath,
+	})
+}
+
+func makeFilterPodConf(d *csifDisk, t *filterPodTemplate) *core.Pod {
+	pod := makeFilterPodBase(t, filterPodName(d))
+	setFilterPodLabel(pod, filterPodNodeLabel, d.cd.nodeID)
+	setFilterPodLabel(pod, filterPodSourceLabel, d.SourcePVC)
+	pod.Annotations[filterPodVolumeAnno] = d.volID
+	addFilterPodPVC(pod, "csi-csif-vol-src", d.SourcePVC, CsifFilterBstoreSrc)
+	if d.CachePVC != "" {
+		addFilterPodPVC(pod, "csi-csif-vol-cache", d.CachePVC, CsifFilterBstoreCache)
+	}
+	return pod
+}
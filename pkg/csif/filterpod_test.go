@@ -0,0 +1,165 @@
+package csif
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+func TestFilterPodReservation(t *testing.T) {
+	cd := newTestDriver(t).cd
+	ctx := context.Background()
+
+	if fp, err := cd.lookupFilterPod(ctx, "pod-0"); fp != nil || err != nil {
+		t.Fatalf("expected reservation, got %v, %v", fp, err)
+	}
+
+	cctx, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := cd.lookupFilterPod(cctx, "pod-0"); status.Code(err) != codes.Canceled {
+		t.Errorf("lookup of reserved key: %v", err)
+	}
+
+	got := make(chan *filterPod)
+	go func() {
+		fp, err := cd.lookupFilterPod(ctx, "pod-0")
+		if err != nil {
+			t.Errorf("lookup: %v", err)
+		}
+		got <- fp
+	}()
+	select {
+	case <-got:
+		t.Fatalf("lookup didn't wait for reservation")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	created := &filterPod{key: "pod-0", refs: 1}
+	cd.publishFilterPod("pod-0", created)
+	if fp := <-got; fp != created || fp.refs != 2 {
+		t.Errorf("expected published pod with 2 refs, got %+v", fp)
+	}
+}
+
+func TestFilterPodReservationRollback(t *testing.T) {
+	cd := newTestDriver(t).cd
+	ctx := context.Background()
+
+	if fp, err := cd.lookupFilterPod(ctx, "pod-0"); fp != nil || err != nil {
+		t.Fatalf("expected reservation, got %v, %v", fp, err)
+	}
+	// creation failed
+	cd.publishFilterPod("pod-0", nil)
+
+	if fp, err := cd.lookupFilterPod(ctx, "pod-0"); fp != nil || err != nil {
+		t.Fatalf("expected new reservation, got %v, %v", fp, err)
+	}
+	cd.publishFilterPod("pod-0", nil)
+	if len(cd.filterPods) != 0 || len(cd.podsPending) != 0 {
+		t.Errorf("leftover pods %v, pending %v", cd.filterPods, cd.podsPending)
+	}
+}
+
+func TestFilterPodLabels(t *testing.T) {
+	cd := newTestDriver(t).cd
+	cd.nodeID = "node-" + strings.Repeat("a", 60) + ".example.com"
+	d := newCsifDisk(cd)
+	if err := d.LoadContext(map[string]string{"sourcePVC": strings.Repeat("b", 70) + "-0"}); err != nil {
+		t.Fatal(err)
+	}
+	d.volID = testVolID
+
+	pod := makeFilterPodConf(d, defaultFilterPodTemplate())
+	for key, name := range map[string]string{
+		filterPodNodeLabel:   cd.nodeID,
+		filterPodSourceLabel: d.SourcePVC,
+	} {
+		if errs := validation.IsValidLabelValue(pod.Labels[key]); len(errs) != 0 {
+			t.Errorf("label %s: %v", key, errs)
+		}
+		if pod.Labels[key] != filterLabelValue(name) {
+			t.Errorf("label %s is %q, selectors use %q", key, pod.Labels[key], filterLabelValue(name))
+		}
+		if pod.Annotations[key] != name {
+			t.Errorf("annotation %s is %q, expected %q", key, pod.Annotations[key], name)
+		}
+	}
+
+	if v := filterLabelValue("node-0"); v != "node-0" {
+		t.Errorf("short name is changed to %q", v)
+	}
+	if filterLabelValue(d.SourcePVC) == filterLabelValue(strings.Repeat("b", 70)+"-1") {
+		t.Errorf("long names with the same prefix collide")
+	}
+}
+
+// Daemon can't serve network PVs, this must come out on CreateVolume
+func TestFilterDaemonNonLocalSource(t *testing.T) {
+	ctx := context.Background()
+	e := newConformanceEnv(t)
+	e.td.cd.filterMode = FilterModeDaemon
+
+	_, err := e.controller.CreateVolume(ctx, conformanceCreateRequest("unbound", false))
+	expectCode(t, "CreateVolume of unbound pool", err, codes.InvalidArgument)
+
+	coreif := e.td.cd.clientset.CoreV1()
+	for name, source := range map[string]core.PersistentVolumeSource{
+		"pool-pv": {Local: &core.LocalVolumeSource{Path: "/mnt/disks/pool"}},
+		"net-pv":  {CSI: &core.CSIPersistentVolumeSource{Driver: "network.csi.io", VolumeHandle: "net-0"}},
+	} {
+		pv := &core.PersistentVolume{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Spec:       core.PersistentVolumeSpec{PersistentVolumeSource: source},
+		}
+		if _, err := coreif.PersistentVolumes().Create(ctx, pv, metav1.CreateOptions{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	net := conformancePoolPVC()
+	net.Name, net.Spec.VolumeName = "net", "net-pv"
+	pool := conformancePoolPVC()
+	pool.Spec.VolumeName = "pool-pv"
+	if _, err := coreif.PersistentVolumeClaims(net.Namespace).Create(ctx, net, metav1.CreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := coreif.PersistentVolumeClaims(pool.Namespace).Update(ctx, pool, metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	req := conformanceCreateRequest("net", false)
+	req.Parameters[paramSlicePool] = net.Name
+	_, err = e.controller.CreateVolume(ctx, req)
+	expectCode(t, "CreateVolume of network pool", err, codes.InvalidArgument)
+	if err == nil || !strings.Contains(err.Error(), "not node-local") {
+		t.Errorf("unclear error: %v", err)
+	}
+
+	vol := e.createVolume(t, "local", false)
+	caps := []*csi.VolumeCapability{conformanceCapability(false)}
+	resp, err := e.controller.ValidateVolumeCapabilities(ctx, &csi.ValidateVolumeCapabilitiesRequest{
+		VolumeId:           vol.GetVolumeId(),
+		VolumeContext:      vol.GetVolumeContext(),
+		VolumeCapabilities: caps,
+	})
+	if err != nil || resp.GetConfirmed() == nil {
+		t.Errorf("local volume is not confirmed: %v, %v", resp.GetMessage(), err)
+	}
+
+	// statically provisioned volume on network PV
+	resp, err = e.controller.ValidateVolumeCapabilities(ctx, &csi.ValidateVolumeCapabilitiesRequest{
+		VolumeId:           vol.GetVolumeId(),
+		VolumeContext:      map[string]string{"sourcePVC": net.Name},
+		VolumeCapabilities: caps,
+	})
+	if err != nil || resp.GetConfirmed() != nil || resp.GetMessage() == "" {
+		t.Errorf("network volume is confirmed: %v", err)
+	}
+}
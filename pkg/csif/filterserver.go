@@ -2,9 +2,13 @@ package csif
 
 import (
 	"fmt"
+	"math"
+	"sync"
+	"time"
 
 	"github.com/golang/glog"
 	"github.com/pooh64/csif-driver/pkg/filter"
+	"github.com/prometheus/client_golang/prometheus"
 	"golang.org/x/net/context"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
@@ -15,10 +19,37 @@ const (
 	CsifFilterIQNPrefix = "iqn.com.pooh64.csi.csif.filter"
 )
 
+// Target of a single volume, the source is shared by all targets
+type filterTarget struct {
+	target *iscsiTarget
+	chain  *filterChain
+	nbd    *nbdExport
+
+	// I/O stats of the chain
+	lunStats *ioStatsDev
+	srcStats *ioStatsDev
+
+	// source range in use
+	source string
+	start  int64
+	end    int64
+
+	// scrubs in progress, they use the chain without cf.mu and are
+	// canceled by DeleteTarget
+	scrubs       sync.WaitGroup
+	scrubCancels map[int]context.CancelFunc
+	scrubSeq     int
+}
+
 type csifFilterServer struct {
-	endpoint string
-	tgtd     *csifTGTD
-	target   *iscsiTarget
+	endpoint       string
+	metricsAddress string
+	tgtd           targetManager
+
+	mu       sync.Mutex
+	targets  map[string]*filterTarget // by volume ID
+	deleting map[string]*filterTarget // chain is being closed, see DeleteTarget
+	source   string                   // bound by BindSource
 
 	filter.UnimplementedFilterServer
 }
@@ -27,11 +58,13 @@ func getTargetInfoStr(t *filter.TargetInfo) string {
 	return t.GetPortal() + "-" + fmt.Sprint(t.GetPort()) + "-" + t.GetIqn()
 }
 
-func NewCsifFilterServer(endpoint string, tgtd *csifTGTD) (*csifFilterServer, error) {
+func NewCsifFilterServer(endpoint, metricsAddress string, tgtd targetManager) (*csifFilterServer, error) {
 	return &csifFilterServer{
-		endpoint: endpoint,
-		tgtd:     tgtd,
-		target:   nil,
+		endpoint:       endpoint,
+		metricsAddress: metricsAddress,
+		tgtd:           tgtd,
+		targets:        map[string]*filterTarget{},
+		deleting:       map[string]*filterTarget{},
 	}, nil
 }
 
@@ -49,18 +82,135 @@ func csifFilterLogInterceptor(ctx context.Context, req interface{}, info *grpc.U
 }
 
 func (cf *csifFilterServer) Run() error {
+	if cf.metricsAddress != "" {
+		registry := prometheus.NewRegistry()
+		registry.MustRegister(newFilterStatsCollector(cf))
+		serveMetrics(cf.metricsAddress, registry)
+	}
+
 	server := NewNbServer()
 	register := func(s *grpc.Server) {
 		filter.RegisterFilterServer(s, cf)
+		registerFilterHealth(s)
 	}
-	server.Start(cf.endpoint, register, csifFilterLogInterceptor)
+	server.Start(cf.endpoint, register, tracingInterceptor, csifFilterLogInterceptor)
 	server.Wait()
 	return nil
 }
 
+// Source range used by the chain, slice must be the lowest filter
+func sourceRange(cfgs []*filter.FilterConfig) (int64, int64, error) {
+	for i, cfg := range cfgs {
+		if cfg.GetName() != "slice" {
+			continue
+		}
+		if i != 0 {
+			return 0, 0, fmt.Errorf("slice must be the lowest filter")
+		}
+		off, err := parseFilterParam(cfg.GetParams(), "offset", 0)
+		if err != nil {
+			return 0, 0, err
+		}
+		length, err := parseFilterParam(cfg.GetParams(), "length", 0)
+		if err != nil {
+			return 0, 0, err
+		}
+		return off, off + length, nil
+	}
+	return 0, math.MaxInt64, nil
+}
+
+// Stack requested filters on top of the source device, export the chain as nbd
+func (ft *filterTarget) createChain(cfgs []*filter.FilterConfig) (string, error) {
+	src, err := openFileBlockDev(ft.source)
+	if err != nil {
+		return "", fmt.Errorf("failed to open source: %v", err)
+	}
+	srcStats := newIOStatsDev(src)
+	chain, err := newFilterChain(srcStats, cfgs)
+	if err != nil {
+		return "", err
+	}
+	lunStats := newIOStatsDev(chain.top())
+	nbd, err := exportNBD(lunStats)
+	if err != nil {
+		if err := chain.close(); err != nil {
+			glog.Errorf("failed to close filter chain: %v", err)
+		}
+		return "", fmt.Errorf("failed to export nbd: %v", err)
+	}
+	ft.chain = chain
+	ft.nbd = nbd
+	ft.lunStats = lunStats
+	ft.srcStats = srcStats
+	return nbd.path, nil
+}
+
+// Disconnect nbd, flush and close filters
+// Keeps state on failure, so that DeleteTarget may be retried
+func (ft *filterTarget) deleteChain() error {
+	if ft.nbd != nil {
+		if ft.chain != nil {
+			ft.chain.interrupt()
+		}
+		if err := ft.nbd.Close(); err != nil {
+			return err
+		}
+		ft.nbd = nil
+	}
+	if ft.chain != nil {
+		if err := ft.chain.close(); err != nil {
+			return err
+		}
+		ft.chain = nil
+	}
+	return nil
+}
+
 func (cf *csifFilterServer) CreateTarget(ctx context.Context, req *filter.CreateTargetRequest) (*filter.CreateTargetResponse, error) {
-	if cf.target != nil {
-		return nil, status.Errorf(codes.AlreadyExists, "target already exists")
+	cf.mu.Lock()
+	defer cf.mu.Unlock()
+
+	volID := req.GetVolumeId()
+	if _, ok := cf.targets[volID]; ok {
+		return nil, status.Errorf(codes.AlreadyExists, "target already exists: %q", volID)
+	}
+	if _, ok := cf.deleting[volID]; ok {
+		return nil, status.Errorf(codes.Aborted, "target is being deleted: %q", volID)
+	}
+
+	start, end, err := sourceRange(req.GetFilters())
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "bad slice: %v", err)
+	}
+
+	// Filter daemon serves node-local sources, pod has its own one
+	source := req.GetSource()
+	if source == "" {
+		source = cf.source
+	}
+	if source == "" {
+		source = CsifFilterBstoreSrc
+	}
+	for _, targets := range []map[string]*filterTarget{cf.targets, cf.deleting} {
+		for id, t := range targets {
+			if source == t.source && start < t.end && t.start < end {
+				return nil, status.Errorf(codes.FailedPrecondition, "source range overlaps with volume %q", id)
+			}
+		}
+	}
+
+	ft := &filterTarget{
+		source:       source,
+		start:        start,
+		end:          end,
+		scrubCancels: map[int]context.CancelFunc{},
+	}
+	bstore := СsifFilterForcedLoop0
+	if len(req.GetFilters()) != 0 || source != CsifFilterBstoreSrc {
+		if bstore, err = ft.createChain(req.GetFilters()); err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "failed to create filter chain: %v", err)
+		}
 	}
 
 	/*
@@ -70,30 +220,77 @@ func (cf *csifFilterServer) CreateTarget(ctx context.Context, req *filter.Create
 		}
 	*/
 
-	out, err := cf.tgtd.CreateDisk(СsifFilterForcedLoop0)
+	// nbd export passes discards down the filter chain
+	out, err := cf.tgtd.CreateDisk(ctx, bstore, ft.nbd != nil)
 	if err != nil {
+		if err := ft.deleteChain(); err != nil {
+			glog.Errorf("failed to delete filter chain: %v", err)
+		}
 		return nil, status.Errorf(codes.Internal, "failed to create target: %v", err)
 	}
-	cf.target = out
+	ft.target = out
+	cf.targets[volID] = ft
 
+	paths := cf.targetPaths(ft.target.iqn)
 	return &filter.CreateTargetResponse{
-		Target: &filter.TargetInfo{
-			Portal: cf.tgtd.portal,
-			Port:   cf.tgtd.port,
-			Iqn:    cf.target.iqn,
-		},
+		Target: paths[0],
+		Paths:  paths,
 	}, nil
 }
 
+// Target on every portal, see CreateTargetResponse
+func (cf *csifFilterServer) targetPaths(iqn string) []*filter.TargetInfo {
+	var paths []*filter.TargetInfo
+	for _, portal := range cf.tgtd.Portals() {
+		paths = append(paths, &filter.TargetInfo{
+			Portal: portal,
+			Port:   cf.tgtd.Port(),
+			Iqn:    iqn,
+		})
+	}
+	return paths
+}
+
+// Scrubs are canceled and the chain is flushed without cf.mu, the target is
+// kept in cf.deleting meanwhile
 func (cf *csifFilterServer) DeleteTarget(ctx context.Context, req *filter.DeleteTargetRequest) (*filter.DeleteTargetResponse, error) {
-	if cf.target == nil {
-		return nil, status.Errorf(codes.NotFound, "target doesn't exist")
+	volID := req.GetVolumeId()
+	cf.mu.Lock()
+	ft, ok := cf.targets[volID]
+	if !ok {
+		_, deleting := cf.deleting[volID]
+		cf.mu.Unlock()
+		if deleting {
+			return nil, status.Errorf(codes.Aborted, "target is being deleted: %q", volID)
+		}
+		return nil, status.Errorf(codes.NotFound, "target doesn't exist: %q", volID)
+	}
+
+	if ft.target != nil {
+		if err := cf.tgtd.DeleteDisk(ctx, ft.target.id); err != nil {
+			cf.mu.Unlock()
+			return nil, status.Errorf(codes.Internal, "failed to delete tgtd target: %v", err)
+		}
+		ft.target = nil
 	}
+	delete(cf.targets, volID)
+	cf.deleting[volID] = ft
+	for _, cancel := range ft.scrubCancels {
+		cancel()
+	}
+	cf.mu.Unlock()
+
+	// Dirty data must reach the source before the pod is gone
+	ft.scrubs.Wait()
+	err := ft.deleteChain()
 
-	if err := cf.tgtd.DeleteDisk(cf.target.id); err != nil {
-		return nil, status.Errorf(codes.Internal, "failed to delete tgtd target: %v", err)
+	cf.mu.Lock()
+	defer cf.mu.Unlock()
+	delete(cf.deleting, volID)
+	if err != nil {
+		cf.targets[volID] = ft // retried
+		return nil, status.Errorf(codes.Internal, "failed to flush filter chain: %v", err)
 	}
-	cf.target = nil
 
 	/*
 		if err := destroyImg(FakeBstorePath); err != nil {
@@ -103,3 +300,262 @@ func (cf *csifFilterServer) DeleteTarget(ctx context.Context, req *filter.Delete
 
 	return &filter.DeleteTargetResponse{}, nil
 }
+
+func (cf *csifFilterServer) getChain(volID string) (*filterChain, error) {
+	ft, ok := cf.targets[volID]
+	if !ok || ft.chain == nil {
+		return nil, status.Errorf(codes.NotFound, "no filter chain: %q", volID)
+	}
+	return ft.chain, nil
+}
+
+func (cf *csifFilterServer) GetFilterStatus(ctx context.Context, req *filter.GetFilterStatusRequest) (*filter.GetFilterStatusResponse, error) {
+	cf.mu.Lock()
+	defer cf.mu.Unlock()
+
+	chain, err := cf.getChain(req.GetVolumeId())
+	if err != nil {
+		return nil, err
+	}
+	return &filter.GetFilterStatusResponse{
+		Filters: chain.Status(),
+	}, nil
+}
+
+func (cf *csifFilterServer) ConfigureFilter(ctx context.Context, req *filter.ConfigureFilterRequest) (*filter.ConfigureFilterResponse, error) {
+	cf.mu.Lock()
+	defer cf.mu.Unlock()
+
+	chain, err := cf.getChain(req.GetVolumeId())
+	if err != nil {
+		return nil, err
+	}
+	f := chain.getFilter(req.GetName())
+	if f == nil {
+		return nil, status.Errorf(codes.NotFound, "no %s filter in chain", req.GetName())
+	}
+	cfg, ok := f.(configurableFilter)
+	if !ok {
+		return nil, status.Errorf(codes.FailedPrecondition, "%s filter is not configurable", req.GetName())
+	}
+	if err := cfg.Configure(req.GetParams()); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "failed to configure %s: %v", req.GetName(), err)
+	}
+	return &filter.ConfigureFilterResponse{
+		Status: f.Status(),
+	}, nil
+}
+
+func (cf *csifFilterServer) getFaultFilter(volID string) (*faultFilter, error) {
+	chain, err := cf.getChain(volID)
+	if err != nil {
+		return nil, err
+	}
+	f, ok := chain.getFilter("fault").(*faultFilter)
+	if !ok {
+		return nil, status.Errorf(codes.FailedPrecondition, "fault injection is not enabled")
+	}
+	return f, nil
+}
+
+func (cf *csifFilterServer) AddFaultRule(ctx context.Context, req *filter.AddFaultRuleRequest) (*filter.AddFaultRuleResponse, error) {
+	cf.mu.Lock()
+	defer cf.mu.Unlock()
+
+	f, err := cf.getFaultFilter(req.GetVolumeId())
+	if err != nil {
+		return nil, err
+	}
+	if req.GetRule() == nil {
+		return nil, status.Errorf(codes.InvalidArgument, "no rule in request")
+	}
+	id, err := f.AddRule(req.GetRule())
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "bad rule: %v", err)
+	}
+	return &filter.AddFaultRuleResponse{Id: id}, nil
+}
+
+func (cf *csifFilterServer) RemoveFaultRule(ctx context.Context, req *filter.RemoveFaultRuleRequest) (*filter.RemoveFaultRuleResponse, error) {
+	cf.mu.Lock()
+	defer cf.mu.Unlock()
+
+	f, err := cf.getFaultFilter(req.GetVolumeId())
+	if err != nil {
+		return nil, err
+	}
+	if err := f.RemoveRule(req.GetId()); err != nil {
+		return nil, status.Errorf(codes.NotFound, "%v", err)
+	}
+	return &filter.RemoveFaultRuleResponse{}, nil
+}
+
+func (cf *csifFilterServer) ListFaultRules(ctx context.Context, req *filter.ListFaultRulesRequest) (*filter.ListFaultRulesResponse, error) {
+	cf.mu.Lock()
+	defer cf.mu.Unlock()
+
+	f, err := cf.getFaultFilter(req.GetVolumeId())
+	if err != nil {
+		return nil, err
+	}
+	return &filter.ListFaultRulesResponse{Rules: f.ListRules()}, nil
+}
+
+func (cf *csifFilterServer) StreamTrace(req *filter.StreamTraceRequest, stream filter.Filter_StreamTraceServer) error {
+	cf.mu.Lock()
+	var t *traceFilter
+	if chain, err := cf.getChain(req.GetVolumeId()); err == nil {
+		t, _ = chain.getFilter("trace").(*traceFilter)
+	}
+	cf.mu.Unlock()
+	if t == nil {
+		return status.Errorf(codes.FailedPrecondition, "tracing is not enabled")
+	}
+
+	ch, old := t.Subscribe(req.GetReplay())
+	defer t.Unsubscribe(ch)
+
+	for _, rec := range old {
+		if err := stream.Send(rec); err != nil {
+			return err
+		}
+	}
+	for {
+		select {
+		case rec, ok := <-ch:
+			if !ok {
+				return nil // target deleted
+			}
+			if err := stream.Send(rec); err != nil {
+				return err
+			}
+		case <-stream.Context().Done():
+			return stream.Context().Err()
+		}
+	}
+}
+
+func (cf *csifFilterServer) BindSource(ctx context.Context, req *filter.BindSourceRequest) (*filter.BindSourceResponse, error) {
+	cf.mu.Lock()
+	defer cf.mu.Unlock()
+
+	if req.GetSource() == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "no source in request")
+	}
+	if cf.source != "" && cf.source != req.GetSource() {
+		return nil, status.Errorf(codes.FailedPrecondition, "already bound to %s", cf.source)
+	}
+	cf.source = req.GetSource()
+	glog.V(4).Infof("bound to source: %s (PVC %s)", cf.source, req.GetSourcePvc())
+	return &filter.BindSourceResponse{}, nil
+}
+
+func (cf *csifFilterServer) ListTargets(ctx context.Context, req *filter.ListTargetsRequest) (*filter.ListTargetsResponse, error) {
+	cf.mu.Lock()
+	defer cf.mu.Unlock()
+
+	resp := &filter.ListTargetsResponse{}
+	for volID, ft := range cf.targets {
+		t := &filter.TargetSummary{
+			VolumeId: volID,
+			Source:   ft.source,
+		}
+		if ft.target != nil {
+			t.Target = cf.targetPaths(ft.target.iqn)[0]
+		}
+		if ft.chain != nil {
+			for _, f := range ft.chain.filters {
+				t.Filters = append(t.Filters, f.Name())
+			}
+		}
+		resp.Targets = append(resp.Targets, t)
+	}
+	return resp, nil
+}
+
+func (cf *csifFilterServer) GetTargetStats(ctx context.Context, req *filter.GetTargetStatsRequest) (*filter.GetTargetStatsResponse, error) {
+	cf.mu.Lock()
+	defer cf.mu.Unlock()
+
+	ft, ok := cf.targets[req.GetVolumeId()]
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "no target: %q", req.GetVolumeId())
+	}
+	if ft.lunStats == nil {
+		return nil, status.Errorf(codes.FailedPrecondition, "target %q has no filter chain, I/O is not observed", req.GetVolumeId())
+	}
+	return &filter.GetTargetStatsResponse{
+		Lun:     ft.lunStats.stats.Snapshot(),
+		Backing: ft.srcStats.stats.Snapshot(),
+	}, nil
+}
+
+func (cf *csifFilterServer) FlushTarget(ctx context.Context, req *filter.FlushTargetRequest) (*filter.FlushTargetResponse, error) {
+	cf.mu.Lock()
+	defer cf.mu.Unlock()
+
+	chain, err := cf.getChain(req.GetVolumeId())
+	if err != nil {
+		return nil, err
+	}
+	if err := chain.top().Flush(); err != nil {
+		return nil, status.Errorf(codes.Internal, "flush failed: %v", err)
+	}
+	return &filter.FlushTargetResponse{}, nil
+}
+
+const (
+	scrubChunkSize = 1 << 20
+	scrubTimeout   = 6 * time.Hour // 1TiB at 50MiB/s
+)
+
+// Unreadable chunks are counted and skipped, canceled with ctx, on
+// scrubTimeout or by DeleteTarget
+func (cf *csifFilterServer) ScrubTarget(ctx context.Context, req *filter.ScrubTargetRequest) (*filter.ScrubTargetResponse, error) {
+	cf.mu.Lock()
+	ft, ok := cf.targets[req.GetVolumeId()]
+	if !ok || ft.chain == nil {
+		cf.mu.Unlock()
+		return nil, status.Errorf(codes.NotFound, "no filter chain: %q", req.GetVolumeId())
+	}
+	ctx, cancel := context.WithTimeout(ctx, scrubTimeout)
+	id := ft.scrubSeq
+	ft.scrubSeq++
+	ft.scrubCancels[id] = cancel
+	ft.scrubs.Add(1)
+	dev := ft.chain.top()
+	cf.mu.Unlock()
+	defer func() {
+		cf.mu.Lock()
+		delete(ft.scrubCancels, id)
+		cf.mu.Unlock()
+		cancel()
+		ft.scrubs.Done()
+	}()
+
+	resp := &filter.ScrubTargetResponse{}
+	buf := make([]byte, scrubChunkSize)
+	size := dev.Size()
+	for off := int64(0); off < size; off += scrubChunkSize {
+		if err := ctx.Err(); err != nil {
+			code := codes.Canceled
+			if err == context.DeadlineExceeded {
+				code = codes.DeadlineExceeded
+			}
+			return nil, status.Errorf(code, "scrub stopped at %d: %v", off, err)
+		}
+		n := int64(len(buf))
+		if size-off < n {
+			n = size - off
+		}
+		if _, err := dev.ReadAt(buf[:n], off); err != nil {
+			resp.ReadErrors++
+			if resp.FirstError == "" {
+				resp.FirstError = fmt.Sprintf("offset %d: %v", off, err)
+			}
+			glog.Errorf("scrub %q: offset %d: %v", req.GetVolumeId(), off, err)
+		}
+		resp.BytesScanned += uint64(n)
+	}
+	return resp, nil
+}
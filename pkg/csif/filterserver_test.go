@@ -0,0 +1,83 @@
+package csif
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pooh64/csif-driver/pkg/filter"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Source taking a while per read
+type slowDev struct {
+	size int64
+}
+
+func (d *slowDev) ReadAt(p []byte, off int64) (int, error) {
+	time.Sleep(5 * time.Millisecond)
+	return len(p), nil
+}
+
+func (d *slowDev) WriteAt(p []byte, off int64) (int, error) { return len(p), nil }
+func (d *slowDev) Size() int64                              { return d.size }
+func (d *slowDev) Flush() error                             { return nil }
+func (d *slowDev) Trim(off, length int64) error             { return nil }
+func (d *slowDev) Close() error                             { return nil }
+
+func TestFilterDeleteTargetCancelsScrub(t *testing.T) {
+	cf, err := NewCsifFilterServer("", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cf.targets[testVolID] = &filterTarget{
+		chain:        &filterChain{src: &slowDev{size: 1000 * scrubChunkSize}},
+		scrubCancels: map[int]context.CancelFunc{},
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		_, err := cf.ScrubTarget(context.Background(), &filter.ScrubTargetRequest{VolumeId: testVolID})
+		if status.Code(err) != codes.Canceled {
+			t.Errorf("scrub of deleted target: %v", err)
+		}
+	}()
+	for {
+		cf.mu.Lock()
+		n := len(cf.targets[testVolID].scrubCancels)
+		cf.mu.Unlock()
+		if n != 0 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	done := make(chan error)
+	go func() {
+		_, err := cf.DeleteTarget(context.Background(), &filter.DeleteTargetRequest{VolumeId: testVolID})
+		done <- err
+	}()
+
+	// other calls go on while the target is being deleted
+	time.Sleep(time.Millisecond)
+	if _, err := cf.ListTargets(context.Background(), &filter.ListTargetsRequest{}); err != nil {
+		t.Errorf("ListTargets: %v", err)
+	}
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("DeleteTarget: %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("DeleteTarget waits for the whole scrub")
+	}
+	wg.Wait()
+	if len(cf.targets) != 0 || len(cf.deleting) != 0 {
+		t.Errorf("leftover targets %v, deleting %v", cf.targets, cf.deleting)
+	}
+}
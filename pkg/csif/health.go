@@ -0,0 +1,66 @@
+package csif
+
+import (
+	"fmt"
+	"net"
+	"time"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+// Filter readiness: gRPC health protocol is served next to Filter API, it is
+// checked by the pod readiness probe (csif-filter --probe) and on dial
+
+const (
+	FilterProbeTimeout = 5 * time.Second
+)
+
+// tgtd is up by the time filter server is created
+func registerFilterHealth(s *grpc.Server) {
+	hs := health.NewServer()
+	hs.SetServingStatus("", healthpb.HealthCheckResponse_SERVING)
+	healthpb.RegisterHealthServer(s, hs)
+}
+
+func checkFilterHealth(ctx context.Context, conn *grpc.ClientConn) error {
+	resp, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{}, grpc.WaitForReady(true))
+	if err != nil {
+		return status.Errorf(codes.Unavailable, "filter health check failed: %v", err)
+	}
+	if resp.GetStatus() != healthpb.HealthCheckResponse_SERVING {
+		return status.Errorf(codes.Unavailable, "filter is %v", resp.GetStatus())
+	}
+	return nil
+}
+
+// Readiness probe of filter pod, endpoint as passed to the filter server
+func ProbeFilterHealth(endpoint string) error {
+	network, addr, err := parseSockEndpoint(endpoint)
+	if err != nil {
+		return err
+	}
+	if network != "tcp" {
+		return fmt.Errorf("unsupported endpoint: %s", endpoint)
+	}
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return fmt.Errorf("bad endpoint %s: %v", endpoint, err)
+	}
+	if host == "" {
+		host = "127.0.0.1"
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), FilterProbeTimeout)
+	defer cancel()
+	conn, err := grpc.DialContext(ctx, net.JoinHostPort(host, port), grpc.WithInsecure(), grpc.WithBlock())
+	if err != nil {
+		return fmt.Errorf("failed to connect: %v", err)
+	}
+	defer conn.Close()
+	return checkFilterHealth(ctx, conn)
+}
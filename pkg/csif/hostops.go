@@ -0,0 +1,73 @@
+package csif
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	lib_iscsi "github.com/pooh64/csi-lib-iscsi/iscsi"
+	"golang.org/x/net/context"
+)
+
+// Operations on the host and on the cluster are behind interfaces, so that
+// tests can replace them with fakes
+
+// iSCSI initiator of the node
+type iscsiInitiator interface {
+	Connect(c lib_iscsi.Connector) (string, error)
+	Disconnect(iqn string, portals []string) error
+	GetSessions() (string, error)
+	FlushMultipath(dev string) error
+}
+
+type libISCSI struct{}
+
+func (libISCSI) Connect(c lib_iscsi.Connector) (string, error) {
+	return lib_iscsi.Connect(c)
+}
+
+func (libISCSI) Disconnect(iqn string, portals []string) error {
+	return lib_iscsi.Disconnect(iqn, portals)
+}
+
+func (libISCSI) GetSessions() (string, error) {
+	return lib_iscsi.GetSessions()
+}
+
+func (libISCSI) FlushMultipath(dev string) error {
+	return FlushMultipath(dev)
+}
+
+// Multipath map must be flushed before its paths are logged out. Connect
+// returns a path device if multipathd hasn't assembled the map, nothing
+// to flush then
+func FlushMultipath(dev string) error {
+	resolved, err := filepath.EvalSymlinks(dev)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("failed to resolve %s: %v", dev, err)
+	}
+	if !strings.HasPrefix(filepath.Base(resolved), "dm-") {
+		return nil
+	}
+	if err := lib_iscsi.FlushMultipathDevice(filepath.Base(resolved)); err != nil {
+		return fmt.Errorf("failed to flush multipath device %s: %v", resolved, err)
+	}
+	return nil
+}
+
+// Filter pods serving disks, csifDriver is the real one
+type filterPodManager interface {
+	getFilterPod(ctx context.Context, d *csifDisk) (*filterPod, error)
+	putFilterPod(fp *filterPod) error
+}
+
+// iSCSI targets exported by the filter, csifTGTD is the real one
+type targetManager interface {
+	CreateDisk(ctx context.Context, bstore string, thin bool) (*iscsiTarget, error)
+	DeleteDisk(ctx context.Context, tid int) error
+	Portals() []string
+	Port() uint32
+}
@@ -26,22 +26,23 @@ func (cd *csifDriver) GetPluginInfo(ctx context.Context, req *csi.GetPluginInfoR
 func (cd *csifDriver) GetPluginCapabilities(ctx context.Context, req *csi.GetPluginCapabilitiesRequest) (*csi.GetPluginCapabilitiesResponse, error) {
 	glog.V(5).Infof("Get Capabilities")
 
-	return &csi.GetPluginCapabilitiesResponse{
-		Capabilities: []*csi.PluginCapability{
-			{
-				Type: &csi.PluginCapability_Service_{
-					Service: &csi.PluginCapability_Service{
-						Type: csi.PluginCapability_Service_CONTROLLER_SERVICE,
-					},
-				},
-			},
-			{
-				Type: &csi.PluginCapability_Service_{
-					Service: &csi.PluginCapability_Service{
-						Type: csi.PluginCapability_Service_VOLUME_ACCESSIBILITY_CONSTRAINTS,
-					},
+	var services []csi.PluginCapability_Service_Type
+	if cd.runsController() {
+		services = append(services, csi.PluginCapability_Service_CONTROLLER_SERVICE)
+	}
+	services = append(services, csi.PluginCapability_Service_VOLUME_ACCESSIBILITY_CONSTRAINTS)
+
+	var caps []*csi.PluginCapability
+	for _, svc := range services {
+		caps = append(caps, &csi.PluginCapability{
+			Type: &csi.PluginCapability_Service_{
+				Service: &csi.PluginCapability_Service{
+					Type: svc,
 				},
 			},
-		},
+		})
+	}
+	return &csi.GetPluginCapabilitiesResponse{
+		Capabilities: caps,
 	}, nil
 }
@@ -0,0 +1,206 @@
+package csif
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/pooh64/csif-driver/pkg/filter"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// I/O statistics of filter targets: the exported LUN (top of the chain, as
+// seen by tgtd via nbd) and the backing device (bottom of the chain)
+
+const (
+	ioOpRead = iota
+	ioOpWrite
+	ioOpFlush
+	ioOpTrim
+	ioOpCount
+)
+
+var ioOpNames = [ioOpCount]string{"read", "write", "flush", "trim"}
+
+// Latency bucket upper bounds, the last bucket is +Inf
+var ioLatencyBoundsUs = []uint64{50, 100, 250, 500, 1000, 2500, 5000, 10000, 25000, 50000, 100000, 250000, 1000000}
+
+type ioOpStats struct {
+	ops       uint64
+	bytes     uint64
+	errors    uint64
+	latencyUs uint64
+	buckets   [14]uint64 // len(ioLatencyBoundsUs) + 1
+}
+
+type ioStats struct {
+	ops      [ioOpCount]ioOpStats
+	inflight int64
+}
+
+func (s *ioStats) start() time.Time {
+	atomic.AddInt64(&s.inflight, 1)
+	return time.Now()
+}
+
+func (s *ioStats) done(op int, start time.Time, n int, err error) {
+	us := uint64(time.Since(start) / time.Microsecond)
+	atomic.AddInt64(&s.inflight, -1)
+
+	st := &s.ops[op]
+	atomic.AddUint64(&st.ops, 1)
+	atomic.AddUint64(&st.bytes, uint64(n))
+	atomic.AddUint64(&st.latencyUs, us)
+	if err != nil {
+		atomic.AddUint64(&st.errors, 1)
+	}
+	b := len(ioLatencyBoundsUs)
+	for i, bound := range ioLatencyBoundsUs {
+		if us <= bound {
+			b = i
+			break
+		}
+	}
+	atomic.AddUint64(&st.buckets[b], 1)
+}
+
+func (s *ioStats) opStats(op int) *filter.IOOpStats {
+	st := &s.ops[op]
+	out := &filter.IOOpStats{
+		Ops:          atomic.LoadUint64(&st.ops),
+		Bytes:        atomic.LoadUint64(&st.bytes),
+		Errors:       atomic.LoadUint64(&st.errors),
+		LatencySumUs: atomic.LoadUint64(&st.latencyUs),
+	}
+	for i := range st.buckets {
+		out.LatencyBuckets = append(out.LatencyBuckets, atomic.LoadUint64(&st.buckets[i]))
+	}
+	return out
+}
+
+func (s *ioStats) Snapshot() *filter.IOStats {
+	return &filter.IOStats{
+		Read:            s.opStats(ioOpRead),
+		Write:           s.opStats(ioOpWrite),
+		Flush:           s.opStats(ioOpFlush),
+		Trim:            s.opStats(ioOpTrim),
+		QueueDepth:      atomic.LoadInt64(&s.inflight),
+		LatencyBoundsUs: ioLatencyBoundsUs,
+	}
+}
+
+// Pass-through blockDev that accounts I/O, Close is passed down too
+type ioStatsDev struct {
+	lower blockDev
+	stats ioStats
+}
+
+func newIOStatsDev(lower blockDev) *ioStatsDev {
+	return &ioStatsDev{lower: lower}
+}
+
+func (s *ioStatsDev) ReadAt(p []byte, off int64) (int, error) {
+	start := s.stats.start()
+	n, err := s.lower.ReadAt(p, off)
+	s.stats.done(ioOpRead, start, n, err)
+	return n, err
+}
+
+func (s *ioStatsDev) WriteAt(p []byte, off int64) (int, error) {
+	start := s.stats.start()
+	n, err := s.lower.WriteAt(p, off)
+	s.stats.done(ioOpWrite, start, n, err)
+	return n, err
+}
+
+func (s *ioStatsDev) Size() int64 {
+	return s.lower.Size()
+}
+
+func (s *ioStatsDev) Flush() error {
+	start := s.stats.start()
+	err := s.lower.Flush()
+	s.stats.done(ioOpFlush, start, 0, err)
+	return err
+}
+
+func (s *ioStatsDev) Trim(off, length int64) error {
+	start := s.stats.start()
+	err := s.lower.Trim(off, length)
+	s.stats.done(ioOpTrim, start, int(length), err)
+	return err
+}
+
+func (s *ioStatsDev) Close() error {
+	return s.lower.Close()
+}
+
+// Prometheus view of target stats, collected on scrape
+type filterStatsCollector struct {
+	cf *csifFilterServer
+
+	ops        *prometheus.Desc
+	bytes      *prometheus.Desc
+	errors     *prometheus.Desc
+	latency    *prometheus.Desc
+	queueDepth *prometheus.Desc
+}
+
+func newFilterStatsCollector(cf *csifFilterServer) *filterStatsCollector {
+	labels := []string{"volume_id", "layer", "op"}
+	return &filterStatsCollector{
+		cf: cf,
+		ops: prometheus.NewDesc("csif_filter_io_ops_total",
+			"I/O operations by volume, layer (lun, backing) and op.", labels, nil),
+		bytes: prometheus.NewDesc("csif_filter_io_bytes_total",
+			"I/O bytes by volume, layer and op.", labels, nil),
+		errors: prometheus.NewDesc("csif_filter_io_errors_total",
+			"Failed I/O operations by volume, layer and op.", labels, nil),
+		latency: prometheus.NewDesc("csif_filter_io_latency_seconds",
+			"I/O latency by volume, layer and op.", labels, nil),
+		queueDepth: prometheus.NewDesc("csif_filter_io_queue_depth",
+			"I/O operations in flight by volume and layer.", []string{"volume_id", "layer"}, nil),
+	}
+}
+
+func (c *filterStatsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.ops
+	ch <- c.bytes
+	ch <- c.errors
+	ch <- c.latency
+	ch <- c.queueDepth
+}
+
+func (c *filterStatsCollector) collectLayer(ch chan<- prometheus.Metric, volID, layer string, s *ioStats) {
+	ch <- prometheus.MustNewConstMetric(c.queueDepth, prometheus.GaugeValue,
+		float64(atomic.LoadInt64(&s.inflight)), volID, layer)
+
+	for op := 0; op < ioOpCount; op++ {
+		st := s.opStats(op)
+		name := ioOpNames[op]
+		ch <- prometheus.MustNewConstMetric(c.ops, prometheus.CounterValue, float64(st.Ops), volID, layer, name)
+		ch <- prometheus.MustNewConstMetric(c.bytes, prometheus.CounterValue, float64(st.Bytes), volID, layer, name)
+		ch <- prometheus.MustNewConstMetric(c.errors, prometheus.CounterValue, float64(st.Errors), volID, layer, name)
+
+		buckets := map[float64]uint64{}
+		var cum uint64
+		for i, bound := range ioLatencyBoundsUs {
+			cum += st.LatencyBuckets[i]
+			buckets[float64(bound)/1e6] = cum
+		}
+		ch <- prometheus.MustNewConstHistogram(c.latency, st.Ops,
+			float64(st.LatencySumUs)/1e6, buckets, volID, layer, name)
+	}
+}
+
+func (c *filterStatsCollector) Collect(ch chan<- prometheus.Metric) {
+	c.cf.mu.Lock()
+	defer c.cf.mu.Unlock()
+
+	for volID, ft := range c.cf.targets {
+		if ft.lunStats == nil {
+			continue
+		}
+		c.collectLayer(ch, volID, "lun", &ft.lunStats.stats)
+		c.collectLayer(ch, volID, "backing", &ft.srcStats.stats)
+	}
+}
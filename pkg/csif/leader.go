@@ -0,0 +1,167 @@
+package csif
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/golang/glog"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+)
+
+// Controller replicas elect a leader with a Lease. Replicas serve all
+// Controller calls, but allocation of slices must see all volumes, so calls
+// changing them are forwarded to the leader. Lease identity is the address
+// the replica serves forwarded calls on. csi-provisioner elects its own
+// leader, its replica of csif forwards to ours.
+
+const (
+	leaderLeaseDuration = 15 * time.Second
+	leaderRenewDeadline = 10 * time.Second
+	leaderRetryPeriod   = 2 * time.Second
+)
+
+// Calls served by the leader only
+var leaderMethods = map[string]func() interface{}{
+	"/csi.v1.Controller/CreateVolume": func() interface{} { return &csi.CreateVolumeResponse{} },
+	"/csi.v1.Controller/DeleteVolume": func() interface{} { return &csi.DeleteVolumeResponse{} },
+}
+
+type controllerLeader struct {
+	cd        *csifDriver
+	namespace string
+	identity  string // host:port of the peer server
+
+	mu      sync.Mutex
+	leading bool
+	leader  string           // identity of the observed leader
+	conn    *grpc.ClientConn // to leader, if it is not us
+}
+
+func newControllerLeader(cd *csifDriver, namespace, address string) *controllerLeader {
+	if namespace == "" {
+		namespace = cd.podTemplate.Namespace
+	}
+	return &controllerLeader{
+		cd:        cd,
+		namespace: namespace,
+		identity:  address,
+	}
+}
+
+func leaderLeaseName(driverName string) string {
+	return "csif-controller-" + strings.ReplaceAll(driverName, ".", "-")
+}
+
+// Returns when ctx is done, the lease is released then. Leadership lost
+// otherwise is fatal: calls in flight may race with the new leader
+func (l *controllerLeader) run(ctx context.Context) {
+	lock := &resourcelock.LeaseLock{
+		LeaseMeta: metav1.ObjectMeta{
+			Name:      leaderLeaseName(l.cd.name),
+			Namespace: l.namespace,
+		},
+		Client:     l.cd.clientset.CoordinationV1(),
+		LockConfig: resourcelock.ResourceLockConfig{Identity: l.identity},
+	}
+	leaderelection.RunOrDie(ctx, leaderelection.LeaderElectionConfig{
+		Lock:            lock,
+		LeaseDuration:   leaderLeaseDuration,
+		RenewDeadline:   leaderRenewDeadline,
+		RetryPeriod:     leaderRetryPeriod,
+		ReleaseOnCancel: true,
+		Name:            lock.LeaseMeta.Name,
+		Callbacks: leaderelection.LeaderCallbacks{
+			OnStartedLeading: func(ctx context.Context) {
+				glog.Infof("leader election: leading as %s", l.identity)
+				l.setLeading(true)
+			},
+			OnStoppedLeading: func() {
+				l.setLeading(false)
+				if ctx.Err() == nil {
+					glog.Fatalf("leader election: leadership lost")
+				}
+				glog.Infof("leader election: leadership released")
+			},
+			OnNewLeader: func(identity string) {
+				glog.Infof("leader election: new leader %s", identity)
+				l.setLeader(identity)
+			},
+		},
+	})
+}
+
+func (l *controllerLeader) setLeading(leading bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.leading = leading
+}
+
+func (l *controllerLeader) isLeading() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.leading
+}
+
+func (l *controllerLeader) setLeader(identity string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if identity == l.leader {
+		return
+	}
+	l.leader = identity
+	if l.conn != nil {
+		l.conn.Close()
+		l.conn = nil
+	}
+}
+
+func (l *controllerLeader) leaderConn() (*grpc.ClientConn, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.leader == "" || l.leader == l.identity {
+		return nil, fmt.Errorf("no leader elected")
+	}
+	if l.conn == nil {
+		conn, err := grpc.Dial(l.leader, grpc.WithInsecure(),
+			grpc.WithChainUnaryInterceptor(tracingClientInterceptor))
+		if err != nil {
+			return nil, fmt.Errorf("failed to connect to leader %s: %v", l.leader, err)
+		}
+		l.conn = conn
+	}
+	return l.conn, nil
+}
+
+// Innermost in the chain. Calls forwarded by other replicas are not
+// forwarded again, these fail until the leader is known to all
+func (l *controllerLeader) interceptor(forward bool) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		newResp, ok := leaderMethods[info.FullMethod]
+		if !ok || l.isLeading() {
+			return handler(ctx, req)
+		}
+		if !forward {
+			return nil, status.Error(codes.Unavailable, "not the leader")
+		}
+
+		conn, err := l.leaderConn()
+		if err != nil {
+			return nil, status.Errorf(codes.Unavailable, "%v", err)
+		}
+		glog.V(4).Infof("forwarding %s to leader", info.FullMethod)
+		resp := newResp()
+		if err := conn.Invoke(ctx, info.FullMethod, req, resp); err != nil {
+			return nil, err
+		}
+		return resp, nil
+	}
+}
@@ -0,0 +1,190 @@
+package csif
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// Controller replica sharing the API server with others
+type testReplica struct {
+	leader *controllerLeader
+	client csi.ControllerClient // endpoint, as used by csi-provisioner
+	peer   csi.ControllerClient // as used by other replicas
+}
+
+func listenTCP(t *testing.T) net.Listener {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return lis
+}
+
+func serveController(t *testing.T, lis net.Listener, register func(*grpc.Server), li grpc.UnaryServerInterceptor) csi.ControllerClient {
+	s := grpc.NewServer(grpc.ChainUnaryInterceptor(li))
+	register(s)
+	go s.Serve(lis)
+	t.Cleanup(s.Stop)
+
+	conn, err := grpc.Dial(lis.Addr().String(), grpc.WithInsecure())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return csi.NewControllerClient(conn)
+}
+
+func newTestReplica(t *testing.T, clientset *fake.Clientset) *testReplica {
+	cd := &csifDriver{
+		name:        testDriverName,
+		mode:        DriverModeController,
+		clientset:   clientset,
+		podTemplate: defaultFilterPodTemplate(),
+	}
+	cs := newCsifControllerServer(cd)
+	peerLis := listenTCP(t)
+	cd.leader = newControllerLeader(cd, "", peerLis.Addr().String())
+	t.Cleanup(func() { cd.leader.setLeader("") })
+
+	return &testReplica{
+		leader: cd.leader,
+		client: serveController(t, listenTCP(t), cd.registerServices(cs), cd.leader.interceptor(true)),
+		peer: serveController(t, peerLis, func(s *grpc.Server) {
+			csi.RegisterControllerServer(s, cs)
+		}, cd.leader.interceptor(false)),
+	}
+}
+
+// Another replica continues with volumes created by the previous one
+func TestControllerHandover(t *testing.T) {
+	td := newTestDriver(t, conformancePoolPVC())
+	ctx := context.Background()
+	old, next := newCsifControllerServer(td.cd), newCsifControllerServer(td.cd)
+
+	first, err := old.CreateVolume(ctx, conformanceCreateRequest("first", true))
+	if err != nil {
+		t.Fatalf("CreateVolume: %v", err)
+	}
+
+	again, err := next.CreateVolume(ctx, conformanceCreateRequest("first", true))
+	if err != nil {
+		t.Fatalf("retried CreateVolume: %v", err)
+	}
+	if again.GetVolume().GetVolumeId() != first.GetVolume().GetVolumeId() {
+		t.Errorf("retry created another volume")
+	}
+
+	second, err := next.CreateVolume(ctx, conformanceCreateRequest("second", true))
+	if err != nil {
+		t.Fatalf("CreateVolume: %v", err)
+	}
+	if a, b := first.GetVolume().GetVolumeContext()["sliceOffset"], second.GetVolume().GetVolumeContext()["sliceOffset"]; a == b {
+		t.Errorf("slices of both volumes are at %s", a)
+	}
+
+	if _, err := next.DeleteVolume(ctx, &csi.DeleteVolumeRequest{VolumeId: first.GetVolume().GetVolumeId()}); err != nil {
+		t.Fatalf("DeleteVolume: %v", err)
+	}
+	if vol, err := old.getVolumeByName(ctx, "first"); err != nil || vol != nil {
+		t.Errorf("volume record is left: %v, %v", vol, err)
+	}
+}
+
+func TestLeaderForwarding(t *testing.T) {
+	clientset := fake.NewSimpleClientset(conformancePoolPVC())
+	a, b := newTestReplica(t, clientset), newTestReplica(t, clientset)
+	ctx := context.Background()
+
+	_, err := b.client.CreateVolume(ctx, conformanceCreateRequest("vol", true))
+	expectCode(t, "CreateVolume without leader", err, codes.Unavailable)
+	if _, err := b.client.ControllerGetCapabilities(ctx, &csi.ControllerGetCapabilitiesRequest{}); err != nil {
+		t.Errorf("ControllerGetCapabilities without leader: %v", err)
+	}
+
+	a.leader.setLeading(true)
+	a.leader.setLeader(a.leader.identity)
+	b.leader.setLeader(a.leader.identity)
+
+	forwarded, err := b.client.CreateVolume(ctx, conformanceCreateRequest("vol", true))
+	if err != nil {
+		t.Fatalf("forwarded CreateVolume: %v", err)
+	}
+	local, err := a.client.CreateVolume(ctx, conformanceCreateRequest("vol", true))
+	if err != nil {
+		t.Fatalf("CreateVolume: %v", err)
+	}
+	if forwarded.GetVolume().GetVolumeId() != local.GetVolume().GetVolumeId() {
+		t.Errorf("leader created another volume")
+	}
+
+	// a stale leader must not serve
+	_, err = b.peer.CreateVolume(ctx, conformanceCreateRequest("other", true))
+	expectCode(t, "CreateVolume on peer of non-leader", err, codes.Unavailable)
+}
+
+func TestLeaderElection(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+	cd := &csifDriver{name: testDriverName, clientset: clientset, podTemplate: defaultFilterPodTemplate()}
+	a := newControllerLeader(cd, "", "10.0.0.1:9834")
+	b := newControllerLeader(cd, "", "10.0.0.2:9834")
+
+	waitFor := func(what string, cond func() bool) {
+		t.Helper()
+		deadline := time.Now().Add(3 * leaderLeaseDuration)
+		for !cond() {
+			if time.Now().After(deadline) {
+				t.Fatalf("timed out waiting for %s", what)
+			}
+			time.Sleep(50 * time.Millisecond)
+		}
+	}
+	observed := func(l *controllerLeader) string {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		return l.leader
+	}
+
+	ctxA, cancelA := context.WithCancel(context.Background())
+	doneA := make(chan struct{})
+	go func() {
+		a.run(ctxA)
+		close(doneA)
+	}()
+	waitFor("a to lead", a.isLeading)
+
+	ctxB, cancelB := context.WithCancel(context.Background())
+	defer cancelB()
+	go b.run(ctxB)
+	waitFor("b to observe a", func() bool { return observed(b) == a.identity })
+	if b.isLeading() {
+		t.Fatalf("both replicas lead")
+	}
+
+	// released lease is taken over without waiting for it to expire
+	cancelA()
+	<-doneA
+	if a.isLeading() {
+		t.Errorf("a still leads after release")
+	}
+	start := time.Now()
+	waitFor("b to lead", b.isLeading)
+	if d := time.Since(start); d >= leaderLeaseDuration {
+		t.Errorf("takeover took %v", d)
+	}
+
+	lease, err := clientset.CoordinationV1().Leases("default").Get(context.Background(), leaderLeaseName(testDriverName), metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id := lease.Spec.HolderIdentity; id == nil || *id != b.identity {
+		t.Errorf("lease is held by %v", id)
+	}
+}
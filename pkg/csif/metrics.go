@@ -0,0 +1,214 @@
+package csif
+
+import (
+	"net/http"
+	"path"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/pooh64/csif-driver/pkg/filter"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+// Plugin metrics, served on /metrics of --metrics-address
+
+var (
+	metricsRegistry = prometheus.NewRegistry()
+
+	csiRPCDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "csif",
+		Subsystem: "csi",
+		Name:      "rpc_duration_seconds",
+		Help:      "CSI RPC latency by method.",
+		Buckets:   prometheus.ExponentialBuckets(0.001, 4, 10),
+	}, []string{"method"})
+	csiRPCErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "csif",
+		Subsystem: "csi",
+		Name:      "rpc_errors_total",
+		Help:      "Failed CSI RPCs by method and gRPC code.",
+	}, []string{"method", "code"})
+	stagedVolumes = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "csif",
+		Name:      "staged_volumes",
+		Help:      "Volumes staged on the node.",
+	})
+	filterPodCreateDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "csif",
+		Subsystem: "filter_pod",
+		Name:      "create_duration_seconds",
+		Help:      "Time from filter pod creation to readiness by result: ready, error.",
+		Buckets:   prometheus.ExponentialBuckets(0.5, 2, 10),
+	}, []string{"result"})
+	iscsiDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "csif",
+		Subsystem: "iscsi",
+		Name:      "duration_seconds",
+		Help:      "iSCSI operation latency by op: connect, disconnect.",
+		Buckets:   prometheus.ExponentialBuckets(0.01, 2, 12),
+	}, []string{"op"})
+	volumeIOOps = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "csif",
+		Subsystem: "volume_io",
+		Name:      "ops",
+		Help:      "I/O operations of staged volume by layer (lun, backing) and op, as of the last NodeGetVolumeStats.",
+	}, []string{"volume_id", "layer", "op"})
+	volumeIOBytes = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "csif",
+		Subsystem: "volume_io",
+		Name:      "bytes",
+		Help:      "I/O bytes of staged volume by layer and op, as of the last NodeGetVolumeStats.",
+	}, []string{"volume_id", "layer", "op"})
+	volumeIOErrors = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "csif",
+		Subsystem: "volume_io",
+		Name:      "errors",
+		Help:      "Failed I/O operations of staged volume by layer and op, as of the last NodeGetVolumeStats.",
+	}, []string{"volume_id", "layer", "op"})
+	volumeIOQueueDepth = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "csif",
+		Subsystem: "volume_io",
+		Name:      "queue_depth",
+		Help:      "I/O operations in flight of staged volume by layer, as of the last NodeGetVolumeStats.",
+	}, []string{"volume_id", "layer"})
+	iscsiFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "csif",
+		Subsystem: "iscsi",
+		Name:      "failures_total",
+		Help:      "Failed iSCSI operations by op: connect, disconnect.",
+	}, []string{"op"})
+
+	warmPoolTargetSize = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "csif",
+		Subsystem: "warm_pool",
+		Name:      "target_size",
+		Help:      "Configured number of warm filter pods on the node.",
+	})
+	warmPoolReady = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "csif",
+		Subsystem: "warm_pool",
+		Name:      "ready_pods",
+		Help:      "Warm filter pods ready to be claimed.",
+	})
+	warmPoolPending = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "csif",
+		Subsystem: "warm_pool",
+		Name:      "pending_pods",
+		Help:      "Warm filter pods being started.",
+	})
+	warmPoolCreated = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "csif",
+		Subsystem: "warm_pool",
+		Name:      "created_pods_total",
+		Help:      "Warm filter pods created by refill.",
+	})
+	warmPoolClaims = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "csif",
+		Subsystem: "warm_pool",
+		Name:      "claims_total",
+		Help:      "Warm pod claims on staging by result: hit, miss, nonlocal, error.",
+	}, []string{"result"})
+
+	reconcilerRuns = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "csif",
+		Subsystem: "reconciler",
+		Name:      "runs_total",
+		Help:      "Reconciler passes.",
+	})
+	reconcilerCleaned = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "csif",
+		Subsystem: "reconciler",
+		Name:      "cleaned_total",
+		Help:      "Leftovers removed by reconciler by kind: pod, session, target.",
+	}, []string{"kind"})
+	reconcilerErrors = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "csif",
+		Subsystem: "reconciler",
+		Name:      "errors_total",
+		Help:      "Reconciler failures to list or remove leftovers.",
+	})
+)
+
+func init() {
+	metricsRegistry.MustRegister(
+		csiRPCDuration,
+		csiRPCErrors,
+		stagedVolumes,
+		filterPodCreateDuration,
+		iscsiDuration,
+		iscsiFailures,
+		volumeIOOps,
+		volumeIOBytes,
+		volumeIOErrors,
+		volumeIOQueueDepth,
+		warmPoolTargetSize,
+		warmPoolReady,
+		warmPoolPending,
+		warmPoolCreated,
+		warmPoolClaims,
+		reconcilerRuns,
+		reconcilerCleaned,
+		reconcilerErrors,
+	)
+}
+
+// Chained with driverLogInterceptor
+func metricsInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	method := path.Base(info.FullMethod)
+	start := time.Now()
+	resp, err := handler(ctx, req)
+	csiRPCDuration.WithLabelValues(method).Observe(time.Since(start).Seconds())
+	if err != nil {
+		csiRPCErrors.WithLabelValues(method, status.Code(err).String()).Inc()
+	}
+	return resp, err
+}
+
+// Observe duration of op since start, failures are counted too
+func observeISCSI(op string, start time.Time, err error) {
+	iscsiDuration.WithLabelValues(op).Observe(time.Since(start).Seconds())
+	if err != nil {
+		iscsiFailures.WithLabelValues(op).Inc()
+	}
+}
+
+var ioStatsLayers = []string{"lun", "backing"}
+
+// Forward target stats reported by the filter
+func setVolumeIOMetrics(volID string, resp *filter.GetTargetStatsResponse) {
+	for i, st := range []*filter.IOStats{resp.GetLun(), resp.GetBacking()} {
+		layer := ioStatsLayers[i]
+		volumeIOQueueDepth.WithLabelValues(volID, layer).Set(float64(st.GetQueueDepth()))
+		for op, ost := range []*filter.IOOpStats{st.GetRead(), st.GetWrite(), st.GetFlush(), st.GetTrim()} {
+			volumeIOOps.WithLabelValues(volID, layer, ioOpNames[op]).Set(float64(ost.GetOps()))
+			volumeIOBytes.WithLabelValues(volID, layer, ioOpNames[op]).Set(float64(ost.GetBytes()))
+			volumeIOErrors.WithLabelValues(volID, layer, ioOpNames[op]).Set(float64(ost.GetErrors()))
+		}
+	}
+}
+
+func deleteVolumeIOMetrics(volID string) {
+	for _, layer := range ioStatsLayers {
+		volumeIOQueueDepth.DeleteLabelValues(volID, layer)
+		for _, op := range ioOpNames {
+			volumeIOOps.DeleteLabelValues(volID, layer, op)
+			volumeIOBytes.DeleteLabelValues(volID, layer, op)
+			volumeIOErrors.DeleteLabelValues(volID, layer, op)
+		}
+	}
+}
+
+func serveMetrics(addr string, registry *prometheus.Registry) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+	go func() {
+		glog.Infof("serving metrics on %s", addr)
+		if err := http.ListenAndServe(addr, mux); err != nil {
+			glog.Fatalf("metrics server failed: %v", err)
+		}
+	}()
+}
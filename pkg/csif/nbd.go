@@ -0,0 +1,251 @@
+package csif
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+
+	"github.com/golang/glog"
+	"golang.org/x/sys/unix"
+)
+
+// Kernel NBD client driven over a socketpair, used to expose blockDev
+// as /dev/nbdX, so tgtd can use it as a backing store.
+// Requires nbd kernel module on the host.
+
+const (
+	nbdSetSock       = 0xab00
+	nbdSetBlksize    = 0xab01
+	nbdDoIt          = 0xab03
+	nbdClearSock     = 0xab04
+	nbdClearQue      = 0xab05
+	nbdSetSizeBlocks = 0xab07
+	nbdDisconnect    = 0xab08
+	nbdSetFlags      = 0xab0a
+
+	nbdFlagHasFlags  = 1 << 0
+	nbdFlagSendFlush = 1 << 2
+	nbdFlagSendTrim  = 1 << 5
+
+	nbdCmdRead  = 0
+	nbdCmdWrite = 1
+	nbdCmdDisc  = 2
+	nbdCmdFlush = 3
+	nbdCmdTrim  = 4
+
+	nbdRequestMagic = 0x25609513
+	nbdReplyMagic   = 0x67446698
+
+	nbdBlockSize = 4096
+	nbdMaxDevs   = 128
+)
+
+type nbdExport struct {
+	path string
+	dev  *os.File
+	sock *os.File
+	bdev blockDev
+
+	wmu    sync.Mutex // reply writes
+	done   chan error
+	served chan struct{}
+}
+
+func findFreeNBD() (string, error) {
+	for i := 0; i < nbdMaxDevs; i++ {
+		name := "nbd" + fmt.Sprint(i)
+		if _, err := os.Stat(filepath.Join("/sys/block", name)); err != nil {
+			break
+		}
+		// pid attribute exists only while device is connected
+		if _, err := os.Stat(filepath.Join("/sys/block", name, "pid")); os.IsNotExist(err) {
+			return "/dev/" + name, nil
+		}
+	}
+	return "", fmt.Errorf("no free nbd device (is nbd module loaded?)")
+}
+
+func nbdIoctl(f *os.File, req uint, val int) error {
+	return unix.IoctlSetInt(int(f.Fd()), req, val)
+}
+
+// Export bdev as kernel NBD device
+func exportNBD(bdev blockDev) (_ *nbdExport, err error) {
+	path, err := findFreeNBD()
+	if err != nil {
+		return nil, err
+	}
+	dev, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %v", path, err)
+	}
+	defer cleanup(&err, func() { dev.Close() })
+
+	fds, err := unix.Socketpair(unix.AF_UNIX, unix.SOCK_STREAM, 0)
+	if err != nil {
+		return nil, fmt.Errorf("socketpair failed: %v", err)
+	}
+	kernSock := os.NewFile(uintptr(fds[0]), "nbd-kern")
+	sock := os.NewFile(uintptr(fds[1]), "nbd-serv")
+	defer cleanup(&err, func() { sock.Close() })
+
+	if err = nbdIoctl(dev, nbdSetBlksize, nbdBlockSize); err != nil {
+		kernSock.Close()
+		return nil, fmt.Errorf("set blksize failed: %v", err)
+	}
+	if err = nbdIoctl(dev, nbdSetSizeBlocks, int(bdev.Size()/nbdBlockSize)); err != nil {
+		kernSock.Close()
+		return nil, fmt.Errorf("set size failed: %v", err)
+	}
+	if err = nbdIoctl(dev, nbdSetFlags, nbdFlagHasFlags|nbdFlagSendFlush|nbdFlagSendTrim); err != nil {
+		kernSock.Close()
+		return nil, fmt.Errorf("set flags failed: %v", err)
+	}
+	err = nbdIoctl(dev, nbdSetSock, int(kernSock.Fd()))
+	kernSock.Close() // kernel holds a reference now
+	if err != nil {
+		return nil, fmt.Errorf("set sock failed: %v", err)
+	}
+
+	e := &nbdExport{
+		path:   path,
+		dev:    dev,
+		sock:   sock,
+		bdev:   bdev,
+		done:   make(chan error, 1),
+		served: make(chan struct{}),
+	}
+
+	go func() {
+		// NBD_DO_IT blocks until disconnect
+		runtime.LockOSThread()
+		defer runtime.UnlockOSThread()
+		err := nbdIoctl(dev, nbdDoIt, 0)
+		nbdIoctl(dev, nbdClearQue, 0)
+		nbdIoctl(dev, nbdClearSock, 0)
+		e.done <- err
+	}()
+	go e.serve()
+
+	glog.V(4).Infof("nbd: exported %s, size=%v", path, bdev.Size())
+	return e, nil
+}
+
+func (e *nbdExport) reply(handle []byte, errno uint32, data []byte) error {
+	hdr := make([]byte, 16)
+	binary.BigEndian.PutUint32(hdr[0:4], nbdReplyMagic)
+	binary.BigEndian.PutUint32(hdr[4:8], errno)
+	copy(hdr[8:16], handle)
+
+	e.wmu.Lock()
+	defer e.wmu.Unlock()
+	if _, err := e.sock.Write(hdr); err != nil {
+		return err
+	}
+	if data != nil {
+		if _, err := e.sock.Write(data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *nbdExport) handle(cmd uint32, handle []byte, off int64, length uint32, data []byte) {
+	var err error
+	var out []byte
+
+	switch cmd {
+	case nbdCmdRead:
+		out = data
+		_, err = e.bdev.ReadAt(out, off)
+		if err == io.EOF {
+			err = nil
+		}
+	case nbdCmdWrite:
+		_, err = e.bdev.WriteAt(data, off)
+	case nbdCmdFlush:
+		err = e.bdev.Flush()
+	case nbdCmdTrim:
+		err = e.bdev.Trim(off, int64(length))
+	}
+
+	var errno uint32
+	if err != nil {
+		glog.Errorf("nbd: %s: cmd=%v off=%v len=%v: %v", e.path, cmd, off, length, err)
+		errno = uint32(unix.EIO)
+		out = nil
+	}
+	if err := e.reply(handle, errno, out); err != nil {
+		glog.Errorf("nbd: %s: reply failed: %v", e.path, err)
+	}
+}
+
+func (e *nbdExport) serve() {
+	var wg sync.WaitGroup
+	defer close(e.served)
+	defer wg.Wait()
+
+	hdr := make([]byte, 28)
+	for {
+		if _, err := io.ReadFull(e.sock, hdr); err != nil {
+			if err != io.EOF {
+				glog.Errorf("nbd: %s: read request failed: %v", e.path, err)
+			}
+			return
+		}
+		if binary.BigEndian.Uint32(hdr[0:4]) != nbdRequestMagic {
+			glog.Errorf("nbd: %s: bad request magic", e.path)
+			return
+		}
+		cmd := binary.BigEndian.Uint32(hdr[4:8]) & 0xffff
+		handle := append([]byte{}, hdr[8:16]...)
+		off := int64(binary.BigEndian.Uint64(hdr[16:24]))
+		length := binary.BigEndian.Uint32(hdr[24:28])
+
+		var data []byte
+		switch cmd {
+		case nbdCmdDisc:
+			return
+		case nbdCmdWrite:
+			data = make([]byte, length)
+			if _, err := io.ReadFull(e.sock, data); err != nil {
+				glog.Errorf("nbd: %s: read payload failed: %v", e.path, err)
+				return
+			}
+		case nbdCmdRead:
+			data = make([]byte, length)
+		case nbdCmdFlush, nbdCmdTrim:
+		default:
+			glog.Errorf("nbd: %s: unsupported cmd %v", e.path, cmd)
+			if err := e.reply(handle, uint32(unix.EINVAL), nil); err != nil {
+				return
+			}
+			continue
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			e.handle(cmd, handle, off, length, data)
+		}()
+	}
+}
+
+// Disconnect kernel device, blockDev is left open
+func (e *nbdExport) Close() error {
+	if err := nbdIoctl(e.dev, nbdDisconnect, 0); err != nil {
+		return fmt.Errorf("nbd disconnect failed: %s: %v", e.path, err)
+	}
+	if err := <-e.done; err != nil {
+		glog.V(4).Infof("nbd: %s: do_it returned: %v", e.path, err)
+	}
+	e.sock.Close()
+	<-e.served
+	e.dev.Close()
+	glog.V(4).Infof("nbd: %s disconnected", e.path)
+	return nil
+}
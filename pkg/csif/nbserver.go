@@ -8,6 +8,7 @@ import (
 	"sync"
 
 	"github.com/golang/glog"
+	"golang.org/x/net/context"
 	"google.golang.org/grpc"
 )
 
@@ -32,7 +33,8 @@ func (s *nbServer) ForceStop() {
 	s.server.Stop()
 }
 
-func (s *nbServer) Start(endpoint string, prep func(*grpc.Server), li grpc.UnaryServerInterceptor) {
+// Interceptors are chained, the first one is the outermost
+func (s *nbServer) Start(endpoint string, prep func(*grpc.Server), li ...grpc.UnaryServerInterceptor) {
 	s.wg.Add(1)
 	go s.serve(endpoint, prep, li)
 }
@@ -47,7 +49,9 @@ func parseSockEndpoint(ep string) (string, string, error) {
 	return "", "", fmt.Errorf("parseEndpoint: invalid: %v", ep)
 }
 
-func (s *nbServer) serve(endpoint string, prep func(*grpc.Server), li grpc.UnaryServerInterceptor) {
+func (s *nbServer) serve(endpoint string, prep func(*grpc.Server), li []grpc.UnaryServerInterceptor) {
+	defer s.wg.Done()
+
 	network, addr, err := parseSockEndpoint(endpoint)
 	if err != nil {
 		glog.Fatal(err.Error())
@@ -66,7 +70,7 @@ func (s *nbServer) serve(endpoint string, prep func(*grpc.Server), li grpc.Unary
 	}
 
 	server_opts := []grpc.ServerOption{
-		grpc.UnaryInterceptor(li),
+		grpc.ChainUnaryInterceptor(li...),
 	}
 	s.server = grpc.NewServer(server_opts...)
 
@@ -77,3 +81,20 @@ func (s *nbServer) serve(endpoint string, prep func(*grpc.Server), li grpc.Unary
 	glog.Infof("Listen, Serve: %#v", listener.Addr())
 	s.server.Serve(listener)
 }
+
+// Client side of Start, endpoint in the same format
+func DialEndpoint(ctx context.Context, endpoint string) (*grpc.ClientConn, error) {
+	network, addr, err := parseSockEndpoint(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	if network == "unix" {
+		addr = "/" + addr
+	}
+	dialer := func(ctx context.Context, addr string) (net.Conn, error) {
+		var d net.Dialer
+		return d.DialContext(ctx, network, addr)
+	}
+	return grpc.DialContext(ctx, addr, grpc.WithInsecure(), grpc.WithBlock(),
+		grpc.WithContextDialer(dialer))
+}
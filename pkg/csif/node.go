@@ -2,67 +2,117 @@ package csif
 
 import (
 	"fmt"
+	"io"
 	"os"
+	"sync"
 
 	"github.com/container-storage-interface/spec/lib/go/csi"
 	"github.com/golang/glog"
+	"github.com/pooh64/csif-driver/pkg/filter"
+	"go.opentelemetry.io/otel/attribute"
 	"golang.org/x/net/context"
+	"golang.org/x/sys/unix"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	core "k8s.io/api/core/v1"
 	"k8s.io/mount-utils"
-	"k8s.io/utils/exec"
 )
 
 type csifNodeServer struct {
 	cd      *csifDriver
-	mounter mount.SafeFormatAndMount
-	disks   map[string]*csifDisk
+	mounter *mount.SafeFormatAndMount
+	locks   *volumeLocks // disks are attached and detached under volume lock
+
+	// protects disks and fields of disks in it, which are read without
+	// volume lock by NodeGetVolumeStats and reconciler
+	mu    sync.RWMutex
+	disks map[string]*csifDisk
 }
 
 func newCsifNodeServer(driver *csifDriver) *csifNodeServer {
-	mounter := mount.SafeFormatAndMount{
-		Interface: mount.New(""),
-		Exec:      exec.New(),
-	}
-
 	return &csifNodeServer{
 		cd:      driver,
-		mounter: mounter,
+		mounter: driver.mounter,
+		locks:   newVolumeLocks(),
 		disks:   map[string]*csifDisk{},
 	}
 }
 
 func (ns *csifNodeServer) getDisk(volID string) (*csifDisk, error) {
+	ns.mu.RLock()
+	defer ns.mu.RUnlock()
 	if vol, ok := ns.disks[volID]; ok {
 		return vol, nil
 	}
 	return nil, fmt.Errorf("no volID=%s in volumes", volID)
 }
 
-func (ns *csifNodeServer) attachDisk(req *csi.NodeStageVolumeRequest) (*csifDisk, error) {
+func (ns *csifNodeServer) attachDisk(ctx context.Context, req *csi.NodeStageVolumeRequest) (*csifDisk, error) {
 	disk := newCsifDisk(ns.cd)
 	if err := disk.LoadContext(req.GetVolumeContext()); err != nil {
 		return nil, fmt.Errorf("failed to load disk context: %v", err)
 	}
-	if err := disk.Connect(); err != nil {
-		return nil, fmt.Errorf("failed to connect disk: %v", err)
+	disk.volID = req.GetVolumeId()
+	disk.staging = newDiskStaging(req)
+	if err := disk.Connect(ctx); err != nil {
+		return nil, wrapStatus(err, "failed to connect disk")
+	}
+
+	if err := saveNodeDiskState(ns.cd.stateDir, disk); err != nil {
+		if err := disk.Disconnect(ctx); err != nil {
+			glog.Errorf("failed to disconnect disk: %v", err)
+		}
+		return nil, err
 	}
 
+	ns.mu.Lock()
 	ns.disks[req.VolumeId] = disk
+	stagedVolumes.Set(float64(len(ns.disks)))
+	ns.mu.Unlock()
 	return disk, nil
 }
 
-func (ns *csifNodeServer) detachDisk(volumeID string) error {
-	disk := ns.disks[volumeID]
+// Disk is dropped from disks before Disconnect changes it, put back on failure
+func (ns *csifNodeServer) detachDisk(ctx context.Context, volumeID string) error {
+	ns.mu.Lock()
+	disk, ok := ns.disks[volumeID]
+	delete(ns.disks, volumeID)
+	ns.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("no volID=%s in volumes", volumeID)
+	}
 
-	if err := disk.Disconnect(); err != nil {
-		return fmt.Errorf("failed to disconnect disk: %v", err)
+	err := disk.Disconnect(ctx)
+	if err != nil {
+		err = fmt.Errorf("failed to disconnect disk: %v", err)
+	} else {
+		err = RemoveNodeDiskState(ns.cd.stateDir, volumeID)
 	}
-	delete(ns.disks, volumeID)
+
+	ns.mu.Lock()
+	defer ns.mu.Unlock()
+	if err != nil {
+		ns.disks[volumeID] = disk
+		return err
+	}
+	deleteVolumeIOMetrics(volumeID)
+	stagedVolumes.Set(float64(len(ns.disks)))
 	return nil
 }
 
-func (ns *csifNodeServer) stageDeviceMount(req *csi.NodeStageVolumeRequest, devPath string) error {
+// Copy of staged disk to be read without volume lock
+func (ns *csifNodeServer) snapshotDisk(volID string) (*csifDisk, error) {
+	ns.mu.RLock()
+	defer ns.mu.RUnlock()
+	disk, ok := ns.disks[volID]
+	if !ok {
+		return nil, fmt.Errorf("no volID=%s in volumes", volID)
+	}
+	snap := *disk
+	return &snap, nil
+}
+
+func (ns *csifNodeServer) stageDeviceMount(ctx context.Context, req *csi.NodeStageVolumeRequest, devPath string) error {
 	mntPath := req.GetStagingTargetPath()
 	notMP, err := ns.mounter.IsLikelyNotMountPoint(mntPath)
 	if err != nil && !os.IsNotExist(err) {
@@ -72,14 +122,17 @@ func (ns *csifNodeServer) stageDeviceMount(req *csi.NodeStageVolumeRequest, devP
 	}
 	if !notMP {
 		glog.V(4).Infof("Volume %s: already mounted", req.GetVolumeId())
-		return nil
+		return ns.verifyStagingMount(req, devPath)
 	}
 
 	fsType := req.GetVolumeCapability().GetMount().GetFsType()
 	mountFlags := req.GetVolumeCapability().GetMount().GetMountFlags()
 	options := append([]string{}, mountFlags...)
 
-	if err := ns.mounter.FormatAndMount(devPath, mntPath, fsType, options); err != nil {
+	_, span := startSpan(ctx, "format and mount", attribute.String("mount.fstype", fsType))
+	err = ns.mounter.FormatAndMount(devPath, mntPath, fsType, options)
+	endSpan(span, err)
+	if err != nil {
 		return fmt.Errorf("mount failed: volume %s, bdev %s, fs %s, path %s: %v",
 			req.GetVolumeId(), devPath, fsType, mntPath, err)
 	}
@@ -117,9 +170,21 @@ func (ns *csifNodeServer) NodeStageVolume(ctx context.Context, req *csi.NodeStag
 	if len(req.GetVolumeId()) == 0 || len(req.GetStagingTargetPath()) == 0 || req.GetVolumeCapability() == nil {
 		return nil, status.Error(codes.InvalidArgument, "wrong args")
 	}
-	disk, err := ns.attachDisk(req)
-	if err != nil {
-		return nil, fmt.Errorf("failed to attach disk: %v", err)
+	if !ns.locks.tryAcquire(req.GetVolumeId()) {
+		return nil, volumeBusyError(req.GetVolumeId())
+	}
+	defer ns.locks.release(req.GetVolumeId())
+
+	// a retried call must not spawn another filter pod
+	disk, err := ns.getDisk(req.GetVolumeId())
+	attached := err != nil // by this call
+	if attached {
+		disk, err = ns.attachDisk(ctx, req)
+		if err != nil {
+			return nil, wrapStatus(err, "failed to attach disk")
+		}
+	} else if err := ns.verifyStaged(disk, req); err != nil {
+		return nil, err
 	}
 	bdev := disk.GetDevPath()
 
@@ -127,9 +192,12 @@ func (ns *csifNodeServer) NodeStageVolume(ctx context.Context, req *csi.NodeStag
 		return &csi.NodeStageVolumeResponse{}, nil
 	}
 
-	if err := ns.stageDeviceMount(req, bdev); err != nil {
-		if err := ns.detachDisk(req.GetVolumeId()); err != nil {
-			glog.Errorf("failed to detach disk: %v", err)
+	if err := ns.stageDeviceMount(ctx, req, bdev); err != nil {
+		disk.recordEvent(core.EventTypeWarning, eventMountFailed, "%v", err)
+		if attached {
+			if err := ns.detachDisk(ctx, req.GetVolumeId()); err != nil {
+				glog.Errorf("failed to detach disk: %v", err)
+			}
 		}
 		return nil, fmt.Errorf("format and mount failed: %v", err)
 	}
@@ -144,15 +212,23 @@ func (ns *csifNodeServer) NodeUnstageVolume(ctx context.Context, req *csi.NodeUn
 	}
 
 	volID := req.GetVolumeId()
-	_, err := ns.getDisk(volID)
-	if err != nil {
-		return nil, status.Error(codes.NotFound, err.Error())
-		// TODO: After plugin restart CO keeps asking me to unstage the volume. What to do?
+	if !ns.locks.tryAcquire(volID) {
+		return nil, volumeBusyError(volID)
+	}
+	defer ns.locks.release(volID)
+
+	// not staged or unstaged already, staging path may be left by crash
+	if _, err := ns.getDisk(volID); err != nil {
+		glog.V(4).Infof("NodeUnstageVolume: %v", err)
+		if err := ns.unstageDevice(req); err != nil {
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+		return &csi.NodeUnstageVolumeResponse{}, nil
 	}
 
 	ns.unstageDevice(req) // if staging MP exists - unmount
 
-	if err := ns.detachDisk(volID); err != nil {
+	if err := ns.detachDisk(ctx, volID); err != nil {
 		return nil, fmt.Errorf("failed to delete volume attachment: %v", err)
 	}
 	return &csi.NodeUnstageVolumeResponse{}, nil
@@ -235,10 +311,35 @@ func (ns *csifNodeServer) NodePublishVolume(ctx context.Context, req *csi.NodePu
 	if len(req.GetVolumeId()) == 0 || len(req.GetStagingTargetPath()) == 0 || req.GetVolumeCapability() == nil {
 		return nil, status.Error(codes.InvalidArgument, "Wrong args")
 	}
-	_, err := ns.getDisk(req.GetVolumeId()) // TODO: check mount capab.?
+	if !ns.locks.tryAcquire(req.GetVolumeId()) {
+		return nil, volumeBusyError(req.GetVolumeId())
+	}
+	defer ns.locks.release(req.GetVolumeId())
+
+	disk, err := ns.getDisk(req.GetVolumeId())
 	if err != nil {
 		return nil, status.Error(codes.NotFound, err.Error())
 	}
+	if st := disk.staging; st != nil {
+		if st.Path != req.GetStagingTargetPath() {
+			return nil, status.Errorf(codes.FailedPrecondition, "volume %s is staged at %s", req.GetVolumeId(), st.Path)
+		}
+		if st.Block != (req.GetVolumeCapability().GetBlock() != nil) {
+			return nil, status.Errorf(codes.InvalidArgument, "volume %s is staged %v", req.GetVolumeId(), st)
+		}
+	}
+
+	notMP, err := ns.mounter.IsLikelyNotMountPoint(req.GetTargetPath())
+	if err != nil && !os.IsNotExist(err) {
+		return nil, status.Errorf(codes.Internal, "failed to check target %s: %v", req.GetTargetPath(), err)
+	}
+	if err == nil && !notMP {
+		glog.V(4).Infof("Volume %s: already published at %s", req.GetVolumeId(), req.GetTargetPath())
+		if err := ns.verifyPublished(disk, req); err != nil {
+			return nil, err
+		}
+		return &csi.NodePublishVolumeResponse{}, nil
+	}
 
 	mountOptions := []string{"bind"}
 	if req.GetReadonly() {
@@ -261,14 +362,13 @@ func (ns *csifNodeServer) NodeUnpublishVolume(ctx context.Context, req *csi.Node
 	if len(req.GetVolumeId()) == 0 || len(req.GetTargetPath()) == 0 {
 		return nil, status.Error(codes.InvalidArgument, "wrong args")
 	}
-
-	target := req.GetTargetPath()
-
-	_, err := ns.getDisk(req.GetVolumeId())
-	if err != nil {
-		return nil, status.Error(codes.NotFound, err.Error())
+	if !ns.locks.tryAcquire(req.GetVolumeId()) {
+		return nil, volumeBusyError(req.GetVolumeId())
 	}
+	defer ns.locks.release(req.GetVolumeId())
 
+	// the disk may be unknown, target is unmounted anyway
+	target := req.GetTargetPath()
 	notMP, err := ns.mounter.IsLikelyNotMountPoint(target)
 	if (err == nil && notMP) || os.IsNotExist(err) {
 		glog.V(4).Infof("NodeUnpublishVolume: %s not mounted: %v", target, err)
@@ -282,8 +382,127 @@ func (ns *csifNodeServer) NodeUnpublishVolume(ctx context.Context, req *csi.Node
 	return &csi.NodeUnpublishVolumeResponse{}, nil
 }
 
-func (ns *csifNodeServer) NodeGetVolumeStats(_ context.Context, _ *csi.NodeGetVolumeStatsRequest) (*csi.NodeGetVolumeStatsResponse, error) {
-	return nil, status.Error(codes.Unimplemented, "unimplemented")
+func getVolumeUsage(path string) ([]*csi.VolumeUsage, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if fi.IsDir() {
+		var st unix.Statfs_t
+		if err := unix.Statfs(path, &st); err != nil {
+			return nil, fmt.Errorf("statfs %s failed: %v", path, err)
+		}
+		bsize := int64(st.Bsize)
+		return []*csi.VolumeUsage{
+			{
+				Unit:      csi.VolumeUsage_BYTES,
+				Total:     int64(st.Blocks) * bsize,
+				Available: int64(st.Bavail) * bsize,
+				Used:      int64(st.Blocks-st.Bfree) * bsize,
+			},
+			{
+				Unit:      csi.VolumeUsage_INODES,
+				Total:     int64(st.Files),
+				Available: int64(st.Ffree),
+				Used:      int64(st.Files - st.Ffree),
+			},
+		}, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	size, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get size of %s: %v", path, err)
+	}
+	return []*csi.VolumeUsage{{Unit: csi.VolumeUsage_BYTES, Total: size}}, nil
+}
+
+func (ns *csifNodeServer) NodeGetVolumeStats(ctx context.Context, req *csi.NodeGetVolumeStatsRequest) (*csi.NodeGetVolumeStatsResponse, error) {
+	if len(req.GetVolumeId()) == 0 || len(req.GetVolumePath()) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "wrong args")
+	}
+	// read-only, doesn't take the volume lock not to abort stage and publish
+	disk, err := ns.snapshotDisk(req.GetVolumeId())
+	if err != nil {
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+
+	usage, err := getVolumeUsage(req.GetVolumePath())
+	if os.IsNotExist(err) {
+		return nil, status.Error(codes.NotFound, err.Error())
+	} else if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	cond, err := disk.GetCondition(ctx)
+	if err != nil {
+		cond = fmt.Sprintf("filter is unreachable: %v", err)
+	} else if ioCond := ns.updateIOStats(ctx, disk); ioCond != "" {
+		if cond != "" {
+			cond += "; "
+		}
+		cond += ioCond
+	}
+	if ns.updateCondition(disk, cond) && cond != "" {
+		disk.recordEvent(core.EventTypeWarning, eventVolumeAbnormal, "%s", cond)
+	}
+
+	vc := &csi.VolumeCondition{Abnormal: cond != "", Message: cond}
+	if !vc.Abnormal {
+		vc.Message = "ok"
+	}
+	return &csi.NodeGetVolumeStatsResponse{
+		Usage:           usage,
+		VolumeCondition: vc,
+	}, nil
+}
+
+// Forward target I/O stats to metrics, new I/O errors make volume abnormal
+func (ns *csifNodeServer) updateIOStats(ctx context.Context, disk *csifDisk) string {
+	resp, err := disk.GetTargetStats(ctx)
+	if err != nil {
+		glog.Errorf("volume %s: failed to get target stats: %v", disk.volID, err)
+		return ""
+	}
+	if resp == nil {
+		return ""
+	}
+	setVolumeIOMetrics(disk.volID, resp)
+
+	var errs uint64
+	for _, st := range []*filter.IOStats{resp.GetLun(), resp.GetBacking()} {
+		for _, ost := range []*filter.IOOpStats{st.GetRead(), st.GetWrite(), st.GetFlush(), st.GetTrim()} {
+			errs += ost.GetErrors()
+		}
+	}
+	ns.mu.Lock()
+	last := disk.ioErrors
+	if staged, ok := ns.disks[disk.volID]; ok {
+		last = staged.ioErrors
+		staged.ioErrors = errs
+	}
+	ns.mu.Unlock()
+	if errs > last {
+		return fmt.Sprintf("%d new I/O errors", errs-last)
+	}
+	return ""
+}
+
+// Record condition of snapshot in the staged disk, true if it has changed
+func (ns *csifNodeServer) updateCondition(disk *csifDisk, cond string) bool {
+	ns.mu.Lock()
+	defer ns.mu.Unlock()
+	staged, ok := ns.disks[disk.volID]
+	if !ok || staged.condition == cond {
+		return false
+	}
+	staged.condition = cond
+	return true
 }
 
 func (ns *csifNodeServer) NodeExpandVolume(_ context.Context, _ *csi.NodeExpandVolumeRequest) (*csi.NodeExpandVolumeResponse, error) {
@@ -293,6 +512,8 @@ func (ns *csifNodeServer) NodeExpandVolume(_ context.Context, _ *csi.NodeExpandV
 func (ns *csifNodeServer) getNSCapabilities() []*csi.NodeServiceCapability {
 	rpcCap := []csi.NodeServiceCapability_RPC_Type{
 		csi.NodeServiceCapability_RPC_STAGE_UNSTAGE_VOLUME,
+		csi.NodeServiceCapability_RPC_GET_VOLUME_STATS,
+		csi.NodeServiceCapability_RPC_VOLUME_CONDITION,
 	}
 
 	var nsCap []*csi.NodeServiceCapability
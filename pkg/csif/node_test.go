@@ -0,0 +1,610 @@
+package csif
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/mount-utils"
+	testingexec "k8s.io/utils/exec/testing"
+)
+
+const (
+	testDriverName = "csif.csi.pooh64.io"
+	testVolID      = "vol-0"
+)
+
+// PV of the test volume, so that events have an object to be recorded on
+func testPV(driver string) *core.PersistentVolume {
+	return &core.PersistentVolume{
+		ObjectMeta: metav1.ObjectMeta{Name: "pv-0"},
+		Spec: core.PersistentVolumeSpec{
+			PersistentVolumeSource: core.PersistentVolumeSource{
+				CSI: &core.CSIPersistentVolumeSource{Driver: driver, VolumeHandle: testVolID},
+			},
+			ClaimRef: &core.ObjectReference{Namespace: "default", Name: "pvc-0"},
+		},
+	}
+}
+
+// Staging dir is created by kubelet
+func stageRequest(t *testing.T, block bool) *csi.NodeStageVolumeRequest {
+	staging := path.Join(t.TempDir(), "staging")
+	if err := os.Mkdir(staging, 0750); err != nil {
+		t.Fatal(err)
+	}
+	capability := &csi.VolumeCapability{
+		AccessType: &csi.VolumeCapability_Mount{Mount: &csi.VolumeCapability_MountVolume{FsType: "ext4"}},
+	}
+	if block {
+		capability.AccessType = &csi.VolumeCapability_Block{Block: &csi.VolumeCapability_BlockVolume{}}
+	}
+	return &csi.NodeStageVolumeRequest{
+		VolumeId:          testVolID,
+		StagingTargetPath: staging,
+		VolumeCapability:  capability,
+		VolumeContext:     map[string]string{"sourcePVC": "source-pvc"},
+	}
+}
+
+func unstageRequest(req *csi.NodeStageVolumeRequest) *csi.NodeUnstageVolumeRequest {
+	return &csi.NodeUnstageVolumeRequest{
+		VolumeId:          req.GetVolumeId(),
+		StagingTargetPath: req.GetStagingTargetPath(),
+	}
+}
+
+// blkid finds no filesystem, mkfs succeeds or fails with mkfsErr
+func (td *testDriver) expectFormat(mkfsErr error) {
+	td.exec.expect("blkid", "", testingexec.FakeExitError{Status: 2})
+	td.exec.expect("mkfs.ext4", "", mkfsErr)
+}
+
+// Nothing of the volume is left on the node
+func (td *testDriver) checkDetached(t *testing.T) {
+	t.Helper()
+	if _, err := td.ns.getDisk(testVolID); err == nil {
+		t.Errorf("disk is still registered")
+	}
+	if states, err := LoadNodeDiskStates(td.cd.stateDir); err != nil || len(states) != 0 {
+		t.Errorf("node state is left: %v, %v", states, err)
+	}
+	if n := td.pods.filter.numTargets(); n != 0 {
+		t.Errorf("%d filter targets are left", n)
+	}
+	if n := td.pods.numRefs(); n != 0 {
+		t.Errorf("%d filter pod refs are left", n)
+	}
+	if out, _ := td.iscsi.GetSessions(); out != "" {
+		t.Errorf("iSCSI sessions are left: %s", out)
+	}
+}
+
+func (td *testDriver) checkEvent(t *testing.T, reason string) {
+	t.Helper()
+	events := td.events()
+	for _, ev := range events {
+		if strings.Contains(ev, " "+reason+" ") {
+			return
+		}
+	}
+	t.Errorf("no %s event in %v", reason, events)
+}
+
+func TestNodeStageUnstageBlock(t *testing.T) {
+	td := newTestDriver(t)
+	ctx := context.Background()
+	req := stageRequest(t, true)
+
+	if _, err := td.ns.NodeStageVolume(ctx, req); err != nil {
+		t.Fatalf("NodeStageVolume: %v", err)
+	}
+	disk, err := td.ns.getDisk(testVolID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(disk.GetDevPath(), "/dev/fake-"+CsifFilterIQNPrefix) {
+		t.Errorf("unexpected device %s", disk.GetDevPath())
+	}
+	states, err := LoadNodeDiskStates(td.cd.stateDir)
+	if err != nil || len(states) != 1 || states[0].Device != disk.GetDevPath() {
+		t.Errorf("bad node state: %+v, %v", states, err)
+	}
+	td.checkEvent(t, eventAttached)
+
+	if _, err := td.ns.NodeUnstageVolume(ctx, unstageRequest(req)); err != nil {
+		t.Fatalf("NodeUnstageVolume: %v", err)
+	}
+	td.checkDetached(t)
+}
+
+func TestNodeStageUnstageMount(t *testing.T) {
+	td := newTestDriver(t)
+	ctx := context.Background()
+	req := stageRequest(t, false)
+	td.expectFormat(nil)
+
+	if _, err := td.ns.NodeStageVolume(ctx, req); err != nil {
+		t.Fatalf("NodeStageVolume: %v", err)
+	}
+	td.exec.done(t)
+	if notMP, _ := td.mounter.IsLikelyNotMountPoint(req.GetStagingTargetPath()); notMP {
+		t.Errorf("staging path is not mounted")
+	}
+
+	if _, err := td.ns.NodeUnstageVolume(ctx, unstageRequest(req)); err != nil {
+		t.Fatalf("NodeUnstageVolume: %v", err)
+	}
+	td.checkDetached(t)
+	if len(td.mounter.MountPoints) != 0 {
+		t.Errorf("mounts are left: %v", td.mounter.MountPoints)
+	}
+}
+
+// Every failed step must undo the previous ones
+func TestNodeStageRollback(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		block  bool
+		setup  func(td *testDriver)
+		code   codes.Code
+		reason string
+	}{
+		{
+			name:   "filter pod",
+			block:  true,
+			setup:  func(td *testDriver) { td.pods.getErr = status.Error(codes.ResourceExhausted, "unschedulable") },
+			code:   codes.ResourceExhausted,
+			reason: eventFilterPodFailed,
+		},
+		{
+			name:   "create target",
+			block:  true,
+			setup:  func(td *testDriver) { td.pods.filter.createErr = status.Error(codes.Internal, "tgtadm failed") },
+			code:   codes.Unknown,
+			reason: eventTargetExportFailed,
+		},
+		{
+			name:   "iscsi login",
+			block:  true,
+			setup:  func(td *testDriver) { td.iscsi.connectErr = fmt.Errorf("login timed out") },
+			code:   codes.Internal,
+			reason: eventISCSILoginFailed,
+		},
+		{
+			name:   "format",
+			setup:  func(td *testDriver) { td.expectFormat(fmt.Errorf("mkfs failed")) },
+			code:   codes.Unknown,
+			reason: eventMountFailed,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			td := newTestDriver(t, testPV(testDriverName))
+			tc.setup(td)
+
+			_, err := td.ns.NodeStageVolume(context.Background(), stageRequest(t, tc.block))
+			if err == nil {
+				t.Fatalf("NodeStageVolume succeeded")
+			}
+			if code := status.Code(err); code != tc.code {
+				t.Errorf("code %v, expected %v: %v", code, tc.code, err)
+			}
+			td.exec.done(t)
+			td.checkDetached(t)
+			td.checkEvent(t, tc.reason)
+		})
+	}
+}
+
+// Failed unstage keeps the disk, so that it can be retried
+func TestNodeUnstageRetry(t *testing.T) {
+	td := newTestDriver(t)
+	ctx := context.Background()
+	req := stageRequest(t, true)
+
+	if _, err := td.ns.NodeUnstageVolume(ctx, unstageRequest(req)); err != nil {
+		t.Errorf("unstage of unknown volume: %v", err)
+	}
+
+	if _, err := td.ns.NodeStageVolume(ctx, req); err != nil {
+		t.Fatalf("NodeStageVolume: %v", err)
+	}
+	td.pods.filter.deleteErr = status.Error(codes.Unavailable, "filter is down")
+	if _, err := td.ns.NodeUnstageVolume(ctx, unstageRequest(req)); err == nil {
+		t.Fatalf("NodeUnstageVolume succeeded")
+	}
+	if _, err := td.ns.getDisk(testVolID); err != nil {
+		t.Errorf("disk is dropped on failed unstage")
+	}
+	if states, _ := LoadNodeDiskStates(td.cd.stateDir); len(states) != 1 {
+		t.Errorf("node state is dropped on failed unstage")
+	}
+
+	td.pods.filter.deleteErr = nil
+	if _, err := td.ns.NodeUnstageVolume(ctx, unstageRequest(req)); err != nil {
+		t.Fatalf("NodeUnstageVolume retry: %v", err)
+	}
+	td.checkDetached(t)
+	if td.iscsi.disconnects != 1 {
+		t.Errorf("%d iSCSI logouts, expected 1", td.iscsi.disconnects)
+	}
+}
+
+type failingMounter struct {
+	*mount.FakeMounter
+	err error
+}
+
+func (m *failingMounter) Mount(source, target, fstype string, options []string) error {
+	return m.err
+}
+
+func TestNodePublish(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		block    bool
+		mountErr error
+	}{
+		{name: "mount"},
+		{name: "block", block: true},
+		{name: "mount failure", mountErr: fmt.Errorf("bind failed")},
+		{name: "block failure", block: true, mountErr: fmt.Errorf("bind failed")},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			td := newTestDriver(t)
+			ctx := context.Background()
+			sreq := stageRequest(t, tc.block)
+			if !tc.block {
+				td.expectFormat(nil)
+			}
+			if _, err := td.ns.NodeStageVolume(ctx, sreq); err != nil {
+				t.Fatalf("NodeStageVolume: %v", err)
+			}
+			if tc.mountErr != nil {
+				td.ns.mounter.Interface = &failingMounter{td.mounter, tc.mountErr}
+			}
+
+			target := path.Join(t.TempDir(), "target")
+			preq := &csi.NodePublishVolumeRequest{
+				VolumeId:          testVolID,
+				StagingTargetPath: sreq.GetStagingTargetPath(),
+				TargetPath:        target,
+				VolumeCapability:  sreq.GetVolumeCapability(),
+				Readonly:          true,
+			}
+			_, err := td.ns.NodePublishVolume(ctx, preq)
+			if tc.mountErr != nil {
+				if err == nil {
+					t.Fatalf("NodePublishVolume succeeded")
+				}
+				if _, err := os.Stat(target); !os.IsNotExist(err) {
+					t.Errorf("target is left after failed publish: %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("NodePublishVolume: %v", err)
+			}
+			if notMP, _ := td.mounter.IsLikelyNotMountPoint(target); notMP {
+				t.Errorf("target is not mounted")
+			}
+
+			ureq := &csi.NodeUnpublishVolumeRequest{VolumeId: testVolID, TargetPath: target}
+			if _, err := td.ns.NodeUnpublishVolume(ctx, ureq); err != nil {
+				t.Fatalf("NodeUnpublishVolume: %v", err)
+			}
+			if notMP, _ := td.mounter.IsLikelyNotMountPoint(target); !notMP {
+				t.Errorf("target is still mounted")
+			}
+		})
+	}
+}
+
+func TestNodePublishNotStaged(t *testing.T) {
+	td := newTestDriver(t)
+	req := &csi.NodePublishVolumeRequest{
+		VolumeId:          testVolID,
+		StagingTargetPath: "/staging",
+		TargetPath:        "/target",
+		VolumeCapability:  stageRequest(t, true).GetVolumeCapability(),
+	}
+	if _, err := td.ns.NodePublishVolume(context.Background(), req); status.Code(err) != codes.NotFound {
+		t.Errorf("publish of unstaged volume: %v", err)
+	}
+}
+
+func TestNodeVolumeBusy(t *testing.T) {
+	td := newTestDriver(t)
+	ctx := context.Background()
+	req := stageRequest(t, true)
+
+	td.ns.locks.tryAcquire(testVolID)
+	_, err := td.ns.NodeStageVolume(ctx, req)
+	expectCode(t, "NodeStageVolume of busy volume", err, codes.Aborted)
+	_, err = td.ns.NodeUnstageVolume(ctx, unstageRequest(req))
+	expectCode(t, "NodeUnstageVolume of busy volume", err, codes.Aborted)
+	td.checkDetached(t)
+
+	td.ns.locks.release(testVolID)
+	if _, err := td.ns.NodeStageVolume(ctx, req); err != nil {
+		t.Fatalf("NodeStageVolume: %v", err)
+	}
+
+	// stats are read-only, kubelet polling them must not abort operations
+	td.ns.locks.tryAcquire(testVolID)
+	_, err = td.ns.NodeGetVolumeStats(ctx, &csi.NodeGetVolumeStatsRequest{
+		VolumeId:   testVolID,
+		VolumePath: req.GetStagingTargetPath(),
+	})
+	if err != nil {
+		t.Errorf("NodeGetVolumeStats of busy volume: %v", err)
+	}
+	td.ns.locks.release(testVolID)
+
+	if _, err := td.ns.NodeUnstageVolume(ctx, unstageRequest(req)); err != nil {
+		t.Fatalf("NodeUnstageVolume: %v", err)
+	}
+}
+
+// Concurrent stage, unstage and stats of a few volumes must neither fail nor leak
+func TestNodeStageConcurrent(t *testing.T) {
+	const (
+		volumes    = 4
+		workers    = 16
+		iterations = 50
+	)
+	td := newTestDriver(t)
+	td.cd.recorder = nil
+	ctx := context.Background()
+
+	reqs := make([]*csi.NodeStageVolumeRequest, volumes)
+	for i := range reqs {
+		reqs[i] = stageRequest(t, true)
+		reqs[i].VolumeId = fmt.Sprintf("vol-%d", i)
+	}
+
+	var wg sync.WaitGroup
+	var aborted int32
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			rnd := rand.New(rand.NewSource(int64(w)))
+			for i := 0; i < iterations; i++ {
+				req := reqs[rnd.Intn(volumes)]
+				var err error
+				switch rnd.Intn(3) {
+				case 0:
+					_, err = td.ns.NodeStageVolume(ctx, req)
+				case 1:
+					_, err = td.ns.NodeUnstageVolume(ctx, unstageRequest(req))
+				case 2:
+					_, err = td.ns.NodeGetVolumeStats(ctx, &csi.NodeGetVolumeStatsRequest{
+						VolumeId:   req.GetVolumeId(),
+						VolumePath: req.GetStagingTargetPath(),
+					})
+					if status.Code(err) == codes.NotFound {
+						continue // not staged
+					} else if status.Code(err) == codes.Aborted {
+						t.Errorf("NodeGetVolumeStats of %s is aborted", req.GetVolumeId())
+						continue
+					}
+				}
+				switch status.Code(err) {
+				case codes.Aborted:
+					atomic.AddInt32(&aborted, 1)
+				case codes.OK:
+				default:
+					t.Errorf("volume %s: %v", req.GetVolumeId(), err)
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	t.Logf("%d calls aborted", aborted)
+
+	td.ns.mu.Lock()
+	staged := len(td.ns.disks)
+	td.ns.mu.Unlock()
+	if n := td.pods.filter.numTargets(); n != staged {
+		t.Errorf("%d filter targets for %d staged volumes", n, staged)
+	}
+	if n := td.pods.numRefs(); n != staged {
+		t.Errorf("%d filter pod refs for %d staged volumes", n, staged)
+	}
+
+	for _, req := range reqs {
+		if _, err := td.ns.NodeUnstageVolume(ctx, unstageRequest(req)); err != nil {
+			t.Errorf("NodeUnstageVolume: %v", err)
+		}
+	}
+	if n := td.pods.filter.numTargets(); n != 0 {
+		t.Errorf("%d filter targets are left", n)
+	}
+	if n := td.pods.numRefs(); n != 0 {
+		t.Errorf("%d filter pod refs are left", n)
+	}
+	if out, _ := td.iscsi.GetSessions(); out != "" {
+		t.Errorf("iSCSI sessions are left: %s", out)
+	}
+	if states, err := LoadNodeDiskStates(td.cd.stateDir); err != nil || len(states) != 0 {
+		t.Errorf("node state is left: %v, %v", states, err)
+	}
+}
+
+func TestNodeStageIdempotent(t *testing.T) {
+	for _, block := range []bool{true, false} {
+		t.Run(fmt.Sprintf("block=%v", block), func(t *testing.T) {
+			td := newTestDriver(t)
+			ctx := context.Background()
+			req := stageRequest(t, block)
+			if !block {
+				td.expectFormat(nil)
+			}
+			for i := 0; i < 2; i++ {
+				if _, err := td.ns.NodeStageVolume(ctx, req); err != nil {
+					t.Fatalf("NodeStageVolume #%d: %v", i, err)
+				}
+			}
+			td.exec.done(t)
+			if n := td.pods.filter.numTargets(); n != 1 {
+				t.Errorf("%d filter targets", n)
+			}
+			if n := td.pods.numRefs(); n != 1 {
+				t.Errorf("%d filter pod refs", n)
+			}
+
+			conflicts := map[string]*csi.NodeStageVolumeRequest{
+				"access type": stageRequest(t, !block),
+				"context":     stageRequest(t, block),
+				"path":        stageRequest(t, block),
+			}
+			conflicts["access type"].StagingTargetPath = req.GetStagingTargetPath()
+			conflicts["context"].StagingTargetPath = req.GetStagingTargetPath()
+			conflicts["context"].VolumeContext = map[string]string{"sourcePVC": "other-pvc"}
+			for what, creq := range conflicts {
+				_, err := td.ns.NodeStageVolume(ctx, creq)
+				expectCode(t, "NodeStageVolume with other "+what, err, codes.AlreadyExists)
+			}
+
+			disk, _ := td.ns.getDisk(testVolID)
+			td.iscsi.Disconnect(disk.targetConn.Targets[0].Iqn, nil)
+			_, err := td.ns.NodeStageVolume(ctx, req)
+			expectCode(t, "NodeStageVolume without session", err, codes.FailedPrecondition)
+
+			for i := 0; i < 2; i++ {
+				if _, err := td.ns.NodeUnstageVolume(ctx, unstageRequest(req)); err != nil {
+					t.Fatalf("NodeUnstageVolume #%d: %v", i, err)
+				}
+			}
+			td.checkDetached(t)
+		})
+	}
+}
+
+// Target is left in the filter pod, but node state is lost
+func TestNodeStageStaleTarget(t *testing.T) {
+	td := newTestDriver(t)
+	ctx := context.Background()
+	req := stageRequest(t, true)
+	td.pods.filter.targets[testVolID] = true
+
+	if _, err := td.ns.NodeStageVolume(ctx, req); err != nil {
+		t.Fatalf("NodeStageVolume: %v", err)
+	}
+	if n := td.pods.filter.numTargets(); n != 1 {
+		t.Errorf("%d filter targets", n)
+	}
+	if _, err := td.ns.NodeUnstageVolume(ctx, unstageRequest(req)); err != nil {
+		t.Fatalf("NodeUnstageVolume: %v", err)
+	}
+	td.checkDetached(t)
+}
+
+func TestNodePublishIdempotent(t *testing.T) {
+	for _, block := range []bool{true, false} {
+		t.Run(fmt.Sprintf("block=%v", block), func(t *testing.T) {
+			td := newTestDriver(t)
+			ctx := context.Background()
+			sreq := stageRequest(t, block)
+			if !block {
+				td.expectFormat(nil)
+			}
+			if _, err := td.ns.NodeStageVolume(ctx, sreq); err != nil {
+				t.Fatalf("NodeStageVolume: %v", err)
+			}
+			mounts := len(td.mounter.MountPoints)
+
+			preq := &csi.NodePublishVolumeRequest{
+				VolumeId:          testVolID,
+				StagingTargetPath: sreq.GetStagingTargetPath(),
+				TargetPath:        path.Join(t.TempDir(), "target"),
+				VolumeCapability:  sreq.GetVolumeCapability(),
+				Readonly:          true,
+			}
+			for i := 0; i < 2; i++ {
+				if _, err := td.ns.NodePublishVolume(ctx, preq); err != nil {
+					t.Fatalf("NodePublishVolume #%d: %v", i, err)
+				}
+			}
+			if n := len(td.mounter.MountPoints) - mounts; n != 1 {
+				t.Errorf("%d mounts of target", n)
+			}
+
+			preq.Readonly = false
+			_, err := td.ns.NodePublishVolume(ctx, preq)
+			expectCode(t, "NodePublishVolume with other access mode", err, codes.AlreadyExists)
+			preq.VolumeCapability = stageRequest(t, !block).GetVolumeCapability()
+			_, err = td.ns.NodePublishVolume(ctx, preq)
+			expectCode(t, "NodePublishVolume with other access type", err, codes.InvalidArgument)
+
+			ureq := &csi.NodeUnpublishVolumeRequest{VolumeId: testVolID, TargetPath: preq.GetTargetPath()}
+			for i := 0; i < 2; i++ {
+				if _, err := td.ns.NodeUnpublishVolume(ctx, ureq); err != nil {
+					t.Fatalf("NodeUnpublishVolume #%d: %v", i, err)
+				}
+			}
+			if _, err := td.ns.NodeUnstageVolume(ctx, unstageRequest(sreq)); err != nil {
+				t.Fatalf("NodeUnstageVolume: %v", err)
+			}
+			if _, err := td.ns.NodeUnpublishVolume(ctx, ureq); err != nil {
+				t.Errorf("NodeUnpublishVolume of unstaged volume: %v", err)
+			}
+		})
+	}
+}
+
+// Filter advertising more portals makes a multipath device
+func TestNodeStageMultipath(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		portals []string
+		logout  []string
+	}{
+		{name: "single path", logout: []string{"10.0.0.1:9821"}},
+		{name: "multipath", portals: []string{"10.1.0.1"}, logout: []string{"10.0.0.1:9821", "10.1.0.1:9821"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			td := newTestDriver(t)
+			ctx := context.Background()
+			req := stageRequest(t, true)
+			td.pods.filter.portals = tc.portals
+
+			if _, err := td.ns.NodeStageVolume(ctx, req); err != nil {
+				t.Fatalf("NodeStageVolume: %v", err)
+			}
+			states, err := LoadNodeDiskStates(td.cd.stateDir)
+			if err != nil || len(states) != 1 {
+				t.Fatalf("node state: %v, %v", states, err)
+			}
+			c := states[0].Connector
+			if len(c.Targets) != len(tc.logout) || c.Multipath != (len(tc.logout) > 1) {
+				t.Errorf("connector with %d targets, multipath=%v", len(c.Targets), c.Multipath)
+			}
+			dev := states[0].Device
+
+			if _, err := td.ns.NodeUnstageVolume(ctx, unstageRequest(req)); err != nil {
+				t.Fatalf("NodeUnstageVolume: %v", err)
+			}
+			td.checkDetached(t)
+			if strings.Join(td.iscsi.portals, " ") != strings.Join(tc.logout, " ") {
+				t.Errorf("logged out of %v, expected %v", td.iscsi.portals, tc.logout)
+			}
+			flushed := len(td.iscsi.flushed) == 1 && td.iscsi.flushed[0] == dev
+			if flushed != (len(tc.logout) > 1) {
+				t.Errorf("flushed multipath devices %v", td.iscsi.flushed)
+			}
+		})
+	}
+}
@@ -0,0 +1,157 @@
+package csif
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"golang.org/x/sys/unix"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"k8s.io/mount-utils"
+)
+
+// Node calls are retried by kubelet, also after plugin restart. Work already
+// done is verified against what was recorded and reported as success, a
+// retry with different arguments is a conflict
+
+// How the disk is staged, recorded in node state
+type diskStaging struct {
+	Path       string   `json:"path"`
+	Block      bool     `json:"block,omitempty"`
+	FsType     string   `json:"fsType,omitempty"`
+	MountFlags []string `json:"mountFlags,omitempty"`
+}
+
+func newDiskStaging(req *csi.NodeStageVolumeRequest) *diskStaging {
+	st := &diskStaging{Path: req.GetStagingTargetPath()}
+	if mnt := req.GetVolumeCapability().GetMount(); mnt != nil {
+		st.FsType = mnt.GetFsType()
+		st.MountFlags = append([]string{}, mnt.GetMountFlags()...)
+		sort.Strings(st.MountFlags)
+	} else {
+		st.Block = true
+	}
+	return st
+}
+
+func (st *diskStaging) String() string {
+	if st.Block {
+		return fmt.Sprintf("as block at %s", st.Path)
+	}
+	return fmt.Sprintf("as %q with flags %v at %s", st.FsType, st.MountFlags, st.Path)
+}
+
+// Retried NodeStageVolume of a staged disk
+func (ns *csifNodeServer) verifyStaged(disk *csifDisk, req *csi.NodeStageVolumeRequest) error {
+	volID := req.GetVolumeId()
+	want := newCsifDisk(ns.cd)
+	if err := want.LoadContext(req.GetVolumeContext()); err != nil {
+		return status.Errorf(codes.InvalidArgument, "bad volume context: %v", err)
+	}
+	if !reflect.DeepEqual(want.SaveContext(), disk.SaveContext()) {
+		return status.Errorf(codes.AlreadyExists, "volume %s is staged with another volume context", volID)
+	}
+	// unknown for disks staged by older plugin versions
+	if st := newDiskStaging(req); disk.staging != nil && !reflect.DeepEqual(st, disk.staging) {
+		return status.Errorf(codes.AlreadyExists, "volume %s is staged %v, requested %v", volID, disk.staging, st)
+	}
+
+	if !disk.targetExists || disk.targetConn == nil {
+		return status.Errorf(codes.FailedPrecondition, "volume %s is staged, but its filter target is gone", volID)
+	}
+	sessions, err := listFilterSessions(ns.cd.iscsi)
+	if err != nil {
+		return status.Errorf(codes.Internal, "%v", err)
+	}
+	iqn := disk.targetConn.Targets[0].Iqn
+	for _, s := range sessions {
+		if s[1] == iqn {
+			return nil
+		}
+	}
+	return status.Errorf(codes.FailedPrecondition, "volume %s is staged, but iSCSI session to %s is gone", volID, iqn)
+}
+
+// Topmost mount on path, nil if there is none
+func (ns *csifNodeServer) findMount(path string) (*mount.MountPoint, error) {
+	mps, err := ns.mounter.List()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list mounts: %v", err)
+	}
+	var found *mount.MountPoint
+	for i := range mps {
+		if mps[i].Path == path {
+			found = &mps[i]
+		}
+	}
+	return found, nil
+}
+
+// Both are the same block device, mount table may name it differently
+func sameDevice(a, b string) bool {
+	if a == b {
+		return true
+	}
+	var sa, sb unix.Stat_t
+	if unix.Stat(a, &sa) != nil || unix.Stat(b, &sb) != nil {
+		return false
+	}
+	return sa.Mode&unix.S_IFMT == unix.S_IFBLK && sb.Mode&unix.S_IFMT == unix.S_IFBLK && sa.Rdev == sb.Rdev
+}
+
+func hasOption(opts []string, opt string) bool {
+	for _, o := range opts {
+		if o == opt {
+			return true
+		}
+	}
+	return false
+}
+
+// Existing mount of the staging path must be of the disk
+func (ns *csifNodeServer) verifyStagingMount(req *csi.NodeStageVolumeRequest, devPath string) error {
+	mp, err := ns.findMount(req.GetStagingTargetPath())
+	if err != nil || mp == nil {
+		return err
+	}
+	if !sameDevice(mp.Device, devPath) {
+		return status.Errorf(codes.AlreadyExists, "staging path %s is mounted from %s, not %s",
+			mp.Path, mp.Device, devPath)
+	}
+	if fsType := req.GetVolumeCapability().GetMount().GetFsType(); fsType != "" && mp.Type != fsType {
+		return status.Errorf(codes.AlreadyExists, "staging path %s is mounted as %s, not %s",
+			mp.Path, mp.Type, fsType)
+	}
+	return nil
+}
+
+// Existing mount of the target must be a bind of the staged disk with the
+// same access mode. Bind of a block device is seen as mount of devtmpfs,
+// so the target itself is compared
+func (ns *csifNodeServer) verifyPublished(disk *csifDisk, req *csi.NodePublishVolumeRequest) error {
+	target := req.GetTargetPath()
+	mp, err := ns.findMount(target)
+	if err != nil {
+		return err
+	}
+	if mp == nil {
+		return status.Errorf(codes.Internal, "target %s is a mount point, but not in mount table", target)
+	}
+
+	source := sameDevice(mp.Device, disk.GetDevPath())
+	if req.GetVolumeCapability().GetBlock() != nil {
+		source = source || sameDevice(target, disk.GetDevPath())
+	} else {
+		source = source || mp.Device == req.GetStagingTargetPath()
+	}
+	if !source {
+		return status.Errorf(codes.AlreadyExists, "target %s is mounted from %s, not volume %s",
+			target, mp.Device, req.GetVolumeId())
+	}
+	if ro := hasOption(mp.Opts, "ro"); ro != req.GetReadonly() {
+		return status.Errorf(codes.AlreadyExists, "target %s is mounted with readonly=%v", target, ro)
+	}
+	return nil
+}
@@ -0,0 +1,196 @@
+package csif
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+	lib_iscsi "github.com/pooh64/csi-lib-iscsi/iscsi"
+	"golang.org/x/net/context"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Node state: staged disks are recorded in --state-dir, so that the plugin
+// can unstage them and tell them from leftovers after restart
+
+const (
+	nodeStateSuffix         = ".json"
+	nodeStateRestoreTimeout = 30 * time.Second // per filter pod
+)
+
+// Staged disk as recorded in state dir, also read by csifctl
+type NodeDiskState struct {
+	VolumeID     string               `json:"volumeID"`
+	Context      map[string]string    `json:"context"`
+	FilterPod    string               `json:"filterPod,omitempty"`
+	PodNamespace string               `json:"podNamespace,omitempty"`
+	PodKey       string               `json:"podKey,omitempty"`
+	Daemon       bool                 `json:"daemon,omitempty"`
+	Local        bool                 `json:"local,omitempty"`
+	TargetExists bool                 `json:"targetExists,omitempty"`
+	Connector    *lib_iscsi.Connector `json:"connector,omitempty"`
+	Device       string               `json:"device,omitempty"`
+	Staging      *diskStaging         `json:"staging,omitempty"`
+}
+
+// Volume IDs are arbitrary strings
+func nodeStateFile(dir, volID string) string {
+	sum := sha256.Sum256([]byte(volID))
+	return path.Join(dir, hex.EncodeToString(sum[:16])+nodeStateSuffix)
+}
+
+func (d *csifDisk) nodeState() *NodeDiskState {
+	st := &NodeDiskState{
+		VolumeID:     d.volID,
+		Context:      d.SaveContext(),
+		TargetExists: d.targetExists,
+		Connector:    d.targetConn,
+		Device:       d.dev,
+		Staging:      d.staging,
+	}
+	if fp := d.filterPod; fp != nil {
+		st.FilterPod = fp.pod.Name
+		st.PodNamespace = fp.pod.Namespace
+		st.PodKey = fp.key
+		st.Daemon = fp.daemon
+		st.Local = fp.local
+	}
+	return st
+}
+
+// Write via rename, state is never seen half-written
+func saveNodeDiskState(dir string, d *csifDisk) error {
+	if dir == "" {
+		return nil
+	}
+	jbyt, err := json.Marshal(d.nodeState())
+	if err != nil {
+		return err
+	}
+	file := nodeStateFile(dir, d.volID)
+	tmp := file + ".tmp"
+	if err := ioutil.WriteFile(tmp, jbyt, 0600); err != nil {
+		return fmt.Errorf("failed to write node state: %v", err)
+	}
+	if err := os.Rename(tmp, file); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write node state: %v", err)
+	}
+	return nil
+}
+
+func RemoveNodeDiskState(dir, volID string) error {
+	if dir == "" {
+		return nil
+	}
+	if err := os.Remove(nodeStateFile(dir, volID)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove node state: %v", err)
+	}
+	return nil
+}
+
+func LoadNodeDiskStates(dir string) ([]*NodeDiskState, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read state dir: %v", err)
+	}
+
+	var states []*NodeDiskState
+	for _, f := range files {
+		if f.IsDir() || !strings.HasSuffix(f.Name(), nodeStateSuffix) {
+			continue
+		}
+		jbyt, err := ioutil.ReadFile(path.Join(dir, f.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read node state: %v", err)
+		}
+		st := &NodeDiskState{}
+		if err := json.Unmarshal(jbyt, st); err != nil {
+			glog.Errorf("bad node state %s, skip: %v", f.Name(), err)
+			continue
+		}
+		states = append(states, st)
+	}
+	return states, nil
+}
+
+// Take the filter pod of restored disk, nil if it is gone
+func (cd *csifDriver) adoptFilterPod(ctx context.Context, st *NodeDiskState) (*filterPod, error) {
+	fp, err := cd.lookupFilterPod(ctx, st.PodKey)
+	if fp != nil || err != nil {
+		return fp, err
+	}
+	fp, err = cd.restoreFilterPod(ctx, st)
+	cd.publishFilterPod(st.PodKey, fp)
+	return fp, err
+}
+
+func (cd *csifDriver) restoreFilterPod(ctx context.Context, st *NodeDiskState) (*filterPod, error) {
+	pod, err := cd.clientset.CoreV1().Pods(st.PodNamespace).Get(ctx, st.FilterPod, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to get filter pod %s: %v", st.FilterPod, err)
+	}
+	if pod.DeletionTimestamp != nil || pod.Status.PodIP == "" {
+		return nil, nil
+	}
+
+	fp := &filterPod{key: st.PodKey, pod: pod, refs: 1, daemon: st.Daemon, local: st.Local}
+	if fp.conn, err = dialFilterPod(ctx, pod); err != nil {
+		return nil, err
+	}
+	return fp, nil
+}
+
+// Rebuild disks staged before restart
+func (ns *csifNodeServer) restoreDisks() error {
+	if err := os.MkdirAll(ns.cd.stateDir, 0700); err != nil {
+		return fmt.Errorf("failed to create state dir: %v", err)
+	}
+	states, err := LoadNodeDiskStates(ns.cd.stateDir)
+	if err != nil {
+		return err
+	}
+
+	for _, st := range states {
+		disk := newCsifDisk(ns.cd)
+		if err := disk.LoadContext(st.Context); err != nil {
+			glog.Errorf("volume %s: bad saved context, skip: %v", st.VolumeID, err)
+			continue
+		}
+		disk.volID = st.VolumeID
+		disk.targetConn = st.Connector
+		disk.dev = st.Device
+		disk.staging = st.Staging
+
+		ctx, cancel := context.WithTimeout(context.Background(), nodeStateRestoreTimeout)
+		if err := disk.resolveVolumeRefs(ctx); err != nil {
+			glog.Errorf("volume %s: no events on PV: %v", st.VolumeID, err)
+		}
+		if st.FilterPod != "" {
+			if disk.filterPod, err = ns.cd.adoptFilterPod(ctx, st); err != nil {
+				cancel()
+				return fmt.Errorf("volume %s: %v", st.VolumeID, err)
+			}
+		}
+		cancel()
+		// target went away with the pod
+		disk.targetExists = st.TargetExists && disk.filterPod != nil
+
+		ns.mu.Lock()
+		ns.disks[st.VolumeID] = disk
+		stagedVolumes.Set(float64(len(ns.disks)))
+		ns.mu.Unlock()
+		glog.Infof("volume %s: restored, filter pod %q", st.VolumeID, st.FilterPod)
+	}
+	return nil
+}
@@ -0,0 +1,203 @@
+package csif
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"golang.org/x/net/context"
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/kubernetes"
+	"sigs.k8s.io/yaml"
+)
+
+// Filter pod template: loaded at startup from a file (mounted ConfigMap) or
+// a ConfigMap via API. Volumes may override it with filterPodTemplate
+// attribute (StorageClass parameter), which is merged over the driver one.
+
+const (
+	filterPodTemplateKey = "template.yaml" // ConfigMap key
+)
+
+type filterPodTemplate struct {
+	Image              string                    `json:"image,omitempty"`
+	ImagePullPolicy    core.PullPolicy           `json:"imagePullPolicy,omitempty"`
+	Namespace          string                    `json:"namespace,omitempty"`
+	Resources          core.ResourceRequirements `json:"resources,omitempty"`
+	Tolerations        []core.Toleration         `json:"tolerations,omitempty"`
+	NodeSelector       map[string]string         `json:"nodeSelector,omitempty"`
+	PriorityClassName  string                    `json:"priorityClassName,omitempty"`
+	ServiceAccountName string                    `json:"serviceAccountName,omitempty"`
+	ExtraArgs          []string                  `json:"extraArgs,omitempty"`
+
+	// multipath: addresses of these interfaces are advertised as portals
+	// in addition to pod IP, e.g. of networks attached via Annotations.
+	// Paths are redundant networks to one pod, not to a standby filter
+	Annotations      map[string]string `json:"annotations,omitempty"`
+	PortalInterfaces []string          `json:"portalInterfaces,omitempty"`
+}
+
+func defaultFilterPodTemplate() *filterPodTemplate {
+	return &filterPodTemplate{
+		Image:           "pooh64/csif-filter:latest",
+		ImagePullPolicy: core.PullAlways,
+		Namespace:       "default",
+		ExtraArgs:       []string{"--v=5"},
+	}
+}
+
+// Decode YAML or JSON over a copy of the template
+func (t *filterPodTemplate) merge(data []byte) (*filterPodTemplate, error) {
+	jbyt, err := json.Marshal(t)
+	if err != nil {
+		return nil, err
+	}
+	out := &filterPodTemplate{}
+	if err := json.Unmarshal(jbyt, out); err != nil {
+		return nil, err
+	}
+	if err := yaml.UnmarshalStrict(data, out); err != nil {
+		return nil, fmt.Errorf("failed to decode: %v", err)
+	}
+	if err := out.validate(); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (t *filterPodTemplate) validate() error {
+	if t.Image == "" {
+		return fmt.Errorf("no image")
+	}
+	switch t.ImagePullPolicy {
+	case core.PullAlways, core.PullIfNotPresent, core.PullNever:
+	default:
+		return fmt.Errorf("bad imagePullPolicy: %s", t.ImagePullPolicy)
+	}
+	if errs := validation.IsDNS1123Label(t.Namespace); len(errs) != 0 {
+		return fmt.Errorf("bad namespace %q: %s", t.Namespace, strings.Join(errs, ", "))
+	}
+	for _, name := range []string{t.PriorityClassName, t.ServiceAccountName} {
+		if name == "" {
+			continue
+		}
+		if errs := validation.IsDNS1123Subdomain(name); len(errs) != 0 {
+			return fmt.Errorf("bad name %q: %s", name, strings.Join(errs, ", "))
+		}
+	}
+
+	for k := range t.Annotations {
+		if errs := validation.IsQualifiedName(k); len(errs) != 0 {
+			return fmt.Errorf("bad annotation %q: %s", k, strings.Join(errs, ", "))
+		}
+	}
+	for _, iface := range t.PortalInterfaces {
+		if iface == "" || strings.ContainsAny(iface, ", /") {
+			return fmt.Errorf("bad portal interface %q", iface)
+		}
+	}
+
+	for k, v := range t.NodeSelector {
+		if errs := validation.IsQualifiedName(k); len(errs) != 0 {
+			return fmt.Errorf("bad nodeSelector key %q: %s", k, strings.Join(errs, ", "))
+		}
+		if errs := validation.IsValidLabelValue(v); len(errs) != 0 {
+			return fmt.Errorf("bad nodeSelector value %q: %s", v, strings.Join(errs, ", "))
+		}
+	}
+
+	for _, tol := range t.Tolerations {
+		switch tol.Operator {
+		case core.TolerationOpEqual, "":
+		case core.TolerationOpExists:
+			if tol.Value != "" {
+				return fmt.Errorf("toleration %q: value must be empty for Exists", tol.Key)
+			}
+		default:
+			return fmt.Errorf("toleration %q: bad operator %s", tol.Key, tol.Operator)
+		}
+		switch tol.Effect {
+		case core.TaintEffectNoSchedule, core.TaintEffectPreferNoSchedule, core.TaintEffectNoExecute, "":
+		default:
+			return fmt.Errorf("toleration %q: bad effect %s", tol.Key, tol.Effect)
+		}
+	}
+
+	for name, req := range t.Resources.Requests {
+		if lim, ok := t.Resources.Limits[name]; ok && req.Cmp(lim) > 0 {
+			return fmt.Errorf("%s request %s exceeds limit %s", name, req.String(), lim.String())
+		}
+	}
+
+	// Set by driver, must match plugin side
+	for _, arg := range t.ExtraArgs {
+		for _, flag := range []string{"--endpoint", "--tgtport", "--tgtcontrol", "--metrics-address", "--portal-interfaces"} {
+			if arg == flag || strings.HasPrefix(arg, flag+"=") {
+				return fmt.Errorf("%s can't be set in extraArgs", flag)
+			}
+		}
+	}
+	return nil
+}
+
+// Load driver template from file or "namespace/name" ConfigMap
+func loadFilterPodTemplate(clientset kubernetes.Interface, file, configMap string) (*filterPodTemplate, error) {
+	t := defaultFilterPodTemplate()
+	var data []byte
+	var err error
+
+	switch {
+	case file != "" && configMap != "":
+		return nil, fmt.Errorf("both template file and ConfigMap are set")
+	case file != "":
+		if data, err = ioutil.ReadFile(file); err != nil {
+			return nil, fmt.Errorf("failed to read template: %v", err)
+		}
+	case configMap != "":
+		parts := strings.Split(configMap, "/")
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("ConfigMap must be namespace/name: %s", configMap)
+		}
+		cm, err := clientset.CoreV1().ConfigMaps(parts[0]).Get(context.TODO(), parts[1], metav1.GetOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("failed to get ConfigMap %s: %v", configMap, err)
+		}
+		str, ok := cm.Data[filterPodTemplateKey]
+		if !ok {
+			return nil, fmt.Errorf("no %s in ConfigMap %s", filterPodTemplateKey, configMap)
+		}
+		data = []byte(str)
+	default:
+		return t, t.validate()
+	}
+	return t.merge(data)
+}
+
+// Driver template with volume overrides. Pod is placed in the namespace of
+// source PVC, so template namespace is not overridable
+func (d *csifDisk) podTemplate() (*filterPodTemplate, error) {
+	base := d.cd.podTemplate
+	t := base
+	if d.FilterPodTemplate != "" {
+		var err error
+		if t, err = base.merge([]byte(d.FilterPodTemplate)); err != nil {
+			return nil, fmt.Errorf("bad filterPodTemplate: %v", err)
+		}
+		if t.Namespace != base.Namespace {
+			return nil, fmt.Errorf("bad filterPodTemplate: namespace can't be overridden")
+		}
+	}
+
+	if ns := d.sourceNamespace(); ns != t.Namespace {
+		if errs := validation.IsDNS1123Label(ns); len(errs) != 0 {
+			return nil, fmt.Errorf("bad sourcePVCNamespace %q: %s", ns, strings.Join(errs, ", "))
+		}
+		tns := *t
+		tns.Namespace = ns
+		t = &tns
+	}
+	return t, nil
+}
@@ -0,0 +1,283 @@
+package csif
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/pooh64/csif-driver/pkg/filter"
+	"golang.org/x/net/context"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// Reconciler: filter pods, iSCSI sessions and tgtd targets left by crashes or
+// failed teardown are found by comparing them with staged disks of the node
+// and VolumeAttachments. Leftovers are removed only if seen on two passes in
+// a row, so that staging in progress is not torn down.
+
+const (
+	reconcilePodGrace = 2 * time.Minute // pod creation is in progress
+	reconcileTimeout  = 30 * time.Second
+)
+
+type reconciler struct {
+	cd       *csifDriver
+	interval time.Duration
+
+	suspects map[string]bool // leftovers seen on the previous pass
+}
+
+func newReconciler(cd *csifDriver, interval time.Duration) *reconciler {
+	return &reconciler{
+		cd:       cd,
+		interval: interval,
+		suspects: map[string]bool{},
+	}
+}
+
+// What the node is known to use
+type reconcileKnown struct {
+	volumes  map[string]bool            // volume IDs
+	pods     map[string]*filterPod      // by pod name
+	targets  map[string]map[string]bool // volume IDs by pod name
+	sessions map[string]bool            // portal iqn
+}
+
+func sessionKey(portal, iqn string) string {
+	return portal + " " + iqn
+}
+
+func (r *reconciler) known(ctx context.Context) (*reconcileKnown, error) {
+	k := &reconcileKnown{
+		volumes:  map[string]bool{},
+		pods:     map[string]*filterPod{},
+		targets:  map[string]map[string]bool{},
+		sessions: map[string]bool{},
+	}
+
+	// pods first: disk being staged has its pod registered before disk
+	r.cd.podsMu.Lock()
+	for _, fp := range r.cd.filterPods {
+		k.pods[fp.pod.Name] = fp
+		k.targets[fp.pod.Name] = map[string]bool{}
+	}
+	// being created, named by key unless claimed from warm pool
+	for key := range r.cd.podsPending {
+		if _, ok := k.pods[key]; !ok {
+			k.pods[key] = nil
+		}
+	}
+	r.cd.podsMu.Unlock()
+
+	// disk fields are read under ns.mu. Volumes in operation may have
+	// resources not recorded in disks yet, they are left alone
+	ns := r.cd.ns
+	ns.mu.RLock()
+	for _, volID := range ns.locks.held() {
+		k.volumes[volID] = true
+	}
+	for volID, d := range ns.disks {
+		k.volumes[volID] = true
+		if fp := d.filterPod; fp != nil {
+			if k.targets[fp.pod.Name] == nil {
+				k.targets[fp.pod.Name] = map[string]bool{}
+			}
+			k.targets[fp.pod.Name][volID] = true
+		}
+		if c := d.targetConn; c != nil {
+			for _, t := range c.Targets {
+				k.sessions[sessionKey(t.Portal+":"+t.Port, t.Iqn)] = true
+			}
+		}
+	}
+	ns.mu.RUnlock()
+
+	// attachments are kept even if the plugin lost track of them
+	vas, err := r.cd.clientset.StorageV1().VolumeAttachments().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list VolumeAttachments: %v", err)
+	}
+	for _, va := range vas.Items {
+		if va.Spec.Attacher != r.cd.name || va.Spec.NodeName != r.cd.nodeID {
+			continue
+		}
+		pvName := va.Spec.Source.PersistentVolumeName
+		if pvName == nil {
+			continue
+		}
+		pv, err := r.cd.clientset.CoreV1().PersistentVolumes().Get(ctx, *pvName, metav1.GetOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("failed to get PV %s: %v", *pvName, err)
+		}
+		if pv.Spec.CSI == nil {
+			continue
+		}
+		volID := pv.Spec.CSI.VolumeHandle
+		k.volumes[volID] = true
+
+		d := newCsifDisk(r.cd)
+		if err := d.LoadContext(pv.Spec.CSI.VolumeAttributes); err != nil {
+			continue
+		}
+		d.volID = volID
+		name := filterPodName(d)
+		if _, ok := k.pods[name]; !ok {
+			k.pods[name] = nil
+		}
+	}
+	return k, nil
+}
+
+// Returns true if key was suspected on the previous pass too
+func (r *reconciler) suspect(seen map[string]bool, key string) bool {
+	seen[key] = true
+	return r.suspects[key]
+}
+
+func (r *reconciler) reconcilePods(ctx context.Context, k *reconcileKnown, seen map[string]bool) error {
+	coreif := r.cd.clientset.CoreV1()
+	pods, err := coreif.Pods(metav1.NamespaceAll).List(ctx, metav1.ListOptions{
+		LabelSelector: labels.Set{
+			"app":              csifFilterApp,
+			filterPodNodeLabel: filterLabelValue(r.cd.nodeID),
+		}.AsSelector().String(),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list filter pods: %v", err)
+	}
+
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		if _, ok := k.pods[pod.Name]; ok || pod.DeletionTimestamp != nil {
+			continue
+		}
+		if pod.Labels[warmPoolStateLabel] == "ready" {
+			continue // managed by warm pool
+		}
+		if time.Since(pod.CreationTimestamp.Time) < reconcilePodGrace {
+			continue
+		}
+		if !r.suspect(seen, "pod/"+pod.Name) {
+			continue
+		}
+		glog.Infof("reconciler: deleting orphaned filter pod %s", pod.Name)
+		if err := deleteFilterPod(coreif, pod); err != nil {
+			glog.Errorf("reconciler: failed to delete pod %s: %v", pod.Name, err)
+			reconcilerErrors.Inc()
+			continue
+		}
+		reconcilerCleaned.WithLabelValues("pod").Inc()
+	}
+	return nil
+}
+
+func (r *reconciler) reconcileTargets(ctx context.Context, k *reconcileKnown, seen map[string]bool) {
+	for name, fp := range k.pods {
+		if fp == nil || fp.conn == nil {
+			continue
+		}
+		client := filter.NewFilterClient(fp.conn)
+		resp, err := client.ListTargets(ctx, &filter.ListTargetsRequest{})
+		if err != nil {
+			glog.Errorf("reconciler: failed to list targets of %s: %v", name, err)
+			reconcilerErrors.Inc()
+			continue
+		}
+		for _, t := range resp.GetTargets() {
+			volID := t.GetVolumeId()
+			if k.targets[name][volID] || k.volumes[volID] {
+				continue
+			}
+			if !r.suspect(seen, "target/"+name+"/"+volID) {
+				continue
+			}
+			glog.Infof("reconciler: deleting orphaned target %q in %s", volID, name)
+			if _, err := client.DeleteTarget(ctx, &filter.DeleteTargetRequest{VolumeId: volID}); err != nil {
+				glog.Errorf("reconciler: failed to delete target %q in %s: %v", volID, name, err)
+				reconcilerErrors.Inc()
+				continue
+			}
+			reconcilerCleaned.WithLabelValues("target").Inc()
+		}
+	}
+}
+
+// Sessions to filter targets, see parseSessions of csi-lib-iscsi:
+// tcp: [1] 10.244.0.5:9821,1 iqn.com.pooh64.csi.csif.filter:1 (non-flash)
+func listFilterSessions(initiator iscsiInitiator) ([][2]string, error) {
+	out, err := initiator.GetSessions()
+	if err != nil {
+		if strings.Contains(out, "No active sessions") {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to list iSCSI sessions: %v", err)
+	}
+
+	var sessions [][2]string
+	for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+		f := strings.Fields(line)
+		if len(f) < 4 || !strings.HasPrefix(f[3], CsifFilterIQNPrefix+":") {
+			continue
+		}
+		portal := strings.Split(f[2], ",")[0]
+		sessions = append(sessions, [2]string{portal, f[3]})
+	}
+	return sessions, nil
+}
+
+func (r *reconciler) reconcileSessions(k *reconcileKnown, seen map[string]bool) error {
+	sessions, err := listFilterSessions(r.cd.iscsi)
+	if err != nil {
+		return err
+	}
+	for _, s := range sessions {
+		portal, iqn := s[0], s[1]
+		key := sessionKey(portal, iqn)
+		if k.sessions[key] || !r.suspect(seen, "session/"+key) {
+			continue
+		}
+		glog.Infof("reconciler: logging out orphaned session %s", key)
+		if err := r.cd.iscsi.Disconnect(iqn, []string{portal}); err != nil {
+			glog.Errorf("reconciler: failed to logout %s: %v", key, err)
+			reconcilerErrors.Inc()
+			continue
+		}
+		reconcilerCleaned.WithLabelValues("session").Inc()
+	}
+	return nil
+}
+
+func (r *reconciler) reconcile() {
+	ctx, cancel := context.WithTimeout(context.Background(), reconcileTimeout)
+	defer cancel()
+	reconcilerRuns.Inc()
+
+	k, err := r.known(ctx)
+	if err != nil {
+		glog.Errorf("reconciler: %v", err)
+		reconcilerErrors.Inc()
+		return // nothing is safe to delete
+	}
+
+	seen := map[string]bool{}
+	if err := r.reconcileSessions(k, seen); err != nil {
+		glog.Errorf("reconciler: %v", err)
+		reconcilerErrors.Inc()
+	}
+	r.reconcileTargets(ctx, k, seen)
+	if err := r.reconcilePods(ctx, k, seen); err != nil {
+		glog.Errorf("reconciler: %v", err)
+		reconcilerErrors.Inc()
+	}
+	r.suspects = seen
+}
+
+func (r *reconciler) run() {
+	glog.Infof("reconciler: interval %v", r.interval)
+	for {
+		r.reconcile()
+		time.Sleep(r.interval)
+	}
+}
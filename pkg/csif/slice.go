@@ -0,0 +1,182 @@
+package csif
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/golang/glog"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	core "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Slice allocator: dynamic volumes are carved out of a pool PVC set by
+// StorageClass parameter. Ranges in use are collected from PVs of the driver,
+// so statically provisioned slices of the pool are respected too.
+
+const (
+	paramSlicePool = "slicePool"
+	sliceAlign     = 1 * mib
+)
+
+type sliceRange struct {
+	volID  string
+	offset int64
+	length int64
+}
+
+func (r *sliceRange) end() int64 {
+	return r.offset + r.length
+}
+
+func parseSliceParam(key, str string) (int64, error) {
+	if str == "" {
+		return 0, nil
+	}
+	val, err := strconv.ParseInt(str, 10, 64)
+	if err != nil || val < 0 {
+		return 0, fmt.Errorf("bad %s: %s", key, str)
+	}
+	return val, nil
+}
+
+// Source range used by the disk, not a slice takes the whole source
+func (d *csifDisk) sliceRange(sourceSize int64) (sliceRange, error) {
+	if d.SliceLength == "" {
+		return sliceRange{volID: d.volID, offset: 0, length: sourceSize}, nil
+	}
+	offset, err := parseSliceParam("sliceOffset", d.SliceOffset)
+	if err != nil {
+		return sliceRange{}, err
+	}
+	length, err := parseSliceParam("sliceLength", d.SliceLength)
+	if err != nil {
+		return sliceRange{}, err
+	}
+	return sliceRange{volID: d.volID, offset: offset, length: length}, nil
+}
+
+// Slices of the pool: existing PVs and volume records not yet turned into PVs
+func (cs *csifControllerServer) listSlices(ctx context.Context, namespace, pool string, poolSize int64) ([]sliceRange, error) {
+	pvs, err := cs.cd.clientset.CoreV1().PersistentVolumes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list PVs: %v", err)
+	}
+
+	var slices []sliceRange
+	seen := map[string]bool{}
+	for _, pv := range pvs.Items {
+		src := pv.Spec.CSI
+		if src == nil || src.Driver != cs.cd.name {
+			continue
+		}
+		d := newCsifDisk(cs.cd)
+		if err := d.LoadContext(src.VolumeAttributes); err != nil {
+			glog.Errorf("PV %s: bad volume attributes: %v", pv.Name, err)
+			continue
+		}
+		if d.SourcePVC != pool || d.sourceNamespace() != namespace {
+			continue
+		}
+		d.volID = src.VolumeHandle
+		r, err := d.sliceRange(poolSize)
+		if err != nil {
+			return nil, fmt.Errorf("PV %s: %v", pv.Name, err)
+		}
+		slices = append(slices, r)
+		seen[d.volID] = true
+	}
+
+	vols, err := cs.listVolumes(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+	for _, vol := range vols {
+		if seen[vol.ID] || vol.Disk.SourcePVC != pool || vol.Disk.sourceNamespace() != namespace {
+			continue
+		}
+		r, err := vol.Disk.sliceRange(poolSize)
+		if err != nil {
+			return nil, fmt.Errorf("volume %s: %v", vol.ID, err)
+		}
+		slices = append(slices, r)
+	}
+
+	sort.Slice(slices, func(i, j int) bool { return slices[i].offset < slices[j].offset })
+	return slices, nil
+}
+
+// Slices must be sorted by offset
+func checkSliceOverlaps(slices []sliceRange, poolSize int64) error {
+	var last *sliceRange
+	for i := range slices {
+		r := &slices[i]
+		if r.end() > poolSize {
+			return fmt.Errorf("volume %s: slice [%v, %v) is out of pool", r.volID, r.offset, r.end())
+		}
+		if last != nil && r.offset < last.end() {
+			return fmt.Errorf("volumes %s and %s overlap", last.volID, r.volID)
+		}
+		if last == nil || r.end() > last.end() {
+			last = r
+		}
+	}
+	return nil
+}
+
+// First fit, slices must be sorted by offset
+func findSliceGap(slices []sliceRange, poolSize, length int64) (int64, bool) {
+	pos := int64(0)
+	for _, r := range slices {
+		if r.offset-pos >= length {
+			return pos, true
+		}
+		if end := alignUp(r.end(), sliceAlign); end > pos {
+			pos = end
+		}
+	}
+	if poolSize-pos >= length {
+		return pos, true
+	}
+	return 0, false
+}
+
+// Place the disk into a free range of its pool
+func (cs *csifControllerServer) allocSlice(ctx context.Context, d *csifDisk) error {
+	pool, namespace := d.SourcePVC, d.sourceNamespace()
+	pvc, err := cs.cd.clientset.CoreV1().PersistentVolumeClaims(namespace).Get(ctx, pool, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return status.Errorf(codes.InvalidArgument, "pool PVC %s not found", pool)
+	} else if err != nil {
+		return status.Errorf(codes.Internal, "failed to get pool PVC %s: %v", pool, err)
+	}
+	capacity, ok := pvc.Status.Capacity[core.ResourceStorage]
+	if !ok {
+		return status.Errorf(codes.FailedPrecondition, "pool PVC %s is not bound", pool)
+	}
+	poolSize := capacity.Value()
+
+	slices, err := cs.listSlices(ctx, namespace, pool, poolSize)
+	if err != nil {
+		return status.Errorf(codes.Internal, "%v", err)
+	}
+	if err := checkSliceOverlaps(slices, poolSize); err != nil {
+		return status.Errorf(codes.FailedPrecondition, "pool %s is inconsistent: %v", pool, err)
+	}
+
+	length, err := parseSliceParam("sliceLength", d.SliceLength)
+	if err != nil {
+		return status.Errorf(codes.InvalidArgument, "%v", err)
+	}
+	offset, ok := findSliceGap(slices, poolSize, length)
+	if !ok {
+		return status.Errorf(codes.ResourceExhausted, "no free range of %v bytes in pool %s", length, pool)
+	}
+	d.SliceOffset = fmt.Sprint(offset)
+	glog.V(4).Infof("slice allocated: pool=%s offset=%v length=%v", pool, offset, length)
+	return nil
+}
@@ -0,0 +1,94 @@
+package csif
+
+import (
+	"fmt"
+
+	"github.com/pooh64/csif-driver/pkg/filter"
+)
+
+// Exposes [offset, offset+length) range of the lower device, always the
+// lowest filter, so that several volumes may share one source
+//
+// params: offset, length: bytes, multiple of sector size
+
+type sliceFilter struct {
+	lower  blockDev
+	offset int64
+	length int64
+}
+
+func newSliceFilter(lower blockDev, params map[string]string) (blockFilter, error) {
+	offset, err := parseFilterParam(params, "offset", 0)
+	if err != nil {
+		return nil, err
+	}
+	length, err := parseFilterParam(params, "length", 0)
+	if err != nil {
+		return nil, err
+	}
+	if offset%sectorSize != 0 || length%sectorSize != 0 {
+		return nil, fmt.Errorf("slice must be aligned to %v", sectorSize)
+	}
+	if length == 0 || offset+length > lower.Size() {
+		return nil, fmt.Errorf("slice [%v, %v) is out of source range %v", offset, offset+length, lower.Size())
+	}
+	return &sliceFilter{
+		lower:  lower,
+		offset: offset,
+		length: length,
+	}, nil
+}
+
+func (s *sliceFilter) check(off, length int64) error {
+	if off < 0 || off+length > s.length {
+		return fmt.Errorf("out of range: off=%v len=%v", off, length)
+	}
+	return nil
+}
+
+func (s *sliceFilter) ReadAt(p []byte, off int64) (int, error) {
+	if err := s.check(off, int64(len(p))); err != nil {
+		return 0, err
+	}
+	return s.lower.ReadAt(p, s.offset+off)
+}
+
+func (s *sliceFilter) WriteAt(p []byte, off int64) (int, error) {
+	if err := s.check(off, int64(len(p))); err != nil {
+		return 0, err
+	}
+	return s.lower.WriteAt(p, s.offset+off)
+}
+
+func (s *sliceFilter) Size() int64 {
+	return s.length
+}
+
+func (s *sliceFilter) Flush() error {
+	return s.lower.Flush()
+}
+
+func (s *sliceFilter) Trim(off, length int64) error {
+	if err := s.check(off, length); err != nil {
+		return err
+	}
+	return s.lower.Trim(s.offset+off, length)
+}
+
+func (s *sliceFilter) Close() error {
+	return nil
+}
+
+func (s *sliceFilter) Name() string {
+	return "slice"
+}
+
+func (s *sliceFilter) Status() *filter.FilterStatus {
+	return &filter.FilterStatus{
+		Name: s.Name(),
+		Counters: map[string]uint64{
+			"offset": uint64(s.offset),
+			"length": uint64(s.length),
+		},
+	}
+}
@@ -5,6 +5,8 @@ import (
 	"strings"
 
 	"github.com/golang/glog"
+	"go.opentelemetry.io/otel/attribute"
+	"golang.org/x/net/context"
 	utilexec "k8s.io/utils/exec"
 )
 
@@ -14,22 +16,23 @@ const (
 )
 
 type csifTGTD struct {
+	exec    utilexec.Interface // runs tgtadm
 	control uint32
 	iqnPref string
 	targets map[int]*iscsiTarget
 
-	portal string
-	port   uint32
+	portals []string // tgtd listens on all, first is the primary one
+	port    uint32
 }
 
 type iscsiTarget struct {
+	exec    utilexec.Interface
 	control uint32
 	id      int
 	iqn     string
 }
 
-func startTGTD(control uint32, portal string) error {
-	exec := utilexec.New()
+func startTGTD(exec utilexec.Interface, control uint32, portal string) error {
 	out, err := exec.Command("tgtd", "-C", fmt.Sprint(control),
 		"--iscsi", "portal="+portal).CombinedOutput()
 	if err != nil {
@@ -38,60 +41,70 @@ func startTGTD(control uint32, portal string) error {
 	return nil
 }
 
-func NewCsifTGTD(control uint32, iqnPref, portal string, port uint32) (*csifTGTD, error) {
+func NewCsifTGTD(control uint32, iqnPref string, portals []string, port uint32) (*csifTGTD, error) {
 	fullportal := "*:" + fmt.Sprint(port)
 
-	if err := startTGTD(control, fullportal); err != nil {
+	exec := utilexec.New()
+	if err := startTGTD(exec, control, fullportal); err != nil {
 		return nil, fmt.Errorf("failed to start tgtd: %v", err)
 	}
 	glog.V(4).Infof("tgtd: control=%v, portal=%v", control, fullportal)
 
 	return &csifTGTD{
+		exec:    exec,
 		control: control,
 		iqnPref: iqnPref,
 		targets: map[int]*iscsiTarget{0: {}},
-		portal:  portal,
+		portals: portals,
 		port:    port,
 	}, nil
 }
 
-func (d *csifTGTD) CreateDisk(bstore string) (*iscsiTarget, error) {
+// thin: advertise UNMAP support, bstore must handle discards
+func (d *csifTGTD) CreateDisk(ctx context.Context, bstore string, thin bool) (*iscsiTarget, error) {
 	tid, err := d.allocTID()
 	if err != nil {
 		return nil, fmt.Errorf("failed to allocate tid: %v", err)
 	}
 
 	target := &iscsiTarget{
+		exec:    d.exec,
 		control: d.control,
 		id:      tid,
 		iqn:     d.iqnPref + ":" + fmt.Sprint(tid),
 	}
 
-	if err = target.start(); err != nil {
+	if err = target.start(ctx); err != nil {
 		return nil, fmt.Errorf("failed to start target: %v", err)
 	}
-	defer cleanup(&err, func() { target.stop() })
+	defer cleanup(&err, func() { target.stop(ctx) })
 
-	if err = target.createLun(csifTGTDdefaultLUN, bstore); err != nil {
+	if err = target.createLun(ctx, csifTGTDdefaultLUN, bstore); err != nil {
 		return nil, fmt.Errorf("failed to create lun: %v", err)
 	}
-	defer cleanup(&err, func() { target.deleteLun(csifTGTDdefaultLUN) })
+	defer cleanup(&err, func() { target.deleteLun(ctx, csifTGTDdefaultLUN) })
 
-	if err = target.bindAddr("ALL"); err != nil {
+	if thin {
+		if err = target.updateLun(ctx, csifTGTDdefaultLUN, "thin_provisioning=1"); err != nil {
+			return nil, fmt.Errorf("failed to enable thin provisioning: %v", err)
+		}
+	}
+
+	if err = target.bindAddr(ctx, "ALL"); err != nil {
 		return nil, fmt.Errorf("failed to bind addr: %v", err)
 	}
 	d.targets[tid] = target
 	return target, nil
 }
 
-func (d *csifTGTD) DeleteDisk(tid int) error {
+func (d *csifTGTD) DeleteDisk(ctx context.Context, tid int) error {
 	target, ok := d.targets[tid]
 	if !ok {
 		return fmt.Errorf("tid doesn't exitst")
 	}
 
-	if err := target.deleteLun(csifTGTDdefaultLUN); err != nil {
-		if err := target.stop(); err != nil {
+	if err := target.deleteLun(ctx, csifTGTDdefaultLUN); err != nil {
+		if err := target.stop(ctx); err != nil {
 			glog.Errorf("failed to stop target: %v", err)
 		} else {
 			delete(d.targets, tid)
@@ -100,13 +113,21 @@ func (d *csifTGTD) DeleteDisk(tid int) error {
 		return fmt.Errorf("failed to delete lun: %v", err)
 	}
 
-	if err := target.stop(); err != nil {
+	if err := target.stop(ctx); err != nil {
 		return fmt.Errorf("failed to stop target: %v", err)
 	}
 	delete(d.targets, tid)
 	return nil
 }
 
+func (d *csifTGTD) Portals() []string {
+	return d.portals
+}
+
+func (d *csifTGTD) Port() uint32 {
+	return d.port
+}
+
 // TODO: rewrite
 func (d *csifTGTD) allocTID() (int, error) {
 	for id := 1; id < csifTGTDmaxTargets; id++ {
@@ -117,8 +138,11 @@ func (d *csifTGTD) allocTID() (int, error) {
 	return 0, fmt.Errorf("cisfTGTD limit reached")
 }
 
-func (it *iscsiTarget) execCmd(args ...string) error {
-	cmd := utilexec.New().Command("tgtadm", args...)
+func (it *iscsiTarget) execCmd(ctx context.Context, args ...string) (err error) {
+	_, span := startSpan(ctx, "exec tgtadm", attribute.String("exec.args", strings.Join(args, " ")))
+	defer func() { endSpan(span, err) }()
+
+	cmd := it.exec.Command("tgtadm", args...)
 	out, err := cmd.CombinedOutput()
 	glog.V(4).Infof("exec: %v\nout: %v", strings.Join(args, " "), string(out))
 	if err != nil {
@@ -127,43 +151,52 @@ func (it *iscsiTarget) execCmd(args ...string) error {
 	return nil
 }
 
-func (it *iscsiTarget) start() error {
+func (it *iscsiTarget) start(ctx context.Context) error {
 	//--lld <driver> --op new --mode target --tid <id> --targetname <name>
 	args := []string{"-C", fmt.Sprint(it.control), "--lld", "iscsi",
 		"--op", "new", "--mode", "target",
 		"--tid", fmt.Sprint(it.id), "--targetname", it.iqn}
-	return it.execCmd(args...)
+	return it.execCmd(ctx, args...)
 }
 
-func (it *iscsiTarget) stop() error {
+func (it *iscsiTarget) stop(ctx context.Context) error {
 	//--lld <driver> --op delete --mode target --tid <id>
 	args := []string{"-C", fmt.Sprint(it.control), "--lld", "iscsi",
 		"--op", "delete", "--mode", "target",
 		"--tid", fmt.Sprint(it.id)}
-	return it.execCmd(args...)
+	return it.execCmd(ctx, args...)
 }
 
-func (it *iscsiTarget) createLun(lun uint32, bstore string) error {
+func (it *iscsiTarget) createLun(ctx context.Context, lun uint32, bstore string) error {
 	//--lld <driver> --op new --mode logicalunit --tid <id> --lun <lun> --backing-store <path>
 	args := []string{"-C", fmt.Sprint(it.control), "--lld", "iscsi",
 		"--op", "new", "--mode", "logicalunit",
 		"--tid", fmt.Sprint(it.id), "--lun", fmt.Sprint(lun),
 		"--backing-store", bstore}
-	return it.execCmd(args...)
+	return it.execCmd(ctx, args...)
 }
 
-func (it *iscsiTarget) deleteLun(lun uint32) error {
+func (it *iscsiTarget) deleteLun(ctx context.Context, lun uint32) error {
 	//--lld <driver> --op delete --mode logicalunit --tid <id> --lun <lun>
 	args := []string{"-C", fmt.Sprint(it.control), "--lld", "iscsi",
 		"--op", "delete", "--mode", "logicalunit",
 		"--tid", fmt.Sprint(it.id), "--lun", fmt.Sprint(lun)}
-	return it.execCmd(args...)
+	return it.execCmd(ctx, args...)
+}
+
+func (it *iscsiTarget) updateLun(ctx context.Context, lun uint32, params string) error {
+	//--lld <driver> --op update --mode logicalunit --tid <id> --lun <lun> --params <params>
+	args := []string{"-C", fmt.Sprint(it.control), "--lld", "iscsi",
+		"--op", "update", "--mode", "logicalunit",
+		"--tid", fmt.Sprint(it.id), "--lun", fmt.Sprint(lun),
+		"--params", params}
+	return it.execCmd(ctx, args...)
 }
 
-func (it *iscsiTarget) bindAddr(addr string) error {
+func (it *iscsiTarget) bindAddr(ctx context.Context, addr string) error {
 	//--lld <driver> --op bind --mode target --tid <id> --initiator-address <address>
 	args := []string{"-C", fmt.Sprint(it.control), "--lld", "iscsi",
 		"--op", "bind", "--mode", "target",
 		"--tid", fmt.Sprint(it.id), "--initiator-address", addr}
-	return it.execCmd(args...)
+	return it.execCmd(ctx, args...)
 }
@@ -0,0 +1,158 @@
+package csif
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/context"
+)
+
+func newTestTGTD() (*csifTGTD, *fakeExec) {
+	fe := &fakeExec{}
+	return &csifTGTD{
+		exec:    &fe.FakeExec,
+		control: 1,
+		iqnPref: CsifFilterIQNPrefix,
+		targets: map[int]*iscsiTarget{0: {}},
+		portals: []string{"10.0.0.1"},
+		port:    CsifFilterPortTGT,
+	}, fe
+}
+
+// Subcommands of the tgtadm calls, "op mode"
+func tgtadmOps(calls []string) []string {
+	var ops []string
+	for _, c := range calls {
+		args := strings.Fields(c)
+		var op, mode string
+		for i := 0; i+1 < len(args); i++ {
+			switch args[i] {
+			case "--op":
+				op = args[i+1]
+			case "--mode":
+				mode = args[i+1]
+			}
+		}
+		ops = append(ops, op+" "+mode)
+	}
+	return ops
+}
+
+func checkOps(t *testing.T, fe *fakeExec, expected ...string) {
+	t.Helper()
+	fe.done(t)
+	if ops := tgtadmOps(fe.calls); strings.Join(ops, ", ") != strings.Join(expected, ", ") {
+		t.Errorf("tgtadm ops %v, expected %v", ops, expected)
+	}
+}
+
+func TestTGTDCreateDelete(t *testing.T) {
+	for _, thin := range []bool{false, true} {
+		t.Run(fmt.Sprintf("thin=%v", thin), func(t *testing.T) {
+			d, fe := newTestTGTD()
+			ctx := context.Background()
+			ops := []string{"new target", "new logicalunit", "bind target"}
+			if thin {
+				ops = []string{"new target", "new logicalunit", "update logicalunit", "bind target"}
+			}
+			for range ops {
+				fe.expect("tgtadm", "", nil)
+			}
+
+			target, err := d.CreateDisk(ctx, "/dev/nbd0", thin)
+			if err != nil {
+				t.Fatalf("CreateDisk: %v", err)
+			}
+			if target.id != 1 || target.iqn != CsifFilterIQNPrefix+":1" {
+				t.Errorf("unexpected target %d %s", target.id, target.iqn)
+			}
+			checkOps(t, fe, ops...)
+
+			fe.expect("tgtadm", "", nil)
+			fe.expect("tgtadm", "", nil)
+			if err := d.DeleteDisk(ctx, target.id); err != nil {
+				t.Fatalf("DeleteDisk: %v", err)
+			}
+			checkOps(t, fe, append(ops, "delete logicalunit", "delete target")...)
+			if _, ok := d.targets[target.id]; ok {
+				t.Errorf("target is not released")
+			}
+		})
+	}
+}
+
+func TestTGTDCreateRollback(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		fail int // index of the failing command
+		ops  []string
+	}{
+		{
+			name: "start",
+			fail: 0,
+			ops:  []string{"new target"},
+		},
+		{
+			name: "lun",
+			fail: 1,
+			ops:  []string{"new target", "new logicalunit", "delete target"},
+		},
+		{
+			name: "thin",
+			fail: 2,
+			ops:  []string{"new target", "new logicalunit", "update logicalunit", "delete logicalunit", "delete target"},
+		},
+		{
+			name: "bind",
+			fail: 3,
+			ops: []string{"new target", "new logicalunit", "update logicalunit", "bind target",
+				"delete logicalunit", "delete target"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			d, fe := newTestTGTD()
+			for i := range tc.ops {
+				var err error
+				if i == tc.fail {
+					err = fmt.Errorf("exit status 22")
+				}
+				fe.expect("tgtadm", "tgtadm: error", err)
+			}
+
+			if _, err := d.CreateDisk(context.Background(), "/dev/nbd0", true); err == nil {
+				t.Fatalf("CreateDisk succeeded")
+			}
+			checkOps(t, fe, tc.ops...)
+			if len(d.targets) != 1 {
+				t.Errorf("target is not released")
+			}
+		})
+	}
+}
+
+// Target is stopped even if its lun can't be deleted
+func TestTGTDDeleteLunFailure(t *testing.T) {
+	d, fe := newTestTGTD()
+	ctx := context.Background()
+	for i := 0; i < 3; i++ {
+		fe.expect("tgtadm", "", nil)
+	}
+	target, err := d.CreateDisk(ctx, "/dev/nbd0", false)
+	if err != nil {
+		t.Fatalf("CreateDisk: %v", err)
+	}
+
+	fe.expect("tgtadm", "tgtadm: can't find the logical unit", fmt.Errorf("exit status 22"))
+	fe.expect("tgtadm", "", nil)
+	if err := d.DeleteDisk(ctx, target.id); err != nil {
+		t.Fatalf("DeleteDisk: %v", err)
+	}
+	if _, ok := d.targets[target.id]; ok {
+		t.Errorf("target is not released")
+	}
+
+	if err := d.DeleteDisk(ctx, target.id); err == nil {
+		t.Errorf("DeleteDisk of released target succeeded")
+	}
+}
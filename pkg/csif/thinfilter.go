@@ -0,0 +1,337 @@
+package csif
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"sync"
+
+	"github.com/golang/glog"
+	"github.com/pooh64/csif-driver/pkg/filter"
+	"golang.org/x/sys/unix"
+)
+
+// Thin provisioning: virtual size may exceed the source, extents are
+// allocated on first write and freed by trim
+//
+// Source layout:
+//   header | allocation map (8 bytes per virtual extent) | data extents
+// Map entry is physical extent + 1, 0 is an unallocated (zero) extent.
+// The map never points to an extent before its data is flushed, and a freed
+// extent is not reused until its map clear is flushed, so after a crash an
+// extent has at most one owner.
+//
+// params: virtualSize: required
+//         extentSize: default 1MiB
+//         fullThreshold: pool usage percent reported as abnormal, default 90
+
+const (
+	thinDefaultExtentSize    = 1 * mib
+	thinDefaultFullThreshold = 90
+	thinHeaderSize           = 4096
+	thinHeaderMagic          = "CSIFTHIN1"
+)
+
+type thinFilter struct {
+	lower     blockDev
+	esize     int64
+	vsize     int64
+	threshold int64
+
+	nvirt   int64
+	nphys   int64
+	dataOff int64
+
+	mu      sync.Mutex
+	amap    []int64 // virtual -> physical + 1
+	free    []int64
+	nospc   uint64
+	trimmed uint64
+}
+
+func newThinFilter(lower blockDev, params map[string]string) (blockFilter, error) {
+	esize, err := parseFilterParam(params, "extentSize", thinDefaultExtentSize)
+	if err != nil {
+		return nil, err
+	}
+	if esize < nbdBlockSize || esize%nbdBlockSize != 0 {
+		return nil, fmt.Errorf("extent size must be multiple of %v", nbdBlockSize)
+	}
+	vsize, err := parseFilterParam(params, "virtualSize", 0)
+	if err != nil {
+		return nil, err
+	}
+	threshold, err := parseFilterParam(params, "fullThreshold", thinDefaultFullThreshold)
+	if err != nil {
+		return nil, err
+	}
+	if threshold > 100 {
+		return nil, fmt.Errorf("fullThreshold is percent: %v", threshold)
+	}
+
+	t := &thinFilter{
+		lower:     lower,
+		esize:     esize,
+		threshold: threshold,
+		nvirt:     vsize / esize,
+	}
+	t.vsize = t.nvirt * esize
+	t.dataOff = alignUp(thinHeaderSize+t.nvirt*8, esize)
+	t.nphys = (lower.Size() - t.dataOff) / esize
+	if t.nvirt <= 0 || t.nphys <= 0 {
+		return nil, fmt.Errorf("bad thin geometry: virtual=%v source=%v", vsize, lower.Size())
+	}
+
+	if err := t.load(); err != nil {
+		return nil, err
+	}
+	glog.V(4).Infof("thin: esize=%v virtual=%v physical=%v", esize, t.nvirt, t.nphys)
+	return t, nil
+}
+
+func (t *thinFilter) makeHeader() []byte {
+	hdr := make([]byte, thinHeaderSize)
+	copy(hdr, thinHeaderMagic)
+	binary.LittleEndian.PutUint64(hdr[16:], uint64(t.esize))
+	binary.LittleEndian.PutUint64(hdr[24:], uint64(t.vsize))
+	return hdr
+}
+
+func (t *thinFilter) load() error {
+	hdr := make([]byte, thinHeaderSize)
+	if _, err := t.lower.ReadAt(hdr, 0); err != nil {
+		return fmt.Errorf("failed to read header: %v", err)
+	}
+	want := t.makeHeader()
+	t.amap = make([]int64, t.nvirt)
+	mapBuf := make([]byte, t.nvirt*8)
+
+	if !bytes.HasPrefix(hdr, []byte(thinHeaderMagic)) {
+		if !bytes.Equal(hdr, make([]byte, thinHeaderSize)) {
+			return fmt.Errorf("source contains foreign data, refusing to format")
+		}
+		glog.V(4).Infof("thin: formatting source")
+		if _, err := t.lower.WriteAt(mapBuf, thinHeaderSize); err != nil {
+			return fmt.Errorf("failed to format: %v", err)
+		}
+		if _, err := t.lower.WriteAt(want, 0); err != nil {
+			return fmt.Errorf("failed to write header: %v", err)
+		}
+		if err := t.lower.Flush(); err != nil {
+			return err
+		}
+	} else {
+		// Source may grow, so extent count is not a part of the header
+		if !bytes.Equal(hdr, want) {
+			return fmt.Errorf("thin geometry mismatch")
+		}
+		if _, err := t.lower.ReadAt(mapBuf, thinHeaderSize); err != nil {
+			return err
+		}
+	}
+
+	used := make([]bool, t.nphys)
+	for v := range t.amap {
+		ent := int64(binary.LittleEndian.Uint64(mapBuf[v*8:]))
+		if ent > t.nphys || (ent != 0 && used[ent-1]) {
+			return fmt.Errorf("corrupted allocation map entry: %v", v)
+		}
+		t.amap[v] = ent
+		if ent != 0 {
+			used[ent-1] = true
+		}
+	}
+	for p := t.nphys - 1; p >= 0; p-- {
+		if !used[p] {
+			t.free = append(t.free, p)
+		}
+	}
+	return nil
+}
+
+func (t *thinFilter) writeMap(v int64) error {
+	ent := make([]byte, 8)
+	binary.LittleEndian.PutUint64(ent, uint64(t.amap[v]))
+	_, err := t.lower.WriteAt(ent, thinHeaderSize+v*8)
+	return err
+}
+
+func (t *thinFilter) extentOff(ent int64) int64 {
+	return t.dataOff + (ent-1)*t.esize
+}
+
+// Allocate extent, zero parts not covered by the pending write
+func (t *thinFilter) allocExtent(boff, length int64) (int64, error) {
+	n := len(t.free)
+	if n == 0 {
+		t.nospc++
+		return 0, fmt.Errorf("thin pool is full: %w", unix.ENOSPC)
+	}
+	ent := t.free[n-1] + 1
+	zero := make([]byte, t.esize)
+	if boff != 0 {
+		if _, err := t.lower.WriteAt(zero[:boff], t.extentOff(ent)); err != nil {
+			return 0, err
+		}
+	}
+	if end := boff + length; end != t.esize {
+		if _, err := t.lower.WriteAt(zero[end:], t.extentOff(ent)+end); err != nil {
+			return 0, err
+		}
+	}
+	t.free = t.free[:n-1]
+	return ent, nil
+}
+
+func (t *thinFilter) forEachExtent(p []byte, off int64, fn func(v, boff int64, buf []byte) error) (int, error) {
+	if off+int64(len(p)) > t.vsize {
+		return 0, fmt.Errorf("out of range: off=%v len=%v", off, len(p))
+	}
+	done := 0
+	for done < len(p) {
+		pos := off + int64(done)
+		v, boff := pos/t.esize, pos%t.esize
+		n := t.esize - boff
+		if rem := int64(len(p) - done); n > rem {
+			n = rem
+		}
+		if err := fn(v, boff, p[done:done+int(n)]); err != nil {
+			return done, err
+		}
+		done += int(n)
+	}
+	return done, nil
+}
+
+func (t *thinFilter) ReadAt(p []byte, off int64) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.forEachExtent(p, off, func(v, boff int64, buf []byte) error {
+		ent := t.amap[v]
+		if ent == 0 {
+			for i := range buf {
+				buf[i] = 0
+			}
+			return nil
+		}
+		_, err := t.lower.ReadAt(buf, t.extentOff(ent)+boff)
+		return err
+	})
+}
+
+func (t *thinFilter) WriteAt(p []byte, off int64) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.forEachExtent(p, off, func(v, boff int64, buf []byte) error {
+		ent := t.amap[v]
+		if ent != 0 {
+			_, err := t.lower.WriteAt(buf, t.extentOff(ent)+boff)
+			return err
+		}
+
+		ent, err := t.allocExtent(boff, int64(len(buf)))
+		if err != nil {
+			return err
+		}
+		if _, err := t.lower.WriteAt(buf, t.extentOff(ent)+boff); err != nil {
+			t.free = append(t.free, ent-1)
+			return err
+		}
+		if err := t.lower.Flush(); err != nil {
+			t.free = append(t.free, ent-1)
+			return err
+		}
+		t.amap[v] = ent
+		if err := t.writeMap(v); err != nil {
+			t.amap[v] = 0
+			t.free = append(t.free, ent-1)
+			return err
+		}
+		return nil
+	})
+}
+
+func (t *thinFilter) Size() int64 {
+	return t.vsize
+}
+
+func (t *thinFilter) Flush() error {
+	return t.lower.Flush()
+}
+
+// Free fully covered extents, pass trim down to release backing space.
+// Extents are freed once the map is flushed, leaked until reload on failure
+func (t *thinFilter) Trim(off, length int64) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var freed []int64
+	for v := alignUp(off, t.esize) / t.esize; (v+1)*t.esize <= off+length && v < t.nvirt; v++ {
+		ent := t.amap[v]
+		if ent == 0 {
+			continue
+		}
+		t.amap[v] = 0
+		if err := t.writeMap(v); err != nil {
+			t.amap[v] = ent
+			return err
+		}
+		freed = append(freed, ent)
+	}
+	if len(freed) == 0 {
+		return nil
+	}
+	if err := t.lower.Flush(); err != nil {
+		return err
+	}
+
+	for _, ent := range freed {
+		t.free = append(t.free, ent-1)
+		t.trimmed++
+		if err := t.lower.Trim(t.extentOff(ent), t.esize); err != nil {
+			glog.Errorf("thin: lower trim failed: %v", err)
+		}
+	}
+	return nil
+}
+
+func (t *thinFilter) Close() error {
+	return nil
+}
+
+func (t *thinFilter) Name() string {
+	return "thin"
+}
+
+func (t *thinFilter) Status() *filter.FilterStatus {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	allocated := t.nphys - int64(len(t.free))
+	percent := allocated * 100 / t.nphys
+
+	var cond string
+	if percent >= t.threshold {
+		cond = fmt.Sprintf("thin pool is %v%% full (threshold %v%%)", percent, t.threshold)
+	}
+	return &filter.FilterStatus{
+		Name: t.Name(),
+		Counters: map[string]uint64{
+			"virtualBytes":     uint64(t.vsize),
+			"physicalBytes":    uint64(t.nphys * t.esize),
+			"allocatedBytes":   uint64(allocated * t.esize),
+			"allocatedExtents": uint64(allocated),
+			"totalExtents":     uint64(t.nphys),
+			"usedPercent":      uint64(percent),
+			"trimmedExtents":   t.trimmed,
+			"noSpaceErrors":    t.nospc,
+		},
+		Info: map[string]string{
+			"extentSize":    fmt.Sprint(t.esize),
+			"fullThreshold": fmt.Sprint(t.threshold),
+		},
+		Condition: cond,
+	}
+}
@@ -0,0 +1,114 @@
+package csif
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+// 8 virtual and 4 physical extents of a block
+const testThinSourceSize = 6 * testCacheBlock
+
+func openTestThin(t *testing.T, lower blockDev) *thinFilter {
+	t.Helper()
+	f, err := newThinFilter(lower, map[string]string{
+		"virtualSize": "32768",
+		"extentSize":  "4096",
+	})
+	if err != nil {
+		t.Fatalf("newThinFilter: %v", err)
+	}
+	th := f.(*thinFilter)
+	if th.nphys != 4 || th.nvirt != 8 {
+		t.Fatalf("thin geometry: %d physical, %d virtual extents", th.nphys, th.nvirt)
+	}
+	return th
+}
+
+func TestThinFilter(t *testing.T) {
+	lower := newVolatileDev(testThinSourceSize)
+	th := openTestThin(t, lower)
+	zero := make([]byte, testCacheBlock)
+
+	// not covered part of new extent is zeroed
+	copy(lower.data[th.dataOff:], bytes.Repeat([]byte{0xff}, 4*testCacheBlock))
+	if _, err := th.WriteAt([]byte("data"), 7*testCacheBlock+100); err != nil {
+		t.Fatal(err)
+	}
+	want := make([]byte, testCacheBlock)
+	copy(want[100:], "data")
+	checkDevBlock(t, th, 7, want)
+	checkDevBlock(t, th, 0, zero)
+
+	for v := 0; v < 3; v++ {
+		writeDevBlock(t, th, v, testBlockData(v))
+	}
+	if _, err := th.WriteAt(testBlockData(3), 3*testCacheBlock); !errors.Is(err, unix.ENOSPC) {
+		t.Errorf("write to full pool: %v", err)
+	}
+	if n := th.Status().GetCounters()["noSpaceErrors"]; n != 1 {
+		t.Errorf("%d no space errors", n)
+	}
+	if th.Status().GetCondition() == "" {
+		t.Errorf("full pool is not abnormal")
+	}
+
+	trimDevBlock(t, th, 7)
+	writeDevBlock(t, th, 3, testBlockData(3))
+	if err := th.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	th = openTestThin(t, lower)
+	for v := 0; v < 4; v++ {
+		checkDevBlock(t, th, v, testBlockData(v))
+	}
+	checkDevBlock(t, th, 7, zero)
+}
+
+// Trimmed extent is reused at once, after a crash it has a single owner
+func TestThinFilterTrimCrash(t *testing.T) {
+	lower := newVolatileDev(testThinSourceSize)
+	th := openTestThin(t, lower)
+	for v := 0; v < 4; v++ {
+		writeDevBlock(t, th, v, testBlockData(v))
+	}
+
+	lower.checkpoint()
+	trimDevBlock(t, th, 0)
+	writeDevBlock(t, th, 4, testBlockData(4))
+
+	zero := make([]byte, testCacheBlock)
+	lower.forEachCrash(func(dev *volatileDev) {
+		th := openTestThin(t, dev)
+		checkDevBlock(t, th, 0, testBlockData(0), zero)
+		checkDevBlock(t, th, 4, testBlockData(4), zero)
+		for v := 1; v < 4; v++ {
+			checkDevBlock(t, th, v, testBlockData(v))
+		}
+	})
+}
+
+// New extent must not show data of the trimmed one it reuses
+func TestThinFilterAllocCrash(t *testing.T) {
+	lower := newVolatileDev(testThinSourceSize)
+	th := openTestThin(t, lower)
+	for v := 0; v < 4; v++ {
+		writeDevBlock(t, th, v, testBlockData(v))
+	}
+	trimDevBlock(t, th, 0)
+
+	lower.checkpoint()
+	if _, err := th.WriteAt([]byte("data"), 4*testCacheBlock); err != nil {
+		t.Fatal(err)
+	}
+
+	want := make([]byte, testCacheBlock)
+	copy(want, "data")
+	lower.forEachCrash(func(dev *volatileDev) {
+		th := openTestThin(t, dev)
+		checkDevBlock(t, th, 4, want, make([]byte, testCacheBlock))
+	})
+}
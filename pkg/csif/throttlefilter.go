@@ -0,0 +1,268 @@
+package csif
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/pooh64/csif-driver/pkg/filter"
+	"golang.org/x/net/context"
+	"golang.org/x/time/rate"
+)
+
+// Token bucket I/O throttling, limits may be changed at runtime
+//
+// params: maxReadIOPS, maxWriteIOPS, maxReadBPS, maxWriteBPS: 0 or unset is unlimited
+//         burstSeconds: bucket size in seconds of the limit, default 1
+
+var throttleParams = []string{"maxReadIOPS", "maxWriteIOPS", "maxReadBPS", "maxWriteBPS", "burstSeconds"}
+
+// Time source of limiters, fake one in tests
+type throttleClock interface {
+	Now() time.Time
+	Sleep(ctx context.Context, d time.Duration) error
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) Sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Larger bursts make no sense for I/O and overflow int
+const throttleMaxBurst = math.MaxInt32
+
+type throttleFilter struct {
+	lower blockDev
+	clock throttleClock
+
+	// waits are canceled by interrupt and Close
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu     sync.Mutex
+	params map[string]string
+
+	readIOPS  *rate.Limiter
+	writeIOPS *rate.Limiter
+	readBPS   *rate.Limiter
+	writeBPS  *rate.Limiter
+
+	readOps     uint64
+	writeOps    uint64
+	throttled   uint64
+	throttledNs uint64
+}
+
+func newThrottleFilter(lower blockDev, params map[string]string) (blockFilter, error) {
+	return newThrottleFilterClock(lower, params, realClock{})
+}
+
+func newThrottleFilterClock(lower blockDev, params map[string]string, clock throttleClock) (*throttleFilter, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	t := &throttleFilter{
+		lower:     lower,
+		clock:     clock,
+		ctx:       ctx,
+		cancel:    cancel,
+		params:    map[string]string{},
+		readIOPS:  rate.NewLimiter(rate.Inf, 1),
+		writeIOPS: rate.NewLimiter(rate.Inf, 1),
+		readBPS:   rate.NewLimiter(rate.Inf, 1),
+		writeBPS:  rate.NewLimiter(rate.Inf, 1),
+	}
+	if err := t.Configure(params); err != nil {
+		cancel()
+		return nil, err
+	}
+	return t, nil
+}
+
+func isThrottleParam(key string) bool {
+	for _, k := range throttleParams {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
+func setLimit(l *rate.Limiter, now time.Time, limit, burstSec int64) {
+	if limit == 0 {
+		l.SetLimitAt(now, rate.Inf)
+		return
+	}
+	burst := int64(throttleMaxBurst)
+	if burstSec == 0 || limit <= throttleMaxBurst/burstSec {
+		burst = limit * burstSec
+	}
+	if burst < 1 {
+		burst = 1
+	}
+	l.SetLimitAt(now, rate.Limit(limit))
+	l.SetBurstAt(now, int(burst))
+}
+
+// Update limits, params that are not set keep their values
+func (t *throttleFilter) Configure(params map[string]string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	merged := map[string]string{}
+	for k, v := range t.params {
+		merged[k] = v
+	}
+	for k, v := range params {
+		if !isThrottleParam(k) {
+			return fmt.Errorf("unknown throttle param: %s", k)
+		}
+		merged[k] = v
+	}
+
+	vals := map[string]int64{}
+	for _, key := range throttleParams {
+		def := int64(0)
+		if key == "burstSeconds" {
+			def = 1
+		}
+		val, err := parseFilterParam(merged, key, def)
+		if err != nil {
+			return err
+		}
+		vals[key] = val
+	}
+
+	burst, now := vals["burstSeconds"], t.clock.Now()
+	setLimit(t.readIOPS, now, vals["maxReadIOPS"], burst)
+	setLimit(t.writeIOPS, now, vals["maxWriteIOPS"], burst)
+	setLimit(t.readBPS, now, vals["maxReadBPS"], burst)
+	setLimit(t.writeBPS, now, vals["maxWriteBPS"], burst)
+	t.params = merged
+	return nil
+}
+
+// Take n tokens in chunks of burst. Configure may lower the burst while
+// waiting, then the reservation fails and is retried with the new one
+func waitLimiter(ctx context.Context, clock throttleClock, l *rate.Limiter, n int) error {
+	for n > 0 {
+		if l.Limit() == rate.Inf {
+			return nil
+		}
+		k := n
+		if b := l.Burst(); k > b {
+			k = b
+		}
+		now := clock.Now()
+		r := l.ReserveN(now, k)
+		if !r.OK() {
+			continue
+		}
+		if err := clock.Sleep(ctx, r.DelayFrom(now)); err != nil {
+			r.CancelAt(clock.Now())
+			return err
+		}
+		n -= k
+	}
+	return nil
+}
+
+func (t *throttleFilter) throttle(ops, bps *rate.Limiter, n int) error {
+	start := t.clock.Now()
+	err := waitLimiter(t.ctx, t.clock, ops, 1)
+	if err == nil {
+		err = waitLimiter(t.ctx, t.clock, bps, n)
+	}
+	if err != nil {
+		return fmt.Errorf("throttle: %v", err)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if d := t.clock.Now().Sub(start); d > time.Millisecond {
+		t.throttled++
+		t.throttledNs += uint64(d.Nanoseconds())
+	}
+	return nil
+}
+
+func (t *throttleFilter) ReadAt(p []byte, off int64) (int, error) {
+	if err := t.throttle(t.readIOPS, t.readBPS, len(p)); err != nil {
+		return 0, err
+	}
+	t.mu.Lock()
+	t.readOps++
+	t.mu.Unlock()
+	return t.lower.ReadAt(p, off)
+}
+
+func (t *throttleFilter) WriteAt(p []byte, off int64) (int, error) {
+	if err := t.throttle(t.writeIOPS, t.writeBPS, len(p)); err != nil {
+		return 0, err
+	}
+	t.mu.Lock()
+	t.writeOps++
+	t.mu.Unlock()
+	return t.lower.WriteAt(p, off)
+}
+
+func (t *throttleFilter) Size() int64 {
+	return t.lower.Size()
+}
+
+func (t *throttleFilter) Flush() error {
+	return t.lower.Flush()
+}
+
+func (t *throttleFilter) Trim(off, length int64) error {
+	return t.lower.Trim(off, length)
+}
+
+func (t *throttleFilter) interrupt() {
+	t.cancel()
+}
+
+func (t *throttleFilter) Close() error {
+	t.cancel()
+	return nil
+}
+
+func (t *throttleFilter) Name() string {
+	return "throttle"
+}
+
+func (t *throttleFilter) Status() *filter.FilterStatus {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	info := map[string]string{}
+	for _, key := range throttleParams {
+		if val, ok := t.params[key]; ok {
+			info[key] = val
+		}
+	}
+	return &filter.FilterStatus{
+		Name: t.Name(),
+		Counters: map[string]uint64{
+			"readOps":     t.readOps,
+			"writeOps":    t.writeOps,
+			"throttled":   t.throttled,
+			"throttledNs": t.throttledNs,
+		},
+		Info: info,
+	}
+}
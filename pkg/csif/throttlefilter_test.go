@@ -0,0 +1,205 @@
+package csif
+
+import (
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// Time moves only when limiter sleeps
+type fakeClock struct {
+	now   time.Time
+	slept time.Duration
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Unix(1000, 0)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func (c *fakeClock) Sleep(ctx context.Context, d time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	c.now = c.now.Add(d)
+	c.slept += d
+	return nil
+}
+
+func openTestThrottle(t *testing.T, params map[string]string) (*throttleFilter, *fakeClock) {
+	t.Helper()
+	clock := newFakeClock()
+	th, err := newThrottleFilterClock(newVolatileDev(1*mib), params, clock)
+	if err != nil {
+		t.Fatalf("newThrottleFilter: %v", err)
+	}
+	return th, clock
+}
+
+type throttleIO struct {
+	write bool
+	size  int
+	count int
+}
+
+func runThrottleIO(t *testing.T, th *throttleFilter, ios []throttleIO) {
+	t.Helper()
+	for _, io := range ios {
+		buf := make([]byte, io.size)
+		for i := 0; i < io.count; i++ {
+			var err error
+			if io.write {
+				_, err = th.WriteAt(buf, 0)
+			} else {
+				_, err = th.ReadAt(buf, 0)
+			}
+			if err != nil {
+				t.Fatalf("I/O: %v", err)
+			}
+		}
+	}
+}
+
+func TestThrottleFilterRate(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		params map[string]string
+		ios    []throttleIO
+		slept  time.Duration
+	}{
+		{
+			name: "unlimited",
+			ios:  []throttleIO{{size: 4096, count: 100}, {write: true, size: 4096, count: 100}},
+		},
+		{
+			name:   "bps",
+			params: map[string]string{"maxReadBPS": "4096"},
+			ios:    []throttleIO{{size: 4096, count: 4}},
+			slept:  3 * time.Second,
+		},
+		{
+			name:   "iops",
+			params: map[string]string{"maxWriteIOPS": "10"},
+			ios:    []throttleIO{{write: true, size: 512, count: 21}},
+			slept:  2 * time.Second,
+		},
+		{
+			name:   "request over burst",
+			params: map[string]string{"maxReadBPS": "1000"},
+			ios:    []throttleIO{{size: 1000}, {size: 3000, count: 1}},
+			slept:  3 * time.Second,
+		},
+		{
+			name:   "burst seconds",
+			params: map[string]string{"maxReadBPS": "1000", "burstSeconds": "3"},
+			ios:    []throttleIO{{size: 3000, count: 3}},
+			slept:  8 * time.Second,
+		},
+		{
+			name:   "zero burst seconds",
+			params: map[string]string{"maxReadIOPS": "2", "burstSeconds": "0"},
+			ios:    []throttleIO{{size: 512, count: 5}},
+			slept:  2 * time.Second,
+		},
+		{
+			name:   "reads don't limit writes",
+			params: map[string]string{"maxReadBPS": "1", "maxReadIOPS": "1"},
+			ios:    []throttleIO{{write: true, size: 4096, count: 10}},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			th, clock := openTestThrottle(t, tc.params)
+			runThrottleIO(t, th, tc.ios)
+			// limiter starts with a token, filling the first burst takes up to a second more
+			if d := clock.slept - tc.slept; d < 0 || d > time.Second {
+				t.Errorf("slept %v, expected %v", clock.slept, tc.slept)
+			}
+		})
+	}
+}
+
+func TestThrottleFilterBurst(t *testing.T) {
+	for _, tc := range []struct {
+		limit, burstSec string
+		burst           int
+	}{
+		{"100", "1", 100},
+		{"100", "5", 500},
+		{"100", "0", 1},
+		{"4611686018427387904", "4", throttleMaxBurst},
+		{"9223372036854775807", "1", throttleMaxBurst},
+	} {
+		th, _ := openTestThrottle(t, map[string]string{"maxWriteBPS": tc.limit, "burstSeconds": tc.burstSec})
+		if b := th.writeBPS.Burst(); b != tc.burst {
+			t.Errorf("limit %s for %ss: burst %d, expected %d", tc.limit, tc.burstSec, b, tc.burst)
+		}
+	}
+}
+
+func TestThrottleFilterConfigure(t *testing.T) {
+	th, clock := openTestThrottle(t, map[string]string{"maxReadBPS": "4096", "maxWriteIOPS": "5"})
+	runThrottleIO(t, th, []throttleIO{{size: 4096, count: 2}})
+
+	// unset params keep their values
+	if err := th.Configure(map[string]string{"maxReadBPS": "0"}); err != nil {
+		t.Fatal(err)
+	}
+	clock.slept = 0
+	runThrottleIO(t, th, []throttleIO{{size: 4096, count: 100}})
+	if clock.slept != 0 {
+		t.Errorf("unlimited reads slept %v", clock.slept)
+	}
+	if info := th.Status().GetInfo(); info["maxWriteIOPS"] != "5" || info["maxReadBPS"] != "0" {
+		t.Errorf("params after Configure: %v", info)
+	}
+
+	// burst lowered below the request size
+	if err := th.Configure(map[string]string{"maxReadBPS": "1024"}); err != nil {
+		t.Fatal(err)
+	}
+	clock.slept = 0
+	runThrottleIO(t, th, []throttleIO{{size: 4096, count: 2}})
+	if clock.slept < 6*time.Second || clock.slept > 8*time.Second {
+		t.Errorf("8KiB at 1KiB/s slept %v", clock.slept)
+	}
+
+	if err := th.Configure(map[string]string{"maxReadBPS": "-1"}); err == nil {
+		t.Errorf("negative limit is accepted")
+	}
+	if err := th.Configure(map[string]string{"maxIOPS": "1"}); err == nil {
+		t.Errorf("unknown param is accepted")
+	}
+}
+
+// Export waits for I/O on close, throttled I/O must not hold it
+func TestThrottleFilterInterrupt(t *testing.T) {
+	f, err := newThrottleFilter(newVolatileDev(1*mib), map[string]string{"maxReadBPS": "1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	chain := &filterChain{src: newVolatileDev(1 * mib), filters: []blockFilter{f}}
+
+	done := make(chan error)
+	go func() {
+		_, err := f.ReadAt(make([]byte, 4096), 0)
+		done <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+	chain.interrupt()
+
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Errorf("interrupted read succeeded")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("read is not interrupted")
+	}
+	if _, err := f.ReadAt(make([]byte, 1), 0); err == nil {
+		t.Errorf("read after interrupt succeeded")
+	}
+}
@@ -0,0 +1,331 @@
+package csif
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/pooh64/csif-driver/pkg/filter"
+	"golang.org/x/sys/unix"
+)
+
+// Block-level access log: ring buffer, streaming subscribers, optional file
+//
+// params: bufferSize: ring buffer records, default 4096
+//         file: output path relative to CsifFilterTraceDir
+//         format: json (JSON lines, default) or blktrace
+
+const (
+	traceDefaultBufferSize = 4096
+	traceSubscriberQueue   = 1024
+
+	traceFormatJSON     = "json"
+	traceFormatBlktrace = "blktrace"
+
+	// see linux/blktrace_api.h
+	blkIOTraceMagic   = 0x65617400 | 0x07
+	blkTCRead         = 1 << 0
+	blkTCWrite        = 1 << 1
+	blkTCFlush        = 1 << 2
+	blkTCIssue        = 1 << 6
+	blkTCComplete     = 1 << 7
+	blkTCDiscard      = 1 << 13
+	blkTCShift        = 16
+	blkTAIssue        = 7 | (blkTCIssue << blkTCShift)
+	blkTAComplete     = 8 | (blkTCComplete << blkTCShift)
+	blkIOTraceRecSize = 48
+)
+
+type traceFilter struct {
+	lower blockDev
+
+	mu      sync.Mutex
+	ring    []*filter.TraceRecord
+	head    int // next write position
+	count   int
+	subs    map[chan *filter.TraceRecord]struct{}
+	dropped uint64
+	total   uint64
+
+	file   *os.File
+	out    *bufio.Writer
+	format string
+	seq    uint32
+}
+
+func newTraceFilter(lower blockDev, params map[string]string) (blockFilter, error) {
+	return newTraceFilterDir(lower, params, CsifFilterTraceDir)
+}
+
+// Path comes from volume params and the filter is privileged, keep it in dir
+func traceFilePath(dir, name string) (string, error) {
+	if filepath.IsAbs(name) {
+		return "", fmt.Errorf("trace file must be relative to %s: %s", dir, name)
+	}
+	for _, elem := range strings.Split(name, "/") {
+		if elem == ".." {
+			return "", fmt.Errorf("trace file must not contain \"..\": %s", name)
+		}
+	}
+	return filepath.Join(dir, name), nil
+}
+
+func newTraceFilterDir(lower blockDev, params map[string]string, dir string) (*traceFilter, error) {
+	size, err := parseFilterParam(params, "bufferSize", traceDefaultBufferSize)
+	if err != nil {
+		return nil, err
+	}
+	if size == 0 {
+		return nil, fmt.Errorf("zero bufferSize")
+	}
+
+	t := &traceFilter{
+		lower:  lower,
+		ring:   make([]*filter.TraceRecord, size),
+		subs:   map[chan *filter.TraceRecord]struct{}{},
+		format: params["format"],
+	}
+	switch t.format {
+	case "":
+		t.format = traceFormatJSON
+	case traceFormatJSON, traceFormatBlktrace:
+	default:
+		return nil, fmt.Errorf("bad trace format: %s", t.format)
+	}
+
+	if name := params["file"]; name != "" {
+		path, err := traceFilePath(dir, name)
+		if err != nil {
+			return nil, err
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return nil, fmt.Errorf("failed to create trace dir: %v", err)
+		}
+		t.file, err = os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND|unix.O_NOFOLLOW, 0644)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open trace file: %v", err)
+		}
+		t.out = bufio.NewWriter(t.file)
+	}
+	return t, nil
+}
+
+func encodeBlkTrace(buf []byte, seq uint32, ts int64, sector uint64, bytes uint32, action uint32, errno uint16) {
+	le := binary.LittleEndian
+	le.PutUint32(buf[0:], blkIOTraceMagic)
+	le.PutUint32(buf[4:], seq)
+	le.PutUint64(buf[8:], uint64(ts))
+	le.PutUint64(buf[16:], sector)
+	le.PutUint32(buf[24:], bytes)
+	le.PutUint32(buf[28:], action)
+	le.PutUint32(buf[32:], uint32(os.Getpid()))
+	le.PutUint32(buf[36:], 0) // device
+	le.PutUint32(buf[40:], 0) // cpu
+	le.PutUint16(buf[44:], errno)
+	le.PutUint16(buf[46:], 0) // pdu_len
+}
+
+func (t *traceFilter) writeBlkTrace(rec *filter.TraceRecord) error {
+	var cat uint32
+	switch rec.Op {
+	case filter.TraceRecord_READ:
+		cat = blkTCRead
+	case filter.TraceRecord_WRITE:
+		cat = blkTCWrite
+	case filter.TraceRecord_FLUSH:
+		cat = blkTCFlush
+	case filter.TraceRecord_TRIM:
+		cat = blkTCDiscard | blkTCWrite
+	}
+	var errno uint16
+	if rec.Error {
+		errno = 5 // EIO
+	}
+
+	buf := make([]byte, 2*blkIOTraceRecSize)
+	t.seq++
+	encodeBlkTrace(buf, t.seq, rec.TimestampNs, rec.Lba, uint32(rec.Length), blkTAIssue|cat<<blkTCShift, 0)
+	t.seq++
+	encodeBlkTrace(buf[blkIOTraceRecSize:], t.seq, rec.TimestampNs+rec.LatencyNs, rec.Lba, uint32(rec.Length), blkTAComplete|cat<<blkTCShift, errno)
+	_, err := t.out.Write(buf)
+	return err
+}
+
+func (t *traceFilter) writeJSON(rec *filter.TraceRecord) error {
+	line, err := json.Marshal(map[string]interface{}{
+		"ts":        rec.TimestampNs,
+		"op":        rec.Op.String(),
+		"lba":       rec.Lba,
+		"len":       rec.Length,
+		"latencyNs": rec.LatencyNs,
+		"error":     rec.Error,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = t.out.Write(append(line, '\n'))
+	return err
+}
+
+func (t *traceFilter) record(op filter.TraceRecord_Op, off, length int64, start time.Time, ioerr error) {
+	rec := &filter.TraceRecord{
+		TimestampNs: start.UnixNano(),
+		Op:          op,
+		Lba:         uint64(off / sectorSize),
+		Length:      uint64(length),
+		LatencyNs:   time.Since(start).Nanoseconds(),
+		Error:       ioerr != nil,
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.total++
+	t.ring[t.head] = rec
+	t.head = (t.head + 1) % len(t.ring)
+	if t.count < len(t.ring) {
+		t.count++
+	}
+
+	for ch := range t.subs {
+		select {
+		case ch <- rec:
+		default:
+			t.dropped++
+		}
+	}
+
+	if t.out != nil {
+		var err error
+		if t.format == traceFormatBlktrace {
+			err = t.writeBlkTrace(rec)
+		} else {
+			err = t.writeJSON(rec)
+		}
+		if err != nil {
+			glog.Errorf("trace: write failed, file output disabled: %v", err)
+			t.out = nil
+		}
+	}
+}
+
+// Subscribe to new records, optionally get ring buffer contents first
+func (t *traceFilter) Subscribe(replay bool) (chan *filter.TraceRecord, []*filter.TraceRecord) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var old []*filter.TraceRecord
+	if replay {
+		for i := 0; i < t.count; i++ {
+			old = append(old, t.ring[(t.head-t.count+i+len(t.ring))%len(t.ring)])
+		}
+	}
+	ch := make(chan *filter.TraceRecord, traceSubscriberQueue)
+	t.subs[ch] = struct{}{}
+	return ch, old
+}
+
+func (t *traceFilter) Unsubscribe(ch chan *filter.TraceRecord) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if _, ok := t.subs[ch]; ok {
+		delete(t.subs, ch)
+		close(ch)
+	}
+}
+
+func (t *traceFilter) ReadAt(p []byte, off int64) (int, error) {
+	start := time.Now()
+	n, err := t.lower.ReadAt(p, off)
+	t.record(filter.TraceRecord_READ, off, int64(len(p)), start, err)
+	return n, err
+}
+
+func (t *traceFilter) WriteAt(p []byte, off int64) (int, error) {
+	start := time.Now()
+	n, err := t.lower.WriteAt(p, off)
+	t.record(filter.TraceRecord_WRITE, off, int64(len(p)), start, err)
+	return n, err
+}
+
+func (t *traceFilter) Size() int64 {
+	return t.lower.Size()
+}
+
+func (t *traceFilter) Flush() error {
+	start := time.Now()
+	err := t.lower.Flush()
+	t.record(filter.TraceRecord_FLUSH, 0, 0, start, err)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.out != nil {
+		if err := t.out.Flush(); err != nil {
+			glog.Errorf("trace: flush failed: %v", err)
+		}
+	}
+	return err
+}
+
+func (t *traceFilter) Trim(off, length int64) error {
+	start := time.Now()
+	err := t.lower.Trim(off, length)
+	t.record(filter.TraceRecord_TRIM, off, length, start, err)
+	return err
+}
+
+// Ends all streams, flushes trace file
+func (t *traceFilter) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for ch := range t.subs {
+		delete(t.subs, ch)
+		close(ch)
+	}
+	if t.file != nil {
+		if t.out != nil {
+			if err := t.out.Flush(); err != nil {
+				return err
+			}
+		}
+		if err := t.file.Close(); err != nil {
+			return err
+		}
+		t.file = nil
+		t.out = nil
+	}
+	return nil
+}
+
+func (t *traceFilter) Name() string {
+	return "trace"
+}
+
+func (t *traceFilter) Status() *filter.FilterStatus {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	info := map[string]string{"format": t.format}
+	if t.file != nil {
+		info["file"] = t.file.Name()
+	}
+	return &filter.FilterStatus{
+		Name: t.Name(),
+		Counters: map[string]uint64{
+			"records":     t.total,
+			"buffered":    uint64(t.count),
+			"subscribers": uint64(len(t.subs)),
+			"dropped":     t.dropped,
+		},
+		Info: info,
+	}
+}
@@ -0,0 +1,238 @@
+package csif
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pooh64/csif-driver/pkg/filter"
+	"golang.org/x/sys/unix"
+)
+
+func openTestTrace(t *testing.T, dir string, params map[string]string) *traceFilter {
+	t.Helper()
+	tf, err := newTraceFilterDir(newVolatileDev(1*mib), params, dir)
+	if err != nil {
+		t.Fatalf("newTraceFilter: %v", err)
+	}
+	return tf
+}
+
+func TestTraceFilePath(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		path string
+	}{
+		{"trace.bin", "/trace/trace.bin"},
+		{"vol/trace.json", "/trace/vol/trace.json"},
+		{"./a/../b", ""},
+		{"..", ""},
+		{"../etc/passwd", ""},
+		{"/etc/passwd", ""},
+		{"a/b/../../..", ""},
+		{"..trace", "/trace/..trace"},
+	} {
+		path, err := traceFilePath("/trace", tc.name)
+		if tc.path == "" && err == nil {
+			t.Errorf("%s: is accepted as %s", tc.name, path)
+		}
+		if tc.path != "" && (err != nil || path != tc.path) {
+			t.Errorf("%s: %s, %v, expected %s", tc.name, path, err, tc.path)
+		}
+	}
+
+	if _, err := newTraceFilterDir(newVolatileDev(1*mib), map[string]string{"file": "../trace"}, t.TempDir()); err == nil {
+		t.Errorf("trace file out of trace dir is opened")
+	}
+}
+
+func TestTraceFilterRing(t *testing.T) {
+	tf := openTestTrace(t, "", map[string]string{"bufferSize": "4"})
+	defer tf.Close()
+
+	for l := 0; l < 6; l++ {
+		writeDevBlock(t, tf, l, testBlockData(l))
+	}
+	ch, old := tf.Subscribe(true)
+	if len(old) != 4 {
+		t.Fatalf("%d records replayed, expected 4", len(old))
+	}
+	for i, rec := range old {
+		lba := uint64((i + 2) * testCacheBlock / sectorSize)
+		if rec.Op != filter.TraceRecord_WRITE || rec.Lba != lba || rec.Length != testCacheBlock {
+			t.Errorf("record %d: %v, expected write of lba %d", i, rec, lba)
+		}
+	}
+
+	if err := tf.Trim(0, 2*testCacheBlock); err != nil {
+		t.Fatal(err)
+	}
+	if rec := <-ch; rec.Op != filter.TraceRecord_TRIM || rec.Lba != 0 || rec.Length != 2*testCacheBlock {
+		t.Errorf("streamed %v, expected trim", rec)
+	}
+	if _, old := tf.Subscribe(false); len(old) != 0 {
+		t.Errorf("%d records replayed without replay", len(old))
+	}
+
+	counters := tf.Status().GetCounters()
+	if counters["records"] != 7 || counters["buffered"] != 4 || counters["subscribers"] != 2 {
+		t.Errorf("unexpected counters %v", counters)
+	}
+}
+
+func TestTraceFilterSlowSubscriber(t *testing.T) {
+	tf := openTestTrace(t, "", nil)
+	slow, _ := tf.Subscribe(false)
+	fast, _ := tf.Subscribe(false)
+
+	n := traceSubscriberQueue + 10
+	got := 0
+	for i := 0; i < n; i++ {
+		readDevBlock(t, tf, 0)
+		<-fast
+		got++
+	}
+	if got != n || len(slow) != traceSubscriberQueue {
+		t.Errorf("fast got %d of %d, slow has %d queued", got, n, len(slow))
+	}
+	if d := tf.Status().GetCounters()["dropped"]; d != 10 {
+		t.Errorf("%d records dropped, expected 10", d)
+	}
+
+	tf.Unsubscribe(fast)
+	if _, ok := <-fast; ok {
+		t.Errorf("unsubscribed channel is open")
+	}
+	if err := tf.Close(); err != nil {
+		t.Fatal(err)
+	}
+	for range slow {
+	}
+}
+
+func TestTraceFilterJSON(t *testing.T) {
+	dir := t.TempDir()
+	tf := openTestTrace(t, dir, map[string]string{"file": "vol/trace.json"})
+
+	writeDevBlock(t, tf, 1, testBlockData(1))
+	readDevBlock(t, tf, 2)
+	if err := tf.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if err := tf.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := os.Open(filepath.Join(dir, "vol/trace.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	var recs []map[string]interface{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var rec map[string]interface{}
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			t.Fatalf("bad line %q: %v", scanner.Text(), err)
+		}
+		recs = append(recs, rec)
+	}
+	if len(recs) != 3 {
+		t.Fatalf("%d records, expected 3", len(recs))
+	}
+	for i, want := range []struct {
+		op       string
+		lba, len float64
+	}{
+		{"WRITE", 8, testCacheBlock},
+		{"READ", 16, testCacheBlock},
+		{"FLUSH", 0, 0},
+	} {
+		rec := recs[i]
+		if rec["op"] != want.op || rec["lba"] != want.lba || rec["len"] != want.len || rec["error"] != false {
+			t.Errorf("record %d: %v", i, rec)
+		}
+		if _, ok := rec["ts"].(float64); !ok {
+			t.Errorf("record %d has no timestamp", i)
+		}
+	}
+}
+
+func TestTraceFilterBlktrace(t *testing.T) {
+	dir := t.TempDir()
+	tf := openTestTrace(t, dir, map[string]string{"file": "trace.bin", "format": traceFormatBlktrace})
+
+	writeDevBlock(t, tf, 1, testBlockData(1))
+	if err := tf.Trim(0, testCacheBlock); err != nil {
+		t.Fatal(err)
+	}
+	if err := tf.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	buf, err := os.ReadFile(filepath.Join(dir, "trace.bin"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(buf) != 4*blkIOTraceRecSize {
+		t.Fatalf("%d bytes, expected 4 records", len(buf))
+	}
+
+	le := binary.LittleEndian
+	for i, want := range []struct {
+		action uint32
+		sector uint64
+	}{
+		{blkTAIssue | blkTCWrite<<blkTCShift, 8},
+		{blkTAComplete | blkTCWrite<<blkTCShift, 8},
+		{blkTAIssue | (blkTCDiscard|blkTCWrite)<<blkTCShift, 0},
+		{blkTAComplete | (blkTCDiscard|blkTCWrite)<<blkTCShift, 0},
+	} {
+		rec := buf[i*blkIOTraceRecSize:]
+		if magic := le.Uint32(rec[0:]); magic != blkIOTraceMagic {
+			t.Errorf("record %d: magic %x", i, magic)
+		}
+		if seq := le.Uint32(rec[4:]); seq != uint32(i+1) {
+			t.Errorf("record %d: sequence %d", i, seq)
+		}
+		if sector := le.Uint64(rec[16:]); sector != want.sector {
+			t.Errorf("record %d: sector %d, expected %d", i, sector, want.sector)
+		}
+		if bytes := le.Uint32(rec[24:]); bytes != testCacheBlock {
+			t.Errorf("record %d: %d bytes", i, bytes)
+		}
+		if action := le.Uint32(rec[28:]); action != want.action {
+			t.Errorf("record %d: action %x, expected %x", i, action, want.action)
+		}
+		if errno := le.Uint16(rec[44:]); errno != 0 {
+			t.Errorf("record %d: errno %d", i, errno)
+		}
+	}
+	if issue, complete := le.Uint64(buf[8:]), le.Uint64(buf[blkIOTraceRecSize+8:]); complete < issue {
+		t.Errorf("completed at %d before issue at %d", complete, issue)
+	}
+}
+
+func TestTraceFilterBlktraceError(t *testing.T) {
+	dir := t.TempDir()
+	tf := openTestTrace(t, dir, map[string]string{"file": "trace.bin", "format": traceFormatBlktrace})
+	tf.record(filter.TraceRecord_READ, 512, 512, time.Now(), unix.EIO)
+	if err := tf.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	buf, err := os.ReadFile(filepath.Join(dir, "trace.bin"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	le := binary.LittleEndian
+	if len(buf) != 2*blkIOTraceRecSize || le.Uint16(buf[44:]) != 0 ||
+		le.Uint16(buf[blkIOTraceRecSize+44:]) != uint16(unix.EIO) {
+		t.Errorf("failed read isn't completed with EIO")
+	}
+}
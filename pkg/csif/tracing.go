@@ -0,0 +1,175 @@
+package csif
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/golang/glog"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"k8s.io/client-go/transport"
+)
+
+// Tracing: spans start in the gRPC interceptor of NbServer and are passed to
+// the filter via gRPC metadata. Exec and Kubernetes API calls get child spans,
+// calls made outside of a traced request are not recorded.
+//
+// exporters:
+//
+//	otlp: OTLP over HTTP, endpoint is collector host:port
+//	file: JSON lines, endpoint is file path
+
+const (
+	TracingExporterOTLP = "otlp"
+	TracingExporterFile = "file"
+
+	tracerName = "github.com/pooh64/csif-driver/pkg/csif"
+)
+
+var tracer = otel.Tracer(tracerName)
+
+// Set global tracer provider, returns flush on exit
+func SetupTracing(service, exporter, endpoint string) (func(), error) {
+	var exp sdktrace.SpanExporter
+	var err error
+
+	switch exporter {
+	case "":
+		return func() {}, nil
+	case TracingExporterOTLP:
+		exp, err = otlptracehttp.New(context.Background(),
+			otlptracehttp.WithEndpoint(endpoint), otlptracehttp.WithInsecure())
+	case TracingExporterFile:
+		var file *os.File
+		if file, err = os.OpenFile(endpoint, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644); err != nil {
+			return nil, fmt.Errorf("failed to open trace file: %v", err)
+		}
+		exp, err = stdouttrace.New(stdouttrace.WithWriter(file))
+	default:
+		return nil, fmt.Errorf("unknown tracing exporter: %s", exporter)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s exporter: %v", exporter, err)
+	}
+
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exp),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL,
+			semconv.ServiceNameKey.String(service))),
+	)
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	glog.Infof("tracing: %s exporter to %s", exporter, endpoint)
+
+	return func() {
+		if err := tp.Shutdown(context.Background()); err != nil {
+			glog.Errorf("failed to flush traces: %v", err)
+		}
+	}, nil
+}
+
+// gRPC metadata as propagation carrier
+type metadataCarrier metadata.MD
+
+func (c metadataCarrier) Get(key string) string {
+	if v := metadata.MD(c).Get(key); len(v) != 0 {
+		return v[0]
+	}
+	return ""
+}
+
+func (c metadataCarrier) Set(key, value string) {
+	metadata.MD(c).Set(key, value)
+}
+
+func (c metadataCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for k := range c {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(otelcodes.Error, err.Error())
+	}
+	span.End()
+}
+
+// Server side, the outermost interceptor
+func tracingInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		ctx = otel.GetTextMapPropagator().Extract(ctx, metadataCarrier(md))
+	}
+	ctx, span := tracer.Start(ctx, info.FullMethod, trace.WithSpanKind(trace.SpanKindServer))
+	resp, err := handler(ctx, req)
+	span.SetAttributes(attribute.String("rpc.grpc.status_code", status.Code(err).String()))
+	endSpan(span, err)
+	return resp, err
+}
+
+// Client side, for Filter API calls
+func tracingClientInterceptor(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	ctx, span := tracer.Start(ctx, method, trace.WithSpanKind(trace.SpanKindClient))
+	md, ok := metadata.FromOutgoingContext(ctx)
+	if ok {
+		md = md.Copy()
+	} else {
+		md = metadata.MD{}
+	}
+	otel.GetTextMapPropagator().Inject(ctx, metadataCarrier(md))
+	err := invoker(metadata.NewOutgoingContext(ctx, md), method, req, reply, cc, opts...)
+	endSpan(span, err)
+	return err
+}
+
+// Child span of traced request, no-op span otherwise
+func startSpan(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	if !trace.SpanFromContext(ctx).SpanContext().IsValid() {
+		return ctx, trace.SpanFromContext(ctx)
+	}
+	return tracer.Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// Cleanup must not be cut by the deadline of request, keep the span only
+func detachedContext(ctx context.Context) context.Context {
+	return trace.ContextWithSpan(context.Background(), trace.SpanFromContext(ctx))
+}
+
+// Span per Kubernetes API call
+type tracingRoundTripper struct {
+	rt http.RoundTripper
+}
+
+func (t *tracingRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx, span := startSpan(req.Context(), "k8s "+req.Method,
+		attribute.String("http.method", req.Method),
+		attribute.String("http.target", req.URL.Path))
+	resp, err := t.rt.RoundTrip(req.WithContext(ctx))
+	if err == nil {
+		span.SetAttributes(attribute.Int("http.status_code", resp.StatusCode))
+	}
+	endSpan(span, err)
+	return resp, err
+}
+
+var _ transport.WrapperFunc = wrapTracingTransport
+
+func wrapTracingTransport(rt http.RoundTripper) http.RoundTripper {
+	return &tracingRoundTripper{rt: rt}
+}
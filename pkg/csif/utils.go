@@ -7,6 +7,7 @@ import (
 
 	"github.com/golang/glog"
 	"github.com/google/uuid"
+	"google.golang.org/grpc/status"
 	utilexec "k8s.io/utils/exec"
 )
 
@@ -17,6 +18,14 @@ func cleanup(err *error, f func()) {
 	}
 }
 
+// Prefix error message, gRPC code is kept if there is one
+func wrapStatus(err error, msg string) error {
+	if st, ok := status.FromError(err); ok {
+		return status.Errorf(st.Code(), "%s: %s", msg, st.Message())
+	}
+	return fmt.Errorf("%s: %v", msg, err)
+}
+
 func newUUID() (string, error) {
 	id, err := uuid.NewUUID()
 	if err != nil {
@@ -78,3 +87,30 @@ func GetPortal() (string, error) {
 	}
 	return "", fmt.Errorf("hostname ip not found")
 }
+
+// Get IPs of secondary interfaces, additional portals for multipath
+func GetInterfacePortals(names []string) ([]string, error) {
+	var portals []string
+	for _, name := range names {
+		iface, err := net.InterfaceByName(name)
+		if err != nil {
+			return nil, err
+		}
+		addrs, err := iface.Addrs()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", name, err)
+		}
+		found := false
+		for _, addr := range addrs {
+			if ipnet, ok := addr.(*net.IPNet); ok && ipnet.IP.To4() != nil {
+				portals = append(portals, ipnet.IP.String())
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("%s: no ipv4 address", name)
+		}
+	}
+	return portals, nil
+}
@@ -0,0 +1,144 @@
+package csif
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	core "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Controller state is kept in the API server, so that any replica may take
+// over: each volume is a ConfigMap named after the CSI volume name. It is
+// created before CreateVolume returns and deleted by DeleteVolume, retried
+// calls find it by name. Slices of pools are allocated by the leader only,
+// see leader.go
+
+const (
+	csifVolumeApp     = "csi-csif-volume"
+	csifVolumeIDLabel = "csif.pooh64.io/volume-id"
+	csifVolumeDataKey = "volume.json"
+)
+
+type volumeRecord struct {
+	Name       string            `json:"name"`
+	ID         string            `json:"id"`
+	Size       int64             `json:"size"`
+	AccessType volAccessType     `json:"accessType"`
+	Context    map[string]string `json:"context"`
+}
+
+// CSI names are arbitrary strings, object names are not
+func volumeRecordName(volName string) string {
+	sum := sha256.Sum256([]byte(volName))
+	return "csif-vol-" + hex.EncodeToString(sum[:10])
+}
+
+func (cs *csifControllerServer) recordNamespace() string {
+	return cs.cd.podTemplate.Namespace
+}
+
+func (cs *csifControllerServer) recordToVolume(cm *core.ConfigMap) (*csifVolume, error) {
+	var rec volumeRecord
+	if err := json.Unmarshal([]byte(cm.Data[csifVolumeDataKey]), &rec); err != nil {
+		return nil, fmt.Errorf("bad volume record %s: %v", cm.Name, err)
+	}
+	disk := newCsifDisk(cs.cd)
+	if err := disk.LoadContext(rec.Context); err != nil {
+		return nil, fmt.Errorf("bad volume record %s: %v", cm.Name, err)
+	}
+	disk.volID = rec.ID
+	return &csifVolume{
+		Name:       rec.Name,
+		ID:         rec.ID,
+		Size:       rec.Size,
+		AccessType: rec.AccessType,
+		Disk:       disk,
+	}, nil
+}
+
+// nil if there is no such volume
+func (cs *csifControllerServer) getVolumeByName(ctx context.Context, volName string) (*csifVolume, error) {
+	cm, err := cs.cd.clientset.CoreV1().ConfigMaps(cs.recordNamespace()).Get(ctx, volumeRecordName(volName), metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to get volume record: %v", err)
+	}
+	return cs.recordToVolume(cm)
+}
+
+// nil if there is no such volume
+func (cs *csifControllerServer) getVolumeByID(ctx context.Context, volID string) (*csifVolume, error) {
+	vols, err := cs.listVolumes(ctx, csifVolumeIDLabel+"="+volID)
+	if err != nil || len(vols) == 0 {
+		return nil, err
+	}
+	return vols[0], nil
+}
+
+func (cs *csifControllerServer) listVolumes(ctx context.Context, selector string) ([]*csifVolume, error) {
+	if selector != "" {
+		selector = "," + selector
+	}
+	cms, err := cs.cd.clientset.CoreV1().ConfigMaps(cs.recordNamespace()).List(ctx, metav1.ListOptions{
+		LabelSelector: "app=" + csifVolumeApp + selector,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list volume records: %v", err)
+	}
+	var vols []*csifVolume
+	for i := range cms.Items {
+		vol, err := cs.recordToVolume(&cms.Items[i])
+		if err != nil {
+			return nil, err
+		}
+		vols = append(vols, vol)
+	}
+	return vols, nil
+}
+
+func (cs *csifControllerServer) saveVolume(ctx context.Context, vol *csifVolume) error {
+	data, err := json.Marshal(&volumeRecord{
+		Name:       vol.Name,
+		ID:         vol.ID,
+		Size:       vol.Size,
+		AccessType: vol.AccessType,
+		Context:    vol.Disk.SaveContext(),
+	})
+	if err != nil {
+		return err
+	}
+	cm := &core.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      volumeRecordName(vol.Name),
+			Namespace: cs.recordNamespace(),
+			Labels: map[string]string{
+				"app":             csifVolumeApp,
+				csifVolumeIDLabel: vol.ID,
+			},
+		},
+		Data: map[string]string{csifVolumeDataKey: string(data)},
+	}
+	_, err = cs.cd.clientset.CoreV1().ConfigMaps(cm.Namespace).Create(ctx, cm, metav1.CreateOptions{})
+	if errors.IsAlreadyExists(err) {
+		return status.Errorf(codes.Aborted, "volume %s is being created concurrently", vol.Name)
+	} else if err != nil {
+		return status.Errorf(codes.Internal, "failed to save volume record: %v", err)
+	}
+	return nil
+}
+
+func (cs *csifControllerServer) removeVolume(ctx context.Context, vol *csifVolume) error {
+	err := cs.cd.clientset.CoreV1().ConfigMaps(cs.recordNamespace()).Delete(ctx, volumeRecordName(vol.Name), metav1.DeleteOptions{})
+	if err != nil && !errors.IsNotFound(err) {
+		return fmt.Errorf("failed to delete volume record: %v", err)
+	}
+	return nil
+}
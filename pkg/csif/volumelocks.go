@@ -0,0 +1,52 @@
+package csif
+
+import (
+	"sync"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// One operation per volume at a time. Concurrent calls are not queued but
+// fail with Aborted, as CSI recommends, the CO retries them
+type volumeLocks struct {
+	mu    sync.Mutex
+	locks map[string]bool
+}
+
+func newVolumeLocks() *volumeLocks {
+	return &volumeLocks{
+		locks: map[string]bool{},
+	}
+}
+
+func (vl *volumeLocks) tryAcquire(volID string) bool {
+	vl.mu.Lock()
+	defer vl.mu.Unlock()
+	if vl.locks[volID] {
+		return false
+	}
+	vl.locks[volID] = true
+	return true
+}
+
+func (vl *volumeLocks) release(volID string) {
+	vl.mu.Lock()
+	defer vl.mu.Unlock()
+	delete(vl.locks, volID)
+}
+
+// Volumes in operation
+func (vl *volumeLocks) held() []string {
+	vl.mu.Lock()
+	defer vl.mu.Unlock()
+	var ids []string
+	for volID := range vl.locks {
+		ids = append(ids, volID)
+	}
+	return ids
+}
+
+func volumeBusyError(volID string) error {
+	return status.Errorf(codes.Aborted, "an operation on volume %s is already in progress", volID)
+}
@@ -0,0 +1,245 @@
+package csif
+
+import (
+	"fmt"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/pooh64/csif-driver/pkg/filter"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	core "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// Warm pool: ready filter pods pinned to the node. Staging claims one and
+// binds it to the source via BindSource instead of waiting for scheduling,
+// image pull and tgtd startup.
+//
+// Only node-local sources (local and hostPath PVs) can be bound: a network
+// PVC has to be attached to the pod by kubelet and volumes can't be added to
+// a running pod. For the same reason the dirs a claim needs are mounted in
+// advance: warm pods get the configured local volume dirs of the node, not
+// host root, and PVs out of them can't be bound. Device links there resolve
+// to /dev of the privileged container, devices added after pod start are not
+// seen. Disks with network or out-of-dirs source or cache PVCs always get a
+// dedicated pod, counted as "nonlocal" claims.
+
+const (
+	warmPoolStateLabel     = "csif.pooh64.io/warm" // ready or claimed
+	warmPoolRefillInterval = 10 * time.Second
+	warmPoolBindTimeout    = 30 * time.Second
+)
+
+type warmPool struct {
+	cd   *csifDriver
+	size int
+	dirs []string // host dirs of local PVs, see makeWarmPodConf
+
+	mu     sync.Mutex // serializes claims
+	refill chan struct{}
+}
+
+func newWarmPool(cd *csifDriver, size int, dirs []string) *warmPool {
+	return &warmPool{
+		cd:     cd,
+		size:   size,
+		dirs:   dirs,
+		refill: make(chan struct{}, 1),
+	}
+}
+
+func makeWarmPodConf(t *filterPodTemplate, nodeID string, dirs []string) *core.Pod {
+	pod := makeFilterPodBase(t, "")
+	pod.GenerateName = "csi-csif-fw-"
+	pod.Labels[warmPoolStateLabel] = "ready"
+	setFilterPodLabel(pod, filterPodNodeLabel, nodeID)
+	pod.Spec.NodeName = nodeID
+
+	// Paths are the same as in filter daemon, see resolveLocalPVC
+	spec := &pod.Spec
+	dirType := core.HostPathDirectory
+	for i, dir := range dirs {
+		name := fmt.Sprintf("local-dir-%d", i)
+		spec.Volumes = append(spec.Volumes, core.Volume{
+			Name: name,
+			VolumeSource: core.VolumeSource{
+				HostPath: &core.HostPathVolumeSource{Path: dir, Type: &dirType},
+			},
+		})
+		spec.Containers[0].VolumeMounts = append(spec.Containers[0].VolumeMounts, core.VolumeMount{
+			Name:      name,
+			MountPath: path.Join(csifFilterDaemonHostRoot, dir),
+		})
+	}
+	return pod
+}
+
+// Path of node-local PV in warm pod, error if it is not mounted there
+func (wp *warmPool) resolve(namespace, name string) (string, error) {
+	p, err := wp.cd.resolveLocalPVC(namespace, name)
+	if err != nil {
+		return "", err
+	}
+	for _, dir := range wp.dirs {
+		if strings.HasPrefix(p, path.Join(csifFilterDaemonHostRoot, dir)+"/") {
+			return p, nil
+		}
+	}
+	return "", fmt.Errorf("PVC %s is out of warm pool local dirs %v", name, wp.dirs)
+}
+
+func (wp *warmPool) list(state string) ([]core.Pod, error) {
+	sel := labels.Set{
+		warmPoolStateLabel: state,
+		filterPodNodeLabel: filterLabelValue(wp.cd.nodeID),
+	}.AsSelector().String()
+	pods, err := wp.cd.clientset.CoreV1().Pods(wp.cd.podTemplate.Namespace).List(context.TODO(), metav1.ListOptions{
+		LabelSelector: sel,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list warm pods: %v", err)
+	}
+	return pods.Items, nil
+}
+
+// Drop failed pods, create missing ones
+func (wp *warmPool) fill() error {
+	coreif := wp.cd.clientset.CoreV1()
+	pods, err := wp.list("ready")
+	if err != nil {
+		return err
+	}
+
+	ready, pending := 0, 0
+	for i := range pods {
+		pod := &pods[i]
+		switch {
+		case pod.DeletionTimestamp != nil:
+		case isPodReady(pod):
+			ready++
+		case pod.Status.Phase == core.PodPending, pod.Status.Phase == core.PodRunning:
+			pending++ // not ready yet
+		default:
+			glog.Warningf("warm pod %s is %v, deleting", pod.Name, pod.Status.Phase)
+			if err := deleteFilterPod(coreif, pod); err != nil {
+				glog.Errorf("failed to delete pod: %v", err)
+			}
+		}
+	}
+
+	for ready+pending < wp.size {
+		conf := makeWarmPodConf(wp.cd.podTemplate, wp.cd.nodeID, wp.dirs)
+		pod, err := coreif.Pods(conf.Namespace).Create(context.TODO(), conf, metav1.CreateOptions{})
+		if err != nil {
+			return fmt.Errorf("failed to create warm pod: %v", err)
+		}
+		glog.V(4).Infof("warm pod created: %s", pod.Name)
+		warmPoolCreated.Inc()
+		pending++
+	}
+
+	warmPoolReady.Set(float64(ready))
+	warmPoolPending.Set(float64(pending))
+	return nil
+}
+
+func (wp *warmPool) run() {
+	warmPoolTargetSize.Set(float64(wp.size))
+	ticker := time.NewTicker(warmPoolRefillInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := wp.fill(); err != nil {
+			glog.Errorf("warm pool refill failed: %v", err)
+		}
+		select {
+		case <-ticker.C:
+		case <-wp.refill:
+		}
+	}
+}
+
+func (wp *warmPool) triggerRefill() {
+	select {
+	case wp.refill <- struct{}{}:
+	default:
+	}
+}
+
+func bindSource(ctx context.Context, conn *grpc.ClientConn, source, pvc string) error {
+	ctx, cancel := context.WithTimeout(ctx, warmPoolBindTimeout)
+	defer cancel()
+
+	client := filter.NewFilterClient(conn)
+	_, err := client.BindSource(ctx, &filter.BindSourceRequest{
+		Source:    source,
+		SourcePvc: pvc,
+	})
+	return err
+}
+
+// Claim ready pod and bind it to the disk source, nil pod if none fits
+func (wp *warmPool) claim(ctx context.Context, d *csifDisk) (*core.Pod, *grpc.ClientConn, error) {
+	source, err := wp.resolve(d.sourceNamespace(), d.SourcePVC)
+	if err == nil && d.CachePVC != "" {
+		_, err = wp.resolve(d.sourceNamespace(), d.CachePVC)
+	}
+	if err != nil {
+		glog.V(4).Infof("warm pool is not usable: %v", err)
+		warmPoolClaims.WithLabelValues("nonlocal").Inc()
+		return nil, nil, nil
+	}
+
+	wp.mu.Lock()
+	defer wp.mu.Unlock()
+	defer wp.triggerRefill()
+
+	pods, err := wp.list("ready")
+	if err != nil {
+		warmPoolClaims.WithLabelValues("error").Inc()
+		return nil, nil, err
+	}
+
+	coreif := wp.cd.clientset.CoreV1()
+	for i := range pods {
+		pod := &pods[i]
+		if !isPodReady(pod) {
+			continue
+		}
+		pod.Labels[warmPoolStateLabel] = "claimed"
+		pod, err = coreif.Pods(pod.Namespace).Update(context.TODO(), pod, metav1.UpdateOptions{})
+		if errors.IsConflict(err) || errors.IsNotFound(err) {
+			continue
+		} else if err != nil {
+			warmPoolClaims.WithLabelValues("error").Inc()
+			return nil, nil, fmt.Errorf("failed to claim warm pod: %v", err)
+		}
+
+		conn, err := dialFilterPod(ctx, pod)
+		if err == nil {
+			if err = bindSource(ctx, conn, source, d.SourcePVC); err != nil {
+				conn.Close()
+			}
+		}
+		if err != nil {
+			if err := deleteFilterPod(coreif, pod); err != nil {
+				glog.Errorf("failed to delete pod: %v", err)
+			}
+			warmPoolClaims.WithLabelValues("error").Inc()
+			return nil, nil, fmt.Errorf("failed to bind warm pod %s: %v", pod.Name, err)
+		}
+
+		glog.V(4).Infof("warm pod %s claimed for %s", pod.Name, d.SourcePVC)
+		warmPoolClaims.WithLabelValues("hit").Inc()
+		return pod, conn, nil
+	}
+
+	warmPoolClaims.WithLabelValues("miss").Inc()
+	return nil, nil, nil
+}
@@ -0,0 +1,136 @@
+package csif
+
+import (
+	"testing"
+
+	"golang.org/x/net/context"
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+var testWarmPoolDirs = []string{"/mnt/disks"}
+
+func readyWarmPod(nodeID string) *core.Pod {
+	pod := makeWarmPodConf(defaultFilterPodTemplate(), nodeID, testWarmPoolDirs)
+	pod.Name = "csi-csif-fw-0"
+	pod.Status = core.PodStatus{
+		Phase: core.PodRunning,
+		PodIP: "10.0.0.2",
+		Conditions: []core.PodCondition{
+			{Type: core.PodReady, Status: core.ConditionTrue},
+		},
+	}
+	return pod
+}
+
+// Network PVC can't be added to running pod, warm pod must be left alone
+func TestWarmPoolClaimNonLocal(t *testing.T) {
+	pv := &core.PersistentVolume{
+		ObjectMeta: metav1.ObjectMeta{Name: "source-pv"},
+		Spec: core.PersistentVolumeSpec{
+			PersistentVolumeSource: core.PersistentVolumeSource{
+				CSI: &core.CSIPersistentVolumeSource{Driver: "network.csi.io", VolumeHandle: "net-0"},
+			},
+		},
+	}
+	pvc := &core.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{Name: "source-pvc", Namespace: defaultFilterPodTemplate().Namespace},
+		Spec:       core.PersistentVolumeClaimSpec{VolumeName: pv.Name},
+	}
+	td := newTestDriver(t, pv, pvc, readyWarmPod("node-0"))
+	wp := newWarmPool(td.cd, 1, testWarmPoolDirs)
+
+	d := newCsifDisk(td.cd)
+	if err := d.LoadContext(map[string]string{"sourcePVC": pvc.Name}); err != nil {
+		t.Fatal(err)
+	}
+	d.volID = testVolID
+
+	pod, conn, err := wp.claim(context.Background(), d)
+	if pod != nil || conn != nil || err != nil {
+		t.Fatalf("expected fallback to dedicated pod, got %v, %v", pod, err)
+	}
+	ready, err := wp.list("ready")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ready) != 1 {
+		t.Errorf("warm pod is claimed for network source")
+	}
+}
+
+func localTestPVC(name, hostPath string) (*core.PersistentVolume, *core.PersistentVolumeClaim) {
+	pv := &core.PersistentVolume{
+		ObjectMeta: metav1.ObjectMeta{Name: name + "-pv"},
+		Spec: core.PersistentVolumeSpec{
+			PersistentVolumeSource: core.PersistentVolumeSource{
+				Local: &core.LocalVolumeSource{Path: hostPath},
+			},
+		},
+	}
+	pvc := &core.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: defaultFilterPodTemplate().Namespace},
+		Spec:       core.PersistentVolumeClaimSpec{VolumeName: pv.Name},
+	}
+	return pv, pvc
+}
+
+// Warm pod sees local dirs only, PVs out of them can't be bound
+func TestWarmPoolLocalDirs(t *testing.T) {
+	pod := readyWarmPod("node-0")
+	var mounts []string
+	for _, m := range pod.Spec.Containers[0].VolumeMounts {
+		mounts = append(mounts, m.MountPath)
+	}
+	if len(mounts) != 1 || mounts[0] != "/host/mnt/disks" {
+		t.Errorf("warm pod mounts %v", mounts)
+	}
+	for _, v := range pod.Spec.Volumes {
+		if v.HostPath != nil && v.HostPath.Path != "/mnt/disks" {
+			t.Errorf("warm pod has host path %s", v.HostPath.Path)
+		}
+	}
+
+	var objs []runtime.Object
+	for name, hostPath := range map[string]string{
+		"in-dir":     "/mnt/disks/ssd0",
+		"nested":     "/mnt/disks/a/b",
+		"out-of-dir": "/var/lib/data",
+		"prefix":     "/mnt/disks2/ssd0",
+		"escape":     "/mnt/disks/../../etc",
+		"dir-itself": "/mnt/disks",
+	} {
+		pv, pvc := localTestPVC(name, hostPath)
+		objs = append(objs, pv, pvc)
+	}
+	td := newTestDriver(t, objs...)
+	wp := newWarmPool(td.cd, 1, testWarmPoolDirs)
+	ns := defaultFilterPodTemplate().Namespace
+
+	for name, want := range map[string]string{
+		"in-dir":     "/host/mnt/disks/ssd0",
+		"nested":     "/host/mnt/disks/a/b",
+		"out-of-dir": "",
+		"prefix":     "",
+		"escape":     "",
+		"dir-itself": "",
+	} {
+		p, err := wp.resolve(ns, name)
+		if want == "" && err == nil {
+			t.Errorf("%s: resolved to %s", name, p)
+		}
+		if want != "" && (err != nil || p != want) {
+			t.Errorf("%s: %s, %v, expected %s", name, p, err, want)
+		}
+	}
+
+	d := newCsifDisk(td.cd)
+	if err := d.LoadContext(map[string]string{"sourcePVC": "out-of-dir"}); err != nil {
+		t.Fatal(err)
+	}
+	d.volID = testVolID
+	if pod, _, err := wp.claim(context.Background(), d); pod != nil || err != nil {
+		t.Errorf("expected fallback to dedicated pod, got %v, %v", pod, err)
+	}
+}
@@ -20,6 +20,211 @@ const (
 	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
 )
 
+type FaultRule_Op int32
+
+const (
+	FaultRule_ANY   FaultRule_Op = 0
+	FaultRule_READ  FaultRule_Op = 1
+	FaultRule_WRITE FaultRule_Op = 2
+)
+
+// Enum value maps for FaultRule_Op.
+var (
+	FaultRule_Op_name = map[int32]string{
+		0: "ANY",
+		1: "READ",
+		2: "WRITE",
+	}
+	FaultRule_Op_value = map[string]int32{
+		"ANY":   0,
+		"READ":  1,
+		"WRITE": 2,
+	}
+)
+
+func (x FaultRule_Op) Enum() *FaultRule_Op {
+	p := new(FaultRule_Op)
+	*p = x
+	return p
+}
+
+func (x FaultRule_Op) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (FaultRule_Op) Descriptor() protoreflect.EnumDescriptor {
+	return file_filter_proto_enumTypes[0].Descriptor()
+}
+
+func (FaultRule_Op) Type() protoreflect.EnumType {
+	return &file_filter_proto_enumTypes[0]
+}
+
+func (x FaultRule_Op) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use FaultRule_Op.Descriptor instead.
+func (FaultRule_Op) EnumDescriptor() ([]byte, []int) {
+	return file_filter_proto_rawDescGZIP(), []int{11, 0}
+}
+
+type FaultRule_Action int32
+
+const (
+	FaultRule_ERROR      FaultRule_Action = 0 // fail request with EIO
+	FaultRule_LATENCY    FaultRule_Action = 1 // delay request
+	FaultRule_DROP_WRITE FaultRule_Action = 2 // report success, don't write
+	FaultRule_TORN_WRITE FaultRule_Action = 3 // write random sector prefix, fail request
+)
+
+// Enum value maps for FaultRule_Action.
+var (
+	FaultRule_Action_name = map[int32]string{
+		0: "ERROR",
+		1: "LATENCY",
+		2: "DROP_WRITE",
+		3: "TORN_WRITE",
+	}
+	FaultRule_Action_value = map[string]int32{
+		"ERROR":      0,
+		"LATENCY":    1,
+		"DROP_WRITE": 2,
+		"TORN_WRITE": 3,
+	}
+)
+
+func (x FaultRule_Action) Enum() *FaultRule_Action {
+	p := new(FaultRule_Action)
+	*p = x
+	return p
+}
+
+func (x FaultRule_Action) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (FaultRule_Action) Descriptor() protoreflect.EnumDescriptor {
+	return file_filter_proto_enumTypes[1].Descriptor()
+}
+
+func (FaultRule_Action) Type() protoreflect.EnumType {
+	return &file_filter_proto_enumTypes[1]
+}
+
+func (x FaultRule_Action) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use FaultRule_Action.Descriptor instead.
+func (FaultRule_Action) EnumDescriptor() ([]byte, []int) {
+	return file_filter_proto_rawDescGZIP(), []int{11, 1}
+}
+
+type FaultRule_LatencyDist int32
+
+const (
+	FaultRule_FIXED       FaultRule_LatencyDist = 0 // latency_us
+	FaultRule_UNIFORM     FaultRule_LatencyDist = 1 // latency_us +- latency_jitter_us
+	FaultRule_NORMAL      FaultRule_LatencyDist = 2 // mean latency_us, stddev latency_jitter_us
+	FaultRule_EXPONENTIAL FaultRule_LatencyDist = 3 // mean latency_us
+)
+
+// Enum value maps for FaultRule_LatencyDist.
+var (
+	FaultRule_LatencyDist_name = map[int32]string{
+		0: "FIXED",
+		1: "UNIFORM",
+		2: "NORMAL",
+		3: "EXPONENTIAL",
+	}
+	FaultRule_LatencyDist_value = map[string]int32{
+		"FIXED":       0,
+		"UNIFORM":     1,
+		"NORMAL":      2,
+		"EXPONENTIAL": 3,
+	}
+)
+
+func (x FaultRule_LatencyDist) Enum() *FaultRule_LatencyDist {
+	p := new(FaultRule_LatencyDist)
+	*p = x
+	return p
+}
+
+func (x FaultRule_LatencyDist) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (FaultRule_LatencyDist) Descriptor() protoreflect.EnumDescriptor {
+	return file_filter_proto_enumTypes[2].Descriptor()
+}
+
+func (FaultRule_LatencyDist) Type() protoreflect.EnumType {
+	return &file_filter_proto_enumTypes[2]
+}
+
+func (x FaultRule_LatencyDist) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use FaultRule_LatencyDist.Descriptor instead.
+func (FaultRule_LatencyDist) EnumDescriptor() ([]byte, []int) {
+	return file_filter_proto_rawDescGZIP(), []int{11, 2}
+}
+
+type TraceRecord_Op int32
+
+const (
+	TraceRecord_READ  TraceRecord_Op = 0
+	TraceRecord_WRITE TraceRecord_Op = 1
+	TraceRecord_FLUSH TraceRecord_Op = 2
+	TraceRecord_TRIM  TraceRecord_Op = 3
+)
+
+// Enum value maps for TraceRecord_Op.
+var (
+	TraceRecord_Op_name = map[int32]string{
+		0: "READ",
+		1: "WRITE",
+		2: "FLUSH",
+		3: "TRIM",
+	}
+	TraceRecord_Op_value = map[string]int32{
+		"READ":  0,
+		"WRITE": 1,
+		"FLUSH": 2,
+		"TRIM":  3,
+	}
+)
+
+func (x TraceRecord_Op) Enum() *TraceRecord_Op {
+	p := new(TraceRecord_Op)
+	*p = x
+	return p
+}
+
+func (x TraceRecord_Op) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (TraceRecord_Op) Descriptor() protoreflect.EnumDescriptor {
+	return file_filter_proto_enumTypes[3].Descriptor()
+}
+
+func (TraceRecord_Op) Type() protoreflect.EnumType {
+	return &file_filter_proto_enumTypes[3]
+}
+
+func (x TraceRecord_Op) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use TraceRecord_Op.Descriptor instead.
+func (TraceRecord_Op) EnumDescriptor() ([]byte, []int) {
+	return file_filter_proto_rawDescGZIP(), []int{18, 0}
+}
+
 type TargetInfo struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
@@ -83,16 +288,150 @@ func (x *TargetInfo) GetIqn() string {
 	return ""
 }
 
+// Block filter stacked on top of the source device, filters are
+// applied in the order they are listed (first is the lowest one)
+type FilterConfig struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Name   string            `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Params map[string]string `protobuf:"bytes,2,rep,name=params,proto3" json:"params,omitempty" protobuf_key:"bytes,1,opt,name=key,proto3" protobuf_val:"bytes,2,opt,name=value,proto3"`
+}
+
+func (x *FilterConfig) Reset() {
+	*x = FilterConfig{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_filter_proto_msgTypes[1]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *FilterConfig) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*FilterConfig) ProtoMessage() {}
+
+func (x *FilterConfig) ProtoReflect() protoreflect.Message {
+	mi := &file_filter_proto_msgTypes[1]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use FilterConfig.ProtoReflect.Descriptor instead.
+func (*FilterConfig) Descriptor() ([]byte, []int) {
+	return file_filter_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *FilterConfig) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *FilterConfig) GetParams() map[string]string {
+	if x != nil {
+		return x.Params
+	}
+	return nil
+}
+
+type FilterStatus struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Name      string            `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Counters  map[string]uint64 `protobuf:"bytes,2,rep,name=counters,proto3" json:"counters,omitempty" protobuf_key:"bytes,1,opt,name=key,proto3" protobuf_val:"varint,2,opt,name=value,proto3"`
+	Info      map[string]string `protobuf:"bytes,3,rep,name=info,proto3" json:"info,omitempty" protobuf_key:"bytes,1,opt,name=key,proto3" protobuf_val:"bytes,2,opt,name=value,proto3"`
+	Condition string            `protobuf:"bytes,4,opt,name=condition,proto3" json:"condition,omitempty"` // abnormal condition message, empty if healthy
+}
+
+func (x *FilterStatus) Reset() {
+	*x = FilterStatus{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_filter_proto_msgTypes[2]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *FilterStatus) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*FilterStatus) ProtoMessage() {}
+
+func (x *FilterStatus) ProtoReflect() protoreflect.Message {
+	mi := &file_filter_proto_msgTypes[2]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use FilterStatus.ProtoReflect.Descriptor instead.
+func (*FilterStatus) Descriptor() ([]byte, []int) {
+	return file_filter_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *FilterStatus) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *FilterStatus) GetCounters() map[string]uint64 {
+	if x != nil {
+		return x.Counters
+	}
+	return nil
+}
+
+func (x *FilterStatus) GetInfo() map[string]string {
+	if x != nil {
+		return x.Info
+	}
+	return nil
+}
+
+func (x *FilterStatus) GetCondition() string {
+	if x != nil {
+		return x.Condition
+	}
+	return ""
+}
+
+// Filter pod may export targets of several volumes (e.g. slices of one
+// source), volume_id selects the target, empty id is a valid id as well
 type CreateTargetRequest struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
 	unknownFields protoimpl.UnknownFields
+
+	Filters  []*FilterConfig `protobuf:"bytes,1,rep,name=filters,proto3" json:"filters,omitempty"`
+	VolumeId string          `protobuf:"bytes,2,opt,name=volume_id,json=volumeId,proto3" json:"volume_id,omitempty"`
+	Source   string          `protobuf:"bytes,3,opt,name=source,proto3" json:"source,omitempty"` // source path in filter pod, default is attached PVC
 }
 
 func (x *CreateTargetRequest) Reset() {
 	*x = CreateTargetRequest{}
 	if protoimpl.UnsafeEnabled {
-		mi := &file_filter_proto_msgTypes[1]
+		mi := &file_filter_proto_msgTypes[3]
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		ms.StoreMessageInfo(mi)
 	}
@@ -105,7 +444,7 @@ func (x *CreateTargetRequest) String() string {
 func (*CreateTargetRequest) ProtoMessage() {}
 
 func (x *CreateTargetRequest) ProtoReflect() protoreflect.Message {
-	mi := &file_filter_proto_msgTypes[1]
+	mi := &file_filter_proto_msgTypes[3]
 	if protoimpl.UnsafeEnabled && x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -118,7 +457,28 @@ func (x *CreateTargetRequest) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use CreateTargetRequest.ProtoReflect.Descriptor instead.
 func (*CreateTargetRequest) Descriptor() ([]byte, []int) {
-	return file_filter_proto_rawDescGZIP(), []int{1}
+	return file_filter_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *CreateTargetRequest) GetFilters() []*FilterConfig {
+	if x != nil {
+		return x.Filters
+	}
+	return nil
+}
+
+func (x *CreateTargetRequest) GetVolumeId() string {
+	if x != nil {
+		return x.VolumeId
+	}
+	return ""
+}
+
+func (x *CreateTargetRequest) GetSource() string {
+	if x != nil {
+		return x.Source
+	}
+	return ""
 }
 
 type CreateTargetResponse struct {
@@ -127,12 +487,16 @@ type CreateTargetResponse struct {
 	unknownFields protoimpl.UnknownFields
 
 	Target *TargetInfo `protobuf:"bytes,1,opt,name=target,proto3" json:"target,omitempty"`
+	// target on every portal of the filter, the first one is target,
+	// initiator builds a dm-multipath device if there are several. All paths
+	// lead to this filter, they don't survive its restart
+	Paths []*TargetInfo `protobuf:"bytes,2,rep,name=paths,proto3" json:"paths,omitempty"`
 }
 
 func (x *CreateTargetResponse) Reset() {
 	*x = CreateTargetResponse{}
 	if protoimpl.UnsafeEnabled {
-		mi := &file_filter_proto_msgTypes[2]
+		mi := &file_filter_proto_msgTypes[4]
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		ms.StoreMessageInfo(mi)
 	}
@@ -145,7 +509,7 @@ func (x *CreateTargetResponse) String() string {
 func (*CreateTargetResponse) ProtoMessage() {}
 
 func (x *CreateTargetResponse) ProtoReflect() protoreflect.Message {
-	mi := &file_filter_proto_msgTypes[2]
+	mi := &file_filter_proto_msgTypes[4]
 	if protoimpl.UnsafeEnabled && x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -158,7 +522,7 @@ func (x *CreateTargetResponse) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use CreateTargetResponse.ProtoReflect.Descriptor instead.
 func (*CreateTargetResponse) Descriptor() ([]byte, []int) {
-	return file_filter_proto_rawDescGZIP(), []int{2}
+	return file_filter_proto_rawDescGZIP(), []int{4}
 }
 
 func (x *CreateTargetResponse) GetTarget() *TargetInfo {
@@ -168,16 +532,25 @@ func (x *CreateTargetResponse) GetTarget() *TargetInfo {
 	return nil
 }
 
+func (x *CreateTargetResponse) GetPaths() []*TargetInfo {
+	if x != nil {
+		return x.Paths
+	}
+	return nil
+}
+
 type DeleteTargetRequest struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
 	unknownFields protoimpl.UnknownFields
+
+	VolumeId string `protobuf:"bytes,1,opt,name=volume_id,json=volumeId,proto3" json:"volume_id,omitempty"`
 }
 
 func (x *DeleteTargetRequest) Reset() {
 	*x = DeleteTargetRequest{}
 	if protoimpl.UnsafeEnabled {
-		mi := &file_filter_proto_msgTypes[3]
+		mi := &file_filter_proto_msgTypes[5]
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		ms.StoreMessageInfo(mi)
 	}
@@ -190,7 +563,7 @@ func (x *DeleteTargetRequest) String() string {
 func (*DeleteTargetRequest) ProtoMessage() {}
 
 func (x *DeleteTargetRequest) ProtoReflect() protoreflect.Message {
-	mi := &file_filter_proto_msgTypes[3]
+	mi := &file_filter_proto_msgTypes[5]
 	if protoimpl.UnsafeEnabled && x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -203,7 +576,14 @@ func (x *DeleteTargetRequest) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use DeleteTargetRequest.ProtoReflect.Descriptor instead.
 func (*DeleteTargetRequest) Descriptor() ([]byte, []int) {
-	return file_filter_proto_rawDescGZIP(), []int{3}
+	return file_filter_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *DeleteTargetRequest) GetVolumeId() string {
+	if x != nil {
+		return x.VolumeId
+	}
+	return ""
 }
 
 type DeleteTargetResponse struct {
@@ -215,7 +595,7 @@ type DeleteTargetResponse struct {
 func (x *DeleteTargetResponse) Reset() {
 	*x = DeleteTargetResponse{}
 	if protoimpl.UnsafeEnabled {
-		mi := &file_filter_proto_msgTypes[4]
+		mi := &file_filter_proto_msgTypes[6]
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		ms.StoreMessageInfo(mi)
 	}
@@ -228,7 +608,7 @@ func (x *DeleteTargetResponse) String() string {
 func (*DeleteTargetResponse) ProtoMessage() {}
 
 func (x *DeleteTargetResponse) ProtoReflect() protoreflect.Message {
-	mi := &file_filter_proto_msgTypes[4]
+	mi := &file_filter_proto_msgTypes[6]
 	if protoimpl.UnsafeEnabled && x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -241,74 +621,1885 @@ func (x *DeleteTargetResponse) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use DeleteTargetResponse.ProtoReflect.Descriptor instead.
 func (*DeleteTargetResponse) Descriptor() ([]byte, []int) {
-	return file_filter_proto_rawDescGZIP(), []int{4}
+	return file_filter_proto_rawDescGZIP(), []int{6}
 }
 
-var File_filter_proto protoreflect.FileDescriptor
+type GetFilterStatusRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
 
-var file_filter_proto_rawDesc = []byte{
-	0x0a, 0x0c, 0x66, 0x69, 0x6c, 0x74, 0x65, 0x72, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x22, 0x4a,
-	0x0a, 0x0a, 0x54, 0x61, 0x72, 0x67, 0x65, 0x74, 0x49, 0x6e, 0x66, 0x6f, 0x12, 0x16, 0x0a, 0x06,
-	0x70, 0x6f, 0x72, 0x74, 0x61, 0x6c, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x06, 0x70, 0x6f,
-	0x72, 0x74, 0x61, 0x6c, 0x12, 0x12, 0x0a, 0x04, 0x70, 0x6f, 0x72, 0x74, 0x18, 0x02, 0x20, 0x01,
-	0x28, 0x0d, 0x52, 0x04, 0x70, 0x6f, 0x72, 0x74, 0x12, 0x10, 0x0a, 0x03, 0x69, 0x71, 0x6e, 0x18,
-	0x03, 0x20, 0x01, 0x28, 0x09, 0x52, 0x03, 0x69, 0x71, 0x6e, 0x22, 0x15, 0x0a, 0x13, 0x43, 0x72,
-	0x65, 0x61, 0x74, 0x65, 0x54, 0x61, 0x72, 0x67, 0x65, 0x74, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73,
-	0x74, 0x22, 0x3b, 0x0a, 0x14, 0x43, 0x72, 0x65, 0x61, 0x74, 0x65, 0x54, 0x61, 0x72, 0x67, 0x65,
-	0x74, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x23, 0x0a, 0x06, 0x74, 0x61, 0x72,
-	0x67, 0x65, 0x74, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x0b, 0x2e, 0x54, 0x61, 0x72, 0x67,
-	0x65, 0x74, 0x49, 0x6e, 0x66, 0x6f, 0x52, 0x06, 0x74, 0x61, 0x72, 0x67, 0x65, 0x74, 0x22, 0x15,
-	0x0a, 0x13, 0x44, 0x65, 0x6c, 0x65, 0x74, 0x65, 0x54, 0x61, 0x72, 0x67, 0x65, 0x74, 0x52, 0x65,
-	0x71, 0x75, 0x65, 0x73, 0x74, 0x22, 0x16, 0x0a, 0x14, 0x44, 0x65, 0x6c, 0x65, 0x74, 0x65, 0x54,
-	0x61, 0x72, 0x67, 0x65, 0x74, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x32, 0x86, 0x01,
-	0x0a, 0x06, 0x46, 0x69, 0x6c, 0x74, 0x65, 0x72, 0x12, 0x3d, 0x0a, 0x0c, 0x43, 0x72, 0x65, 0x61,
-	0x74, 0x65, 0x54, 0x61, 0x72, 0x67, 0x65, 0x74, 0x12, 0x14, 0x2e, 0x43, 0x72, 0x65, 0x61, 0x74,
-	0x65, 0x54, 0x61, 0x72, 0x67, 0x65, 0x74, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x15,
-	0x2e, 0x43, 0x72, 0x65, 0x61, 0x74, 0x65, 0x54, 0x61, 0x72, 0x67, 0x65, 0x74, 0x52, 0x65, 0x73,
-	0x70, 0x6f, 0x6e, 0x73, 0x65, 0x22, 0x00, 0x12, 0x3d, 0x0a, 0x0c, 0x44, 0x65, 0x6c, 0x65, 0x74,
-	0x65, 0x54, 0x61, 0x72, 0x67, 0x65, 0x74, 0x12, 0x14, 0x2e, 0x44, 0x65, 0x6c, 0x65, 0x74, 0x65,
-	0x54, 0x61, 0x72, 0x67, 0x65, 0x74, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x15, 0x2e,
-	0x44, 0x65, 0x6c, 0x65, 0x74, 0x65, 0x54, 0x61, 0x72, 0x67, 0x65, 0x74, 0x52, 0x65, 0x73, 0x70,
-	0x6f, 0x6e, 0x73, 0x65, 0x22, 0x00, 0x42, 0x26, 0x5a, 0x24, 0x67, 0x69, 0x74, 0x68, 0x75, 0x62,
-	0x2e, 0x63, 0x6f, 0x6d, 0x2f, 0x70, 0x6f, 0x6f, 0x68, 0x36, 0x34, 0x2f, 0x63, 0x73, 0x69, 0x66,
-	0x2d, 0x64, 0x72, 0x69, 0x76, 0x65, 0x72, 0x2f, 0x66, 0x69, 0x6c, 0x74, 0x65, 0x72, 0x62, 0x06,
-	0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
+	VolumeId string `protobuf:"bytes,1,opt,name=volume_id,json=volumeId,proto3" json:"volume_id,omitempty"`
 }
 
-var (
-	file_filter_proto_rawDescOnce sync.Once
-	file_filter_proto_rawDescData = file_filter_proto_rawDesc
-)
-
-func file_filter_proto_rawDescGZIP() []byte {
-	file_filter_proto_rawDescOnce.Do(func() {
-		file_filter_proto_rawDescData = protoimpl.X.CompressGZIP(file_filter_proto_rawDescData)
-	})
-	return file_filter_proto_rawDescData
+func (x *GetFilterStatusRequest) Reset() {
+	*x = GetFilterStatusRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_filter_proto_msgTypes[7]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
 }
 
-var file_filter_proto_msgTypes = make([]protoimpl.MessageInfo, 5)
-var file_filter_proto_goTypes = []interface{}{
-	(*TargetInfo)(nil),           // 0: TargetInfo
-	(*CreateTargetRequest)(nil),  // 1: CreateTargetRequest
-	(*CreateTargetResponse)(nil), // 2: CreateTargetResponse
-	(*DeleteTargetRequest)(nil),  // 3: DeleteTargetRequest
-	(*DeleteTargetResponse)(nil), // 4: DeleteTargetResponse
-}
-var file_filter_proto_depIdxs = []int32{
-	0, // 0: CreateTargetResponse.target:type_name -> TargetInfo
-	1, // 1: Filter.CreateTarget:input_type -> CreateTargetRequest
-	3, // 2: Filter.DeleteTarget:input_type -> DeleteTargetRequest
-	2, // 3: Filter.CreateTarget:output_type -> CreateTargetResponse
-	4, // 4: Filter.DeleteTarget:output_type -> DeleteTargetResponse
-	3, // [3:5] is the sub-list for method output_type
-	1, // [1:3] is the sub-list for method input_type
-	1, // [1:1] is the sub-list for extension type_name
-	1, // [1:1] is the sub-list for extension extendee
-	0, // [0:1] is the sub-list for field type_name
+func (x *GetFilterStatusRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
 }
 
-func init() { file_filter_proto_init() }
+func (*GetFilterStatusRequest) ProtoMessage() {}
+
+func (x *GetFilterStatusRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_filter_proto_msgTypes[7]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetFilterStatusRequest.ProtoReflect.Descriptor instead.
+func (*GetFilterStatusRequest) Descriptor() ([]byte, []int) {
+	return file_filter_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *GetFilterStatusRequest) GetVolumeId() string {
+	if x != nil {
+		return x.VolumeId
+	}
+	return ""
+}
+
+type GetFilterStatusResponse struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Filters []*FilterStatus `protobuf:"bytes,1,rep,name=filters,proto3" json:"filters,omitempty"`
+}
+
+func (x *GetFilterStatusResponse) Reset() {
+	*x = GetFilterStatusResponse{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_filter_proto_msgTypes[8]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *GetFilterStatusResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetFilterStatusResponse) ProtoMessage() {}
+
+func (x *GetFilterStatusResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_filter_proto_msgTypes[8]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetFilterStatusResponse.ProtoReflect.Descriptor instead.
+func (*GetFilterStatusResponse) Descriptor() ([]byte, []int) {
+	return file_filter_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *GetFilterStatusResponse) GetFilters() []*FilterStatus {
+	if x != nil {
+		return x.Filters
+	}
+	return nil
+}
+
+// Change parameters of a running filter, params not listed are kept
+type ConfigureFilterRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Name     string            `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Params   map[string]string `protobuf:"bytes,2,rep,name=params,proto3" json:"params,omitempty" protobuf_key:"bytes,1,opt,name=key,proto3" protobuf_val:"bytes,2,opt,name=value,proto3"`
+	VolumeId string            `protobuf:"bytes,3,opt,name=volume_id,json=volumeId,proto3" json:"volume_id,omitempty"`
+}
+
+func (x *ConfigureFilterRequest) Reset() {
+	*x = ConfigureFilterRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_filter_proto_msgTypes[9]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *ConfigureFilterRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ConfigureFilterRequest) ProtoMessage() {}
+
+func (x *ConfigureFilterRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_filter_proto_msgTypes[9]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ConfigureFilterRequest.ProtoReflect.Descriptor instead.
+func (*ConfigureFilterRequest) Descriptor() ([]byte, []int) {
+	return file_filter_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *ConfigureFilterRequest) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *ConfigureFilterRequest) GetParams() map[string]string {
+	if x != nil {
+		return x.Params
+	}
+	return nil
+}
+
+func (x *ConfigureFilterRequest) GetVolumeId() string {
+	if x != nil {
+		return x.VolumeId
+	}
+	return ""
+}
+
+type ConfigureFilterResponse struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Status *FilterStatus `protobuf:"bytes,1,opt,name=status,proto3" json:"status,omitempty"`
+}
+
+func (x *ConfigureFilterResponse) Reset() {
+	*x = ConfigureFilterResponse{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_filter_proto_msgTypes[10]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *ConfigureFilterResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ConfigureFilterResponse) ProtoMessage() {}
+
+func (x *ConfigureFilterResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_filter_proto_msgTypes[10]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ConfigureFilterResponse.ProtoReflect.Descriptor instead.
+func (*ConfigureFilterResponse) Descriptor() ([]byte, []int) {
+	return file_filter_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *ConfigureFilterResponse) GetStatus() *FilterStatus {
+	if x != nil {
+		return x.Status
+	}
+	return nil
+}
+
+// Fault injection rule, LBA is in 512-byte sectors
+type FaultRule struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Id              uint64                `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"` // assigned by filter
+	Op              FaultRule_Op          `protobuf:"varint,2,opt,name=op,proto3,enum=FaultRule_Op" json:"op,omitempty"`
+	Action          FaultRule_Action      `protobuf:"varint,3,opt,name=action,proto3,enum=FaultRule_Action" json:"action,omitempty"`
+	LbaStart        uint64                `protobuf:"varint,4,opt,name=lba_start,json=lbaStart,proto3" json:"lba_start,omitempty"`
+	LbaCount        uint64                `protobuf:"varint,5,opt,name=lba_count,json=lbaCount,proto3" json:"lba_count,omitempty"`            // 0 is till the end of device
+	Probability     float64               `protobuf:"fixed64,6,opt,name=probability,proto3" json:"probability,omitempty"`                     // 0 is always
+	StartTimeMs     int64                 `protobuf:"varint,7,opt,name=start_time_ms,json=startTimeMs,proto3" json:"start_time_ms,omitempty"` // unix time, 0 is now
+	DurationMs      int64                 `protobuf:"varint,8,opt,name=duration_ms,json=durationMs,proto3" json:"duration_ms,omitempty"`      // 0 is forever
+	LatencyDist     FaultRule_LatencyDist `protobuf:"varint,9,opt,name=latency_dist,json=latencyDist,proto3,enum=FaultRule_LatencyDist" json:"latency_dist,omitempty"`
+	LatencyUs       uint32                `protobuf:"varint,10,opt,name=latency_us,json=latencyUs,proto3" json:"latency_us,omitempty"`
+	LatencyJitterUs uint32                `protobuf:"varint,11,opt,name=latency_jitter_us,json=latencyJitterUs,proto3" json:"latency_jitter_us,omitempty"`
+}
+
+func (x *FaultRule) Reset() {
+	*x = FaultRule{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_filter_proto_msgTypes[11]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *FaultRule) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*FaultRule) ProtoMessage() {}
+
+func (x *FaultRule) ProtoReflect() protoreflect.Message {
+	mi := &file_filter_proto_msgTypes[11]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use FaultRule.ProtoReflect.Descriptor instead.
+func (*FaultRule) Descriptor() ([]byte, []int) {
+	return file_filter_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *FaultRule) GetId() uint64 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+func (x *FaultRule) GetOp() FaultRule_Op {
+	if x != nil {
+		return x.Op
+	}
+	return FaultRule_ANY
+}
+
+func (x *FaultRule) GetAction() FaultRule_Action {
+	if x != nil {
+		return x.Action
+	}
+	return FaultRule_ERROR
+}
+
+func (x *FaultRule) GetLbaStart() uint64 {
+	if x != nil {
+		return x.LbaStart
+	}
+	return 0
+}
+
+func (x *FaultRule) GetLbaCount() uint64 {
+	if x != nil {
+		return x.LbaCount
+	}
+	return 0
+}
+
+func (x *FaultRule) GetProbability() float64 {
+	if x != nil {
+		return x.Probability
+	}
+	return 0
+}
+
+func (x *FaultRule) GetStartTimeMs() int64 {
+	if x != nil {
+		return x.StartTimeMs
+	}
+	return 0
+}
+
+func (x *FaultRule) GetDurationMs() int64 {
+	if x != nil {
+		return x.DurationMs
+	}
+	return 0
+}
+
+func (x *FaultRule) GetLatencyDist() FaultRule_LatencyDist {
+	if x != nil {
+		return x.LatencyDist
+	}
+	return FaultRule_FIXED
+}
+
+func (x *FaultRule) GetLatencyUs() uint32 {
+	if x != nil {
+		return x.LatencyUs
+	}
+	return 0
+}
+
+func (x *FaultRule) GetLatencyJitterUs() uint32 {
+	if x != nil {
+		return x.LatencyJitterUs
+	}
+	return 0
+}
+
+type AddFaultRuleRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Rule     *FaultRule `protobuf:"bytes,1,opt,name=rule,proto3" json:"rule,omitempty"`
+	VolumeId string     `protobuf:"bytes,2,opt,name=volume_id,json=volumeId,proto3" json:"volume_id,omitempty"`
+}
+
+func (x *AddFaultRuleRequest) Reset() {
+	*x = AddFaultRuleRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_filter_proto_msgTypes[12]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *AddFaultRuleRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AddFaultRuleRequest) ProtoMessage() {}
+
+func (x *AddFaultRuleRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_filter_proto_msgTypes[12]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AddFaultRuleRequest.ProtoReflect.Descriptor instead.
+func (*AddFaultRuleRequest) Descriptor() ([]byte, []int) {
+	return file_filter_proto_rawDescGZIP(), []int{12}
+}
+
+func (x *AddFaultRuleRequest) GetRule() *FaultRule {
+	if x != nil {
+		return x.Rule
+	}
+	return nil
+}
+
+func (x *AddFaultRuleRequest) GetVolumeId() string {
+	if x != nil {
+		return x.VolumeId
+	}
+	return ""
+}
+
+type AddFaultRuleResponse struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Id uint64 `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+}
+
+func (x *AddFaultRuleResponse) Reset() {
+	*x = AddFaultRuleResponse{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_filter_proto_msgTypes[13]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *AddFaultRuleResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AddFaultRuleResponse) ProtoMessage() {}
+
+func (x *AddFaultRuleResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_filter_proto_msgTypes[13]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AddFaultRuleResponse.ProtoReflect.Descriptor instead.
+func (*AddFaultRuleResponse) Descriptor() ([]byte, []int) {
+	return file_filter_proto_rawDescGZIP(), []int{13}
+}
+
+func (x *AddFaultRuleResponse) GetId() uint64 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+type RemoveFaultRuleRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Id       uint64 `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"` // 0 removes all rules
+	VolumeId string `protobuf:"bytes,2,opt,name=volume_id,json=volumeId,proto3" json:"volume_id,omitempty"`
+}
+
+func (x *RemoveFaultRuleRequest) Reset() {
+	*x = RemoveFaultRuleRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_filter_proto_msgTypes[14]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *RemoveFaultRuleRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RemoveFaultRuleRequest) ProtoMessage() {}
+
+func (x *RemoveFaultRuleRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_filter_proto_msgTypes[14]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RemoveFaultRuleRequest.ProtoReflect.Descriptor instead.
+func (*RemoveFaultRuleRequest) Descriptor() ([]byte, []int) {
+	return file_filter_proto_rawDescGZIP(), []int{14}
+}
+
+func (x *RemoveFaultRuleRequest) GetId() uint64 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+func (x *RemoveFaultRuleRequest) GetVolumeId() string {
+	if x != nil {
+		return x.VolumeId
+	}
+	return ""
+}
+
+type RemoveFaultRuleResponse struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+}
+
+func (x *RemoveFaultRuleResponse) Reset() {
+	*x = RemoveFaultRuleResponse{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_filter_proto_msgTypes[15]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *RemoveFaultRuleResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RemoveFaultRuleResponse) ProtoMessage() {}
+
+func (x *RemoveFaultRuleResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_filter_proto_msgTypes[15]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RemoveFaultRuleResponse.ProtoReflect.Descriptor instead.
+func (*RemoveFaultRuleResponse) Descriptor() ([]byte, []int) {
+	return file_filter_proto_rawDescGZIP(), []int{15}
+}
+
+type ListFaultRulesRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	VolumeId string `protobuf:"bytes,1,opt,name=volume_id,json=volumeId,proto3" json:"volume_id,omitempty"`
+}
+
+func (x *ListFaultRulesRequest) Reset() {
+	*x = ListFaultRulesRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_filter_proto_msgTypes[16]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *ListFaultRulesRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListFaultRulesRequest) ProtoMessage() {}
+
+func (x *ListFaultRulesRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_filter_proto_msgTypes[16]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListFaultRulesRequest.ProtoReflect.Descriptor instead.
+func (*ListFaultRulesRequest) Descriptor() ([]byte, []int) {
+	return file_filter_proto_rawDescGZIP(), []int{16}
+}
+
+func (x *ListFaultRulesRequest) GetVolumeId() string {
+	if x != nil {
+		return x.VolumeId
+	}
+	return ""
+}
+
+type ListFaultRulesResponse struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Rules []*FaultRule `protobuf:"bytes,1,rep,name=rules,proto3" json:"rules,omitempty"`
+}
+
+func (x *ListFaultRulesResponse) Reset() {
+	*x = ListFaultRulesResponse{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_filter_proto_msgTypes[17]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *ListFaultRulesResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListFaultRulesResponse) ProtoMessage() {}
+
+func (x *ListFaultRulesResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_filter_proto_msgTypes[17]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListFaultRulesResponse.ProtoReflect.Descriptor instead.
+func (*ListFaultRulesResponse) Descriptor() ([]byte, []int) {
+	return file_filter_proto_rawDescGZIP(), []int{17}
+}
+
+func (x *ListFaultRulesResponse) GetRules() []*FaultRule {
+	if x != nil {
+		return x.Rules
+	}
+	return nil
+}
+
+// Completed request seen by trace filter, LBA is in 512-byte sectors
+type TraceRecord struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	TimestampNs int64          `protobuf:"varint,1,opt,name=timestamp_ns,json=timestampNs,proto3" json:"timestamp_ns,omitempty"` // unix time of request start
+	Op          TraceRecord_Op `protobuf:"varint,2,opt,name=op,proto3,enum=TraceRecord_Op" json:"op,omitempty"`
+	Lba         uint64         `protobuf:"varint,3,opt,name=lba,proto3" json:"lba,omitempty"`
+	Length      uint64         `protobuf:"varint,4,opt,name=length,proto3" json:"length,omitempty"`
+	LatencyNs   int64          `protobuf:"varint,5,opt,name=latency_ns,json=latencyNs,proto3" json:"latency_ns,omitempty"`
+	Error       bool           `protobuf:"varint,6,opt,name=error,proto3" json:"error,omitempty"`
+}
+
+func (x *TraceRecord) Reset() {
+	*x = TraceRecord{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_filter_proto_msgTypes[18]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *TraceRecord) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*TraceRecord) ProtoMessage() {}
+
+func (x *TraceRecord) ProtoReflect() protoreflect.Message {
+	mi := &file_filter_proto_msgTypes[18]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use TraceRecord.ProtoReflect.Descriptor instead.
+func (*TraceRecord) Descriptor() ([]byte, []int) {
+	return file_filter_proto_rawDescGZIP(), []int{18}
+}
+
+func (x *TraceRecord) GetTimestampNs() int64 {
+	if x != nil {
+		return x.TimestampNs
+	}
+	return 0
+}
+
+func (x *TraceRecord) GetOp() TraceRecord_Op {
+	if x != nil {
+		return x.Op
+	}
+	return TraceRecord_READ
+}
+
+func (x *TraceRecord) GetLba() uint64 {
+	if x != nil {
+		return x.Lba
+	}
+	return 0
+}
+
+func (x *TraceRecord) GetLength() uint64 {
+	if x != nil {
+		return x.Length
+	}
+	return 0
+}
+
+func (x *TraceRecord) GetLatencyNs() int64 {
+	if x != nil {
+		return x.LatencyNs
+	}
+	return 0
+}
+
+func (x *TraceRecord) GetError() bool {
+	if x != nil {
+		return x.Error
+	}
+	return false
+}
+
+type StreamTraceRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Replay   bool   `protobuf:"varint,1,opt,name=replay,proto3" json:"replay,omitempty"` // send records from ring buffer first
+	VolumeId string `protobuf:"bytes,2,opt,name=volume_id,json=volumeId,proto3" json:"volume_id,omitempty"`
+}
+
+func (x *StreamTraceRequest) Reset() {
+	*x = StreamTraceRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_filter_proto_msgTypes[19]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *StreamTraceRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StreamTraceRequest) ProtoMessage() {}
+
+func (x *StreamTraceRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_filter_proto_msgTypes[19]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StreamTraceRequest.ProtoReflect.Descriptor instead.
+func (*StreamTraceRequest) Descriptor() ([]byte, []int) {
+	return file_filter_proto_rawDescGZIP(), []int{19}
+}
+
+func (x *StreamTraceRequest) GetReplay() bool {
+	if x != nil {
+		return x.Replay
+	}
+	return false
+}
+
+func (x *StreamTraceRequest) GetVolumeId() string {
+	if x != nil {
+		return x.VolumeId
+	}
+	return ""
+}
+
+// Bind warm pod to a source, it becomes the default for CreateTarget
+type BindSourceRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Source    string `protobuf:"bytes,1,opt,name=source,proto3" json:"source,omitempty"` // path in filter pod
+	SourcePvc string `protobuf:"bytes,2,opt,name=source_pvc,json=sourcePvc,proto3" json:"source_pvc,omitempty"`
+}
+
+func (x *BindSourceRequest) Reset() {
+	*x = BindSourceRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_filter_proto_msgTypes[20]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *BindSourceRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BindSourceRequest) ProtoMessage() {}
+
+func (x *BindSourceRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_filter_proto_msgTypes[20]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BindSourceRequest.ProtoReflect.Descriptor instead.
+func (*BindSourceRequest) Descriptor() ([]byte, []int) {
+	return file_filter_proto_rawDescGZIP(), []int{20}
+}
+
+func (x *BindSourceRequest) GetSource() string {
+	if x != nil {
+		return x.Source
+	}
+	return ""
+}
+
+func (x *BindSourceRequest) GetSourcePvc() string {
+	if x != nil {
+		return x.SourcePvc
+	}
+	return ""
+}
+
+type BindSourceResponse struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+}
+
+func (x *BindSourceResponse) Reset() {
+	*x = BindSourceResponse{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_filter_proto_msgTypes[21]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *BindSourceResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BindSourceResponse) ProtoMessage() {}
+
+func (x *BindSourceResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_filter_proto_msgTypes[21]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BindSourceResponse.ProtoReflect.Descriptor instead.
+func (*BindSourceResponse) Descriptor() ([]byte, []int) {
+	return file_filter_proto_rawDescGZIP(), []int{21}
+}
+
+type ListTargetsRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+}
+
+func (x *ListTargetsRequest) Reset() {
+	*x = ListTargetsRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_filter_proto_msgTypes[22]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *ListTargetsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListTargetsRequest) ProtoMessage() {}
+
+func (x *ListTargetsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_filter_proto_msgTypes[22]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListTargetsRequest.ProtoReflect.Descriptor instead.
+func (*ListTargetsRequest) Descriptor() ([]byte, []int) {
+	return file_filter_proto_rawDescGZIP(), []int{22}
+}
+
+type TargetSummary struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	VolumeId string      `protobuf:"bytes,1,opt,name=volume_id,json=volumeId,proto3" json:"volume_id,omitempty"`
+	Target   *TargetInfo `protobuf:"bytes,2,opt,name=target,proto3" json:"target,omitempty"`
+	Source   string      `protobuf:"bytes,3,opt,name=source,proto3" json:"source,omitempty"`
+	Filters  []string    `protobuf:"bytes,4,rep,name=filters,proto3" json:"filters,omitempty"` // names, bottom to top
+}
+
+func (x *TargetSummary) Reset() {
+	*x = TargetSummary{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_filter_proto_msgTypes[23]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *TargetSummary) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*TargetSummary) ProtoMessage() {}
+
+func (x *TargetSummary) ProtoReflect() protoreflect.Message {
+	mi := &file_filter_proto_msgTypes[23]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use TargetSummary.ProtoReflect.Descriptor instead.
+func (*TargetSummary) Descriptor() ([]byte, []int) {
+	return file_filter_proto_rawDescGZIP(), []int{23}
+}
+
+func (x *TargetSummary) GetVolumeId() string {
+	if x != nil {
+		return x.VolumeId
+	}
+	return ""
+}
+
+func (x *TargetSummary) GetTarget() *TargetInfo {
+	if x != nil {
+		return x.Target
+	}
+	return nil
+}
+
+func (x *TargetSummary) GetSource() string {
+	if x != nil {
+		return x.Source
+	}
+	return ""
+}
+
+func (x *TargetSummary) GetFilters() []string {
+	if x != nil {
+		return x.Filters
+	}
+	return nil
+}
+
+type ListTargetsResponse struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Targets []*TargetSummary `protobuf:"bytes,1,rep,name=targets,proto3" json:"targets,omitempty"`
+}
+
+func (x *ListTargetsResponse) Reset() {
+	*x = ListTargetsResponse{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_filter_proto_msgTypes[24]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *ListTargetsResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListTargetsResponse) ProtoMessage() {}
+
+func (x *ListTargetsResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_filter_proto_msgTypes[24]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListTargetsResponse.ProtoReflect.Descriptor instead.
+func (*ListTargetsResponse) Descriptor() ([]byte, []int) {
+	return file_filter_proto_rawDescGZIP(), []int{24}
+}
+
+func (x *ListTargetsResponse) GetTargets() []*TargetSummary {
+	if x != nil {
+		return x.Targets
+	}
+	return nil
+}
+
+type IOOpStats struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Ops            uint64   `protobuf:"varint,1,opt,name=ops,proto3" json:"ops,omitempty"`
+	Bytes          uint64   `protobuf:"varint,2,opt,name=bytes,proto3" json:"bytes,omitempty"`
+	Errors         uint64   `protobuf:"varint,3,opt,name=errors,proto3" json:"errors,omitempty"`
+	LatencySumUs   uint64   `protobuf:"varint,4,opt,name=latency_sum_us,json=latencySumUs,proto3" json:"latency_sum_us,omitempty"`
+	LatencyBuckets []uint64 `protobuf:"varint,5,rep,packed,name=latency_buckets,json=latencyBuckets,proto3" json:"latency_buckets,omitempty"` // per bucket, last one is +Inf
+}
+
+func (x *IOOpStats) Reset() {
+	*x = IOOpStats{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_filter_proto_msgTypes[25]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *IOOpStats) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*IOOpStats) ProtoMessage() {}
+
+func (x *IOOpStats) ProtoReflect() protoreflect.Message {
+	mi := &file_filter_proto_msgTypes[25]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use IOOpStats.ProtoReflect.Descriptor instead.
+func (*IOOpStats) Descriptor() ([]byte, []int) {
+	return file_filter_proto_rawDescGZIP(), []int{25}
+}
+
+func (x *IOOpStats) GetOps() uint64 {
+	if x != nil {
+		return x.Ops
+	}
+	return 0
+}
+
+func (x *IOOpStats) GetBytes() uint64 {
+	if x != nil {
+		return x.Bytes
+	}
+	return 0
+}
+
+func (x *IOOpStats) GetErrors() uint64 {
+	if x != nil {
+		return x.Errors
+	}
+	return 0
+}
+
+func (x *IOOpStats) GetLatencySumUs() uint64 {
+	if x != nil {
+		return x.LatencySumUs
+	}
+	return 0
+}
+
+func (x *IOOpStats) GetLatencyBuckets() []uint64 {
+	if x != nil {
+		return x.LatencyBuckets
+	}
+	return nil
+}
+
+type IOStats struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Read            *IOOpStats `protobuf:"bytes,1,opt,name=read,proto3" json:"read,omitempty"`
+	Write           *IOOpStats `protobuf:"bytes,2,opt,name=write,proto3" json:"write,omitempty"`
+	Flush           *IOOpStats `protobuf:"bytes,3,opt,name=flush,proto3" json:"flush,omitempty"`
+	Trim            *IOOpStats `protobuf:"bytes,4,opt,name=trim,proto3" json:"trim,omitempty"`
+	QueueDepth      int64      `protobuf:"varint,5,opt,name=queue_depth,json=queueDepth,proto3" json:"queue_depth,omitempty"`                         // operations in flight
+	LatencyBoundsUs []uint64   `protobuf:"varint,6,rep,packed,name=latency_bounds_us,json=latencyBoundsUs,proto3" json:"latency_bounds_us,omitempty"` // bucket upper bounds
+}
+
+func (x *IOStats) Reset() {
+	*x = IOStats{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_filter_proto_msgTypes[26]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *IOStats) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*IOStats) ProtoMessage() {}
+
+func (x *IOStats) ProtoReflect() protoreflect.Message {
+	mi := &file_filter_proto_msgTypes[26]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use IOStats.ProtoReflect.Descriptor instead.
+func (*IOStats) Descriptor() ([]byte, []int) {
+	return file_filter_proto_rawDescGZIP(), []int{26}
+}
+
+func (x *IOStats) GetRead() *IOOpStats {
+	if x != nil {
+		return x.Read
+	}
+	return nil
+}
+
+func (x *IOStats) GetWrite() *IOOpStats {
+	if x != nil {
+		return x.Write
+	}
+	return nil
+}
+
+func (x *IOStats) GetFlush() *IOOpStats {
+	if x != nil {
+		return x.Flush
+	}
+	return nil
+}
+
+func (x *IOStats) GetTrim() *IOOpStats {
+	if x != nil {
+		return x.Trim
+	}
+	return nil
+}
+
+func (x *IOStats) GetQueueDepth() int64 {
+	if x != nil {
+		return x.QueueDepth
+	}
+	return 0
+}
+
+func (x *IOStats) GetLatencyBoundsUs() []uint64 {
+	if x != nil {
+		return x.LatencyBoundsUs
+	}
+	return nil
+}
+
+type GetTargetStatsRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	VolumeId string `protobuf:"bytes,1,opt,name=volume_id,json=volumeId,proto3" json:"volume_id,omitempty"`
+}
+
+func (x *GetTargetStatsRequest) Reset() {
+	*x = GetTargetStatsRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_filter_proto_msgTypes[27]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *GetTargetStatsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetTargetStatsRequest) ProtoMessage() {}
+
+func (x *GetTargetStatsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_filter_proto_msgTypes[27]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetTargetStatsRequest.ProtoReflect.Descriptor instead.
+func (*GetTargetStatsRequest) Descriptor() ([]byte, []int) {
+	return file_filter_proto_rawDescGZIP(), []int{27}
+}
+
+func (x *GetTargetStatsRequest) GetVolumeId() string {
+	if x != nil {
+		return x.VolumeId
+	}
+	return ""
+}
+
+type GetTargetStatsResponse struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Lun     *IOStats `protobuf:"bytes,1,opt,name=lun,proto3" json:"lun,omitempty"`         // exported LUN, top of the filter chain
+	Backing *IOStats `protobuf:"bytes,2,opt,name=backing,proto3" json:"backing,omitempty"` // source device
+}
+
+func (x *GetTargetStatsResponse) Reset() {
+	*x = GetTargetStatsResponse{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_filter_proto_msgTypes[28]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *GetTargetStatsResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetTargetStatsResponse) ProtoMessage() {}
+
+func (x *GetTargetStatsResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_filter_proto_msgTypes[28]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetTargetStatsResponse.ProtoReflect.Descriptor instead.
+func (*GetTargetStatsResponse) Descriptor() ([]byte, []int) {
+	return file_filter_proto_rawDescGZIP(), []int{28}
+}
+
+func (x *GetTargetStatsResponse) GetLun() *IOStats {
+	if x != nil {
+		return x.Lun
+	}
+	return nil
+}
+
+func (x *GetTargetStatsResponse) GetBacking() *IOStats {
+	if x != nil {
+		return x.Backing
+	}
+	return nil
+}
+
+// Write back dirty data of the filter chain down to the source
+type FlushTargetRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	VolumeId string `protobuf:"bytes,1,opt,name=volume_id,json=volumeId,proto3" json:"volume_id,omitempty"`
+}
+
+func (x *FlushTargetRequest) Reset() {
+	*x = FlushTargetRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_filter_proto_msgTypes[29]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *FlushTargetRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*FlushTargetRequest) ProtoMessage() {}
+
+func (x *FlushTargetRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_filter_proto_msgTypes[29]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use FlushTargetRequest.ProtoReflect.Descriptor instead.
+func (*FlushTargetRequest) Descriptor() ([]byte, []int) {
+	return file_filter_proto_rawDescGZIP(), []int{29}
+}
+
+func (x *FlushTargetRequest) GetVolumeId() string {
+	if x != nil {
+		return x.VolumeId
+	}
+	return ""
+}
+
+type FlushTargetResponse struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+}
+
+func (x *FlushTargetResponse) Reset() {
+	*x = FlushTargetResponse{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_filter_proto_msgTypes[30]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *FlushTargetResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*FlushTargetResponse) ProtoMessage() {}
+
+func (x *FlushTargetResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_filter_proto_msgTypes[30]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use FlushTargetResponse.ProtoReflect.Descriptor instead.
+func (*FlushTargetResponse) Descriptor() ([]byte, []int) {
+	return file_filter_proto_rawDescGZIP(), []int{30}
+}
+
+// Read the whole volume through the filter chain to find unreadable blocks,
+// the target keeps serving I/O meanwhile
+type ScrubTargetRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	VolumeId string `protobuf:"bytes,1,opt,name=volume_id,json=volumeId,proto3" json:"volume_id,omitempty"`
+}
+
+func (x *ScrubTargetRequest) Reset() {
+	*x = ScrubTargetRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_filter_proto_msgTypes[31]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *ScrubTargetRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ScrubTargetRequest) ProtoMessage() {}
+
+func (x *ScrubTargetRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_filter_proto_msgTypes[31]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ScrubTargetRequest.ProtoReflect.Descriptor instead.
+func (*ScrubTargetRequest) Descriptor() ([]byte, []int) {
+	return file_filter_proto_rawDescGZIP(), []int{31}
+}
+
+func (x *ScrubTargetRequest) GetVolumeId() string {
+	if x != nil {
+		return x.VolumeId
+	}
+	return ""
+}
+
+type ScrubTargetResponse struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	BytesScanned uint64 `protobuf:"varint,1,opt,name=bytes_scanned,json=bytesScanned,proto3" json:"bytes_scanned,omitempty"`
+	ReadErrors   uint64 `protobuf:"varint,2,opt,name=read_errors,json=readErrors,proto3" json:"read_errors,omitempty"`
+	FirstError   string `protobuf:"bytes,3,opt,name=first_error,json=firstError,proto3" json:"first_error,omitempty"` // with offset, empty if none
+}
+
+func (x *ScrubTargetResponse) Reset() {
+	*x = ScrubTargetResponse{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_filter_proto_msgTypes[32]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *ScrubTargetResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ScrubTargetResponse) ProtoMessage() {}
+
+func (x *ScrubTargetResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_filter_proto_msgTypes[32]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ScrubTargetResponse.ProtoReflect.Descriptor instead.
+func (*ScrubTargetResponse) Descriptor() ([]byte, []int) {
+	return file_filter_proto_rawDescGZIP(), []int{32}
+}
+
+func (x *ScrubTargetResponse) GetBytesScanned() uint64 {
+	if x != nil {
+		return x.BytesScanned
+	}
+	return 0
+}
+
+func (x *ScrubTargetResponse) GetReadErrors() uint64 {
+	if x != nil {
+		return x.ReadErrors
+	}
+	return 0
+}
+
+func (x *ScrubTargetResponse) GetFirstError() string {
+	if x != nil {
+		return x.FirstError
+	}
+	return ""
+}
+
+var File_filter_proto protoreflect.FileDescriptor
+
+var file_filter_proto_rawDesc = []byte{
+	0x0a, 0x0c, 0x66, 0x69, 0x6c, 0x74, 0x65, 0x72, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x22, 0x4a,
+	0x0a, 0x0a, 0x54, 0x61, 0x72, 0x67, 0x65, 0x74, 0x49, 0x6e, 0x66, 0x6f, 0x12, 0x16, 0x0a, 0x06,
+	0x70, 0x6f, 0x72, 0x74, 0x61, 0x6c, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x06, 0x70, 0x6f,
+	0x72, 0x74, 0x61, 0x6c, 0x12, 0x12, 0x0a, 0x04, 0x70, 0x6f, 0x72, 0x74, 0x18, 0x02, 0x20, 0x01,
+	0x28, 0x0d, 0x52, 0x04, 0x70, 0x6f, 0x72, 0x74, 0x12, 0x10, 0x0a, 0x03, 0x69, 0x71, 0x6e, 0x18,
+	0x03, 0x20, 0x01, 0x28, 0x09, 0x52, 0x03, 0x69, 0x71, 0x6e, 0x22, 0x90, 0x01, 0x0a, 0x0c, 0x46,
+	0x69, 0x6c, 0x74, 0x65, 0x72, 0x43, 0x6f, 0x6e, 0x66, 0x69, 0x67, 0x12, 0x12, 0x0a, 0x04, 0x6e,
+	0x61, 0x6d, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x6e, 0x61, 0x6d, 0x65, 0x12,
+	0x31, 0x0a, 0x06, 0x70, 0x61, 0x72, 0x61, 0x6d, 0x73, 0x18, 0x02, 0x20, 0x03, 0x28, 0x0b, 0x32,
+	0x19, 0x2e, 0x46, 0x69, 0x6c, 0x74, 0x65, 0x72, 0x43, 0x6f, 0x6e, 0x66, 0x69, 0x67, 0x2e, 0x50,
+	0x61, 0x72, 0x61, 0x6d, 0x73, 0x45, 0x6e, 0x74, 0x72, 0x79, 0x52, 0x06, 0x70, 0x61, 0x72, 0x61,
+	0x6d, 0x73, 0x1a, 0x39, 0x0a, 0x0b, 0x50, 0x61, 0x72, 0x61, 0x6d, 0x73, 0x45, 0x6e, 0x74, 0x72,
+	0x79, 0x12, 0x10, 0x0a, 0x03, 0x6b, 0x65, 0x79, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x03,
+	0x6b, 0x65, 0x79, 0x12, 0x14, 0x0a, 0x05, 0x76, 0x61, 0x6c, 0x75, 0x65, 0x18, 0x02, 0x20, 0x01,
+	0x28, 0x09, 0x52, 0x05, 0x76, 0x61, 0x6c, 0x75, 0x65, 0x3a, 0x02, 0x38, 0x01, 0x22, 0x9c, 0x02,
+	0x0a, 0x0c, 0x46, 0x69, 0x6c, 0x74, 0x65, 0x72, 0x53, 0x74, 0x61, 0x74, 0x75, 0x73, 0x12, 0x12,
+	0x0a, 0x04, 0x6e, 0x61, 0x6d, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x6e, 0x61,
+	0x6d, 0x65, 0x12, 0x37, 0x0a, 0x08, 0x63, 0x6f, 0x75, 0x6e, 0x74, 0x65, 0x72, 0x73, 0x18, 0x02,
+	0x20, 0x03, 0x28, 0x0b, 0x32, 0x1b, 0x2e, 0x46, 0x69, 0x6c, 0x74, 0x65, 0x72, 0x53, 0x74, 0x61,
+	0x74, 0x75, 0x73, 0x2e, 0x43, 0x6f, 0x75, 0x6e, 0x74, 0x65, 0x72, 0x73, 0x45, 0x6e, 0x74, 0x72,
+	0x79, 0x52, 0x08, 0x63, 0x6f, 0x75, 0x6e, 0x74, 0x65, 0x72, 0x73, 0x12, 0x2b, 0x0a, 0x04, 0x69,
+	0x6e, 0x66, 0x6f, 0x18, 0x03, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x17, 0x2e, 0x46, 0x69, 0x6c, 0x74,
+	0x65, 0x72, 0x53, 0x74, 0x61, 0x74, 0x75, 0x73, 0x2e, 0x49, 0x6e, 0x66, 0x6f, 0x45, 0x6e, 0x74,
+	0x72, 0x79, 0x52, 0x04, 0x69, 0x6e, 0x66, 0x6f, 0x12, 0x1c, 0x0a, 0x09, 0x63, 0x6f, 0x6e, 0x64,
+	0x69, 0x74, 0x69, 0x6f, 0x6e, 0x18, 0x04, 0x20, 0x01, 0x28, 0x09, 0x52, 0x09, 0x63, 0x6f, 0x6e,
+	0x64, 0x69, 0x74, 0x69, 0x6f, 0x6e, 0x1a, 0x3b, 0x0a, 0x0d, 0x43, 0x6f, 0x75, 0x6e, 0x74, 0x65,
+	0x72, 0x73, 0x45, 0x6e, 0x74, 0x72, 0x79, 0x12, 0x10, 0x0a, 0x03, 0x6b, 0x65, 0x79, 0x18, 0x01,
+	0x20, 0x01, 0x28, 0x09, 0x52, 0x03, 0x6b, 0x65, 0x79, 0x12, 0x14, 0x0a, 0x05, 0x76, 0x61, 0x6c,
+	0x75, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x04, 0x52, 0x05, 0x76, 0x61, 0x6c, 0x75, 0x65, 0x3a,
+	0x02, 0x38, 0x01, 0x1a, 0x37, 0x0a, 0x09, 0x49, 0x6e, 0x66, 0x6f, 0x45, 0x6e, 0x74, 0x72, 0x79,
+	0x12, 0x10, 0x0a, 0x03, 0x6b, 0x65, 0x79, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x03, 0x6b,
+	0x65, 0x79, 0x12, 0x14, 0x0a, 0x05, 0x76, 0x61, 0x6c, 0x75, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28,
+	0x09, 0x52, 0x05, 0x76, 0x61, 0x6c, 0x75, 0x65, 0x3a, 0x02, 0x38, 0x01, 0x22, 0x73, 0x0a, 0x13,
+	0x43, 0x72, 0x65, 0x61, 0x74, 0x65, 0x54, 0x61, 0x72, 0x67, 0x65, 0x74, 0x52, 0x65, 0x71, 0x75,
+	0x65, 0x73, 0x74, 0x12, 0x27, 0x0a, 0x07, 0x66, 0x69, 0x6c, 0x74, 0x65, 0x72, 0x73, 0x18, 0x01,
+	0x20, 0x03, 0x28, 0x0b, 0x32, 0x0d, 0x2e, 0x46, 0x69, 0x6c, 0x74, 0x65, 0x72, 0x43, 0x6f, 0x6e,
+	0x66, 0x69, 0x67, 0x52, 0x07, 0x66, 0x69, 0x6c, 0x74, 0x65, 0x72, 0x73, 0x12, 0x1b, 0x0a, 0x09,
+	0x76, 0x6f, 0x6c, 0x75, 0x6d, 0x65, 0x5f, 0x69, 0x64, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52,
+	0x08, 0x76, 0x6f, 0x6c, 0x75, 0x6d, 0x65, 0x49, 0x64, 0x12, 0x16, 0x0a, 0x06, 0x73, 0x6f, 0x75,
+	0x72, 0x63, 0x65, 0x18, 0x03, 0x20, 0x01, 0x28, 0x09, 0x52, 0x06, 0x73, 0x6f, 0x75, 0x72, 0x63,
+	0x65, 0x22, 0x5e, 0x0a, 0x14, 0x43, 0x72, 0x65, 0x61, 0x74, 0x65, 0x54, 0x61, 0x72, 0x67, 0x65,
+	0x74, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x23, 0x0a, 0x06, 0x74, 0x61, 0x72,
+	0x67, 0x65, 0x74, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x0b, 0x2e, 0x54, 0x61, 0x72, 0x67,
+	0x65, 0x74, 0x49, 0x6e, 0x66, 0x6f, 0x52, 0x06, 0x74, 0x61, 0x72, 0x67, 0x65, 0x74, 0x12, 0x21,
+	0x0a, 0x05, 0x70, 0x61, 0x74, 0x68, 0x73, 0x18, 0x02, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x0b, 0x2e,
+	0x54, 0x61, 0x72, 0x67, 0x65, 0x74, 0x49, 0x6e, 0x66, 0x6f, 0x52, 0x05, 0x70, 0x61, 0x74, 0x68,
+	0x73, 0x22, 0x32, 0x0a, 0x13, 0x44, 0x65, 0x6c, 0x65, 0x74, 0x65, 0x54, 0x61, 0x72, 0x67, 0x65,
+	0x74, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x1b, 0x0a, 0x09, 0x76, 0x6f, 0x6c, 0x75,
+	0x6d, 0x65, 0x5f, 0x69, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x08, 0x76, 0x6f, 0x6c,
+	0x75, 0x6d, 0x65, 0x49, 0x64, 0x22, 0x16, 0x0a, 0x14, 0x44, 0x65, 0x6c, 0x65, 0x74, 0x65, 0x54,
+	0x61, 0x72, 0x67, 0x65, 0x74, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x22, 0x35, 0x0a,
+	0x16, 0x47, 0x65, 0x74, 0x46, 0x69, 0x6c, 0x74, 0x65, 0x72, 0x53, 0x74, 0x61, 0x74, 0x75, 0x73,
+	0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x1b, 0x0a, 0x09, 0x76, 0x6f, 0x6c, 0x75, 0x6d,
+	0x65, 0x5f, 0x69, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x08, 0x76, 0x6f, 0x6c, 0x75,
+	0x6d, 0x65, 0x49, 0x64, 0x22, 0x42, 0x0a, 0x17, 0x47, 0x65, 0x74, 0x46, 0x69, 0x6c, 0x74, 0x65,
+	0x72, 0x53, 0x74, 0x61, 0x74, 0x75, 0x73, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12,
+	0x27, 0x0a, 0x07, 0x66, 0x69, 0x6c, 0x74, 0x65, 0x72, 0x73, 0x18, 0x01, 0x20, 0x03, 0x28, 0x0b,
+	0x32, 0x0d, 0x2e, 0x46, 0x69, 0x6c, 0x74, 0x65, 0x72, 0x53, 0x74, 0x61, 0x74, 0x75, 0x73, 0x52,
+	0x07, 0x66, 0x69, 0x6c, 0x74, 0x65, 0x72, 0x73, 0x22, 0xc1, 0x01, 0x0a, 0x16, 0x43, 0x6f, 0x6e,
+	0x66, 0x69, 0x67, 0x75, 0x72, 0x65, 0x46, 0x69, 0x6c, 0x74, 0x65, 0x72, 0x52, 0x65, 0x71, 0x75,
+	0x65, 0x73, 0x74, 0x12, 0x12, 0x0a, 0x04, 0x6e, 0x61, 0x6d, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28,
+	0x09, 0x52, 0x04, 0x6e, 0x61, 0x6d, 0x65, 0x12, 0x3b, 0x0a, 0x06, 0x70, 0x61, 0x72, 0x61, 0x6d,
+	0x73, 0x18, 0x02, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x23, 0x2e, 0x43, 0x6f, 0x6e, 0x66, 0x69, 0x67,
+	0x75, 0x72, 0x65, 0x46, 0x69, 0x6c, 0x74, 0x65, 0x72, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74,
+	0x2e, 0x50, 0x61, 0x72, 0x61, 0x6d, 0x73, 0x45, 0x6e, 0x74, 0x72, 0x79, 0x52, 0x06, 0x70, 0x61,
+	0x72, 0x61, 0x6d, 0x73, 0x12, 0x1b, 0x0a, 0x09, 0x76, 0x6f, 0x6c, 0x75, 0x6d, 0x65, 0x5f, 0x69,
+	0x64, 0x18, 0x03, 0x20, 0x01, 0x28, 0x09, 0x52, 0x08, 0x76, 0x6f, 0x6c, 0x75, 0x6d, 0x65, 0x49,
+	0x64, 0x1a, 0x39, 0x0a, 0x0b, 0x50, 0x61, 0x72, 0x61, 0x6d, 0x73, 0x45, 0x6e, 0x74, 0x72, 0x79,
+	0x12, 0x10, 0x0a, 0x03, 0x6b, 0x65, 0x79, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x03, 0x6b,
+	0x65, 0x79, 0x12, 0x14, 0x0a, 0x05, 0x76, 0x61, 0x6c, 0x75, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28,
+	0x09, 0x52, 0x05, 0x76, 0x61, 0x6c, 0x75, 0x65, 0x3a, 0x02, 0x38, 0x01, 0x22, 0x40, 0x0a, 0x17,
+	0x43, 0x6f, 0x6e, 0x66, 0x69, 0x67, 0x75, 0x72, 0x65, 0x46, 0x69, 0x6c, 0x74, 0x65, 0x72, 0x52,
+	0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x25, 0x0a, 0x06, 0x73, 0x74, 0x61, 0x74, 0x75,
+	0x73, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x0d, 0x2e, 0x46, 0x69, 0x6c, 0x74, 0x65, 0x72,
+	0x53, 0x74, 0x61, 0x74, 0x75, 0x73, 0x52, 0x06, 0x73, 0x74, 0x61, 0x74, 0x75, 0x73, 0x22, 0xb6,
+	0x04, 0x0a, 0x09, 0x46, 0x61, 0x75, 0x6c, 0x74, 0x52, 0x75, 0x6c, 0x65, 0x12, 0x0e, 0x0a, 0x02,
+	0x69, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x04, 0x52, 0x02, 0x69, 0x64, 0x12, 0x1d, 0x0a, 0x02,
+	0x6f, 0x70, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0e, 0x32, 0x0d, 0x2e, 0x46, 0x61, 0x75, 0x6c, 0x74,
+	0x52, 0x75, 0x6c, 0x65, 0x2e, 0x4f, 0x70, 0x52, 0x02, 0x6f, 0x70, 0x12, 0x29, 0x0a, 0x06, 0x61,
+	0x63, 0x74, 0x69, 0x6f, 0x6e, 0x18, 0x03, 0x20, 0x01, 0x28, 0x0e, 0x32, 0x11, 0x2e, 0x46, 0x61,
+	0x75, 0x6c, 0x74, 0x52, 0x75, 0x6c, 0x65, 0x2e, 0x41, 0x63, 0x74, 0x69, 0x6f, 0x6e, 0x52, 0x06,
+	0x61, 0x63, 0x74, 0x69, 0x6f, 0x6e, 0x12, 0x1b, 0x0a, 0x09, 0x6c, 0x62, 0x61, 0x5f, 0x73, 0x74,
+	0x61, 0x72, 0x74, 0x18, 0x04, 0x20, 0x01, 0x28, 0x04, 0x52, 0x08, 0x6c, 0x62, 0x61, 0x53, 0x74,
+	0x61, 0x72, 0x74, 0x12, 0x1b, 0x0a, 0x09, 0x6c, 0x62, 0x61, 0x5f, 0x63, 0x6f, 0x75, 0x6e, 0x74,
+	0x18, 0x05, 0x20, 0x01, 0x28, 0x04, 0x52, 0x08, 0x6c, 0x62, 0x61, 0x43, 0x6f, 0x75, 0x6e, 0x74,
+	0x12, 0x20, 0x0a, 0x0b, 0x70, 0x72, 0x6f, 0x62, 0x61, 0x62, 0x69, 0x6c, 0x69, 0x74, 0x79, 0x18,
+	0x06, 0x20, 0x01, 0x28, 0x01, 0x52, 0x0b, 0x70, 0x72, 0x6f, 0x62, 0x61, 0x62, 0x69, 0x6c, 0x69,
+	0x74, 0x79, 0x12, 0x22, 0x0a, 0x0d, 0x73, 0x74, 0x61, 0x72, 0x74, 0x5f, 0x74, 0x69, 0x6d, 0x65,
+	0x5f, 0x6d, 0x73, 0x18, 0x07, 0x20, 0x01, 0x28, 0x03, 0x52, 0x0b, 0x73, 0x74, 0x61, 0x72, 0x74,
+	0x54, 0x69, 0x6d, 0x65, 0x4d, 0x73, 0x12, 0x1f, 0x0a, 0x0b, 0x64, 0x75, 0x72, 0x61, 0x74, 0x69,
+	0x6f, 0x6e, 0x5f, 0x6d, 0x73, 0x18, 0x08, 0x20, 0x01, 0x28, 0x03, 0x52, 0x0a, 0x64, 0x75, 0x72,
+	0x61, 0x74, 0x69, 0x6f, 0x6e, 0x4d, 0x73, 0x12, 0x39, 0x0a, 0x0c, 0x6c, 0x61, 0x74, 0x65, 0x6e,
+	0x63, 0x79, 0x5f, 0x64, 0x69, 0x73, 0x74, 0x18, 0x09, 0x20, 0x01, 0x28, 0x0e, 0x32, 0x16, 0x2e,
+	0x46, 0x61, 0x75, 0x6c, 0x74, 0x52, 0x75, 0x6c, 0x65, 0x2e, 0x4c, 0x61, 0x74, 0x65, 0x6e, 0x63,
+	0x79, 0x44, 0x69, 0x73, 0x74, 0x52, 0x0b, 0x6c, 0x61, 0x74, 0x65, 0x6e, 0x63, 0x79, 0x44, 0x69,
+	0x73, 0x74, 0x12, 0x1d, 0x0a, 0x0a, 0x6c, 0x61, 0x74, 0x65, 0x6e, 0x63, 0x79, 0x5f, 0x75, 0x73,
+	0x18, 0x0a, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x09, 0x6c, 0x61, 0x74, 0x65, 0x6e, 0x63, 0x79, 0x55,
+	0x73, 0x12, 0x2a, 0x0a, 0x11, 0x6c, 0x61, 0x74, 0x65, 0x6e, 0x63, 0x79, 0x5f, 0x6a, 0x69, 0x74,
+	0x74, 0x65, 0x72, 0x5f, 0x75, 0x73, 0x18, 0x0b, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x0f, 0x6c, 0x61,
+	0x74, 0x65, 0x6e, 0x63, 0x79, 0x4a, 0x69, 0x74, 0x74, 0x65, 0x72, 0x55, 0x73, 0x22, 0x22, 0x0a,
+	0x02, 0x4f, 0x70, 0x12, 0x07, 0x0a, 0x03, 0x41, 0x4e, 0x59, 0x10, 0x00, 0x12, 0x08, 0x0a, 0x04,
+	0x52, 0x45, 0x41, 0x44, 0x10, 0x01, 0x12, 0x09, 0x0a, 0x05, 0x57, 0x52, 0x49, 0x54, 0x45, 0x10,
+	0x02, 0x22, 0x40, 0x0a, 0x06, 0x41, 0x63, 0x74, 0x69, 0x6f, 0x6e, 0x12, 0x09, 0x0a, 0x05, 0x45,
+	0x52, 0x52, 0x4f, 0x52, 0x10, 0x00, 0x12, 0x0b, 0x0a, 0x07, 0x4c, 0x41, 0x54, 0x45, 0x4e, 0x43,
+	0x59, 0x10, 0x01, 0x12, 0x0e, 0x0a, 0x0a, 0x44, 0x52, 0x4f, 0x50, 0x5f, 0x57, 0x52, 0x49, 0x54,
+	0x45, 0x10, 0x02, 0x12, 0x0e, 0x0a, 0x0a, 0x54, 0x4f, 0x52, 0x4e, 0x5f, 0x57, 0x52, 0x49, 0x54,
+	0x45, 0x10, 0x03, 0x22, 0x42, 0x0a, 0x0b, 0x4c, 0x61, 0x74, 0x65, 0x6e, 0x63, 0x79, 0x44, 0x69,
+	0x73, 0x74, 0x12, 0x09, 0x0a, 0x05, 0x46, 0x49, 0x58, 0x45, 0x44, 0x10, 0x00, 0x12, 0x0b, 0x0a,
+	0x07, 0x55, 0x4e, 0x49, 0x46, 0x4f, 0x52, 0x4d, 0x10, 0x01, 0x12, 0x0a, 0x0a, 0x06, 0x4e, 0x4f,
+	0x52, 0x4d, 0x41, 0x4c, 0x10, 0x02, 0x12, 0x0f, 0x0a, 0x0b, 0x45, 0x58, 0x50, 0x4f, 0x4e, 0x45,
+	0x4e, 0x54, 0x49, 0x41, 0x4c, 0x10, 0x03, 0x22, 0x52, 0x0a, 0x13, 0x41, 0x64, 0x64, 0x46, 0x61,
+	0x75, 0x6c, 0x74, 0x52, 0x75, 0x6c, 0x65, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x1e,
+	0x0a, 0x04, 0x72, 0x75, 0x6c, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x0a, 0x2e, 0x46,
+	0x61, 0x75, 0x6c, 0x74, 0x52, 0x75, 0x6c, 0x65, 0x52, 0x04, 0x72, 0x75, 0x6c, 0x65, 0x12, 0x1b,
+	0x0a, 0x09, 0x76, 0x6f, 0x6c, 0x75, 0x6d, 0x65, 0x5f, 0x69, 0x64, 0x18, 0x02, 0x20, 0x01, 0x28,
+	0x09, 0x52, 0x08, 0x76, 0x6f, 0x6c, 0x75, 0x6d, 0x65, 0x49, 0x64, 0x22, 0x26, 0x0a, 0x14, 0x41,
+	0x64, 0x64, 0x46, 0x61, 0x75, 0x6c, 0x74, 0x52, 0x75, 0x6c, 0x65, 0x52, 0x65, 0x73, 0x70, 0x6f,
+	0x6e, 0x73, 0x65, 0x12, 0x0e, 0x0a, 0x02, 0x69, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x04, 0x52,
+	0x02, 0x69, 0x64, 0x22, 0x45, 0x0a, 0x16, 0x52, 0x65, 0x6d, 0x6f, 0x76, 0x65, 0x46, 0x61, 0x75,
+	0x6c, 0x74, 0x52, 0x75, 0x6c, 0x65, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x0e, 0x0a,
+	0x02, 0x69, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x04, 0x52, 0x02, 0x69, 0x64, 0x12, 0x1b, 0x0a,
+	0x09, 0x76, 0x6f, 0x6c, 0x75, 0x6d, 0x65, 0x5f, 0x69, 0x64, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09,
+	0x52, 0x08, 0x76, 0x6f, 0x6c, 0x75, 0x6d, 0x65, 0x49, 0x64, 0x22, 0x19, 0x0a, 0x17, 0x52, 0x65,
+	0x6d, 0x6f, 0x76, 0x65, 0x46, 0x61, 0x75, 0x6c, 0x74, 0x52, 0x75, 0x6c, 0x65, 0x52, 0x65, 0x73,
+	0x70, 0x6f, 0x6e, 0x73, 0x65, 0x22, 0x34, 0x0a, 0x15, 0x4c, 0x69, 0x73, 0x74, 0x46, 0x61, 0x75,
+	0x6c, 0x74, 0x52, 0x75, 0x6c, 0x65, 0x73, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x1b,
+	0x0a, 0x09, 0x76, 0x6f, 0x6c, 0x75, 0x6d, 0x65, 0x5f, 0x69, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28,
+	0x09, 0x52, 0x08, 0x76, 0x6f, 0x6c, 0x75, 0x6d, 0x65, 0x49, 0x64, 0x22, 0x3a, 0x0a, 0x16, 0x4c,
+	0x69, 0x73, 0x74, 0x46, 0x61, 0x75, 0x6c, 0x74, 0x52, 0x75, 0x6c, 0x65, 0x73, 0x52, 0x65, 0x73,
+	0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x20, 0x0a, 0x05, 0x72, 0x75, 0x6c, 0x65, 0x73, 0x18, 0x01,
+	0x20, 0x03, 0x28, 0x0b, 0x32, 0x0a, 0x2e, 0x46, 0x61, 0x75, 0x6c, 0x74, 0x52, 0x75, 0x6c, 0x65,
+	0x52, 0x05, 0x72, 0x75, 0x6c, 0x65, 0x73, 0x22, 0xe0, 0x01, 0x0a, 0x0b, 0x54, 0x72, 0x61, 0x63,
+	0x65, 0x52, 0x65, 0x63, 0x6f, 0x72, 0x64, 0x12, 0x21, 0x0a, 0x0c, 0x74, 0x69, 0x6d, 0x65, 0x73,
+	0x74, 0x61, 0x6d, 0x70, 0x5f, 0x6e, 0x73, 0x18, 0x01, 0x20, 0x01, 0x28, 0x03, 0x52, 0x0b, 0x74,
+	0x69, 0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d, 0x70, 0x4e, 0x73, 0x12, 0x1f, 0x0a, 0x02, 0x6f, 0x70,
+	0x18, 0x02, 0x20, 0x01, 0x28, 0x0e, 0x32, 0x0f, 0x2e, 0x54, 0x72, 0x61, 0x63, 0x65, 0x52, 0x65,
+	0x63, 0x6f, 0x72, 0x64, 0x2e, 0x4f, 0x70, 0x52, 0x02, 0x6f, 0x70, 0x12, 0x10, 0x0a, 0x03, 0x6c,
+	0x62, 0x61, 0x18, 0x03, 0x20, 0x01, 0x28, 0x04, 0x52, 0x03, 0x6c, 0x62, 0x61, 0x12, 0x16, 0x0a,
+	0x06, 0x6c, 0x65, 0x6e, 0x67, 0x74, 0x68, 0x18, 0x04, 0x20, 0x01, 0x28, 0x04, 0x52, 0x06, 0x6c,
+	0x65, 0x6e, 0x67, 0x74, 0x68, 0x12, 0x1d, 0x0a, 0x0a, 0x6c, 0x61, 0x74, 0x65, 0x6e, 0x63, 0x79,
+	0x5f, 0x6e, 0x73, 0x18, 0x05, 0x20, 0x01, 0x28, 0x03, 0x52, 0x09, 0x6c, 0x61, 0x74, 0x65, 0x6e,
+	0x63, 0x79, 0x4e, 0x73, 0x12, 0x14, 0x0a, 0x05, 0x65, 0x72, 0x72, 0x6f, 0x72, 0x18, 0x06, 0x20,
+	0x01, 0x28, 0x08, 0x52, 0x05, 0x65, 0x72, 0x72, 0x6f, 0x72, 0x22, 0x2e, 0x0a, 0x02, 0x4f, 0x70,
+	0x12, 0x08, 0x0a, 0x04, 0x52, 0x45, 0x41, 0x44, 0x10, 0x00, 0x12, 0x09, 0x0a, 0x05, 0x57, 0x52,
+	0x49, 0x54, 0x45, 0x10, 0x01, 0x12, 0x09, 0x0a, 0x05, 0x46, 0x4c, 0x55, 0x53, 0x48, 0x10, 0x02,
+	0x12, 0x08, 0x0a, 0x04, 0x54, 0x52, 0x49, 0x4d, 0x10, 0x03, 0x22, 0x49, 0x0a, 0x12, 0x53, 0x74,
+	0x72, 0x65, 0x61, 0x6d, 0x54, 0x72, 0x61, 0x63, 0x65, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74,
+	0x12, 0x16, 0x0a, 0x06, 0x72, 0x65, 0x70, 0x6c, 0x61, 0x79, 0x18, 0x01, 0x20, 0x01, 0x28, 0x08,
+	0x52, 0x06, 0x72, 0x65, 0x70, 0x6c, 0x61, 0x79, 0x12, 0x1b, 0x0a, 0x09, 0x76, 0x6f, 0x6c, 0x75,
+	0x6d, 0x65, 0x5f, 0x69, 0x64, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x08, 0x76, 0x6f, 0x6c,
+	0x75, 0x6d, 0x65, 0x49, 0x64, 0x22, 0x4a, 0x0a, 0x11, 0x42, 0x69, 0x6e, 0x64, 0x53, 0x6f, 0x75,
+	0x72, 0x63, 0x65, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x16, 0x0a, 0x06, 0x73, 0x6f,
+	0x75, 0x72, 0x63, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x06, 0x73, 0x6f, 0x75, 0x72,
+	0x63, 0x65, 0x12, 0x1d, 0x0a, 0x0a, 0x73, 0x6f, 0x75, 0x72, 0x63, 0x65, 0x5f, 0x70, 0x76, 0x63,
+	0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x09, 0x73, 0x6f, 0x75, 0x72, 0x63, 0x65, 0x50, 0x76,
+	0x63, 0x22, 0x14, 0x0a, 0x12, 0x42, 0x69, 0x6e, 0x64, 0x53, 0x6f, 0x75, 0x72, 0x63, 0x65, 0x52,
+	0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x22, 0x14, 0x0a, 0x12, 0x4c, 0x69, 0x73, 0x74, 0x54,
+	0x61, 0x72, 0x67, 0x65, 0x74, 0x73, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x22, 0x83, 0x01,
+	0x0a, 0x0d, 0x54, 0x61, 0x72, 0x67, 0x65, 0x74, 0x53, 0x75, 0x6d, 0x6d, 0x61, 0x72, 0x79, 0x12,
+	0x1b, 0x0a, 0x09, 0x76, 0x6f, 0x6c, 0x75, 0x6d, 0x65, 0x5f, 0x69, 0x64, 0x18, 0x01, 0x20, 0x01,
+	0x28, 0x09, 0x52, 0x08, 0x76, 0x6f, 0x6c, 0x75, 0x6d, 0x65, 0x49, 0x64, 0x12, 0x23, 0x0a, 0x06,
+	0x74, 0x61, 0x72, 0x67, 0x65, 0x74, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x0b, 0x2e, 0x54,
+	0x61, 0x72, 0x67, 0x65, 0x74, 0x49, 0x6e, 0x66, 0x6f, 0x52, 0x06, 0x74, 0x61, 0x72, 0x67, 0x65,
+	0x74, 0x12, 0x16, 0x0a, 0x06, 0x73, 0x6f, 0x75, 0x72, 0x63, 0x65, 0x18, 0x03, 0x20, 0x01, 0x28,
+	0x09, 0x52, 0x06, 0x73, 0x6f, 0x75, 0x72, 0x63, 0x65, 0x12, 0x18, 0x0a, 0x07, 0x66, 0x69, 0x6c,
+	0x74, 0x65, 0x72, 0x73, 0x18, 0x04, 0x20, 0x03, 0x28, 0x09, 0x52, 0x07, 0x66, 0x69, 0x6c, 0x74,
+	0x65, 0x72, 0x73, 0x22, 0x3f, 0x0a, 0x13, 0x4c, 0x69, 0x73, 0x74, 0x54, 0x61, 0x72, 0x67, 0x65,
+	0x74, 0x73, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x28, 0x0a, 0x07, 0x74, 0x61,
+	0x72, 0x67, 0x65, 0x74, 0x73, 0x18, 0x01, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x0e, 0x2e, 0x54, 0x61,
+	0x72, 0x67, 0x65, 0x74, 0x53, 0x75, 0x6d, 0x6d, 0x61, 0x72, 0x79, 0x52, 0x07, 0x74, 0x61, 0x72,
+	0x67, 0x65, 0x74, 0x73, 0x22, 0x9a, 0x01, 0x0a, 0x09, 0x49, 0x4f, 0x4f, 0x70, 0x53, 0x74, 0x61,
+	0x74, 0x73, 0x12, 0x10, 0x0a, 0x03, 0x6f, 0x70, 0x73, 0x18, 0x01, 0x20, 0x01, 0x28, 0x04, 0x52,
+	0x03, 0x6f, 0x70, 0x73, 0x12, 0x14, 0x0a, 0x05, 0x62, 0x79, 0x74, 0x65, 0x73, 0x18, 0x02, 0x20,
+	0x01, 0x28, 0x04, 0x52, 0x05, 0x62, 0x79, 0x74, 0x65, 0x73, 0x12, 0x16, 0x0a, 0x06, 0x65, 0x72,
+	0x72, 0x6f, 0x72, 0x73, 0x18, 0x03, 0x20, 0x01, 0x28, 0x04, 0x52, 0x06, 0x65, 0x72, 0x72, 0x6f,
+	0x72, 0x73, 0x12, 0x24, 0x0a, 0x0e, 0x6c, 0x61, 0x74, 0x65, 0x6e, 0x63, 0x79, 0x5f, 0x73, 0x75,
+	0x6d, 0x5f, 0x75, 0x73, 0x18, 0x04, 0x20, 0x01, 0x28, 0x04, 0x52, 0x0c, 0x6c, 0x61, 0x74, 0x65,
+	0x6e, 0x63, 0x79, 0x53, 0x75, 0x6d, 0x55, 0x73, 0x12, 0x27, 0x0a, 0x0f, 0x6c, 0x61, 0x74, 0x65,
+	0x6e, 0x63, 0x79, 0x5f, 0x62, 0x75, 0x63, 0x6b, 0x65, 0x74, 0x73, 0x18, 0x05, 0x20, 0x03, 0x28,
+	0x04, 0x52, 0x0e, 0x6c, 0x61, 0x74, 0x65, 0x6e, 0x63, 0x79, 0x42, 0x75, 0x63, 0x6b, 0x65, 0x74,
+	0x73, 0x22, 0xda, 0x01, 0x0a, 0x07, 0x49, 0x4f, 0x53, 0x74, 0x61, 0x74, 0x73, 0x12, 0x1e, 0x0a,
+	0x04, 0x72, 0x65, 0x61, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x0a, 0x2e, 0x49, 0x4f,
+	0x4f, 0x70, 0x53, 0x74, 0x61, 0x74, 0x73, 0x52, 0x04, 0x72, 0x65, 0x61, 0x64, 0x12, 0x20, 0x0a,
+	0x05, 0x77, 0x72, 0x69, 0x74, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x0a, 0x2e, 0x49,
+	0x4f, 0x4f, 0x70, 0x53, 0x74, 0x61, 0x74, 0x73, 0x52, 0x05, 0x77, 0x72, 0x69, 0x74, 0x65, 0x12,
+	0x20, 0x0a, 0x05, 0x66, 0x6c, 0x75, 0x73, 0x68, 0x18, 0x03, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x0a,
+	0x2e, 0x49, 0x4f, 0x4f, 0x70, 0x53, 0x74, 0x61, 0x74, 0x73, 0x52, 0x05, 0x66, 0x6c, 0x75, 0x73,
+	0x68, 0x12, 0x1e, 0x0a, 0x04, 0x74, 0x72, 0x69, 0x6d, 0x18, 0x04, 0x20, 0x01, 0x28, 0x0b, 0x32,
+	0x0a, 0x2e, 0x49, 0x4f, 0x4f, 0x70, 0x53, 0x74, 0x61, 0x74, 0x73, 0x52, 0x04, 0x74, 0x72, 0x69,
+	0x6d, 0x12, 0x1f, 0x0a, 0x0b, 0x71, 0x75, 0x65, 0x75, 0x65, 0x5f, 0x64, 0x65, 0x70, 0x74, 0x68,
+	0x18, 0x05, 0x20, 0x01, 0x28, 0x03, 0x52, 0x0a, 0x71, 0x75, 0x65, 0x75, 0x65, 0x44, 0x65, 0x70,
+	0x74, 0x68, 0x12, 0x2a, 0x0a, 0x11, 0x6c, 0x61, 0x74, 0x65, 0x6e, 0x63, 0x79, 0x5f, 0x62, 0x6f,
+	0x75, 0x6e, 0x64, 0x73, 0x5f, 0x75, 0x73, 0x18, 0x06, 0x20, 0x03, 0x28, 0x04, 0x52, 0x0f, 0x6c,
+	0x61, 0x74, 0x65, 0x6e, 0x63, 0x79, 0x42, 0x6f, 0x75, 0x6e, 0x64, 0x73, 0x55, 0x73, 0x22, 0x34,
+	0x0a, 0x15, 0x47, 0x65, 0x74, 0x54, 0x61, 0x72, 0x67, 0x65, 0x74, 0x53, 0x74, 0x61, 0x74, 0x73,
+	0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x1b, 0x0a, 0x09, 0x76, 0x6f, 0x6c, 0x75, 0x6d,
+	0x65, 0x5f, 0x69, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x08, 0x76, 0x6f, 0x6c, 0x75,
+	0x6d, 0x65, 0x49, 0x64, 0x22, 0x58, 0x0a, 0x16, 0x47, 0x65, 0x74, 0x54, 0x61, 0x72, 0x67, 0x65,
+	0x74, 0x53, 0x74, 0x61, 0x74, 0x73, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x1a,
+	0x0a, 0x03, 0x6c, 0x75, 0x6e, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x08, 0x2e, 0x49, 0x4f,
+	0x53, 0x74, 0x61, 0x74, 0x73, 0x52, 0x03, 0x6c, 0x75, 0x6e, 0x12, 0x22, 0x0a, 0x07, 0x62, 0x61,
+	0x63, 0x6b, 0x69, 0x6e, 0x67, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x08, 0x2e, 0x49, 0x4f,
+	0x53, 0x74, 0x61, 0x74, 0x73, 0x52, 0x07, 0x62, 0x61, 0x63, 0x6b, 0x69, 0x6e, 0x67, 0x22, 0x31,
+	0x0a, 0x12, 0x46, 0x6c, 0x75, 0x73, 0x68, 0x54, 0x61, 0x72, 0x67, 0x65, 0x74, 0x52, 0x65, 0x71,
+	0x75, 0x65, 0x73, 0x74, 0x12, 0x1b, 0x0a, 0x09, 0x76, 0x6f, 0x6c, 0x75, 0x6d, 0x65, 0x5f, 0x69,
+	0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x08, 0x76, 0x6f, 0x6c, 0x75, 0x6d, 0x65, 0x49,
+	0x64, 0x22, 0x15, 0x0a, 0x13, 0x46, 0x6c, 0x75, 0x73, 0x68, 0x54, 0x61, 0x72, 0x67, 0x65, 0x74,
+	0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x22, 0x31, 0x0a, 0x12, 0x53, 0x63, 0x72, 0x75,
+	0x62, 0x54, 0x61, 0x72, 0x67, 0x65, 0x74, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x1b,
+	0x0a, 0x09, 0x76, 0x6f, 0x6c, 0x75, 0x6d, 0x65, 0x5f, 0x69, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28,
+	0x09, 0x52, 0x08, 0x76, 0x6f, 0x6c, 0x75, 0x6d, 0x65, 0x49, 0x64, 0x22, 0x7c, 0x0a, 0x13, 0x53,
+	0x63, 0x72, 0x75, 0x62, 0x54, 0x61, 0x72, 0x67, 0x65, 0x74, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e,
+	0x73, 0x65, 0x12, 0x23, 0x0a, 0x0d, 0x62, 0x79, 0x74, 0x65, 0x73, 0x5f, 0x73, 0x63, 0x61, 0x6e,
+	0x6e, 0x65, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x04, 0x52, 0x0c, 0x62, 0x79, 0x74, 0x65, 0x73,
+	0x53, 0x63, 0x61, 0x6e, 0x6e, 0x65, 0x64, 0x12, 0x1f, 0x0a, 0x0b, 0x72, 0x65, 0x61, 0x64, 0x5f,
+	0x65, 0x72, 0x72, 0x6f, 0x72, 0x73, 0x18, 0x02, 0x20, 0x01, 0x28, 0x04, 0x52, 0x0a, 0x72, 0x65,
+	0x61, 0x64, 0x45, 0x72, 0x72, 0x6f, 0x72, 0x73, 0x12, 0x1f, 0x0a, 0x0b, 0x66, 0x69, 0x72, 0x73,
+	0x74, 0x5f, 0x65, 0x72, 0x72, 0x6f, 0x72, 0x18, 0x03, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0a, 0x66,
+	0x69, 0x72, 0x73, 0x74, 0x45, 0x72, 0x72, 0x6f, 0x72, 0x32, 0xca, 0x06, 0x0a, 0x06, 0x46, 0x69,
+	0x6c, 0x74, 0x65, 0x72, 0x12, 0x3d, 0x0a, 0x0c, 0x43, 0x72, 0x65, 0x61, 0x74, 0x65, 0x54, 0x61,
+	0x72, 0x67, 0x65, 0x74, 0x12, 0x14, 0x2e, 0x43, 0x72, 0x65, 0x61, 0x74, 0x65, 0x54, 0x61, 0x72,
+	0x67, 0x65, 0x74, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x15, 0x2e, 0x43, 0x72, 0x65,
+	0x61, 0x74, 0x65, 0x54, 0x61, 0x72, 0x67, 0x65, 0x74, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73,
+	0x65, 0x22, 0x00, 0x12, 0x3d, 0x0a, 0x0c, 0x44, 0x65, 0x6c, 0x65, 0x74, 0x65, 0x54, 0x61, 0x72,
+	0x67, 0x65, 0x74, 0x12, 0x14, 0x2e, 0x44, 0x65, 0x6c, 0x65, 0x74, 0x65, 0x54, 0x61, 0x72, 0x67,
+	0x65, 0x74, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x15, 0x2e, 0x44, 0x65, 0x6c, 0x65,
+	0x74, 0x65, 0x54, 0x61, 0x72, 0x67, 0x65, 0x74, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65,
+	0x22, 0x00, 0x12, 0x46, 0x0a, 0x0f, 0x47, 0x65, 0x74, 0x46, 0x69, 0x6c, 0x74, 0x65, 0x72, 0x53,
+	0x74, 0x61, 0x74, 0x75, 0x73, 0x12, 0x17, 0x2e, 0x47, 0x65, 0x74, 0x46, 0x69, 0x6c, 0x74, 0x65,
+	0x72, 0x53, 0x74, 0x61, 0x74, 0x75, 0x73, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x18,
+	0x2e, 0x47, 0x65, 0x74, 0x46, 0x69, 0x6c, 0x74, 0x65, 0x72, 0x53, 0x74, 0x61, 0x74, 0x75, 0x73,
+	0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x22, 0x00, 0x12, 0x46, 0x0a, 0x0f, 0x43, 0x6f,
+	0x6e, 0x66, 0x69, 0x67, 0x75, 0x72, 0x65, 0x46, 0x69, 0x6c, 0x74, 0x65, 0x72, 0x12, 0x17, 0x2e,
+	0x43, 0x6f, 0x6e, 0x66, 0x69, 0x67, 0x75, 0x72, 0x65, 0x46, 0x69, 0x6c, 0x74, 0x65, 0x72, 0x52,
+	0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x18, 0x2e, 0x43, 0x6f, 0x6e, 0x66, 0x69, 0x67, 0x75,
+	0x72, 0x65, 0x46, 0x69, 0x6c, 0x74, 0x65, 0x72, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65,
+	0x22, 0x00, 0x12, 0x3d, 0x0a, 0x0c, 0x41, 0x64, 0x64, 0x46, 0x61, 0x75, 0x6c, 0x74, 0x52, 0x75,
+	0x6c, 0x65, 0x12, 0x14, 0x2e, 0x41, 0x64, 0x64, 0x46, 0x61, 0x75, 0x6c, 0x74, 0x52, 0x75, 0x6c,
+	0x65, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x15, 0x2e, 0x41, 0x64, 0x64, 0x46, 0x61,
+	0x75, 0x6c, 0x74, 0x52, 0x75, 0x6c, 0x65, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x22,
+	0x00, 0x12, 0x46, 0x0a, 0x0f, 0x52, 0x65, 0x6d, 0x6f, 0x76, 0x65, 0x46, 0x61, 0x75, 0x6c, 0x74,
+	0x52, 0x75, 0x6c, 0x65, 0x12, 0x17, 0x2e, 0x52, 0x65, 0x6d, 0x6f, 0x76, 0x65, 0x46, 0x61, 0x75,
+	0x6c, 0x74, 0x52, 0x75, 0x6c, 0x65, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x18, 0x2e,
+	0x52, 0x65, 0x6d, 0x6f, 0x76, 0x65, 0x46, 0x61, 0x75, 0x6c, 0x74, 0x52, 0x75, 0x6c, 0x65, 0x52,
+	0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x22, 0x00, 0x12, 0x43, 0x0a, 0x0e, 0x4c, 0x69, 0x73,
+	0x74, 0x46, 0x61, 0x75, 0x6c, 0x74, 0x52, 0x75, 0x6c, 0x65, 0x73, 0x12, 0x16, 0x2e, 0x4c, 0x69,
+	0x73, 0x74, 0x46, 0x61, 0x75, 0x6c, 0x74, 0x52, 0x75, 0x6c, 0x65, 0x73, 0x52, 0x65, 0x71, 0x75,
+	0x65, 0x73, 0x74, 0x1a, 0x17, 0x2e, 0x4c, 0x69, 0x73, 0x74, 0x46, 0x61, 0x75, 0x6c, 0x74, 0x52,
+	0x75, 0x6c, 0x65, 0x73, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x22, 0x00, 0x12, 0x34,
+	0x0a, 0x0b, 0x53, 0x74, 0x72, 0x65, 0x61, 0x6d, 0x54, 0x72, 0x61, 0x63, 0x65, 0x12, 0x13, 0x2e,
+	0x53, 0x74, 0x72, 0x65, 0x61, 0x6d, 0x54, 0x72, 0x61, 0x63, 0x65, 0x52, 0x65, 0x71, 0x75, 0x65,
+	0x73, 0x74, 0x1a, 0x0c, 0x2e, 0x54, 0x72, 0x61, 0x63, 0x65, 0x52, 0x65, 0x63, 0x6f, 0x72, 0x64,
+	0x22, 0x00, 0x30, 0x01, 0x12, 0x37, 0x0a, 0x0a, 0x42, 0x69, 0x6e, 0x64, 0x53, 0x6f, 0x75, 0x72,
+	0x63, 0x65, 0x12, 0x12, 0x2e, 0x42, 0x69, 0x6e, 0x64, 0x53, 0x6f, 0x75, 0x72, 0x63, 0x65, 0x52,
+	0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x13, 0x2e, 0x42, 0x69, 0x6e, 0x64, 0x53, 0x6f, 0x75,
+	0x72, 0x63, 0x65, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x22, 0x00, 0x12, 0x3a, 0x0a,
+	0x0b, 0x4c, 0x69, 0x73, 0x74, 0x54, 0x61, 0x72, 0x67, 0x65, 0x74, 0x73, 0x12, 0x13, 0x2e, 0x4c,
+	0x69, 0x73, 0x74, 0x54, 0x61, 0x72, 0x67, 0x65, 0x74, 0x73, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73,
+	0x74, 0x1a, 0x14, 0x2e, 0x4c, 0x69, 0x73, 0x74, 0x54, 0x61, 0x72, 0x67, 0x65, 0x74, 0x73, 0x52,
+	0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x22, 0x00, 0x12, 0x43, 0x0a, 0x0e, 0x47, 0x65, 0x74,
+	0x54, 0x61, 0x72, 0x67, 0x65, 0x74, 0x53, 0x74, 0x61, 0x74, 0x73, 0x12, 0x16, 0x2e, 0x47, 0x65,
+	0x74, 0x54, 0x61, 0x72, 0x67, 0x65, 0x74, 0x53, 0x74, 0x61, 0x74, 0x73, 0x52, 0x65, 0x71, 0x75,
+	0x65, 0x73, 0x74, 0x1a, 0x17, 0x2e, 0x47, 0x65, 0x74, 0x54, 0x61, 0x72, 0x67, 0x65, 0x74, 0x53,
+	0x74, 0x61, 0x74, 0x73, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x22, 0x00, 0x12, 0x3a,
+	0x0a, 0x0b, 0x46, 0x6c, 0x75, 0x73, 0x68, 0x54, 0x61, 0x72, 0x67, 0x65, 0x74, 0x12, 0x13, 0x2e,
+	0x46, 0x6c, 0x75, 0x73, 0x68, 0x54, 0x61, 0x72, 0x67, 0x65, 0x74, 0x52, 0x65, 0x71, 0x75, 0x65,
+	0x73, 0x74, 0x1a, 0x14, 0x2e, 0x46, 0x6c, 0x75, 0x73, 0x68, 0x54, 0x61, 0x72, 0x67, 0x65, 0x74,
+	0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x22, 0x00, 0x12, 0x3a, 0x0a, 0x0b, 0x53, 0x63,
+	0x72, 0x75, 0x62, 0x54, 0x61, 0x72, 0x67, 0x65, 0x74, 0x12, 0x13, 0x2e, 0x53, 0x63, 0x72, 0x75,
+	0x62, 0x54, 0x61, 0x72, 0x67, 0x65, 0x74, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x14,
+	0x2e, 0x53, 0x63, 0x72, 0x75, 0x62, 0x54, 0x61, 0x72, 0x67, 0x65, 0x74, 0x52, 0x65, 0x73, 0x70,
+	0x6f, 0x6e, 0x73, 0x65, 0x22, 0x00, 0x42, 0x26, 0x5a, 0x24, 0x67, 0x69, 0x74, 0x68, 0x75, 0x62,
+	0x2e, 0x63, 0x6f, 0x6d, 0x2f, 0x70, 0x6f, 0x6f, 0x68, 0x36, 0x34, 0x2f, 0x63, 0x73, 0x69, 0x66,
+	0x2d, 0x64, 0x72, 0x69, 0x76, 0x65, 0x72, 0x2f, 0x66, 0x69, 0x6c, 0x74, 0x65, 0x72, 0x62, 0x06,
+	0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
+}
+
+var (
+	file_filter_proto_rawDescOnce sync.Once
+	file_filter_proto_rawDescData = file_filter_proto_rawDesc
+)
+
+func file_filter_proto_rawDescGZIP() []byte {
+	file_filter_proto_rawDescOnce.Do(func() {
+		file_filter_proto_rawDescData = protoimpl.X.CompressGZIP(file_filter_proto_rawDescData)
+	})
+	return file_filter_proto_rawDescData
+}
+
+var file_filter_proto_enumTypes = make([]protoimpl.EnumInfo, 4)
+var file_filter_proto_msgTypes = make([]protoimpl.MessageInfo, 37)
+var file_filter_proto_goTypes = []interface{}{
+	(FaultRule_Op)(0),               // 0: FaultRule.Op
+	(FaultRule_Action)(0),           // 1: FaultRule.Action
+	(FaultRule_LatencyDist)(0),      // 2: FaultRule.LatencyDist
+	(TraceRecord_Op)(0),             // 3: TraceRecord.Op
+	(*TargetInfo)(nil),              // 4: TargetInfo
+	(*FilterConfig)(nil),            // 5: FilterConfig
+	(*FilterStatus)(nil),            // 6: FilterStatus
+	(*CreateTargetRequest)(nil),     // 7: CreateTargetRequest
+	(*CreateTargetResponse)(nil),    // 8: CreateTargetResponse
+	(*DeleteTargetRequest)(nil),     // 9: DeleteTargetRequest
+	(*DeleteTargetResponse)(nil),    // 10: DeleteTargetResponse
+	(*GetFilterStatusRequest)(nil),  // 11: GetFilterStatusRequest
+	(*GetFilterStatusResponse)(nil), // 12: GetFilterStatusResponse
+	(*ConfigureFilterRequest)(nil),  // 13: ConfigureFilterRequest
+	(*ConfigureFilterResponse)(nil), // 14: ConfigureFilterResponse
+	(*FaultRule)(nil),               // 15: FaultRule
+	(*AddFaultRuleRequest)(nil),     // 16: AddFaultRuleRequest
+	(*AddFaultRuleResponse)(nil),    // 17: AddFaultRuleResponse
+	(*RemoveFaultRuleRequest)(nil),  // 18: RemoveFaultRuleRequest
+	(*RemoveFaultRuleResponse)(nil), // 19: RemoveFaultRuleResponse
+	(*ListFaultRulesRequest)(nil),   // 20: ListFaultRulesRequest
+	(*ListFaultRulesResponse)(nil),  // 21: ListFaultRulesResponse
+	(*TraceRecord)(nil),             // 22: TraceRecord
+	(*StreamTraceRequest)(nil),      // 23: StreamTraceRequest
+	(*BindSourceRequest)(nil),       // 24: BindSourceRequest
+	(*BindSourceResponse)(nil),      // 25: BindSourceResponse
+	(*ListTargetsRequest)(nil),      // 26: ListTargetsRequest
+	(*TargetSummary)(nil),           // 27: TargetSummary
+	(*ListTargetsResponse)(nil),     // 28: ListTargetsResponse
+	(*IOOpStats)(nil),               // 29: IOOpStats
+	(*IOStats)(nil),                 // 30: IOStats
+	(*GetTargetStatsRequest)(nil),   // 31: GetTargetStatsRequest
+	(*GetTargetStatsResponse)(nil),  // 32: GetTargetStatsResponse
+	(*FlushTargetRequest)(nil),      // 33: FlushTargetRequest
+	(*FlushTargetResponse)(nil),     // 34: FlushTargetResponse
+	(*ScrubTargetRequest)(nil),      // 35: ScrubTargetRequest
+	(*ScrubTargetResponse)(nil),     // 36: ScrubTargetResponse
+	nil,                             // 37: FilterConfig.ParamsEntry
+	nil,                             // 38: FilterStatus.CountersEntry
+	nil,                             // 39: FilterStatus.InfoEntry
+	nil,                             // 40: ConfigureFilterRequest.ParamsEntry
+}
+var file_filter_proto_depIdxs = []int32{
+	37, // 0: FilterConfig.params:type_name -> FilterConfig.ParamsEntry
+	38, // 1: FilterStatus.counters:type_name -> FilterStatus.CountersEntry
+	39, // 2: FilterStatus.info:type_name -> FilterStatus.InfoEntry
+	5,  // 3: CreateTargetRequest.filters:type_name -> FilterConfig
+	4,  // 4: CreateTargetResponse.target:type_name -> TargetInfo
+	4,  // 5: CreateTargetResponse.paths:type_name -> TargetInfo
+	6,  // 6: GetFilterStatusResponse.filters:type_name -> FilterStatus
+	40, // 7: ConfigureFilterRequest.params:type_name -> ConfigureFilterRequest.ParamsEntry
+	6,  // 8: ConfigureFilterResponse.status:type_name -> FilterStatus
+	0,  // 9: FaultRule.op:type_name -> FaultRule.Op
+	1,  // 10: FaultRule.action:type_name -> FaultRule.Action
+	2,  // 11: FaultRule.latency_dist:type_name -> FaultRule.LatencyDist
+	15, // 12: AddFaultRuleRequest.rule:type_name -> FaultRule
+	15, // 13: ListFaultRulesResponse.rules:type_name -> FaultRule
+	3,  // 14: TraceRecord.op:type_name -> TraceRecord.Op
+	4,  // 15: TargetSummary.target:type_name -> TargetInfo
+	27, // 16: ListTargetsResponse.targets:type_name -> TargetSummary
+	29, // 17: IOStats.read:type_name -> IOOpStats
+	29, // 18: IOStats.write:type_name -> IOOpStats
+	29, // 19: IOStats.flush:type_name -> IOOpStats
+	29, // 20: IOStats.trim:type_name -> IOOpStats
+	30, // 21: GetTargetStatsResponse.lun:type_name -> IOStats
+	30, // 22: GetTargetStatsResponse.backing:type_name -> IOStats
+	7,  // 23: Filter.CreateTarget:input_type -> CreateTargetRequest
+	9,  // 24: Filter.DeleteTarget:input_type -> DeleteTargetRequest
+	11, // 25: Filter.GetFilterStatus:input_type -> GetFilterStatusRequest
+	13, // 26: Filter.ConfigureFilter:input_type -> ConfigureFilterRequest
+	16, // 27: Filter.AddFaultRule:input_type -> AddFaultRuleRequest
+	18, // 28: Filter.RemoveFaultRule:input_type -> RemoveFaultRuleRequest
+	20, // 29: Filter.ListFaultRules:input_type -> ListFaultRulesRequest
+	23, // 30: Filter.StreamTrace:input_type -> StreamTraceRequest
+	24, // 31: Filter.BindSource:input_type -> BindSourceRequest
+	26, // 32: Filter.ListTargets:input_type -> ListTargetsRequest
+	31, // 33: Filter.GetTargetStats:input_type -> GetTargetStatsRequest
+	33, // 34: Filter.FlushTarget:input_type -> FlushTargetRequest
+	35, // 35: Filter.ScrubTarget:input_type -> ScrubTargetRequest
+	8,  // 36: Filter.CreateTarget:output_type -> CreateTargetResponse
+	10, // 37: Filter.DeleteTarget:output_type -> DeleteTargetResponse
+	12, // 38: Filter.GetFilterStatus:output_type -> GetFilterStatusResponse
+	14, // 39: Filter.ConfigureFilter:output_type -> ConfigureFilterResponse
+	17, // 40: Filter.AddFaultRule:output_type -> AddFaultRuleResponse
+	19, // 41: Filter.RemoveFaultRule:output_type -> RemoveFaultRuleResponse
+	21, // 42: Filter.ListFaultRules:output_type -> ListFaultRulesResponse
+	22, // 43: Filter.StreamTrace:output_type -> TraceRecord
+	25, // 44: Filter.BindSource:output_type -> BindSourceResponse
+	28, // 45: Filter.ListTargets:output_type -> ListTargetsResponse
+	32, // 46: Filter.GetTargetStats:output_type -> GetTargetStatsResponse
+	34, // 47: Filter.FlushTarget:output_type -> FlushTargetResponse
+	36, // 48: Filter.ScrubTarget:output_type -> ScrubTargetResponse
+	36, // [36:49] is the sub-list for method output_type
+	23, // [23:36] is the sub-list for method input_type
+	23, // [23:23] is the sub-list for extension type_name
+	23, // [23:23] is the sub-list for extension extendee
+	0,  // [0:23] is the sub-list for field type_name
+}
+
+func init() { file_filter_proto_init() }
 func file_filter_proto_init() {
 	if File_filter_proto != nil {
 		return
@@ -326,8 +2517,56 @@ func file_filter_proto_init() {
 				return nil
 			}
 		}
-		file_filter_proto_msgTypes[1].Exporter = func(v interface{}, i int) interface{} {
-			switch v := v.(*CreateTargetRequest); i {
+		file_filter_proto_msgTypes[1].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*FilterConfig); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_filter_proto_msgTypes[2].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*FilterStatus); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_filter_proto_msgTypes[3].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*CreateTargetRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_filter_proto_msgTypes[4].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*CreateTargetResponse); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_filter_proto_msgTypes[5].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*DeleteTargetRequest); i {
 			case 0:
 				return &v.state
 			case 1:
@@ -338,8 +2577,8 @@ func file_filter_proto_init() {
 				return nil
 			}
 		}
-		file_filter_proto_msgTypes[2].Exporter = func(v interface{}, i int) interface{} {
-			switch v := v.(*CreateTargetResponse); i {
+		file_filter_proto_msgTypes[6].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*DeleteTargetResponse); i {
 			case 0:
 				return &v.state
 			case 1:
@@ -350,8 +2589,8 @@ func file_filter_proto_init() {
 				return nil
 			}
 		}
-		file_filter_proto_msgTypes[3].Exporter = func(v interface{}, i int) interface{} {
-			switch v := v.(*DeleteTargetRequest); i {
+		file_filter_proto_msgTypes[7].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*GetFilterStatusRequest); i {
 			case 0:
 				return &v.state
 			case 1:
@@ -362,8 +2601,296 @@ func file_filter_proto_init() {
 				return nil
 			}
 		}
-		file_filter_proto_msgTypes[4].Exporter = func(v interface{}, i int) interface{} {
-			switch v := v.(*DeleteTargetResponse); i {
+		file_filter_proto_msgTypes[8].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*GetFilterStatusResponse); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_filter_proto_msgTypes[9].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*ConfigureFilterRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_filter_proto_msgTypes[10].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*ConfigureFilterResponse); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_filter_proto_msgTypes[11].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*FaultRule); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_filter_proto_msgTypes[12].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*AddFaultRuleRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_filter_proto_msgTypes[13].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*AddFaultRuleResponse); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_filter_proto_msgTypes[14].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*RemoveFaultRuleRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_filter_proto_msgTypes[15].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*RemoveFaultRuleResponse); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_filter_proto_msgTypes[16].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*ListFaultRulesRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_filter_proto_msgTypes[17].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*ListFaultRulesResponse); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_filter_proto_msgTypes[18].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*TraceRecord); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_filter_proto_msgTypes[19].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*StreamTraceRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_filter_proto_msgTypes[20].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*BindSourceRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_filter_proto_msgTypes[21].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*BindSourceResponse); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_filter_proto_msgTypes[22].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*ListTargetsRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_filter_proto_msgTypes[23].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*TargetSummary); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_filter_proto_msgTypes[24].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*ListTargetsResponse); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_filter_proto_msgTypes[25].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*IOOpStats); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_filter_proto_msgTypes[26].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*IOStats); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_filter_proto_msgTypes[27].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*GetTargetStatsRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_filter_proto_msgTypes[28].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*GetTargetStatsResponse); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_filter_proto_msgTypes[29].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*FlushTargetRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_filter_proto_msgTypes[30].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*FlushTargetResponse); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_filter_proto_msgTypes[31].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*ScrubTargetRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_filter_proto_msgTypes[32].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*ScrubTargetResponse); i {
 			case 0:
 				return &v.state
 			case 1:
@@ -380,13 +2907,14 @@ func file_filter_proto_init() {
 		File: protoimpl.DescBuilder{
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: file_filter_proto_rawDesc,
-			NumEnums:      0,
-			NumMessages:   5,
+			NumEnums:      4,
+			NumMessages:   37,
 			NumExtensions: 0,
 			NumServices:   1,
 		},
 		GoTypes:           file_filter_proto_goTypes,
 		DependencyIndexes: file_filter_proto_depIdxs,
+		EnumInfos:         file_filter_proto_enumTypes,
 		MessageInfos:      file_filter_proto_msgTypes,
 	}.Build()
 	File_filter_proto = out.File
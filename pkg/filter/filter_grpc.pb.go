@@ -20,6 +20,17 @@ const _ = grpc.SupportPackageIsVersion7
 type FilterClient interface {
 	CreateTarget(ctx context.Context, in *CreateTargetRequest, opts ...grpc.CallOption) (*CreateTargetResponse, error)
 	DeleteTarget(ctx context.Context, in *DeleteTargetRequest, opts ...grpc.CallOption) (*DeleteTargetResponse, error)
+	GetFilterStatus(ctx context.Context, in *GetFilterStatusRequest, opts ...grpc.CallOption) (*GetFilterStatusResponse, error)
+	ConfigureFilter(ctx context.Context, in *ConfigureFilterRequest, opts ...grpc.CallOption) (*ConfigureFilterResponse, error)
+	AddFaultRule(ctx context.Context, in *AddFaultRuleRequest, opts ...grpc.CallOption) (*AddFaultRuleResponse, error)
+	RemoveFaultRule(ctx context.Context, in *RemoveFaultRuleRequest, opts ...grpc.CallOption) (*RemoveFaultRuleResponse, error)
+	ListFaultRules(ctx context.Context, in *ListFaultRulesRequest, opts ...grpc.CallOption) (*ListFaultRulesResponse, error)
+	StreamTrace(ctx context.Context, in *StreamTraceRequest, opts ...grpc.CallOption) (Filter_StreamTraceClient, error)
+	BindSource(ctx context.Context, in *BindSourceRequest, opts ...grpc.CallOption) (*BindSourceResponse, error)
+	ListTargets(ctx context.Context, in *ListTargetsRequest, opts ...grpc.CallOption) (*ListTargetsResponse, error)
+	GetTargetStats(ctx context.Context, in *GetTargetStatsRequest, opts ...grpc.CallOption) (*GetTargetStatsResponse, error)
+	FlushTarget(ctx context.Context, in *FlushTargetRequest, opts ...grpc.CallOption) (*FlushTargetResponse, error)
+	ScrubTarget(ctx context.Context, in *ScrubTargetRequest, opts ...grpc.CallOption) (*ScrubTargetResponse, error)
 }
 
 type filterClient struct {
@@ -48,12 +59,145 @@ func (c *filterClient) DeleteTarget(ctx context.Context, in *DeleteTargetRequest
 	return out, nil
 }
 
+func (c *filterClient) GetFilterStatus(ctx context.Context, in *GetFilterStatusRequest, opts ...grpc.CallOption) (*GetFilterStatusResponse, error) {
+	out := new(GetFilterStatusResponse)
+	err := c.cc.Invoke(ctx, "/Filter/GetFilterStatus", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *filterClient) ConfigureFilter(ctx context.Context, in *ConfigureFilterRequest, opts ...grpc.CallOption) (*ConfigureFilterResponse, error) {
+	out := new(ConfigureFilterResponse)
+	err := c.cc.Invoke(ctx, "/Filter/ConfigureFilter", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *filterClient) AddFaultRule(ctx context.Context, in *AddFaultRuleRequest, opts ...grpc.CallOption) (*AddFaultRuleResponse, error) {
+	out := new(AddFaultRuleResponse)
+	err := c.cc.Invoke(ctx, "/Filter/AddFaultRule", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *filterClient) RemoveFaultRule(ctx context.Context, in *RemoveFaultRuleRequest, opts ...grpc.CallOption) (*RemoveFaultRuleResponse, error) {
+	out := new(RemoveFaultRuleResponse)
+	err := c.cc.Invoke(ctx, "/Filter/RemoveFaultRule", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *filterClient) ListFaultRules(ctx context.Context, in *ListFaultRulesRequest, opts ...grpc.CallOption) (*ListFaultRulesResponse, error) {
+	out := new(ListFaultRulesResponse)
+	err := c.cc.Invoke(ctx, "/Filter/ListFaultRules", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *filterClient) StreamTrace(ctx context.Context, in *StreamTraceRequest, opts ...grpc.CallOption) (Filter_StreamTraceClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Filter_ServiceDesc.Streams[0], "/Filter/StreamTrace", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &filterStreamTraceClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Filter_StreamTraceClient interface {
+	Recv() (*TraceRecord, error)
+	grpc.ClientStream
+}
+
+type filterStreamTraceClient struct {
+	grpc.ClientStream
+}
+
+func (x *filterStreamTraceClient) Recv() (*TraceRecord, error) {
+	m := new(TraceRecord)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *filterClient) BindSource(ctx context.Context, in *BindSourceRequest, opts ...grpc.CallOption) (*BindSourceResponse, error) {
+	out := new(BindSourceResponse)
+	err := c.cc.Invoke(ctx, "/Filter/BindSource", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *filterClient) ListTargets(ctx context.Context, in *ListTargetsRequest, opts ...grpc.CallOption) (*ListTargetsResponse, error) {
+	out := new(ListTargetsResponse)
+	err := c.cc.Invoke(ctx, "/Filter/ListTargets", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *filterClient) GetTargetStats(ctx context.Context, in *GetTargetStatsRequest, opts ...grpc.CallOption) (*GetTargetStatsResponse, error) {
+	out := new(GetTargetStatsResponse)
+	err := c.cc.Invoke(ctx, "/Filter/GetTargetStats", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *filterClient) FlushTarget(ctx context.Context, in *FlushTargetRequest, opts ...grpc.CallOption) (*FlushTargetResponse, error) {
+	out := new(FlushTargetResponse)
+	err := c.cc.Invoke(ctx, "/Filter/FlushTarget", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *filterClient) ScrubTarget(ctx context.Context, in *ScrubTargetRequest, opts ...grpc.CallOption) (*ScrubTargetResponse, error) {
+	out := new(ScrubTargetResponse)
+	err := c.cc.Invoke(ctx, "/Filter/ScrubTarget", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // FilterServer is the server API for Filter service.
 // All implementations must embed UnimplementedFilterServer
 // for forward compatibility
 type FilterServer interface {
 	CreateTarget(context.Context, *CreateTargetRequest) (*CreateTargetResponse, error)
 	DeleteTarget(context.Context, *DeleteTargetRequest) (*DeleteTargetResponse, error)
+	GetFilterStatus(context.Context, *GetFilterStatusRequest) (*GetFilterStatusResponse, error)
+	ConfigureFilter(context.Context, *ConfigureFilterRequest) (*ConfigureFilterResponse, error)
+	AddFaultRule(context.Context, *AddFaultRuleRequest) (*AddFaultRuleResponse, error)
+	RemoveFaultRule(context.Context, *RemoveFaultRuleRequest) (*RemoveFaultRuleResponse, error)
+	ListFaultRules(context.Context, *ListFaultRulesRequest) (*ListFaultRulesResponse, error)
+	StreamTrace(*StreamTraceRequest, Filter_StreamTraceServer) error
+	BindSource(context.Context, *BindSourceRequest) (*BindSourceResponse, error)
+	ListTargets(context.Context, *ListTargetsRequest) (*ListTargetsResponse, error)
+	GetTargetStats(context.Context, *GetTargetStatsRequest) (*GetTargetStatsResponse, error)
+	FlushTarget(context.Context, *FlushTargetRequest) (*FlushTargetResponse, error)
+	ScrubTarget(context.Context, *ScrubTargetRequest) (*ScrubTargetResponse, error)
 	mustEmbedUnimplementedFilterServer()
 }
 
@@ -67,6 +211,39 @@ func (UnimplementedFilterServer) CreateTarget(context.Context, *CreateTargetRequ
 func (UnimplementedFilterServer) DeleteTarget(context.Context, *DeleteTargetRequest) (*DeleteTargetResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method DeleteTarget not implemented")
 }
+func (UnimplementedFilterServer) GetFilterStatus(context.Context, *GetFilterStatusRequest) (*GetFilterStatusResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetFilterStatus not implemented")
+}
+func (UnimplementedFilterServer) ConfigureFilter(context.Context, *ConfigureFilterRequest) (*ConfigureFilterResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ConfigureFilter not implemented")
+}
+func (UnimplementedFilterServer) AddFaultRule(context.Context, *AddFaultRuleRequest) (*AddFaultRuleResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method AddFaultRule not implemented")
+}
+func (UnimplementedFilterServer) RemoveFaultRule(context.Context, *RemoveFaultRuleRequest) (*RemoveFaultRuleResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RemoveFaultRule not implemented")
+}
+func (UnimplementedFilterServer) ListFaultRules(context.Context, *ListFaultRulesRequest) (*ListFaultRulesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListFaultRules not implemented")
+}
+func (UnimplementedFilterServer) StreamTrace(*StreamTraceRequest, Filter_StreamTraceServer) error {
+	return status.Errorf(codes.Unimplemented, "method StreamTrace not implemented")
+}
+func (UnimplementedFilterServer) BindSource(context.Context, *BindSourceRequest) (*BindSourceResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method BindSource not implemented")
+}
+func (UnimplementedFilterServer) ListTargets(context.Context, *ListTargetsRequest) (*ListTargetsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListTargets not implemented")
+}
+func (UnimplementedFilterServer) GetTargetStats(context.Context, *GetTargetStatsRequest) (*GetTargetStatsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetTargetStats not implemented")
+}
+func (UnimplementedFilterServer) FlushTarget(context.Context, *FlushTargetRequest) (*FlushTargetResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method FlushTarget not implemented")
+}
+func (UnimplementedFilterServer) ScrubTarget(context.Context, *ScrubTargetRequest) (*ScrubTargetResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ScrubTarget not implemented")
+}
 func (UnimplementedFilterServer) mustEmbedUnimplementedFilterServer() {}
 
 // UnsafeFilterServer may be embedded to opt out of forward compatibility for this service.
@@ -116,6 +293,207 @@ func _Filter_DeleteTarget_Handler(srv interface{}, ctx context.Context, dec func
 	return interceptor(ctx, in, info, handler)
 }
 
+func _Filter_GetFilterStatus_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetFilterStatusRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FilterServer).GetFilterStatus(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/Filter/GetFilterStatus",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FilterServer).GetFilterStatus(ctx, req.(*GetFilterStatusRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Filter_ConfigureFilter_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ConfigureFilterRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FilterServer).ConfigureFilter(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/Filter/ConfigureFilter",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FilterServer).ConfigureFilter(ctx, req.(*ConfigureFilterRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Filter_AddFaultRule_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AddFaultRuleRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FilterServer).AddFaultRule(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/Filter/AddFaultRule",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FilterServer).AddFaultRule(ctx, req.(*AddFaultRuleRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Filter_RemoveFaultRule_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RemoveFaultRuleRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FilterServer).RemoveFaultRule(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/Filter/RemoveFaultRule",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FilterServer).RemoveFaultRule(ctx, req.(*RemoveFaultRuleRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Filter_ListFaultRules_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListFaultRulesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FilterServer).ListFaultRules(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/Filter/ListFaultRules",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FilterServer).ListFaultRules(ctx, req.(*ListFaultRulesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Filter_StreamTrace_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(StreamTraceRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(FilterServer).StreamTrace(m, &filterStreamTraceServer{stream})
+}
+
+type Filter_StreamTraceServer interface {
+	Send(*TraceRecord) error
+	grpc.ServerStream
+}
+
+type filterStreamTraceServer struct {
+	grpc.ServerStream
+}
+
+func (x *filterStreamTraceServer) Send(m *TraceRecord) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _Filter_BindSource_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(BindSourceRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FilterServer).BindSource(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/Filter/BindSource",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FilterServer).BindSource(ctx, req.(*BindSourceRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Filter_ListTargets_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListTargetsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FilterServer).ListTargets(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/Filter/ListTargets",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FilterServer).ListTargets(ctx, req.(*ListTargetsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Filter_GetTargetStats_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetTargetStatsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FilterServer).GetTargetStats(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/Filter/GetTargetStats",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FilterServer).GetTargetStats(ctx, req.(*GetTargetStatsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Filter_FlushTarget_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(FlushTargetRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FilterServer).FlushTarget(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/Filter/FlushTarget",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FilterServer).FlushTarget(ctx, req.(*FlushTargetRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Filter_ScrubTarget_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ScrubTargetRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FilterServer).ScrubTarget(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/Filter/ScrubTarget",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FilterServer).ScrubTarget(ctx, req.(*ScrubTargetRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // Filter_ServiceDesc is the grpc.ServiceDesc for Filter service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -131,7 +509,53 @@ var Filter_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "DeleteTarget",
 			Handler:    _Filter_DeleteTarget_Handler,
 		},
+		{
+			MethodName: "GetFilterStatus",
+			Handler:    _Filter_GetFilterStatus_Handler,
+		},
+		{
+			MethodName: "ConfigureFilter",
+			Handler:    _Filter_ConfigureFilter_Handler,
+		},
+		{
+			MethodName: "AddFaultRule",
+			Handler:    _Filter_AddFaultRule_Handler,
+		},
+		{
+			MethodName: "RemoveFaultRule",
+			Handler:    _Filter_RemoveFaultRule_Handler,
+		},
+		{
+			MethodName: "ListFaultRules",
+			Handler:    _Filter_ListFaultRules_Handler,
+		},
+		{
+			MethodName: "BindSource",
+			Handler:    _Filter_BindSource_Handler,
+		},
+		{
+			MethodName: "ListTargets",
+			Handler:    _Filter_ListTargets_Handler,
+		},
+		{
+			MethodName: "GetTargetStats",
+			Handler:    _Filter_GetTargetStats_Handler,
+		},
+		{
+			MethodName: "FlushTarget",
+			Handler:    _Filter_FlushTarget_Handler,
+		},
+		{
+			MethodName: "ScrubTarget",
+			Handler:    _Filter_ScrubTarget_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "StreamTrace",
+			Handler:       _Filter_StreamTrace_Handler,
+			ServerStreams: true,
+		},
 	},
-	Streams:  []grpc.StreamDesc{},
 	Metadata: "filter.proto",
 }